@@ -3,6 +3,7 @@ module github.com/ericmaustin/unixtools
 go 1.16
 
 require (
+	github.com/dswarbrick/smart v0.0.0-20190505152634-909a45200d6d
 	github.com/ghodss/yaml v1.0.0
 	github.com/jaypipes/ghw v0.9.0
 	github.com/mackerelio/go-osstat v0.2.2
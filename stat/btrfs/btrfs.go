@@ -0,0 +1,440 @@
+// Package btrfs reports the chunk allocation, device errors and scrub status
+// of btrfs filesystems from sysfs and the btrfs command
+package btrfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Option configures how filesystems are read
+type Option func(o *options)
+
+type options struct {
+	root       string
+	noCommands bool
+}
+
+// WithRoot reads /proc and /sys under root instead of /, e.g. a host's
+// filesystem mounted in a container
+func WithRoot(root string) Option {
+	return func(o *options) {
+		o.root = root
+	}
+}
+
+// WithNoCommands only reads sysfs and never runs the btrfs command, so
+// device allocation, error counters on older kernels and scrub status are
+// left empty
+func WithNoCommands() Option {
+	return func(o *options) {
+		o.noCommands = true
+	}
+}
+
+func (o *options) path(p string) string {
+	if len(o.root) < 1 {
+		return p
+	}
+
+	return filepath.Join(o.root, p)
+}
+
+// kernelName returns the name sysfs lists a device by, resolving links such
+// as /dev/mapper/<name> to the dm-N device they point to
+func (o *options) kernelName(path string) string {
+	if resolved, err := filepath.EvalSymlinks(o.path(path)); err == nil {
+		return filepath.Base(resolved)
+	}
+
+	return filepath.Base(path)
+}
+
+// Profile is the space of a block group type allocated with one RAID profile,
+// e.g. data in raid1. Sizes are logical, before the profile's redundancy
+type Profile struct {
+	Name      string       `yaml:"name" json:"name"`
+	Allocated cap.Capacity `yaml:"allocated" json:"allocated"`
+	Used      cap.Capacity `yaml:"used" json:"used"`
+	Free      cap.Capacity `yaml:"free" json:"free"`
+}
+
+// BlockGroup is the allocation of one block group type: data, metadata or system
+type BlockGroup struct {
+	Type string `yaml:"type" json:"type"`
+	// Allocated and Used are the logical sizes of the chunks and what's in them
+	Allocated cap.Capacity `yaml:"allocated" json:"allocated"`
+	Used      cap.Capacity `yaml:"used" json:"used"`
+	// DiskAllocated and DiskUsed are the raw sizes across all devices,
+	// including the copies and parity of the RAID profiles
+	DiskAllocated cap.Capacity `yaml:"disk_allocated" json:"disk_allocated"`
+	DiskUsed      cap.Capacity `yaml:"disk_used" json:"disk_used"`
+	Reserved      cap.Capacity `yaml:"reserved" json:"reserved"`
+	Pinned        cap.Capacity `yaml:"pinned" json:"pinned"`
+	MayUse        cap.Capacity `yaml:"may_use" json:"may_use"`
+	ReadOnly      cap.Capacity `yaml:"read_only" json:"read_only"`
+	Profiles      []*Profile   `yaml:"profiles" json:"profiles"`
+}
+
+// Free returns the allocated space not used
+func (g *BlockGroup) Free() cap.Capacity {
+	return g.Allocated.Sub(g.Used)
+}
+
+// UsedPercent returns how much of the allocated space is used
+func (g *BlockGroup) UsedPercent() float64 {
+	if g.Allocated == 0 {
+		return 0
+	}
+
+	return float64(g.Used) / float64(g.Allocated) * 100
+}
+
+// Profile returns the profile with the given name, e.g. raid1
+func (g *BlockGroup) Profile(name string) *Profile {
+	for _, p := range g.Profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// DeviceStats are the persistent error counters of a device
+type DeviceStats struct {
+	WriteErrors      uint64 `yaml:"write_errors" json:"write_errors"`
+	ReadErrors       uint64 `yaml:"read_errors" json:"read_errors"`
+	FlushErrors      uint64 `yaml:"flush_errors" json:"flush_errors"`
+	CorruptionErrors uint64 `yaml:"corruption_errors" json:"corruption_errors"`
+	GenerationErrors uint64 `yaml:"generation_errors" json:"generation_errors"`
+}
+
+// Total returns the sum of the error counters
+func (s *DeviceStats) Total() uint64 {
+	return s.WriteErrors + s.ReadErrors + s.FlushErrors + s.CorruptionErrors + s.GenerationErrors
+}
+
+// Device is a device of a filesystem
+type Device struct {
+	ID   int          `yaml:"id,omitempty" json:"id,omitempty"`
+	Name string       `yaml:"name" json:"name"`
+	Path string       `yaml:"path,omitempty" json:"path,omitempty"`
+	Size cap.Capacity `yaml:"size" json:"size"`
+	// Allocated is how much of the device is allocated to chunks and
+	// Unallocated what's left for new chunks
+	Allocated   cap.Capacity `yaml:"allocated" json:"allocated"`
+	Unallocated cap.Capacity `yaml:"unallocated" json:"unallocated"`
+	Missing     bool         `yaml:"missing,omitempty" json:"missing,omitempty"`
+	Stats       *DeviceStats `yaml:"stats,omitempty" json:"stats,omitempty"`
+}
+
+// ScrubStatus is the progress and result of the last scrub
+type ScrubStatus struct {
+	// Status is running, finished, aborted, interrupted or none if the
+	// filesystem was never scrubbed
+	Status   string        `yaml:"status" json:"status"`
+	Started  time.Time     `yaml:"started,omitempty" json:"started,omitempty"`
+	Duration time.Duration `yaml:"duration" json:"duration"`
+	TimeLeft time.Duration `yaml:"time_left,omitempty" json:"time_left,omitempty"`
+	Total    cap.Capacity  `yaml:"total" json:"total"`
+	Scrubbed cap.Capacity  `yaml:"scrubbed" json:"scrubbed"`
+	Percent  float64       `yaml:"percent" json:"percent"`
+	// Rate is bytes per second
+	Rate cap.Capacity `yaml:"rate" json:"rate"`
+	// Errors are the error counts by kind, e.g. csum and read
+	Errors        map[string]uint64 `yaml:"errors,omitempty" json:"errors,omitempty"`
+	ErrorCount    uint64            `yaml:"error_count" json:"error_count"`
+	Corrected     uint64            `yaml:"corrected" json:"corrected"`
+	Uncorrectable uint64            `yaml:"uncorrectable" json:"uncorrectable"`
+	Unverified    uint64            `yaml:"unverified" json:"unverified"`
+}
+
+// IsRunning returns true while a scrub is running
+func (s *ScrubStatus) IsRunning() bool {
+	return s.Status == "running"
+}
+
+// Filesystem is a mounted btrfs filesystem
+type Filesystem struct {
+	UUID       string       `yaml:"uuid" json:"uuid"`
+	Label      string       `yaml:"label,omitempty" json:"label,omitempty"`
+	MountPoint string       `yaml:"mount_point,omitempty" json:"mount_point,omitempty"`
+	NodeSize   cap.Capacity `yaml:"node_size" json:"node_size"`
+	SectorSize cap.Capacity `yaml:"sector_size" json:"sector_size"`
+	Data       *BlockGroup  `yaml:"data" json:"data"`
+	Metadata   *BlockGroup  `yaml:"metadata" json:"metadata"`
+	System     *BlockGroup  `yaml:"system" json:"system"`
+	// GlobalReserve is metadata space kept back for emergencies such as
+	// deleting files on a full filesystem
+	GlobalReserve     cap.Capacity `yaml:"global_reserve" json:"global_reserve"`
+	GlobalReserveUsed cap.Capacity `yaml:"global_reserve_used" json:"global_reserve_used"`
+	Devices           []*Device    `yaml:"devices" json:"devices"`
+	Scrub             *ScrubStatus `yaml:"scrub,omitempty" json:"scrub,omitempty"`
+	devInfo           map[int]*devInfo
+}
+
+// devInfo is what sysfs has for a device id
+type devInfo struct {
+	missing bool
+	stats   *DeviceStats
+}
+
+// String implements stringer
+func (fs *Filesystem) String() string {
+	b, err := yaml.Marshal(fs)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// JSONString prints the JSON value for this Filesystem
+func (fs *Filesystem) JSONString() string {
+	b, err := json.Marshal(fs)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// Device returns the device with the given name or path, e.g. sda2 or
+// /dev/mapper/luks-data
+func (fs *Filesystem) Device(name string) *Device {
+	for _, d := range fs.Devices {
+		if d.Name == filepath.Base(name) || (len(d.Path) > 0 && d.Path == name) {
+			return d
+		}
+	}
+
+	return nil
+}
+
+// Size returns the total size of the devices
+func (fs *Filesystem) Size() cap.Capacity {
+	var size cap.Capacity
+
+	for _, d := range fs.Devices {
+		size = size.Add(d.Size)
+	}
+
+	return size
+}
+
+// Unallocated returns the space on all devices not allocated to chunks
+func (fs *Filesystem) Unallocated() cap.Capacity {
+	var free cap.Capacity
+
+	for _, d := range fs.Devices {
+		free = free.Add(d.Unallocated)
+	}
+
+	return free
+}
+
+// ErrorCount returns the sum of all device error counters
+func (fs *Filesystem) ErrorCount() uint64 {
+	var n uint64
+
+	for _, d := range fs.Devices {
+		if d.Stats != nil {
+			n += d.Stats.Total()
+		}
+	}
+
+	return n
+}
+
+// IsDegraded returns true if a device is missing
+func (fs *Filesystem) IsDegraded() bool {
+	for _, d := range fs.Devices {
+		if d.Missing {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run runs the btrfs command and returns its output
+func run(args ...string) (string, error) {
+	cmd := exec.Command("btrfs", args...)
+
+	var out bytes.Buffer
+
+	cmd.Stdout = &out
+	err := cmd.Run()
+
+	if err != nil && out.Len() == 0 {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// GetDeviceStats runs btrfs device stats on a mount point or device and
+// returns the error counters by device path
+func GetDeviceStats(path string) (map[string]*DeviceStats, error) {
+	out, err := run("device", "stats", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDeviceStats(out), nil
+}
+
+// GetScrubStatus runs btrfs scrub status on a mount point
+func GetScrubStatus(path string) (*ScrubStatus, error) {
+	out, err := run("scrub", "status", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseScrubStatus(out)
+}
+
+// GetFilesystems reads every btrfs filesystem in /sys/fs/btrfs. Unless
+// WithNoCommands is set, mounted filesystems also get their device
+// allocation, device error counters and scrub status from the btrfs command
+func GetFilesystems(opts ...Option) ([]*Filesystem, error) {
+	o := new(options)
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	dirs, err := ioutil.ReadDir(o.path("/sys/fs/btrfs"))
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := readMounts(o)
+
+	var out []*Filesystem
+
+	for _, dir := range dirs {
+		// features is the only entry that isn't a filesystem uuid
+		if dir.Name() == "features" {
+			continue
+		}
+
+		fs := readFilesystem(o.path(filepath.Join("/sys/fs/btrfs", dir.Name())))
+
+		for _, d := range fs.Devices {
+			if mp, ok := mounts[d.Name]; ok {
+				fs.MountPoint = mp
+				break
+			}
+		}
+
+		if !o.noCommands {
+			fs.readCommands(o)
+		}
+
+		out = append(out, fs)
+	}
+
+	return out, nil
+}
+
+// GetFilesystem reads the filesystem with the given uuid, label or mount point
+func GetFilesystem(id string, opts ...Option) (*Filesystem, error) {
+	all, err := GetFilesystems(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fs := range all {
+		if fs.UUID == id || (len(fs.Label) > 0 && fs.Label == id) ||
+			(len(fs.MountPoint) > 0 && fs.MountPoint == filepath.Clean(id)) {
+			return fs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not find btrfs filesystem %s", id)
+}
+
+// readCommands adds what sysfs doesn't have from the btrfs command. Errors
+// are ignored so a filesystem is still reported without btrfs-progs
+func (fs *Filesystem) readCommands(o *options) {
+	if out, err := run("filesystem", "show", "--raw", fs.UUID); err == nil {
+		fs.addShow(o, ParseShow(out))
+	}
+
+	if len(fs.MountPoint) < 1 {
+		return
+	}
+
+	// the mount point is the host's, which is under the root in a container
+	mountPoint := o.path(fs.MountPoint)
+
+	if stats, err := GetDeviceStats(mountPoint); err == nil {
+		fs.addStats(stats)
+	}
+
+	if s, err := GetScrubStatus(mountPoint); err == nil {
+		fs.Scrub = s
+	}
+}
+
+// addShow adds the device ids and allocation from btrfs filesystem show,
+// which prints /dev/mapper paths for devices sysfs lists as dm-N
+func (fs *Filesystem) addShow(o *options, devices []*Device) {
+	for _, sd := range devices {
+		if len(sd.Path) > 0 {
+			sd.Name = o.kernelName(sd.Path)
+		}
+
+		d := fs.Device(sd.Name)
+
+		if d == nil {
+			// missing devices aren't in sysfs
+			fs.Devices = append(fs.Devices, sd)
+			continue
+		}
+
+		d.ID = sd.ID
+		d.Path = sd.Path
+		d.Allocated = sd.Allocated
+
+		if sd.Size > 0 {
+			d.Size = sd.Size
+		}
+
+		d.Unallocated = d.Size.Sub(d.Allocated)
+	}
+
+	fs.applyDevInfo()
+}
+
+// applyDevInfo sets the missing flag and error counters from sysfs on the
+// devices with known ids
+func (fs *Filesystem) applyDevInfo() {
+	for _, d := range fs.Devices {
+		if di, ok := fs.devInfo[d.ID]; ok && d.ID > 0 {
+			d.Missing = d.Missing || di.missing
+
+			if di.stats != nil {
+				d.Stats = di.stats
+			}
+		}
+	}
+}
+
+// addStats adds device error counters by device path
+func (fs *Filesystem) addStats(stats map[string]*DeviceStats) {
+	for path, s := range stats {
+		if d := fs.Device(path); d != nil && d.Stats == nil {
+			d.Stats = s
+		}
+	}
+}
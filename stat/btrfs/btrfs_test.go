@@ -0,0 +1,166 @@
+package btrfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testUUID = "7e2c9b4a-5d1f-4c3e-9a8b-1f2e3d4c5b6a"
+
+func writeTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestGetFilesystems(t *testing.T) {
+	fsDir := "sys/fs/btrfs/" + testUUID + "/"
+	alloc := fsDir + "allocation/"
+
+	root := writeTree(t, map[string]string{
+		"sys/fs/btrfs/features/raid1c34":              "0\n",
+		"sys/fs/btrfs/features/free_space_tree":       "0\n",
+		"sys/fs/btrfs/features/supported_sectorsizes": "4096\n",
+		fsDir + "label":                      "data\n",
+		fsDir + "nodesize":                   "16384\n",
+		fsDir + "sectorsize":                 "4096\n",
+		fsDir + "devices/sda/size":           "1953525168\n",
+		fsDir + "devices/sdb/size":           "1953525168\n",
+		fsDir + "devinfo/1/missing":          "0\n",
+		fsDir + "devinfo/1/error_stats":      "write_errs 0\nread_errs 2\nflush_errs 0\ncorruption_errs 5\ngeneration_errs 0\n",
+		fsDir + "devinfo/2/missing":          "0\n",
+		alloc + "global_rsv_size":            "536870912\n",
+		alloc + "global_rsv_reserved":        "0\n",
+		alloc + "data/total_bytes":           "396210978816\n",
+		alloc + "data/bytes_used":            "325143240704\n",
+		alloc + "data/disk_total":            "791348215808\n",
+		alloc + "data/disk_used":             "650286481408\n",
+		alloc + "data/raid1/total_bytes":     "395137236992\n",
+		alloc + "data/raid1/used_bytes":      "325143240704\n",
+		alloc + "data/single/total_bytes":    "1073741824\n",
+		alloc + "data/single/used_bytes":     "0\n",
+		alloc + "metadata/total_bytes":       "3221225472\n",
+		alloc + "metadata/bytes_used":        "1610612736\n",
+		alloc + "metadata/raid1/total_bytes": "3221225472\n",
+		alloc + "metadata/raid1/used_bytes":  "1610612736\n",
+		alloc + "system/total_bytes":         "33554432\n",
+		alloc + "system/bytes_used":          "65536\n",
+		alloc + "system/raid1/total_bytes":   "33554432\n",
+		alloc + "system/raid1/used_bytes":    "65536\n",
+		"proc/1/mountinfo":                   "45 1 0:52 / /srv/data rw,relatime shared:20 - btrfs /dev/sdb rw,space_cache=v2,subvolid=5,subvol=/\n",
+	})
+
+	all, err := GetFilesystems(WithRoot(root), WithNoCommands())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 1 {
+		t.Fatalf("expected 1 filesystem, got %d", len(all))
+	}
+
+	fs := all[0]
+	if fs.UUID != testUUID || fs.Label != "data" || fs.MountPoint != "/srv/data" || fs.NodeSize != 16<<10 || fs.SectorSize != 4<<10 {
+		t.Errorf("unexpected filesystem %+v", fs)
+	}
+
+	if fs.GlobalReserve != 512<<20 || len(fs.Devices) != 2 || fs.Size() != 2*1953525168*512 {
+		t.Errorf("unexpected reserve %d or devices %v", fs.GlobalReserve, fs.Devices)
+	}
+
+	if len(fs.Data.Profiles) != 2 || fs.Data.Profiles[0].Name != "raid1" || fs.Data.DiskAllocated != 2*fs.Data.Profile("raid1").Allocated+fs.Data.Profile("single").Allocated {
+		t.Errorf("unexpected data %+v", fs.Data)
+	}
+
+	if p := fs.Data.Profile("raid1"); p.Free != 69993996288 {
+		t.Errorf("unexpected free %d", p.Free)
+	}
+
+	if fs.Metadata.UsedPercent() != 50 || fs.System.Free() != 32<<20-64<<10 {
+		t.Errorf("unexpected metadata %+v or system %+v", fs.Metadata, fs.System)
+	}
+
+	// devinfo can't be matched to device names without btrfs filesystem show
+	if fs.ErrorCount() != 0 {
+		t.Errorf("expected no matched error counters, got %d", fs.ErrorCount())
+	}
+
+	fs.addShow(&options{root: root}, ParseShow(readFixture(t, "show_raw.txt")))
+
+	if sda := fs.Device("/dev/sda"); sda.ID != 1 || sda.Stats == nil || sda.Stats.CorruptionErrors != 5 || sda.Unallocated != 600183234560 {
+		t.Errorf("unexpected device %+v", sda)
+	}
+
+	if !fs.IsDegraded() || len(fs.Devices) != 3 || fs.Unallocated() != 2*600183234560 || fs.ErrorCount() != 7 {
+		t.Errorf("expected a degraded filesystem, got %+v", fs)
+	}
+
+	fs.addStats(ParseDeviceStats(readFixture(t, "device_stats.txt")))
+
+	if s := fs.Device("sdb").Stats; s == nil || s.Total() != 24 || fs.ErrorCount() != 31 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	if _, err := GetFilesystem("data", WithRoot(root), WithNoCommands()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := GetFilesystem("/srv/data/", WithRoot(root), WithNoCommands()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := GetFilesystem("nope", WithRoot(root), WithNoCommands()); err == nil {
+		t.Error("expected an error for a missing filesystem")
+	}
+}
+
+func TestAddShowDeviceMapper(t *testing.T) {
+	fsDir := "sys/fs/btrfs/3b9e1c5d-8a2f-4e6b-b7c1-0d4f5a6e7b8c/"
+
+	root := writeTree(t, map[string]string{
+		fsDir + "label":             "crypt\n",
+		fsDir + "devices/dm-0/size": "976773168\n",
+		fsDir + "devices/dm-1/size": "976773168\n",
+		"dev/dm-0":                  "",
+		"dev/dm-1":                  "",
+	})
+
+	if err := os.MkdirAll(filepath.Join(root, "dev/mapper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, target := range map[string]string{"luks-a": "../dm-0", "luks-b": "../dm-1"} {
+		if err := os.Symlink(target, filepath.Join(root, "dev/mapper", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := readFilesystem(filepath.Join(root, fsDir))
+	fs.addShow(&options{root: root}, ParseShow(readFixture(t, "show_raw_dm.txt")))
+
+	if len(fs.Devices) != 2 || fs.Size() != 2*500107862016 || fs.Unallocated() != 2*(500107862016-120259084288) {
+		t.Fatalf("expected 2 devices, got %v", fs.Devices)
+	}
+
+	if d := fs.Device("dm-0"); d == nil || d.ID != 1 || d.Path != "/dev/mapper/luks-a" {
+		t.Errorf("unexpected device %+v", d)
+	}
+
+	if d := fs.Device("/dev/mapper/luks-b"); d == nil || d.Name != "dm-1" || d.ID != 2 {
+		t.Errorf("unexpected device %+v", d)
+	}
+}
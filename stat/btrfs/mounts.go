@@ -0,0 +1,35 @@
+//+build linux darwin
+
+package btrfs
+
+import (
+	"github.com/ericmaustin/unixtools/stat/disk"
+)
+
+// readMounts returns the mount points of btrfs filesystems in the host's
+// mount table by device name. Only the first mount of each device is kept
+func readMounts(o *options) map[string]string {
+	out := make(map[string]string)
+
+	root := o.root
+	if len(root) < 1 {
+		root = "/"
+	}
+
+	mounts, err := disk.ReadHostMounts(disk.WithRoot(root))
+	if err != nil {
+		return out
+	}
+
+	for _, m := range mounts {
+		if m.FsType != "btrfs" {
+			continue
+		}
+
+		if name := o.kernelName(m.Source); len(out[name]) < 1 {
+			out[name] = m.MountPoint
+		}
+	}
+
+	return out
+}
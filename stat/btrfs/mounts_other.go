@@ -0,0 +1,8 @@
+//+build !linux,!darwin
+
+package btrfs
+
+// readMounts returns no mount points where the mount table can't be read
+func readMounts(o *options) map[string]string {
+	return make(map[string]string)
+}
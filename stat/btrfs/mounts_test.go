@@ -0,0 +1,34 @@
+//+build linux darwin
+
+package btrfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadMounts(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"proc/1/mountinfo": "45 1 0:52 / /srv/my\\011data rw,relatime - btrfs /dev/mapper/crypt-data rw,subvol=/\n" +
+			"46 1 0:52 /@home /home rw,relatime - btrfs /dev/mapper/crypt-data rw,subvol=/@home\n" +
+			"47 1 0:53 / /back\\134slash rw,relatime - btrfs /dev/sdc rw,subvol=/\n" +
+			"48 1 8:1 / /boot rw,relatime - ext4 /dev/sda1 rw\n",
+		"proc/self/mountinfo": "500 400 0:90 / / rw,relatime - overlay overlay rw\n",
+		"dev/dm-0":            "",
+	})
+
+	if err := os.MkdirAll(filepath.Join(root, "dev/mapper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("../dm-0", filepath.Join(root, "dev/mapper/crypt-data")); err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := readMounts(&options{root: root})
+
+	if len(mounts) != 2 || mounts["dm-0"] != "/srv/my\tdata" || mounts["sdc"] != `/back\slash` {
+		t.Errorf("unexpected mounts %q", mounts)
+	}
+}
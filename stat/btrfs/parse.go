@@ -0,0 +1,277 @@
+package btrfs
+
+import (
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// [/dev/sda2].write_io_errs    0
+	deviceStatRe = regexp.MustCompile(`^\[(.+)\]\.(\w+)\s+(\d+)`)
+	// devid    1 size 1000204886016 used 400000000000 path /dev/sda
+	showDeviceRe = regexp.MustCompile(`^devid\s+(\d+)\s+size\s+(\S+)\s+used\s+(\S+)\s+path\s+(.+?)(\s+MISSING)?$`)
+	// scrub started at Sun Oct 16 02:00:01 2022 and finished after 00:45:12
+	oldScrubRe = regexp.MustCompile(`^scrub (?:started|resumed) at (.+?)(?:,| and) (running for|finished after|was aborted after|was interrupted after) (\S+)`)
+	// total bytes scrubbed: 1.20TiB with 0 errors
+	oldScrubTotalRe = regexp.MustCompile(`^total bytes scrubbed: (\S+) with (\d+) errors`)
+	// 560.12GiB  (36.47%)
+	scrubbedRe = regexp.MustCompile(`^(\S+)\s+\(([\d.]+)%\)`)
+	// corrected errors: 2, uncorrectable errors: 0, unverified errors: 0
+	correctedRe = regexp.MustCompile(`(corrected|uncorrectable|unverified) errors: (\d+)`)
+)
+
+// set sets a counter by its name in btrfs device stats or sysfs error_stats
+func (s *DeviceStats) set(key, value string) {
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return
+	}
+
+	switch key {
+	case "write_io_errs", "write_errs":
+		s.WriteErrors = v
+	case "read_io_errs", "read_errs":
+		s.ReadErrors = v
+	case "flush_io_errs", "flush_errs":
+		s.FlushErrors = v
+	case "corruption_errs":
+		s.CorruptionErrors = v
+	case "generation_errs":
+		s.GenerationErrors = v
+	}
+}
+
+// ParseDeviceStats parses the output of btrfs device stats and returns the
+// error counters by device path
+func ParseDeviceStats(out string) map[string]*DeviceStats {
+	stats := make(map[string]*DeviceStats)
+
+	for _, line := range strings.Split(out, "\n") {
+		m := deviceStatRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+
+		s, ok := stats[m[1]]
+		if !ok {
+			s = new(DeviceStats)
+			stats[m[1]] = s
+		}
+
+		s.set(m[2], m[3])
+	}
+
+	return stats
+}
+
+// ParseShow parses the devices in the output of btrfs filesystem show --raw
+// for a single filesystem
+func ParseShow(out string) []*Device {
+	var devices []*Device
+
+	for _, line := range strings.Split(out, "\n") {
+		m := showDeviceRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+
+		d := &Device{
+			Path:    m[4],
+			Name:    filepath.Base(m[4]),
+			Missing: len(m[5]) > 0 || m[4] == "<missing disk>",
+		}
+
+		d.ID, _ = strconv.Atoi(m[1])
+		d.Size = parseSize(m[2])
+		d.Allocated = parseSize(m[3])
+		d.Unallocated = d.Size.Sub(d.Allocated)
+
+		if d.Missing {
+			d.Path = ""
+			d.Name = fmt.Sprintf("devid%d", d.ID)
+		}
+
+		devices = append(devices, d)
+	}
+
+	return devices
+}
+
+// parseSize parses a raw or human readable size such as 1.50TiB
+func parseSize(v string) cap.Capacity {
+	c, err := cap.Parse(strings.TrimSuffix(v, "/s"))
+	if err != nil {
+		return 0
+	}
+
+	return *c
+}
+
+// parseDuration parses a scrub duration such as 1:02:11 or 00:45:12
+func parseDuration(v string) time.Duration {
+	var d time.Duration
+
+	for _, part := range strings.Split(v, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+
+		d = d*60 + time.Duration(n)
+	}
+
+	return d * time.Second
+}
+
+// parseTime parses a ctime formatted scrub start time in the local timezone
+func parseTime(v string) time.Time {
+	t, _ := time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.Join(strings.Fields(v), " "), time.Local)
+	return t
+}
+
+// ParseScrubStatus parses the output of btrfs scrub status. Both the key: value
+// format of btrfs-progs 5.x and later and the sentence format of older
+// versions are supported
+func ParseScrubStatus(out string) (*ScrubStatus, error) {
+	s := &ScrubStatus{Errors: make(map[string]uint64)}
+
+	var found bool
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "no stats available" {
+			s.Status = "none"
+			found = true
+
+			continue
+		}
+
+		if m := oldScrubRe.FindStringSubmatch(line); m != nil {
+			s.Started = parseTime(m[1])
+			s.Duration = parseDuration(m[3])
+			s.Status = map[string]string{
+				"running for":           "running",
+				"finished after":        "finished",
+				"was aborted after":     "aborted",
+				"was interrupted after": "interrupted",
+			}[m[2]]
+			found = true
+
+			continue
+		}
+
+		if m := oldScrubTotalRe.FindStringSubmatch(line); m != nil {
+			s.Scrubbed = parseSize(m[1])
+			s.ErrorCount, _ = strconv.ParseUint(m[2], 10, 64)
+
+			continue
+		}
+
+		if strings.HasPrefix(line, "error details:") {
+			s.addErrors(strings.TrimPrefix(line, "error details:"))
+			continue
+		}
+
+		if m := correctedRe.FindAllStringSubmatch(line, -1); len(m) > 0 {
+			for _, sub := range m {
+				s.setCorrected(sub[1], sub[2])
+			}
+
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		switch key {
+		case "Scrub started", "Scrub resumed":
+			s.Started = parseTime(value)
+		case "Status":
+			s.Status = value
+			found = true
+		case "Duration":
+			s.Duration = parseDuration(value)
+		case "Time left":
+			s.TimeLeft = parseDuration(value)
+		case "Total to scrub":
+			s.Total = parseSize(value)
+		case "Bytes scrubbed":
+			if m := scrubbedRe.FindStringSubmatch(value); m != nil {
+				s.Scrubbed = parseSize(m[1])
+				s.Percent, _ = strconv.ParseFloat(m[2], 64)
+			} else {
+				s.Scrubbed = parseSize(value)
+			}
+		case "Rate":
+			s.Rate = parseSize(value)
+		case "Error summary":
+			if value != "no errors found" {
+				s.addErrors(value)
+			}
+		case "Corrected", "Uncorrectable", "Unverified":
+			s.setCorrected(strings.ToLower(key), value)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("could not find scrub status in %q", out)
+	}
+
+	if s.Status == "finished" {
+		s.Percent = 100
+
+		// finished scrubs don't repeat the bytes scrubbed in newer versions
+		if s.Scrubbed == 0 {
+			s.Scrubbed = s.Total
+		}
+	}
+
+	return s, nil
+}
+
+// addErrors adds error counts such as csum=3 read=1
+func (s *ScrubStatus) addErrors(v string) {
+	var total uint64
+
+	for _, field := range strings.Fields(v) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		n, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s.Errors[kv[0]] = n
+		total += n
+	}
+
+	if total > s.ErrorCount {
+		s.ErrorCount = total
+	}
+}
+
+func (s *ScrubStatus) setCorrected(key, value string) {
+	n, _ := strconv.ParseUint(value, 10, 64)
+
+	switch key {
+	case "corrected":
+		s.Corrected = n
+	case "uncorrectable":
+		s.Uncorrectable = n
+	case "unverified":
+		s.Unverified = n
+	}
+}
@@ -0,0 +1,114 @@
+package btrfs
+
+import (
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readFixture(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestParseDeviceStats(t *testing.T) {
+	stats := ParseDeviceStats(readFixture(t, "device_stats.txt"))
+
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(stats))
+	}
+
+	if s := stats["/dev/sda"]; s == nil || s.Total() != 0 {
+		t.Errorf("expected no errors on sda, got %+v", s)
+	}
+
+	want := DeviceStats{WriteErrors: 12, ReadErrors: 4, FlushErrors: 1, CorruptionErrors: 7}
+	if s := stats["/dev/sdb"]; s == nil || *s != want || s.Total() != 24 {
+		t.Errorf("expected %+v, got %+v", want, s)
+	}
+}
+
+func TestParseShow(t *testing.T) {
+	devices := ParseShow(readFixture(t, "show_raw.txt"))
+
+	if len(devices) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(devices))
+	}
+
+	if d := devices[1]; d.ID != 2 || d.Name != "sdb" || d.Path != "/dev/sdb" || d.Size != 1000204886016 ||
+		d.Allocated != 400021651456 || d.Unallocated != 600183234560 || d.Missing {
+		t.Errorf("unexpected device %+v", d)
+	}
+
+	if d := devices[2]; !d.Missing || d.ID != 3 || d.Name != "devid3" || len(d.Path) > 0 {
+		t.Errorf("expected a missing device, got %+v", d)
+	}
+}
+
+func TestParseScrubStatus(t *testing.T) {
+	tib := func(v float64) cap.Capacity {
+		return cap.Capacity(v * float64(1<<40))
+	}
+
+	for name, want := range map[string]struct {
+		status             string
+		started            time.Time
+		duration, timeLeft time.Duration
+		total              cap.Capacity
+		percent            float64
+		errors             uint64
+	}{
+		"scrub_running.txt": {
+			"running", time.Date(2022, 10, 16, 2, 0, 1, 0, time.Local), 12*time.Minute + 34*time.Second,
+			20*time.Minute + 10*time.Second, tib(1.5), 36.47, 0,
+		},
+		"scrub_finished_errors.txt": {
+			"finished", time.Date(2022, 10, 1, 3, 0, 2, 0, time.Local), 26*time.Hour + 2*time.Minute + 11*time.Second,
+			0, tib(1.2), 100, 4,
+		},
+		"scrub_none.txt": {"none", time.Time{}, 0, 0, 212 << 30, 0, 0},
+		"scrub_v4.txt": {
+			"finished", time.Date(2020, 3, 2, 4, 10, 0, 0, time.Local), 45*time.Minute + 12*time.Second,
+			0, 0, 100, 2,
+		},
+		"scrub_v4_running.txt": {
+			"running", time.Date(2020, 3, 2, 4, 10, 0, 0, time.Local), 5*time.Minute + 30*time.Second, 0, 0, 0, 0,
+		},
+	} {
+		s, err := ParseScrubStatus(readFixture(t, name))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		if s.Status != want.status || !s.Started.Equal(want.started) || s.Duration != want.duration ||
+			s.TimeLeft != want.timeLeft || s.Total != want.total || s.Percent != want.percent || s.ErrorCount != want.errors {
+			t.Errorf("%s: expected %+v, got %+v", name, want, s)
+		}
+	}
+
+	s, _ := ParseScrubStatus(readFixture(t, "scrub_running.txt"))
+	if !s.IsRunning() || s.Scrubbed != parseSize("560.12GiB") || s.Rate != parseSize("760.45MiB") {
+		t.Errorf("unexpected progress %+v", s)
+	}
+
+	s, _ = ParseScrubStatus(readFixture(t, "scrub_finished_errors.txt"))
+	if s.Errors["csum"] != 3 || s.Errors["read"] != 1 || s.Corrected != 3 || s.Uncorrectable != 1 || s.Scrubbed != s.Total {
+		t.Errorf("unexpected errors %+v", s)
+	}
+
+	s, _ = ParseScrubStatus(readFixture(t, "scrub_v4.txt"))
+	if s.Errors["csum"] != 2 || s.Corrected != 2 || s.Scrubbed != tib(1.2) {
+		t.Errorf("unexpected errors %+v", s)
+	}
+
+	if _, err := ParseScrubStatus("ERROR: not a btrfs filesystem: /mnt\n"); err == nil {
+		t.Error("expected an error without a status")
+	}
+}
@@ -0,0 +1,134 @@
+package btrfs
+
+import (
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readAttr reads a sysfs attribute with its whitespace trimmed
+func readAttr(dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// readSizeAttr reads a sysfs attribute in bytes
+func readSizeAttr(dir, name string) cap.Capacity {
+	v, _ := strconv.ParseInt(readAttr(dir, name), 10, 64)
+	return cap.Capacity(v)
+}
+
+// readFilesystem reads a /sys/fs/btrfs/<uuid> directory
+func readFilesystem(dir string) *Filesystem {
+	alloc := filepath.Join(dir, "allocation")
+
+	fs := &Filesystem{
+		UUID:              filepath.Base(dir),
+		Label:             readAttr(dir, "label"),
+		NodeSize:          readSizeAttr(dir, "nodesize"),
+		SectorSize:        readSizeAttr(dir, "sectorsize"),
+		Data:              readBlockGroup(alloc, "data"),
+		Metadata:          readBlockGroup(alloc, "metadata"),
+		System:            readBlockGroup(alloc, "system"),
+		GlobalReserve:     readSizeAttr(alloc, "global_rsv_size"),
+		GlobalReserveUsed: readSizeAttr(alloc, "global_rsv_reserved"),
+	}
+
+	devs, _ := ioutil.ReadDir(filepath.Join(dir, "devices"))
+
+	for _, dev := range devs {
+		d := &Device{Name: dev.Name()}
+
+		// devices/<name> links to the block device, whose size is in sectors
+		if sectors, err := strconv.ParseInt(readAttr(filepath.Join(dir, "devices", dev.Name()), "size"), 10, 64); err == nil {
+			d.Size = cap.Capacity(sectors * 512)
+		}
+
+		fs.Devices = append(fs.Devices, d)
+	}
+
+	// devinfo/<devid> only has device ids, so it's matched to the device names
+	// when there's one device, or later by btrfs filesystem show
+	infos, _ := ioutil.ReadDir(filepath.Join(dir, "devinfo"))
+	fs.devInfo = make(map[int]*devInfo)
+
+	for _, info := range infos {
+		id, err := strconv.Atoi(info.Name())
+		if err != nil {
+			continue
+		}
+
+		infoDir := filepath.Join(dir, "devinfo", info.Name())
+		di := &devInfo{missing: readAttr(infoDir, "missing") == "1"}
+
+		if b, err := ioutil.ReadFile(filepath.Join(infoDir, "error_stats")); err == nil {
+			di.stats = new(DeviceStats)
+
+			for _, line := range strings.Split(string(b), "\n") {
+				if fields := strings.Fields(line); len(fields) == 2 {
+					di.stats.set(fields[0], fields[1])
+				}
+			}
+		}
+
+		fs.devInfo[id] = di
+
+		if len(infos) == 1 && len(fs.Devices) == 1 {
+			fs.Devices[0].ID = id
+		}
+	}
+
+	fs.applyDevInfo()
+
+	return fs
+}
+
+// readBlockGroup reads an allocation/<type> directory and its profiles
+func readBlockGroup(alloc, typ string) *BlockGroup {
+	dir := filepath.Join(alloc, typ)
+
+	g := &BlockGroup{
+		Type:          typ,
+		Allocated:     readSizeAttr(dir, "total_bytes"),
+		Used:          readSizeAttr(dir, "bytes_used"),
+		DiskAllocated: readSizeAttr(dir, "disk_total"),
+		DiskUsed:      readSizeAttr(dir, "disk_used"),
+		Reserved:      readSizeAttr(dir, "bytes_reserved"),
+		Pinned:        readSizeAttr(dir, "bytes_pinned"),
+		MayUse:        readSizeAttr(dir, "bytes_may_use"),
+		ReadOnly:      readSizeAttr(dir, "bytes_readonly"),
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+
+	for _, e := range entries {
+		// profiles are the only sub directories
+		profileDir := filepath.Join(dir, e.Name())
+		if fi, err := os.Stat(profileDir); err != nil || !fi.IsDir() {
+			continue
+		}
+
+		p := &Profile{
+			Name:      e.Name(),
+			Allocated: readSizeAttr(profileDir, "total_bytes"),
+			Used:      readSizeAttr(profileDir, "used_bytes"),
+		}
+
+		p.Free = p.Allocated.Sub(p.Used)
+		g.Profiles = append(g.Profiles, p)
+	}
+
+	sort.Slice(g.Profiles, func(i, j int) bool {
+		return g.Profiles[i].Name < g.Profiles[j].Name
+	})
+
+	return g
+}
@@ -15,6 +15,25 @@ func main() {
 	fmt.Printf("Built with %s on %s (%s)\n\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
 
 	dir := flag.String("dir", "", "dir")
+	root := flag.String("root", "", "root the host filesystem is mounted at")
+	snapshotPath := flag.String("snapshot", "", "ghw snapshot to load the disk inventory from")
+
+	flag.Parse()
+
+	var opts []disk.Option
+
+	if len(*root) > 0 {
+		opts = append(opts, disk.WithRoot(*root))
+	}
+
+	if len(*snapshotPath) > 0 {
+		opts = append(opts, disk.WithSnapshot(*snapshotPath))
+	}
+
+	inv, err := disk.NewInventory(opts...)
+	if err != nil {
+		panic(err)
+	}
 
 	if len(*dir) < 1 {
 		dir = new(string)
@@ -25,7 +44,7 @@ func main() {
 		}
 	}
 
-	partition, err := disk.GetPartitionFromDir(*dir)
+	partition, err := inv.GetPartitionFromDir(*dir)
 	if err != nil {
 		panic(err)
 	}
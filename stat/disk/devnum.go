@@ -0,0 +1,85 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// DevNum is a device number (dev_t) made up of a major and minor number
+type DevNum uint64
+
+// NewDevNum creates a new DevNum from a major and minor number
+func NewDevNum(major, minor uint32) DevNum {
+	return mkdev(major, minor)
+}
+
+// ParseDevNum parses a major:minor string such as the contents of /sys/class/block/*/dev
+func ParseDevNum(v string) (DevNum, error) {
+	parts := strings.Split(strings.TrimSpace(v), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("%s is not a valid major:minor device number", v)
+	}
+
+	major, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	minor, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return NewDevNum(uint32(major), uint32(minor)), nil
+}
+
+// Major returns the major number
+func (d DevNum) Major() uint32 {
+	return devMajor(d)
+}
+
+// Minor returns the minor number
+func (d DevNum) Minor() uint32 {
+	return devMinor(d)
+}
+
+// String returns the device number as major:minor
+func (d DevNum) String() string {
+	return fmt.Sprintf("%d:%d", d.Major(), d.Minor())
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d DevNum) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *DevNum) UnmarshalText(b []byte) error {
+	v, err := ParseDevNum(string(b))
+	if err != nil {
+		return err
+	}
+
+	*d = v
+
+	return nil
+}
+
+// readDevNum reads the first major:minor file found in paths
+func readDevNum(paths ...string) (DevNum, error) {
+	var err error
+
+	for _, path := range paths {
+		var b []byte
+
+		if b, err = ioutil.ReadFile(path); err == nil {
+			return ParseDevNum(string(b))
+		}
+	}
+
+	return 0, err
+}
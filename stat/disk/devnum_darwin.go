@@ -0,0 +1,14 @@
+package disk
+
+// mkdev encodes a major and minor number the same way darwin's makedev does
+func mkdev(major, minor uint32) DevNum {
+	return DevNum((major << 24) | minor)
+}
+
+func devMajor(d DevNum) uint32 {
+	return uint32((d >> 24) & 0xff)
+}
+
+func devMinor(d DevNum) uint32 {
+	return uint32(d & 0xffffff)
+}
@@ -0,0 +1,25 @@
+package disk
+
+// mkdev encodes a major and minor number the same way glibc's makedev does
+func mkdev(major, minor uint32) DevNum {
+	dev := uint64(major&0x00000fff) << 8
+	dev |= uint64(major&0xfffff000) << 32
+	dev |= uint64(minor&0x000000ff) << 0
+	dev |= uint64(minor&0xffffff00) << 12
+
+	return DevNum(dev)
+}
+
+func devMajor(d DevNum) uint32 {
+	major := uint32((d & 0x00000000000fff00) >> 8)
+	major |= uint32((d & 0xfffff00000000000) >> 32)
+
+	return major
+}
+
+func devMinor(d DevNum) uint32 {
+	minor := uint32((d & 0x00000000000000ff) >> 0)
+	minor |= uint32((d & 0x00000ffffff00000) >> 12)
+
+	return minor
+}
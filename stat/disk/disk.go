@@ -5,8 +5,11 @@ package disk
 import (
 	"fmt"
 	cap "github.com/ericmaustin/unixtools/capacity"
+	"github.com/ericmaustin/unixtools/stat/disk/probe"
 	"github.com/jaypipes/ghw/pkg/block"
+	"github.com/jaypipes/ghw/pkg/snapshot"
 	"gopkg.in/yaml.v2"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -16,13 +19,18 @@ import (
 // BlockDevice represents a storage device
 type BlockDevice struct {
 	*block.Disk
-	DevID                  int32        `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
+	DevID                  DevNum       `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
 	Partitions             []*Partition `yaml:"partitions,omitempty" json:"partitions,omitempty"`
 	SizeBytes              cap.Capacity `yaml:"size" json:"size"`
 	PhysicalBlockSizeBytes cap.Capacity `yaml:"physical_block_size_bytes" json:"physical_block_size_bytes"`
 	SMART                  *SMARTInfo
-	mu                     sync.Mutex
-	lastSmartCall          time.Time
+	// SMARTDevice is the device smartctl reads the disk's SMART data from if
+	// matched by Inventory.MatchSMARTDevices
+	SMARTDevice *SMARTDevice `yaml:"smart_device,omitempty" json:"smart_device,omitempty"`
+	// Identity holds the disk's stable identifiers
+	Identity   *DiskIdentity `yaml:"identity,omitempty" json:"identity,omitempty"`
+	mu         sync.Mutex
+	smartCache *SMARTCache
 }
 
 // String implements stringer and returns a yaml formatted string
@@ -35,19 +43,55 @@ func (d *BlockDevice) String() string {
 	return string(b)
 }
 
-// SMARTInfo gets smart info for the disk
+// SMARTInfo gets smart info for the disk, cached by the inventory's
+// SMARTCache
 func (d *BlockDevice) SMARTInfo() (*SMARTInfo, error) {
-	var err error
+	dev, opts := d.smartDevice()
+
+	info, err := d.cache().Get(dev, opts...)
+
+	if info != nil {
+		d.mu.Lock()
+		d.SMART = info
+		d.mu.Unlock()
+	}
+
+	return info, err
+}
 
+// SMARTInfoAge returns how long ago the cached smart info for the disk was
+// read, or false if it hasn't been
+func (d *BlockDevice) SMARTInfoAge() (time.Duration, bool) {
+	dev, opts := d.smartDevice()
+	return d.cache().Age(dev, opts...)
+}
+
+// smartDevice returns the device and options to read the disk's smart info
+// with
+func (d *BlockDevice) smartDevice() (string, []SMARTOption) {
 	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	if d.lastSmartCall.Add(time.Minute).Before(time.Now()) {
-		d.SMART, err = GetSMARTInfo(d.Name)
+	if d.SMARTDevice == nil {
+		return d.Name, nil
 	}
 
+	return d.SMARTDevice.Name, []SMARTOption{WithDeviceType(d.SMARTDevice.Type)}
+}
+
+// setSMARTDevice sets the device smartctl reads the disk's smart info from
+func (d *BlockDevice) setSMARTDevice(dev SMARTDevice) {
+	d.mu.Lock()
+	d.SMARTDevice = &dev
 	d.mu.Unlock()
+}
+
+func (d *BlockDevice) cache() *SMARTCache {
+	if d.smartCache == nil {
+		return DefaultSMARTCache
+	}
 
-	return d.SMART, err
+	return d.smartCache
 }
 
 // Partition represents a logical block device partition
@@ -58,9 +102,14 @@ type Partition struct {
 	Type       string
 	IsReadOnly bool
 	UUID       string // This would be volume UUID on macOS, PartUUID on linux, empty on Windows
+	DevID      DevNum
 	Disk       *BlockDevice
 	SizeBytes  cap.Capacity
 	Capacity   *FsCapacity
+	Identity   *DiskIdentity
+	// Ext4 and XFS are set by Inventory.ReadFsMetadata for those filesystems
+	Ext4 *Ext4Metadata
+	XFS  *XFSMetadata
 }
 
 // PartitionInfo used for printing / marshaling to prevent recursive marshaling calls
@@ -71,17 +120,22 @@ type PartitionInfo struct {
 	Type       string             `yaml:"type" json:"type"`
 	IsReadOnly bool               `yaml:"read_only" json:"read_only"`
 	UUID       string             `yaml:"uuid" json:"uuid"` // This would be volume UUID on macOS, PartUUID on linux, empty on Windows
+	DevID      DevNum             `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
 	Disk       *PartitionDiskInfo `yaml:"disk,omitempty" json:"disk,omitempty"`
 	SizeBytes  cap.Capacity       `yaml:"size" json:"size"`
 	Capacity   *FsCapacity        `yaml:"capacity,omitempty" json:"capacity,omitempty"`
+	Identity   *DiskIdentity      `yaml:"identity,omitempty" json:"identity,omitempty"`
+	Ext4       *Ext4Metadata      `yaml:"ext4,omitempty" json:"ext4,omitempty"`
+	XFS        *XFSMetadata       `yaml:"xfs,omitempty" json:"xfs,omitempty"`
 }
 
 // PartitionDiskInfo used for printing / marshaling to prevent recursive marshaling calls
 type PartitionDiskInfo struct {
-	DevID                  int32        `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
-	SizeBytes              cap.Capacity `yaml:"size" json:"size"`
-	PhysicalBlockSizeBytes cap.Capacity `yaml:"physical_block_size_bytes" json:"physical_block_size_bytes"`
-	SMART                  *SMARTInfo   `yaml:"smart,omitempty" json:"smart,omitempty"`
+	DevID                  DevNum        `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
+	SizeBytes              cap.Capacity  `yaml:"size" json:"size"`
+	PhysicalBlockSizeBytes cap.Capacity  `yaml:"physical_block_size_bytes" json:"physical_block_size_bytes"`
+	SMART                  *SMARTInfo    `yaml:"smart,omitempty" json:"smart,omitempty"`
+	Identity               *DiskIdentity `yaml:"identity,omitempty" json:"identity,omitempty"`
 }
 
 func (p *Partition) toInfo() *PartitionInfo {
@@ -92,14 +146,19 @@ func (p *Partition) toInfo() *PartitionInfo {
 		Type:       p.Type,
 		IsReadOnly: p.IsReadOnly,
 		UUID:       p.UUID,
+		DevID:      p.DevID,
 		Disk: &PartitionDiskInfo{
 			DevID:                  p.Disk.DevID,
 			SizeBytes:              p.Disk.SizeBytes,
 			PhysicalBlockSizeBytes: p.Disk.PhysicalBlockSizeBytes,
 			SMART:                  p.Disk.SMART,
+			Identity:               p.Disk.Identity,
 		},
 		SizeBytes: p.SizeBytes,
 		Capacity:  p.Capacity,
+		Identity:  p.Identity,
+		Ext4:      p.Ext4,
+		XFS:       p.XFS,
 	}
 }
 
@@ -115,82 +174,348 @@ func (p *Partition) String() string {
 	return string(b)
 }
 
+// FsCapacity is the capacity of a mounted filesystem as reported by statfs
 type FsCapacity struct {
 	syscall.Statfs_t
-	UsedBytes      cap.Capacity `yaml:"used_bytes" json:"used_bytes"`
-	AvailableBytes cap.Capacity `yaml:"available" json:"available"`
-	TotalBytes     cap.Capacity `yaml:"total" json:"total"`
-	BlockSizeBytes cap.Capacity `yaml:"block_size" json:"block_size"`
+	UsedBytes         cap.Capacity `yaml:"used_bytes" json:"used_bytes"`
+	AvailableBytes    cap.Capacity `yaml:"available" json:"available"` // free for unprivileged users
+	FreeBytes         cap.Capacity `yaml:"free" json:"free"`           // free for root
+	ReservedBytes     cap.Capacity `yaml:"reserved" json:"reserved"`   // free for root only
+	TotalBytes        cap.Capacity `yaml:"total" json:"total"`
+	BlockSizeBytes    cap.Capacity `yaml:"block_size" json:"block_size"`
+	FragmentSizeBytes cap.Capacity `yaml:"fragment_size" json:"fragment_size"`
+	UsedPercent       float64      `yaml:"used_percent" json:"used_percent"`
+	InodesTotal       uint64       `yaml:"inodes_total" json:"inodes_total"`
+	InodesUsed        uint64       `yaml:"inodes_used" json:"inodes_used"`
+	InodesFree        uint64       `yaml:"inodes_free" json:"inodes_free"`
+	InodesUsedPercent float64      `yaml:"inodes_used_percent" json:"inodes_used_percent"`
+	MaxNameLength     uint64       `yaml:"max_name_length,omitempty" json:"max_name_length,omitempty"`
+	MountFlags        MountFlags   `yaml:"mount_flags" json:"mount_flags"`
 }
 
-// GetPartitionFromDir gets the filesystem capacity for the given dir
+// IsReadOnly returns true if the filesystem is mounted read-only
+func (ds *FsCapacity) IsReadOnly() bool {
+	return ds.MountFlags.Has(MountReadOnly)
+}
+
+// GetPartitionFromDir gets the partition for the given dir from the default inventory
 func GetPartitionFromDir(dir string) (*Partition, error) {
+	return defaultInventory().GetPartitionFromDir(dir)
+}
+
+// GetDiskFromLabel gets the disk from a device label string from the default inventory
+func GetDiskFromLabel(dev string) (*BlockDevice, error) {
+	return defaultInventory().GetDiskFromLabel(dev)
+}
+
+// GetDiskFromDevNum gets the disk with the given device number from the default inventory
+func GetDiskFromDevNum(dev DevNum) (*BlockDevice, error) {
+	return defaultInventory().GetDiskFromDevNum(dev)
+}
+
+// GetPartitionFromDevNum gets the partition with the given device number from the default inventory
+func GetPartitionFromDevNum(dev DevNum) (*Partition, error) {
+	return defaultInventory().GetPartitionFromDevNum(dev)
+}
+
+// GetFSCapacity gets the filesystem capacity for the given dir
+func GetFSCapacity(dir string) (*FsCapacity, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return nil, err
+	}
+
+	return newFsCapacity(stat), nil
+}
+
+// newFsCapacity derives the capacity from a statfs result. Block counts are
+// in fragment sized units and the space between free and available blocks is
+// reserved for root, so it's neither used nor available like in df
+func newFsCapacity(stat syscall.Statfs_t) *FsCapacity {
+	ds := &FsCapacity{Statfs_t: stat}
+
+	ds.BlockSizeBytes = cap.Capacity(ds.Statfs_t.Bsize)
+	ds.FragmentSizeBytes = cap.Capacity(statfsFragmentSize(&ds.Statfs_t))
+	ds.TotalBytes = ds.FragmentSizeBytes.Mult(int64(ds.Statfs_t.Blocks))
+	ds.FreeBytes = ds.FragmentSizeBytes.Mult(int64(ds.Statfs_t.Bfree))
+	ds.AvailableBytes = ds.FragmentSizeBytes.Mult(int64(ds.Statfs_t.Bavail))
+	ds.ReservedBytes = ds.FreeBytes.Sub(ds.AvailableBytes)
+	ds.UsedBytes = ds.TotalBytes.Sub(ds.FreeBytes)
+
+	if userTotal := ds.UsedBytes.Add(ds.AvailableBytes); userTotal > 0 {
+		ds.UsedPercent = float64(ds.UsedBytes) / float64(userTotal) * 100
+	}
+
+	// filesystems with dynamic inodes like btrfs report no inode totals
+	ds.InodesTotal = uint64(ds.Statfs_t.Files)
+	ds.InodesFree = uint64(ds.Statfs_t.Ffree)
+
+	if ds.InodesTotal >= ds.InodesFree {
+		ds.InodesUsed = ds.InodesTotal - ds.InodesFree
+	}
+
+	if ds.InodesTotal > 0 {
+		ds.InodesUsedPercent = float64(ds.InodesUsed) / float64(ds.InodesTotal) * 100
+	}
+
+	ds.MaxNameLength = statfsNameLength(&ds.Statfs_t)
+	ds.MountFlags = statfsMountFlags(&ds.Statfs_t)
+
+	return ds
+}
+
+// Inventory holds the block devices and mounted filesystems of a system
+type Inventory struct {
+	Disks       []*BlockDevice
+	opts        *Options
+	offline     bool
+	partMap     map[DevNum]*Partition
+	partNameMap map[string]*Partition
+	diskMap     map[DevNum]*BlockDevice
+	devMap      map[string]*BlockDevice
+}
+
+// NewInventory discovers all block devices and their mounted filesystems
+// either from the running system or from a ghw snapshot
+func NewInventory(opt ...Option) (*Inventory, error) {
+	inv := &Inventory{
+		opts:        newOptions(opt...),
+		partMap:     make(map[DevNum]*Partition),
+		partNameMap: make(map[string]*Partition),
+		diskMap:     make(map[DevNum]*BlockDevice),
+		devMap:      make(map[string]*BlockDevice),
+	}
+
+	if len(inv.opts.SnapshotPath) > 0 {
+		root, err := snapshot.Unpack(inv.opts.SnapshotPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// the unpacked snapshot is only read while loading so point the root
+		// back at the host once it's removed
+		defer func(hostRoot string) {
+			snapshot.Cleanup(root)
+			inv.opts.Root = hostRoot
+		}(inv.opts.Root)
+
+		inv.opts.Root = root
+		inv.offline = true
+	}
+
+	if err := inv.load(); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// Offline returns true if the inventory was loaded from a snapshot
+func (inv *Inventory) Offline() bool {
+	return inv.offline
+}
+
+// GetPartitionFromDir gets the partition the given dir is on. The dir is
+// resolved relative to the inventory's root. When the dir's st_dev is not a
+// block device, as on btrfs, zfs or overlay mounts, the partition is resolved
+// from the source of its mount in the host's mountinfo. Snapshot inventories
+// match the dir against the captured mount points instead
+func (inv *Inventory) GetPartitionFromDir(dir string) (*Partition, error) {
+	if inv.offline {
+		if part := inv.partitionFromMountPoint(dir); part != nil {
+			return part, nil
+		}
+
+		return nil, fmt.Errorf("could not find filesytem for %s", dir)
+	}
+
 	var stat syscall.Stat_t
 
-	if err := syscall.Stat(dir, &stat); err != nil {
+	if err := syscall.Stat(inv.opts.hostPath(dir), &stat); err != nil {
 		return nil, err
 	}
 
-	if fs, ok := partMap[stat.Dev]; ok {
+	if fs, ok := inv.partMap[DevNum(stat.Dev)]; ok {
+		return fs, nil
+	}
+
+	if fs := inv.partitionFromMountInfo(dir); fs != nil {
 		return fs, nil
 	}
 
 	return nil, fmt.Errorf("could not find filesytem for %s", dir)
 }
 
-// GetDiskFromLabel gets the disk from a device label string
-func GetDiskFromLabel(dev string) (*BlockDevice, error) {
-	dev = strings.TrimPrefix(dev, "/dev/")
-
-	if d, ok := devMap[dev]; ok {
+// GetDiskFromDevNum gets the disk with the given device number
+func (inv *Inventory) GetDiskFromDevNum(dev DevNum) (*BlockDevice, error) {
+	if d, ok := inv.diskMap[dev]; ok {
 		return d, nil
 	}
 
-	return nil, fmt.Errorf("could not find disk with label %s", dev)
+	return nil, fmt.Errorf("could not find disk with device number %s", dev)
 }
 
-// GetFSCapacity gets the filesystem capacity for the given dir
-func GetFSCapacity(dir string) (*FsCapacity, error) {
-	ds := new(FsCapacity)
-	if err := syscall.Statfs(dir, &ds.Statfs_t); err != nil {
+// GetPartitionFromDevNum gets the partition with the given device number
+func (inv *Inventory) GetPartitionFromDevNum(dev DevNum) (*Partition, error) {
+	if p, ok := inv.partMap[dev]; ok {
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("could not find partition with device number %s", dev)
+}
+
+// GetMounts reads the mount table relative to the inventory's root
+func (inv *Inventory) GetMounts() (Mounts, error) {
+	if inv.offline {
+		return nil, fmt.Errorf("the mount table of a snapshot can not be read")
+	}
+
+	return GetMounts(WithRoot(inv.opts.Root))
+}
+
+// GetMountFromDir gets the mount the given dir is on, which includes
+// filesystems that are not on a partition such as tmpfs, nfs or zfs
+func (inv *Inventory) GetMountFromDir(dir string) (*Mount, error) {
+	mounts, err := inv.GetMounts()
+	if err != nil {
 		return nil, err
 	}
 
-	ds.BlockSizeBytes = cap.Capacity(ds.Statfs_t.Bsize)
-	ds.AvailableBytes = ds.BlockSizeBytes.Mult(int64(ds.Statfs_t.Bavail))
-	ds.TotalBytes = ds.BlockSizeBytes.Mult(int64(ds.Statfs_t.Blocks))
-	ds.UsedBytes = ds.TotalBytes.Sub(ds.AvailableBytes)
+	if m := inv.mountFromDir(mounts, dir); m != nil {
+		return m, nil
+	}
 
-	return ds, nil
+	return nil, fmt.Errorf("could not find mount for %s", dir)
 }
 
-var (
-	blockDevices *block.Info
-	partMap      = make(map[int32]*Partition)
-	devMap       = make(map[string]*BlockDevice)
-	fsMu         sync.Mutex
-)
+// GetPartitionFromMount gets the partition a mount's filesystem is on
+func (inv *Inventory) GetPartitionFromMount(m *Mount) (*Partition, error) {
+	if p, ok := inv.partMap[m.DevID]; ok {
+		return p, nil
+	}
 
-// LoadMountedFileSystems loads all the mounted filesystems
-func LoadMountedFileSystems() error {
-	var (
-		err  error
-		stat syscall.Stat_t
-	)
+	if strings.HasPrefix(m.Source, "/dev/") {
+		// follow /dev/mapper and /dev/disk links to the kernel device name
+		source := m.Source
+		if resolved, err := filepath.EvalSymlinks(inv.opts.hostPath(source)); err == nil {
+			source = resolved
+		}
 
-	fsMu.Lock()
-	defer fsMu.Unlock()
+		if p, ok := inv.partNameMap[filepath.Base(source)]; ok {
+			return p, nil
+		}
+	}
+
+	// pseudo filesystems and zfs datasets have no source device
+	return nil, fmt.Errorf("could not find partition for %s mounted at %s", m.Source, m.MountPoint)
+}
+
+// mountFromDir resolves symlinks in dir and returns the mount it's on
+func (inv *Inventory) mountFromDir(mounts Mounts, dir string) *Mount {
+	path, err := filepath.EvalSymlinks(inv.opts.hostPath(dir))
+	if err != nil {
+		return nil
+	}
+
+	if path, err = filepath.Rel(inv.opts.Root, path); err != nil {
+		return nil
+	}
+
+	return mounts.FromDir(filepath.Join("/", path))
+}
+
+// partitionFromMountInfo resolves the partition of the mount containing dir
+// by the mount's major:minor and then by its source device
+func (inv *Inventory) partitionFromMountInfo(dir string) *Partition {
+	mounts, err := inv.opts.readHostMounts()
+	if err != nil {
+		return nil
+	}
 
-	blockDevices, err = block.New()
+	m := inv.mountFromDir(mounts, dir)
+	if m == nil {
+		return nil
+	}
+
+	p, _ := inv.GetPartitionFromMount(m)
+
+	return p
+}
+
+// ProbePartition reads the partition's filesystem signature from its device
+// under the inventory's root. If Type wasn't reported it's set to the probed
+// type
+func (inv *Inventory) ProbePartition(p *Partition) (*probe.Result, error) {
+	if inv.offline {
+		return nil, fmt.Errorf("the partitions of a snapshot can not be probed")
+	}
+
+	res, err := probe.ProbeFile(inv.opts.hostDevicePath(p.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.Type) < 1 || p.Type == "unknown" {
+		p.Type = res.Type
+	}
+
+	return res, nil
+}
+
+// GetDiskFromLabel gets the disk from a device label string
+func (inv *Inventory) GetDiskFromLabel(dev string) (*BlockDevice, error) {
+	dev = strings.TrimPrefix(dev, "/dev/")
+
+	if d, ok := inv.devMap[dev]; ok {
+		return d, nil
+	}
+
+	return nil, fmt.Errorf("could not find disk with label %s", dev)
+}
+
+// partitionFromMountPoint returns the partition with the longest mount point
+// containing dir
+func (inv *Inventory) partitionFromMountPoint(dir string) *Partition {
+	var found *Partition
+
+	dir = filepath.Clean(dir)
+
+	for _, d := range inv.Disks {
+		for _, p := range d.Partitions {
+			if len(p.MountPoint) < 1 || !pathHasPrefix(dir, p.MountPoint) {
+				continue
+			}
+
+			if found == nil || len(p.MountPoint) > len(found.MountPoint) {
+				found = p
+			}
+		}
+	}
+
+	return found
+}
+
+func (inv *Inventory) load() error {
+	blockDevices, err := block.New(inv.opts.ghwOptions()...)
 	if err != nil {
 		return err
 	}
 
+	links := inv.readDiskLinks()
+
 	for _, d := range blockDevices.Disks {
-		disk := &BlockDevice{Disk: d}
+		disk := &BlockDevice{Disk: d, smartCache: inv.opts.SMARTCache}
 		disk.SizeBytes = cap.Capacity(disk.Disk.SizeBytes)
 		disk.PhysicalBlockSizeBytes = cap.Capacity(disk.Disk.PhysicalBlockSizeBytes)
-		devMap[d.Name] = disk
+		disk.Identity = inv.readDiskIdentity(disk, links)
+		inv.devMap[d.Name] = disk
+		inv.Disks = append(inv.Disks, disk)
+
+		// device numbers are only available where there's a sysfs
+		if disk.DevID, err = inv.readDevNum(d.Name, ""); err == nil {
+			inv.diskMap[disk.DevID] = disk
+		}
 
 		disk.Partitions = make([]*Partition, len(d.Partitions))
 
@@ -206,30 +531,62 @@ func LoadMountedFileSystems() error {
 			}
 			disk.Partitions[i] = part
 			part.SizeBytes = cap.Capacity(p.SizeBytes)
+			part.Identity = links[p.Name]
+			inv.partNameMap[p.Name] = part
 
-			if len(p.MountPoint) < 1 {
-				// skip all unmounted filesystems
-				continue
+			if part.DevID, err = inv.readDevNum(p.Name, d.Name); err == nil {
+				inv.partMap[part.DevID] = part
 			}
 
-			if err = syscall.Stat(p.MountPoint, &stat); err != nil {
-				return err
+			if len(p.MountPoint) < 1 || inv.offline {
+				// skip all unmounted filesystems and the mount points of captured machines
+				continue
 			}
 
-			disk.DevID = stat.Dev
+			// a mount that can't be statted, e.g. a hung nfs share or one
+			// unmounted since the block devices were read, has no capacity
+			part.Capacity, _ = GetFSCapacity(inv.opts.hostPath(p.MountPoint))
+		}
+	}
 
-			part.Capacity, err = GetFSCapacity(p.MountPoint)
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-			partMap[disk.DevID] = part
-		}
+// readDevNum reads the major:minor of a disk or partition from sysfs. Snapshots
+// only hold /sys/block so partitions fall back to their parent disk's dir
+func (inv *Inventory) readDevNum(name, parent string) (DevNum, error) {
+	return readDevNum(
+		inv.opts.hostPath(filepath.Join("/sys/class/block", name, "dev")),
+		inv.opts.hostPath(filepath.Join("/sys/block", parent, name, "dev")),
+	)
+}
+
+var (
+	inventory *Inventory
+	fsMu      sync.Mutex
+)
+
+// LoadMountedFileSystems loads all the mounted filesystems into the default inventory
+func LoadMountedFileSystems(opts ...Option) error {
+	inv, err := NewInventory(opts...)
+	if err != nil {
+		return err
 	}
 
+	fsMu.Lock()
+	inventory = inv
+	fsMu.Unlock()
+
 	return nil
 }
 
+func defaultInventory() *Inventory {
+	fsMu.Lock()
+	defer fsMu.Unlock()
+
+	return inventory
+}
+
 func init() {
 	var err error
 	if err = LoadMountedFileSystems(); err != nil {
@@ -244,3 +601,12 @@ func boolYesNo(b bool) string {
 
 	return "No"
 }
+
+// pathHasPrefix returns true if path is prefix or is under the prefix dir
+func pathHasPrefix(path, prefix string) bool {
+	if prefix == "/" || path == prefix {
+		return true
+	}
+
+	return strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
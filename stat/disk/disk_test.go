@@ -0,0 +1,225 @@
+//+build linux
+
+package disk
+
+import (
+	"errors"
+	"github.com/ericmaustin/unixtools/stat/disk/probe"
+	"github.com/jaypipes/ghw/pkg/snapshot"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeFiles is a minimal captured machine with one disk and one mounted partition
+var fakeFiles = map[string]string{
+	"sys/block/sda/size":                      "2097152",
+	"sys/block/sda/dev":                       "8:0",
+	"sys/block/sda/removable":                 "0",
+	"sys/block/sda/queue/physical_block_size": "4096",
+	"sys/block/sda/queue/rotational":          "1",
+	"sys/block/sda/sda1/size":                 "1048576",
+	"sys/block/sda/sda1/dev":                  "8:1",
+	"sys/block/sda/sda2/size":                 "1046528",
+	"sys/block/sda/sda2/dev":                  "8:2",
+	"proc/self/mounts":                        "/dev/sda1 /data ext4 rw,relatime 0 0\n",
+	"proc/1/mountinfo": "30 1 8:1 / /data rw,relatime shared:1 - ext4 /dev/sda1 rw\n" +
+		"31 1 0:45 /@home /home rw,relatime - btrfs /dev/sda2 rw,space_cache\n" +
+		"32 1 0:46 / /tank rw,relatime - zfs tank rw\n",
+}
+
+func writeFakeTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func writeFakeSnapshot(t *testing.T, files map[string]string) string {
+	root := writeFakeTree(t, files)
+	path := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if err = snapshot.PackWithWriter(f, root); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func checkFakeInventory(t *testing.T, inv *Inventory) {
+	if len(inv.Disks) != 1 {
+		t.Fatalf("expected 1 disk, got %d", len(inv.Disks))
+	}
+
+	d, err := inv.GetDiskFromLabel("/dev/sda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.SizeBytes.B() != 2097152*512 {
+		t.Errorf("unexpected disk size %d", d.SizeBytes.B())
+	}
+
+	if len(d.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(d.Partitions))
+	}
+
+	p, err := inv.GetPartitionFromDir("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "sda1" || p.MountPoint != "/data" {
+		t.Errorf("unexpected partition %s mounted at %s", p.Name, p.MountPoint)
+	}
+
+	if p.DevID != NewDevNum(8, 1) {
+		t.Errorf("expected sda1 to be 8:1, got %s", p.DevID)
+	}
+
+	if d, err = inv.GetDiskFromDevNum(NewDevNum(8, 0)); err != nil || d.Name != "sda" {
+		t.Errorf("expected 8:0 to be sda: %v", err)
+	}
+
+	if p, err = inv.GetPartitionFromDevNum(NewDevNum(8, 2)); err != nil || p.Name != "sda2" {
+		t.Errorf("expected 8:2 to be sda2: %v", err)
+	}
+}
+
+func TestInventoryFromSnapshot(t *testing.T) {
+	inv, err := NewInventory(WithSnapshot(writeFakeSnapshot(t, fakeFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !inv.Offline() {
+		t.Error("snapshot inventory should be offline")
+	}
+
+	if _, err = inv.ProbePartition(inv.Disks[0].Partitions[0]); err == nil {
+		t.Error("expected an error probing a snapshot partition")
+	}
+
+	checkFakeInventory(t, inv)
+
+	if inv.opts.Root != newOptions().Root {
+		t.Errorf("expected the root to be reset after loading the snapshot, got %s", inv.opts.Root)
+	}
+
+	if p := inv.partitionFromMountPoint("/data/some/dir"); p == nil || p.Name != "sda1" {
+		t.Error("expected /data/some/dir to resolve to sda1")
+	}
+
+	if p := inv.partitionFromMountPoint("/database"); p != nil {
+		t.Errorf("expected /database not to resolve, got %s", p.Name)
+	}
+}
+
+func TestInventoryWithRoot(t *testing.T) {
+	root := writeFakeTree(t, fakeFiles)
+
+	for _, dir := range []string{"data", "dev", "home/user", "tank"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inv, err := NewInventory(WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFakeInventory(t, inv)
+
+	if inv.Disks[0].Partitions[0].Capacity == nil {
+		t.Error("expected capacity for the mounted partition")
+	}
+
+	// btrfs subvolumes have a synthetic st_dev so resolve from the mount source
+	p, err := inv.GetPartitionFromDir("/home/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "sda2" {
+		t.Errorf("expected /home/user to be on sda2, got %s", p.Name)
+	}
+
+	if _, err = inv.GetPartitionFromDir("/tank"); err == nil {
+		t.Error("expected zfs datasets not to resolve to a partition")
+	}
+
+	m, err := inv.GetMountFromDir("/tank")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.FsType != "zfs" || m.Source != "tank" || m.Capacity == nil {
+		t.Errorf("unexpected mount %+v", m)
+	}
+
+	// the device node is read from under the root
+	if err = os.WriteFile(filepath.Join(root, "dev/sda1"), make([]byte, 64<<10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = inv.ProbePartition(inv.Disks[0].Partitions[0]); !errors.Is(err, probe.ErrNoSignature) {
+		t.Errorf("expected no signature on the fake sda1, got %v", err)
+	}
+}
+
+func TestInventoryMissingMountPoint(t *testing.T) {
+	// /data isn't created so statfs on it fails
+	inv, err := NewInventory(WithRoot(writeFakeTree(t, fakeFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inv.Disks) != 1 || len(inv.Disks[0].Partitions) != 2 {
+		t.Fatalf("unexpected disks %v", inv.Disks)
+	}
+
+	if inv.Disks[0].Partitions[0].Capacity != nil {
+		t.Error("expected no capacity for a mount point that can't be statted")
+	}
+}
+
+func TestDevNum(t *testing.T) {
+	for _, v := range []string{"8:0", "259:3", "254:16", "4095:1048575", "0:45"} {
+		d, err := ParseDevNum(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.String() != v {
+			t.Errorf("expected %s, got %s", v, d)
+		}
+	}
+
+	// dev_t as returned in stat.st_dev on linux for 259:3
+	if d := NewDevNum(259, 3); uint64(d) != 0x10303 {
+		t.Errorf("unexpected dev_t %#x", uint64(d))
+	}
+
+	if _, err := ParseDevNum("8"); err == nil {
+		t.Error("expected an error parsing an invalid device number")
+	}
+}
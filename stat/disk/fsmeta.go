@@ -0,0 +1,100 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+)
+
+// runFsTool runs a filesystem tool such as tune2fs and returns its output
+func runFsTool(name string, args ...string) (string, error) {
+	var out bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &out
+	err := cmd.Run()
+
+	if err != nil && out.Len() == 0 {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// ReadFsMetadata reads the filesystem metadata of every ext2, ext3, ext4 and
+// XFS partition. Every partition is tried and the first error is returned
+func (inv *Inventory) ReadFsMetadata() error {
+	var first error
+
+	for _, d := range inv.Disks {
+		for _, p := range d.Partitions {
+			if err := inv.ReadPartitionFsMetadata(p); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
+
+// ReadPartitionFsMetadata sets Ext4 from tune2fs -l or XFS from xfs_info and
+// sysfs on the partition. Device nodes, mount points and sysfs are resolved
+// relative to the inventory's root. Partitions with other filesystems are
+// skipped
+func (inv *Inventory) ReadPartitionFsMetadata(p *Partition) error {
+	switch p.Type {
+	case "ext2", "ext3", "ext4":
+	case "xfs":
+	default:
+		return nil
+	}
+
+	if inv.offline {
+		return fmt.Errorf("the filesystem metadata of a snapshot can not be read")
+	}
+
+	if p.Type != "xfs" {
+		out, err := runFsTool("tune2fs", "-l", inv.opts.hostDevicePath(p.Name))
+		if err != nil {
+			return err
+		}
+
+		p.Ext4, err = ParseTune2fs(out)
+
+		return err
+	}
+
+	// older xfs_info only accepts a mount point
+	target := inv.opts.hostDevicePath(p.Name)
+	if len(p.MountPoint) > 0 {
+		target = inv.opts.hostPath(p.MountPoint)
+	}
+
+	out, err := runFsTool("xfs_info", target)
+	if err != nil {
+		return err
+	}
+
+	if p.XFS, err = ParseXFSInfo(out); err != nil {
+		return err
+	}
+
+	inv.readXFSSysfs(p.Name, p.XFS)
+
+	return nil
+}
+
+// readXFSSysfs adds the counters and error config of a mounted XFS filesystem
+func (inv *Inventory) readXFSSysfs(name string, m *XFSMetadata) {
+	dir := inv.opts.hostPath(filepath.Join("/sys/fs/xfs", name))
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "stats", "stats")); err == nil {
+		m.Stats = ParseXFSStats(string(b))
+	}
+
+	m.ErrorConfig, _ = readXFSErrorConfig(filepath.Join(dir, "error"))
+}
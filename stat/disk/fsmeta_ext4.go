@@ -0,0 +1,196 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"bufio"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tune2fs 1.46.5 (30-Dec-2021)
+var tune2fsVersionRe = regexp.MustCompile(`^tune2fs (\S+) \(`)
+
+// Ext4Metadata is the superblock of an ext2, ext3 or ext4 filesystem as
+// reported by tune2fs -l
+type Ext4Metadata struct {
+	// Version is the version of e2fsprogs that read the superblock
+	Version             string       `yaml:"version,omitempty" json:"version,omitempty"`
+	VolumeName          string       `yaml:"volume_name,omitempty" json:"volume_name,omitempty"`
+	LastMountedOn       string       `yaml:"last_mounted_on,omitempty" json:"last_mounted_on,omitempty"`
+	UUID                string       `yaml:"uuid" json:"uuid"`
+	Features            []string     `yaml:"features" json:"features"`
+	DefaultMountOptions []string     `yaml:"default_mount_options,omitempty" json:"default_mount_options,omitempty"`
+	State               string       `yaml:"state" json:"state"`
+	ErrorsBehavior      string       `yaml:"errors_behavior" json:"errors_behavior"`
+	InodeCount          uint64       `yaml:"inode_count" json:"inode_count"`
+	FreeInodes          uint64       `yaml:"free_inodes" json:"free_inodes"`
+	BlockCount          uint64       `yaml:"block_count" json:"block_count"`
+	FreeBlocks          uint64       `yaml:"free_blocks" json:"free_blocks"`
+	ReservedBlockCount  uint64       `yaml:"reserved_block_count" json:"reserved_block_count"`
+	BlockSize           cap.Capacity `yaml:"block_size" json:"block_size"`
+	ReservedBlocksUID   int          `yaml:"reserved_blocks_uid" json:"reserved_blocks_uid"`
+	ReservedBlocksGID   int          `yaml:"reserved_blocks_gid" json:"reserved_blocks_gid"`
+	Created             time.Time    `yaml:"created" json:"created"`
+	LastMount           time.Time    `yaml:"last_mount,omitempty" json:"last_mount,omitempty"`
+	LastWrite           time.Time    `yaml:"last_write,omitempty" json:"last_write,omitempty"`
+	MountCount          int          `yaml:"mount_count" json:"mount_count"`
+	// MaxMountCount is -1 when mount count checks are disabled
+	MaxMountCount int       `yaml:"max_mount_count" json:"max_mount_count"`
+	LastChecked   time.Time `yaml:"last_checked" json:"last_checked"`
+	// CheckInterval is 0 when time based checks are disabled
+	CheckInterval  time.Duration `yaml:"check_interval" json:"check_interval"`
+	NextCheck      time.Time     `yaml:"next_check,omitempty" json:"next_check,omitempty"`
+	LifetimeWrites cap.Capacity  `yaml:"lifetime_writes,omitempty" json:"lifetime_writes,omitempty"`
+	// ErrorCount and the first and last error are only kept by ext4
+	ErrorCount         int       `yaml:"error_count" json:"error_count"`
+	FirstErrorTime     time.Time `yaml:"first_error_time,omitempty" json:"first_error_time,omitempty"`
+	FirstErrorFunction string    `yaml:"first_error_function,omitempty" json:"first_error_function,omitempty"`
+	LastErrorTime      time.Time `yaml:"last_error_time,omitempty" json:"last_error_time,omitempty"`
+	LastErrorFunction  string    `yaml:"last_error_function,omitempty" json:"last_error_function,omitempty"`
+	// Fields holds every line of the report by name
+	Fields map[string]string `yaml:"-" json:"-"`
+}
+
+// HasFeature returns true if the filesystem has the given feature, e.g. metadata_csum
+func (m *Ext4Metadata) HasFeature(feature string) bool {
+	for _, f := range m.Features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReservedSize returns the space reserved for the reserved blocks user
+func (m *Ext4Metadata) ReservedSize() cap.Capacity {
+	return m.BlockSize.Mult(int64(m.ReservedBlockCount))
+}
+
+// HasErrors returns true if the kernel recorded errors on the filesystem
+// that fsck hasn't cleared
+func (m *Ext4Metadata) HasErrors() bool {
+	return m.ErrorCount > 0 || strings.Contains(m.State, "error")
+}
+
+// MountCountExceeded returns true if the filesystem has been mounted more
+// times than its maximum without a check
+func (m *Ext4Metadata) MountCountExceeded() bool {
+	return m.MaxMountCount > 0 && m.MountCount >= m.MaxMountCount
+}
+
+// CheckOverdue returns true if the check interval has passed since the last check
+func (m *Ext4Metadata) CheckOverdue(now time.Time) bool {
+	return m.CheckInterval > 0 && now.Sub(m.LastChecked) > m.CheckInterval
+}
+
+// ParseTune2fs parses the output of tune2fs -l
+func ParseTune2fs(out string) (*Ext4Metadata, error) {
+	m := &Ext4Metadata{Fields: make(map[string]string)}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if match := tune2fsVersionRe.FindStringSubmatch(line); match != nil {
+			m.Version = match[1]
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		m.Fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	if len(m.Fields["Filesystem magic number"]) < 1 {
+		return nil, fmt.Errorf("could not find an ext superblock in tune2fs output")
+	}
+
+	f := m.Fields
+
+	m.VolumeName = noneValue(f["Filesystem volume name"])
+	m.LastMountedOn = noneValue(f["Last mounted on"])
+	m.UUID = f["Filesystem UUID"]
+	m.Features = strings.Fields(f["Filesystem features"])
+	m.DefaultMountOptions = strings.Fields(noneValue(f["Default mount options"]))
+	m.State = f["Filesystem state"]
+	m.ErrorsBehavior = f["Errors behavior"]
+	m.InodeCount = parseUintField(f["Inode count"])
+	m.FreeInodes = parseUintField(f["Free inodes"])
+	m.BlockCount = parseUintField(f["Block count"])
+	m.FreeBlocks = parseUintField(f["Free blocks"])
+	m.ReservedBlockCount = parseUintField(f["Reserved block count"])
+	m.BlockSize = cap.Capacity(parseUintField(f["Block size"]))
+	m.ReservedBlocksUID = int(parseUintField(f["Reserved blocks uid"]))
+	m.ReservedBlocksGID = int(parseUintField(f["Reserved blocks gid"]))
+	m.Created = parseCTime(f["Filesystem created"])
+	m.LastMount = parseCTime(f["Last mount time"])
+	m.LastWrite = parseCTime(f["Last write time"])
+	m.MountCount = int(parseIntField(f["Mount count"]))
+	m.MaxMountCount = int(parseIntField(f["Maximum mount count"]))
+	m.LastChecked = parseCTime(f["Last checked"])
+	m.CheckInterval = time.Duration(parseUintField(f["Check interval"])) * time.Second
+	m.NextCheck = parseCTime(f["Next check after"])
+	m.ErrorCount = int(parseIntField(f["FS Error count"]))
+	m.FirstErrorTime = parseCTime(f["First error time"])
+	m.FirstErrorFunction = f["First error function"]
+	m.LastErrorTime = parseCTime(f["Last error time"])
+	m.LastErrorFunction = f["Last error function"]
+
+	// Lifetime writes: 1234 GB, where the units are base 2
+	if v := strings.Replace(f["Lifetime writes"], " ", "", -1); len(v) > 0 {
+		if c, err := cap.ParseAs(v, cap.Base2); err == nil {
+			m.LifetimeWrites = *c
+		}
+	}
+
+	return m, nil
+}
+
+// noneValue returns an empty string for tune2fs' <none> and <not available>
+func noneValue(v string) string {
+	if strings.HasPrefix(v, "<") && strings.HasSuffix(v, ">") {
+		return ""
+	}
+
+	return v
+}
+
+// parseUintField parses the leading number of a field such as 0 (user root)
+func parseUintField(v string) uint64 {
+	n, _ := strconv.ParseUint(firstField(v), 10, 64)
+	return n
+}
+
+func parseIntField(v string) int64 {
+	n, _ := strconv.ParseInt(firstField(v), 10, 64)
+	return n
+}
+
+func firstField(v string) string {
+	if fields := strings.Fields(v); len(fields) > 0 {
+		return strings.TrimSuffix(fields[0], ",")
+	}
+
+	return ""
+}
+
+// parseCTime parses a ctime formatted time such as Tue Mar  1 10:00:00 2022
+// in the local timezone. n/a and unparsable times are zero
+func parseCTime(v string) time.Time {
+	t, err := time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.Join(strings.Fields(v), " "), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
@@ -0,0 +1,203 @@
+//+build linux
+
+package disk
+
+import (
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFsMetaFixture(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "fsmeta", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestParseTune2fs(t *testing.T) {
+	for name, want := range map[string]struct {
+		version, volume, state      string
+		blocks, reserved            uint64
+		mounts, maxMounts, errCount int
+		interval                    time.Duration
+		writes                      cap.Capacity
+		csum, hasErrors, exceeded   bool
+	}{
+		"tune2fs_centos7.txt": {
+			"1.42.9", "", "clean", 262144, 13107, 21, 20, 0, 15552000 * time.Second, 852 << 20, false, false, true,
+		},
+		"tune2fs_ubuntu2004.txt": {
+			"1.45.5", "rootfs", "clean", 26214144, 1310707, 27, -1, 0, 0, 1234 << 30, true, false, false,
+		},
+		"tune2fs_debian12_errors.txt": {
+			"1.47.0", "data", "clean with errors", 244190208, 0, 4, 30, 3, 2592000 * time.Second, 18 << 40, true, true, false,
+		},
+	} {
+		m, err := ParseTune2fs(readFsMetaFixture(t, name))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		if m.Version != want.version || m.VolumeName != want.volume || m.State != want.state || m.BlockCount != want.blocks ||
+			m.ReservedBlockCount != want.reserved || m.BlockSize != 4096 {
+			t.Errorf("%s: unexpected superblock %+v", name, m)
+		}
+
+		if m.MountCount != want.mounts || m.MaxMountCount != want.maxMounts || m.ErrorCount != want.errCount ||
+			m.CheckInterval != want.interval || m.LifetimeWrites != want.writes {
+			t.Errorf("%s: unexpected counts %+v", name, m)
+		}
+
+		if m.HasFeature("metadata_csum") != want.csum || m.HasErrors() != want.hasErrors ||
+			m.MountCountExceeded() != want.exceeded {
+			t.Errorf("%s: unexpected features %v or errors %v", name, m.Features, m.HasErrors())
+		}
+
+		if !m.HasFeature("has_journal") || m.ReservedSize() != cap.Capacity(want.reserved*4096) {
+			t.Errorf("%s: unexpected features %v or reserved size %d", name, m.Features, m.ReservedSize())
+		}
+	}
+
+	m, _ := ParseTune2fs(readFsMetaFixture(t, "tune2fs_centos7.txt"))
+
+	if !m.LastChecked.Equal(time.Date(2015, 6, 4, 14, 22, 31, 0, time.Local)) ||
+		!m.NextCheck.Equal(time.Date(2015, 12, 1, 13, 22, 31, 0, time.Local)) || m.LastMountedOn != "/boot" {
+		t.Errorf("unexpected check times %s and %s", m.LastChecked, m.NextCheck)
+	}
+
+	if !m.CheckOverdue(time.Date(2016, 1, 1, 0, 0, 0, 0, time.Local)) || m.CheckOverdue(m.LastChecked.Add(time.Hour)) {
+		t.Error("expected the check to be overdue after 6 months")
+	}
+
+	if m.Fields["Directory Hash Seed"] != "9a1e6b52-3c4d-4f8e-a0b1-c2d3e4f5a6b7" || m.Fields["Inode size"] != "256" {
+		t.Errorf("unexpected fields %v", m.Fields)
+	}
+
+	m, _ = ParseTune2fs(readFsMetaFixture(t, "tune2fs_debian12_errors.txt"))
+
+	if m.FirstErrorFunction != "ext4_lookup" || m.LastErrorFunction != "ext4_journal_check_start" ||
+		!m.FirstErrorTime.Equal(time.Date(2024, 9, 29, 4, 2, 17, 0, time.Local)) ||
+		!m.LastErrorTime.Equal(time.Date(2024, 10, 3, 2, 11, 9, 0, time.Local)) || m.ErrorsBehavior != "Remount read-only" {
+		t.Errorf("unexpected errors %+v", m)
+	}
+
+	if _, err := ParseTune2fs("tune2fs 1.47.0 (5-Feb-2023)\ntune2fs: Bad magic number in super-block\n"); err == nil {
+		t.Error("expected an error without a superblock")
+	}
+}
+
+func TestParseXFSInfo(t *testing.T) {
+	for name, want := range map[string]struct {
+		device, log              string
+		agCount                  int
+		blocks, logBlocks, sunit uint64
+		sectSize                 cap.Capacity
+		reflink, bigtime, sparse bool
+	}{
+		"xfs_info_centos7.txt":    {"/dev/mapper/centos-root", "internal", 4, 11533312, 5631, 0, 512, false, false, false},
+		"xfs_info_ubuntu2204.txt": {"/dev/sdb1", "internal log", 32, 976754646, 476930, 128, 4096, true, false, true},
+		"xfs_info_debian12.txt":   {"/dev/nvme0n1p2", "/dev/nvme1n1p1", 4, 26214144, 16384, 0, 512, true, true, true},
+	} {
+		m, err := ParseXFSInfo(readFsMetaFixture(t, name))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		if m.Device != want.device || m.LogDevice != want.log || m.AGCount != want.agCount || m.Blocks != want.blocks ||
+			m.LogBlocks != want.logBlocks || m.StripeUnit != want.sunit || m.SectorSize != want.sectSize {
+			t.Errorf("%s: unexpected geometry %+v", name, m)
+		}
+
+		if m.Reflink != want.reflink || m.BigTime != want.bigtime || m.SparseInodes != want.sparse || !m.CRC || !m.FType {
+			t.Errorf("%s: unexpected features %+v", name, m)
+		}
+
+		if m.BlockSize != 4096 || m.Size != cap.Capacity(want.blocks*4096) || m.LogSize != cap.Capacity(want.logBlocks*4096) ||
+			m.NamingVersion != "2" || m.LogVersion != 2 || !m.LazyCount || m.RealtimeDevice != "none" || m.InodeSize != 512 {
+			t.Errorf("%s: unexpected sizes %+v", name, m)
+		}
+
+		if m.HasLogInternal() != strings.HasPrefix(want.log, "internal") {
+			t.Errorf("%s: unexpected log device %s", name, m.LogDevice)
+		}
+	}
+
+	m, _ := ParseXFSInfo(readFsMetaFixture(t, "xfs_info_ubuntu2204.txt"))
+	if m.StripeWidth != 384 || m.InodeMaxPercent != 5 || m.Fields["meta-data"]["inobtcount"] != "0" || m.Fields["log"]["sunit"] != "1" {
+		t.Errorf("unexpected fields %v", m.Fields)
+	}
+
+	if _, err := ParseXFSInfo("xfs_info: /dev/sda1 is not a mounted XFS filesystem\n"); err == nil {
+		t.Error("expected an error without geometry")
+	}
+}
+
+func TestReadXFSSysfs(t *testing.T) {
+	root := writeFakeTree(t, map[string]string{
+		"sys/fs/xfs/sdb1/stats/stats":                                 readFsMetaFixture(t, "xfs_stats.txt"),
+		"sys/fs/xfs/sdb1/error/fail_at_unmount":                       "1\n",
+		"sys/fs/xfs/sdb1/error/metadata/EIO/max_retries":              "-1\n",
+		"sys/fs/xfs/sdb1/error/metadata/EIO/retry_timeout_seconds":    "-1\n",
+		"sys/fs/xfs/sdb1/error/metadata/ENOSPC/max_retries":           "-1\n",
+		"sys/fs/xfs/sdb1/error/metadata/ENOSPC/retry_timeout_seconds": "-1\n",
+		"sys/fs/xfs/sdb1/error/metadata/ENODEV/max_retries":           "0\n",
+		"sys/fs/xfs/sdb1/error/metadata/ENODEV/retry_timeout_seconds": "30\n",
+	})
+
+	inv := &Inventory{opts: newOptions(WithRoot(root))}
+
+	m, err := ParseXFSInfo(readFsMetaFixture(t, "xfs_info_ubuntu2204.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv.readXFSSysfs("sdb1", m)
+
+	s := m.Stats
+	if s == nil || s.WriteCalls != 92381734 || s.ReadCalls != 153018233 || s.ReadBytes != 2146230661120 ||
+		s.WriteBytes != 491213840384 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	if s.LogWrites != 1218393 || s.LogBlocks != 64019838 || s.LogNoIclogs != 17 || s.LogForces != 4109231 ||
+		len(s.Counters["abtb2"]) != 15 {
+		t.Errorf("unexpected log stats %+v", s)
+	}
+
+	c := m.ErrorConfig
+	if c == nil || !c.FailAtUnmount || len(c.Metadata) != 3 {
+		t.Fatalf("unexpected error config %+v", c)
+	}
+
+	if r := c.Metadata["ENODEV"]; r.MaxRetries != 0 || r.RetryTimeout != 30*time.Second {
+		t.Errorf("unexpected ENODEV retry %+v", r)
+	}
+
+	if r := c.Metadata["EIO"]; r.MaxRetries != -1 || r.RetryTimeout >= 0 {
+		t.Errorf("unexpected EIO retry %+v", r)
+	}
+
+	unmounted, _ := ParseXFSInfo(readFsMetaFixture(t, "xfs_info_centos7.txt"))
+	inv.readXFSSysfs("sdc1", unmounted)
+
+	if unmounted.Stats != nil || unmounted.ErrorConfig != nil {
+		t.Error("expected no sysfs for an unmounted filesystem")
+	}
+
+	p := &Partition{Name: "sdb1", Type: "xfs", Disk: &BlockDevice{}, XFS: m}
+	if !strings.Contains(p.String(), "log_device: internal log") {
+		t.Errorf("expected the partition to print its XFS metadata, got %s", p.String())
+	}
+
+	if err := (&Inventory{offline: true}).ReadPartitionFsMetadata(p); err == nil {
+		t.Error("expected an error for a snapshot")
+	}
+}
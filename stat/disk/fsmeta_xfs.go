@@ -0,0 +1,258 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"bufio"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sunit=0      swidth=0 blks, or attr=2, projid32bit=1
+var xfsInfoFieldRe = regexp.MustCompile(`([a-z][a-z0-9-]*)=([^\s,]+)`)
+
+// XFSMetadata is the geometry of an XFS filesystem as reported by xfs_info,
+// and its counters from sysfs if it's mounted
+type XFSMetadata struct {
+	Device          string       `yaml:"device" json:"device"`
+	InodeSize       cap.Capacity `yaml:"inode_size" json:"inode_size"`
+	AGCount         int          `yaml:"ag_count" json:"ag_count"`
+	AGBlocks        uint64       `yaml:"ag_blocks" json:"ag_blocks"`
+	SectorSize      cap.Capacity `yaml:"sector_size" json:"sector_size"`
+	CRC             bool         `yaml:"crc" json:"crc"`
+	FreeInodeBtree  bool         `yaml:"finobt" json:"finobt"`
+	SparseInodes    bool         `yaml:"sparse_inodes" json:"sparse_inodes"`
+	ReverseMap      bool         `yaml:"rmapbt" json:"rmapbt"`
+	Reflink         bool         `yaml:"reflink" json:"reflink"`
+	BigTime         bool         `yaml:"bigtime" json:"bigtime"`
+	BlockSize       cap.Capacity `yaml:"block_size" json:"block_size"`
+	Blocks          uint64       `yaml:"blocks" json:"blocks"`
+	Size            cap.Capacity `yaml:"size" json:"size"`
+	InodeMaxPercent int          `yaml:"imaxpct" json:"imaxpct"`
+	// StripeUnit and StripeWidth are in filesystem blocks
+	StripeUnit    uint64 `yaml:"stripe_unit" json:"stripe_unit"`
+	StripeWidth   uint64 `yaml:"stripe_width" json:"stripe_width"`
+	NamingVersion string `yaml:"naming_version" json:"naming_version"`
+	FType         bool   `yaml:"ftype" json:"ftype"`
+	// LogDevice is internal for a log inside the data device
+	LogDevice     string       `yaml:"log_device" json:"log_device"`
+	LogBlocks     uint64       `yaml:"log_blocks" json:"log_blocks"`
+	LogSize       cap.Capacity `yaml:"log_size" json:"log_size"`
+	LogVersion    int          `yaml:"log_version" json:"log_version"`
+	LogSectorSize cap.Capacity `yaml:"log_sector_size" json:"log_sector_size"`
+	LazyCount     bool         `yaml:"lazy_count" json:"lazy_count"`
+	// RealtimeDevice is none without a realtime section
+	RealtimeDevice string          `yaml:"realtime_device" json:"realtime_device"`
+	RealtimeBlocks uint64          `yaml:"realtime_blocks" json:"realtime_blocks"`
+	Stats          *XFSStats       `yaml:"stats,omitempty" json:"stats,omitempty"`
+	ErrorConfig    *XFSErrorConfig `yaml:"error_config,omitempty" json:"error_config,omitempty"`
+	// Fields holds every value of the report by section, e.g. Fields["log"]["bsize"].
+	// The value before the first key of a section, such as the device, is
+	// under the empty key
+	Fields map[string]map[string]string `yaml:"-" json:"-"`
+}
+
+// HasLogInternal returns true if the log is on the data device
+func (m *XFSMetadata) HasLogInternal() bool {
+	return strings.HasPrefix(m.LogDevice, "internal")
+}
+
+// XFSStats are the counters of a mounted XFS filesystem from
+// /sys/fs/xfs/<dev>/stats/stats. XFS doesn't count errors per filesystem, so
+// these are activity counters; see XFSErrorConfig for how errors are handled
+type XFSStats struct {
+	ReadCalls  uint64       `yaml:"read_calls" json:"read_calls"`
+	WriteCalls uint64       `yaml:"write_calls" json:"write_calls"`
+	ReadBytes  cap.Capacity `yaml:"read_bytes" json:"read_bytes"`
+	WriteBytes cap.Capacity `yaml:"write_bytes" json:"write_bytes"`
+	LogWrites  uint64       `yaml:"log_writes" json:"log_writes"`
+	LogBlocks  uint64       `yaml:"log_blocks" json:"log_blocks"`
+	// LogNoIclogs counts the times a log write waited for a free in-core log
+	// buffer, a sign of log contention
+	LogNoIclogs uint64 `yaml:"log_noiclogs" json:"log_noiclogs"`
+	LogForces   uint64 `yaml:"log_forces" json:"log_forces"`
+	// Counters holds every line of the stats file by name
+	Counters map[string][]uint64 `yaml:"-" json:"-"`
+}
+
+// XFSErrorRetry is how XFS retries a class of failed metadata writes
+type XFSErrorRetry struct {
+	// MaxRetries is -1 to retry forever
+	MaxRetries int `yaml:"max_retries" json:"max_retries"`
+	// RetryTimeout is negative to never time out
+	RetryTimeout time.Duration `yaml:"retry_timeout" json:"retry_timeout"`
+}
+
+// XFSErrorConfig is the error handling of a mounted XFS filesystem from
+// /sys/fs/xfs/<dev>/error
+type XFSErrorConfig struct {
+	FailAtUnmount bool `yaml:"fail_at_unmount" json:"fail_at_unmount"`
+	// Metadata is the retry behavior by error, e.g. EIO, ENOSPC and default
+	Metadata map[string]*XFSErrorRetry `yaml:"metadata" json:"metadata"`
+}
+
+// ParseXFSInfo parses the output of xfs_info, which looks like:
+//
+//	meta-data=/dev/sda1              isize=512    agcount=4, agsize=6553536 blks
+//	         =                       sectsz=4096  attr=2, projid32bit=1
+//	data     =                       bsize=4096   blocks=26214144, imaxpct=25
+func ParseXFSInfo(out string) (*XFSMetadata, error) {
+	m := &XFSMetadata{Fields: make(map[string]map[string]string)}
+
+	var section string
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+
+		// continuation lines start with spaces and belong to the section above
+		if !strings.HasPrefix(line, " ") {
+			section = strings.TrimSpace(line[:i])
+		}
+
+		if len(section) < 1 {
+			continue
+		}
+
+		fields, ok := m.Fields[section]
+		if !ok {
+			fields = make(map[string]string)
+			m.Fields[section] = fields
+		}
+
+		rest := line[i+1:]
+		matches := xfsInfoFieldRe.FindAllStringSubmatchIndex(rest, -1)
+
+		lead := rest
+		if len(matches) > 0 {
+			lead = rest[:matches[0][0]]
+		}
+
+		if lead = strings.TrimSpace(lead); len(lead) > 0 {
+			fields[""] = lead
+		}
+
+		for _, match := range matches {
+			fields[rest[match[2]:match[3]]] = rest[match[4]:match[5]]
+		}
+	}
+
+	meta, data := m.Fields["meta-data"], m.Fields["data"]
+	if meta == nil || data == nil {
+		return nil, fmt.Errorf("could not find xfs geometry in xfs_info output")
+	}
+
+	log, naming, rt := m.Fields["log"], m.Fields["naming"], m.Fields["realtime"]
+
+	m.Device = meta[""]
+	m.InodeSize = cap.Capacity(parseUintField(meta["isize"]))
+	m.AGCount = int(parseUintField(meta["agcount"]))
+	m.AGBlocks = parseUintField(meta["agsize"])
+	m.SectorSize = cap.Capacity(parseUintField(meta["sectsz"]))
+	m.CRC = meta["crc"] == "1"
+	m.FreeInodeBtree = meta["finobt"] == "1"
+	m.SparseInodes = meta["sparse"] == "1" || meta["spinodes"] == "1"
+	m.ReverseMap = meta["rmapbt"] == "1"
+	m.Reflink = meta["reflink"] == "1"
+	m.BigTime = meta["bigtime"] == "1"
+	m.BlockSize = cap.Capacity(parseUintField(data["bsize"]))
+	m.Blocks = parseUintField(data["blocks"])
+	m.Size = m.BlockSize.Mult(int64(m.Blocks))
+	m.InodeMaxPercent = int(parseUintField(data["imaxpct"]))
+	m.StripeUnit = parseUintField(data["sunit"])
+	m.StripeWidth = parseUintField(data["swidth"])
+	m.NamingVersion = strings.TrimPrefix(naming[""], "version ")
+	m.FType = naming["ftype"] == "1"
+	m.LogDevice = log[""]
+	m.LogBlocks = parseUintField(log["blocks"])
+	m.LogSize = cap.Capacity(parseUintField(log["bsize"])).Mult(int64(m.LogBlocks))
+	m.LogVersion = int(parseUintField(log["version"]))
+	m.LogSectorSize = cap.Capacity(parseUintField(log["sectsz"]))
+	m.LazyCount = log["lazy-count"] == "1"
+	m.RealtimeDevice = rt[""]
+	m.RealtimeBlocks = parseUintField(rt["blocks"])
+
+	return m, nil
+}
+
+// ParseXFSStats parses an XFS stats file, where each line is a name followed
+// by its counters
+func ParseXFSStats(out string) *XFSStats {
+	s := &XFSStats{Counters: make(map[string][]uint64)}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		values := make([]uint64, len(fields)-1)
+
+		for i, f := range fields[1:] {
+			values[i], _ = strconv.ParseUint(f, 10, 64)
+		}
+
+		s.Counters[fields[0]] = values
+	}
+
+	counter := func(name string, i int) uint64 {
+		if v := s.Counters[name]; i < len(v) {
+			return v[i]
+		}
+
+		return 0
+	}
+
+	// rw is write calls then read calls, xpc is xstrat, write and read bytes
+	s.WriteCalls = counter("rw", 0)
+	s.ReadCalls = counter("rw", 1)
+	s.WriteBytes = cap.Capacity(counter("xpc", 1))
+	s.ReadBytes = cap.Capacity(counter("xpc", 2))
+	s.LogWrites = counter("log", 0)
+	s.LogBlocks = counter("log", 1)
+	s.LogNoIclogs = counter("log", 2)
+	s.LogForces = counter("log", 3)
+
+	return s
+}
+
+// readXFSErrorConfig reads a /sys/fs/xfs/<dev>/error directory
+func readXFSErrorConfig(dir string) (*XFSErrorConfig, error) {
+	classes, err := ioutil.ReadDir(filepath.Join(dir, "metadata"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &XFSErrorConfig{
+		FailAtUnmount: readSysfsString(filepath.Join(dir, "fail_at_unmount")) == "1",
+		Metadata:      make(map[string]*XFSErrorRetry),
+	}
+
+	for _, class := range classes {
+		classDir := filepath.Join(dir, "metadata", class.Name())
+		if !class.IsDir() {
+			continue
+		}
+
+		timeout := parseIntField(readSysfsString(filepath.Join(classDir, "retry_timeout_seconds")))
+
+		c.Metadata[class.Name()] = &XFSErrorRetry{
+			MaxRetries:   int(parseIntField(readSysfsString(filepath.Join(classDir, "max_retries")))),
+			RetryTimeout: time.Duration(timeout) * time.Second,
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,306 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// diskLinkDirs are the directories udev links stable names to devices in
+var diskLinkDirs = []string{"by-id", "by-path", "by-uuid", "by-partuuid"}
+
+// DiskIdentity holds the identifiers of a disk or partition that stay the
+// same across reboots, unlike kernel names such as sdb
+type DiskIdentity struct {
+	// ByID, ByPath, ByUUID and ByPartUUID are the names of the links to the
+	// device in /dev/disk/by-id, by-path, by-uuid and by-partuuid
+	ByID       []string `yaml:"by_id,omitempty" json:"by_id,omitempty"`
+	ByPath     []string `yaml:"by_path,omitempty" json:"by_path,omitempty"`
+	ByUUID     []string `yaml:"by_uuid,omitempty" json:"by_uuid,omitempty"`
+	ByPartUUID []string `yaml:"by_partuuid,omitempty" json:"by_partuuid,omitempty"`
+	WWN        string   `yaml:"wwn,omitempty" json:"wwn,omitempty"`
+	Serial     string   `yaml:"serial,omitempty" json:"serial,omitempty"`
+	Model      string   `yaml:"model,omitempty" json:"model,omitempty"`
+	Vendor     string   `yaml:"vendor,omitempty" json:"vendor,omitempty"`
+	SASAddress string   `yaml:"sas_address,omitempty" json:"sas_address,omitempty"`
+	// Enclosure and Slot are the SES enclosure and the name of the slot the
+	// disk is in
+	Enclosure string `yaml:"enclosure,omitempty" json:"enclosure,omitempty"`
+	Slot      string `yaml:"slot,omitempty" json:"slot,omitempty"`
+}
+
+// links returns the link names of a /dev/disk directory
+func (i *DiskIdentity) links(dir string) *[]string {
+	switch dir {
+	case "by-id":
+		return &i.ByID
+	case "by-path":
+		return &i.ByPath
+	case "by-uuid":
+		return &i.ByUUID
+	default:
+		return &i.ByPartUUID
+	}
+}
+
+// Identifiers returns all of the identifiers, with links as /dev/disk paths
+func (i *DiskIdentity) Identifiers() []string {
+	var out []string
+
+	for _, dir := range diskLinkDirs {
+		for _, name := range *i.links(dir) {
+			out = append(out, filepath.Join("/dev/disk", dir, name))
+		}
+	}
+
+	for _, v := range []string{i.WWN, i.Serial, i.SASAddress} {
+		if len(v) > 0 {
+			out = append(out, v)
+		}
+	}
+
+	if len(i.Slot) > 0 {
+		out = append(out, i.Enclosure+":"+i.Slot)
+	}
+
+	return out
+}
+
+// Matches returns true if id is one of the identifiers. Links match by name or
+// path, WWNs and SAS addresses with or without a 0x, naa. or eui. prefix,
+// and slots as the slot name or enclosure:slot
+func (i *DiskIdentity) Matches(id string) bool {
+	if len(id) < 1 {
+		return false
+	}
+
+	dir, name := filepath.Split(id)
+
+	for _, d := range diskLinkDirs {
+		if len(dir) > 0 && filepath.Clean(dir) != filepath.Join("/dev/disk", d) {
+			continue
+		}
+
+		for _, link := range *i.links(d) {
+			if link == name {
+				return true
+			}
+		}
+	}
+
+	if len(dir) > 0 {
+		return false
+	}
+
+	if n := normalizeWWN(id); len(n) > 0 && (n == normalizeWWN(i.WWN) || n == normalizeWWN(i.SASAddress)) {
+		return true
+	}
+
+	if len(i.Serial) > 0 && strings.EqualFold(id, i.Serial) {
+		return true
+	}
+
+	return len(i.Slot) > 0 && (id == i.Slot || id == i.Enclosure+":"+i.Slot)
+}
+
+// normalizeWWN lower cases a WWN and strips its prefix
+func normalizeWWN(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+
+	for _, prefix := range []string{"wwn-", "0x", "naa.", "eui.", "t10."} {
+		v = strings.TrimPrefix(v, prefix)
+	}
+
+	return v
+}
+
+// readDiskLinks returns the names of the links in each /dev/disk directory
+// keyed by the kernel name of the device they point to
+func (inv *Inventory) readDiskLinks() map[string]*DiskIdentity {
+	out := make(map[string]*DiskIdentity)
+
+	for _, dir := range diskLinkDirs {
+		path := inv.opts.hostPath(filepath.Join("/dev/disk", dir))
+
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			continue
+		}
+
+		for _, fi := range files {
+			if fi.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+
+			target, err := os.Readlink(filepath.Join(path, fi.Name()))
+			if err != nil {
+				continue
+			}
+
+			name := filepath.Base(target)
+
+			id, ok := out[name]
+			if !ok {
+				id = new(DiskIdentity)
+				out[name] = id
+			}
+
+			links := id.links(dir)
+			*links = append(*links, fi.Name())
+		}
+	}
+
+	for _, id := range out {
+		for _, dir := range diskLinkDirs {
+			sort.Strings(*id.links(dir))
+		}
+	}
+
+	return out
+}
+
+// sysfsDir returns the sysfs directory of a disk or partition
+func (inv *Inventory) sysfsDir(name, parent string) string {
+	dir := inv.opts.hostPath(filepath.Join("/sys/class/block", name))
+
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+
+	return inv.opts.hostPath(filepath.Join("/sys/block", parent, name))
+}
+
+// readSysfsString reads a sysfs attribute with its whitespace trimmed
+func readSysfsString(paths ...string) string {
+	for _, path := range paths {
+		if b, err := ioutil.ReadFile(path); err == nil {
+			if v := strings.TrimSpace(string(b)); len(v) > 0 {
+				return v
+			}
+		}
+	}
+
+	return ""
+}
+
+// readDiskIdentity reads the identity of a disk from its links, sysfs and the
+// values ghw read from udev
+func (inv *Inventory) readDiskIdentity(d *BlockDevice, links map[string]*DiskIdentity) *DiskIdentity {
+	id, ok := links[d.Name]
+	if !ok {
+		id = new(DiskIdentity)
+	}
+
+	dir := inv.sysfsDir(d.Name, "")
+	device := filepath.Join(dir, "device")
+
+	id.WWN = d.WWN
+	if len(id.WWN) < 1 || id.WWN == "unknown" {
+		id.WWN = readSysfsString(filepath.Join(dir, "wwid"), filepath.Join(device, "wwid"))
+	}
+
+	id.Serial = d.SerialNumber
+	if len(id.Serial) < 1 || id.Serial == "unknown" {
+		id.Serial = readSysfsString(filepath.Join(device, "serial"))
+	}
+
+	// SCSI disks only have the unit serial number VPD page
+	if len(id.Serial) < 1 {
+		if b, err := ioutil.ReadFile(filepath.Join(device, "vpd_pg80")); err == nil {
+			id.Serial, _ = parseSCSISerialVPD(b)
+		}
+	}
+
+	id.Model = d.Model
+	if len(id.Model) < 1 || id.Model == "unknown" {
+		id.Model = readSysfsString(filepath.Join(device, "model"))
+	}
+
+	id.Vendor = d.Vendor
+	if len(id.Vendor) < 1 || id.Vendor == "unknown" {
+		id.Vendor = readSysfsString(filepath.Join(device, "vendor"))
+	}
+
+	id.SASAddress = readSysfsString(filepath.Join(device, "sas_address"))
+
+	// SCSI disks in an SES enclosure link to their slot as
+	// enclosure_device:<slot name> -> .../enclosure/<enclosure>/<slot name>
+	if matches, _ := filepath.Glob(filepath.Join(device, "enclosure_device:*")); len(matches) > 0 {
+		id.Slot = strings.TrimPrefix(filepath.Base(matches[0]), "enclosure_device:")
+
+		if target, err := os.Readlink(matches[0]); err == nil {
+			id.Enclosure = filepath.Base(filepath.Dir(target))
+		}
+	}
+
+	return id
+}
+
+// GetDiskFromIdentifier gets the disk with the given kernel name or stable
+// identifier, see DiskIdentity.Matches
+func (inv *Inventory) GetDiskFromIdentifier(id string) (*BlockDevice, error) {
+	if d, err := inv.GetDiskFromLabel(id); err == nil {
+		return d, nil
+	}
+
+	var found []*BlockDevice
+
+	for _, d := range inv.Disks {
+		if d.Identity != nil && d.Identity.Matches(id) {
+			found = append(found, d)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("could not find disk with identifier %s", id)
+	case 1:
+		return found[0], nil
+	}
+
+	return nil, fmt.Errorf("identifier %s matches %d disks", id, len(found))
+}
+
+// GetPartitionFromIdentifier gets the partition with the given kernel name
+// or stable identifier, see DiskIdentity.Matches
+func (inv *Inventory) GetPartitionFromIdentifier(id string) (*Partition, error) {
+	if p, ok := inv.partNameMap[strings.TrimPrefix(id, "/dev/")]; ok {
+		return p, nil
+	}
+
+	var found []*Partition
+
+	for _, d := range inv.Disks {
+		for _, p := range d.Partitions {
+			if p.Identity != nil && p.Identity.Matches(id) {
+				found = append(found, p)
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("could not find partition with identifier %s", id)
+	case 1:
+		return found[0], nil
+	}
+
+	return nil, fmt.Errorf("identifier %s matches %d partitions", id, len(found))
+}
+
+// GetDiskFromIdentifier gets the disk with the given kernel name or stable
+// identifier from the default inventory
+func GetDiskFromIdentifier(id string) (*BlockDevice, error) {
+	return defaultInventory().GetDiskFromIdentifier(id)
+}
+
+// GetPartitionFromIdentifier gets the partition with the given kernel name or
+// stable identifier from the default inventory
+func GetPartitionFromIdentifier(id string) (*Partition, error) {
+	return defaultInventory().GetPartitionFromIdentifier(id)
+}
@@ -0,0 +1,114 @@
+//+build linux
+
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskIdentity(t *testing.T) {
+	files := map[string]string{
+		"sys/class/block/sda/device/sas_address":    "0x5000c500a1b2c3d5\n",
+		"sys/class/block/sda/device/wwid":           "naa.5000c500a1b2c3d4\n",
+		"sys/class/block/sda/device/model":          "ST4000NM0023    \n",
+		"sys/class/block/sda/device/vendor":         "SEAGATE \n",
+		"sys/class/enclosure/0:0:12:0/Slot 04/slot": "4\n",
+	}
+
+	for name, content := range fakeFiles {
+		files[name] = content
+	}
+
+	root := writeFakeTree(t, files)
+
+	vpd := filepath.Join(root, "sys/class/block/sda/device/vpd_pg80")
+	if err := os.WriteFile(vpd, readHexFixture(t, "scsi_serial_vpd.hex"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		"dev/disk/by-id/scsi-35000c500a1b2c3d4":                 "../../sda",
+		"dev/disk/by-id/wwn-0x5000c500a1b2c3d4":                 "../../sda",
+		"dev/disk/by-id/wwn-0x5000c500a1b2c3d4-part1":           "../../sda1",
+		"dev/disk/by-path/pci-0000:03:00.0-sas-phy4-lun-0":      "../../sda",
+		"dev/disk/by-uuid/0b7c7a2e-5d4e-4c1c-9f4b-1c2d3e4f5a6b": "../../sda1",
+		"dev/disk/by-partuuid/6e3a1f2b-01":                      "../../sda1",
+		"dev/disk/by-partuuid/6e3a1f2b-02":                      "../../sda2",
+		"sys/class/block/sda/device/enclosure_device:Slot 04":   "../../../../../../class/enclosure/0:0:12:0/Slot 04",
+	}
+
+	for name, target := range links {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := NewInventory(WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := inv.Disks[0].Identity
+
+	if len(id.ByID) != 2 || len(id.ByPath) != 1 || id.WWN != "naa.5000c500a1b2c3d4" || id.Serial != "Z1Z2ABCD0000C4261234" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+
+	if id.Model != "ST4000NM0023" || id.Vendor != "SEAGATE" || id.SASAddress != "0x5000c500a1b2c3d5" {
+		t.Errorf("unexpected model %q, vendor %q or sas address %q", id.Model, id.Vendor, id.SASAddress)
+	}
+
+	if id.Enclosure != "0:0:12:0" || id.Slot != "Slot 04" {
+		t.Errorf("unexpected enclosure %q and slot %q", id.Enclosure, id.Slot)
+	}
+
+	for _, v := range []string{
+		"sda",
+		"/dev/sda",
+		"scsi-35000c500a1b2c3d4",
+		"/dev/disk/by-id/wwn-0x5000c500a1b2c3d4",
+		"/dev/disk/by-path/pci-0000:03:00.0-sas-phy4-lun-0",
+		"0x5000C500A1B2C3D4",
+		"5000c500a1b2c3d5",
+		"z1z2abcd0000c4261234",
+		"Slot 04",
+		"0:0:12:0:Slot 04",
+	} {
+		if d, err := inv.GetDiskFromIdentifier(v); err != nil || d.Name != "sda" {
+			t.Errorf("expected %q to find sda: %v", v, err)
+		}
+	}
+
+	for _, v := range []string{"/dev/disk/by-uuid/scsi-35000c500a1b2c3d4", "Slot 05", "sdb"} {
+		if _, err := inv.GetDiskFromIdentifier(v); err == nil {
+			t.Errorf("expected %q not to find a disk", v)
+		}
+	}
+
+	for v, want := range map[string]string{
+		"/dev/disk/by-uuid/0b7c7a2e-5d4e-4c1c-9f4b-1c2d3e4f5a6b": "sda1",
+		"6e3a1f2b-02":                  "sda2",
+		"wwn-0x5000c500a1b2c3d4-part1": "sda1",
+		"/dev/sda2":                    "sda2",
+	} {
+		if p, err := inv.GetPartitionFromIdentifier(v); err != nil || p.Name != want {
+			t.Errorf("expected %q to find %s: %v", v, want, err)
+		}
+	}
+
+	if p := inv.Disks[0].Partitions[0]; len(p.Identity.Identifiers()) != 3 {
+		t.Errorf("unexpected partition identifiers %v", p.Identity.Identifiers())
+	}
+}
@@ -0,0 +1,416 @@
+//+build linux
+
+package disk
+
+import (
+	"bufio"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sectorSize is the unit of the sector counters in diskstats regardless of
+// the device's actual sector size
+const sectorSize = 512
+
+// IOCounters are the cumulative I/O counters of a block device as documented
+// in the kernel's Documentation/admin-guide/iostats.rst
+type IOCounters struct {
+	Name             string `yaml:"name" json:"name"`
+	DevID            DevNum `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
+	IsPartition      bool   `yaml:"is_partition" json:"is_partition"`
+	ReadsCompleted   uint64 `yaml:"reads_completed" json:"reads_completed"`
+	ReadsMerged      uint64 `yaml:"reads_merged" json:"reads_merged"`
+	SectorsRead      uint64 `yaml:"sectors_read" json:"sectors_read"`
+	ReadTimeMs       uint64 `yaml:"read_time_ms" json:"read_time_ms"`
+	WritesCompleted  uint64 `yaml:"writes_completed" json:"writes_completed"`
+	WritesMerged     uint64 `yaml:"writes_merged" json:"writes_merged"`
+	SectorsWritten   uint64 `yaml:"sectors_written" json:"sectors_written"`
+	WriteTimeMs      uint64 `yaml:"write_time_ms" json:"write_time_ms"`
+	IOsInProgress    uint64 `yaml:"ios_in_progress" json:"ios_in_progress"`
+	IOTimeMs         uint64 `yaml:"io_time_ms" json:"io_time_ms"`
+	WeightedIOTimeMs uint64 `yaml:"weighted_io_time_ms" json:"weighted_io_time_ms"`
+	// discard counters are only reported by kernel 4.18+
+	DiscardsCompleted uint64 `yaml:"discards_completed,omitempty" json:"discards_completed,omitempty"`
+	DiscardsMerged    uint64 `yaml:"discards_merged,omitempty" json:"discards_merged,omitempty"`
+	SectorsDiscarded  uint64 `yaml:"sectors_discarded,omitempty" json:"sectors_discarded,omitempty"`
+	DiscardTimeMs     uint64 `yaml:"discard_time_ms,omitempty" json:"discard_time_ms,omitempty"`
+	// flush counters are only reported by kernel 5.5+
+	FlushesCompleted uint64 `yaml:"flushes_completed,omitempty" json:"flushes_completed,omitempty"`
+	FlushTimeMs      uint64 `yaml:"flush_time_ms,omitempty" json:"flush_time_ms,omitempty"`
+}
+
+// setFields sets the counters from the stat fields in kernel order. There
+// are 11, 15 or 17 fields depending on the kernel version
+func (c *IOCounters) setFields(fields []string) error {
+	if len(fields) < 11 {
+		return fmt.Errorf("expected at least 11 I/O stat fields, got %d", len(fields))
+	}
+
+	dst := []*uint64{
+		&c.ReadsCompleted, &c.ReadsMerged, &c.SectorsRead, &c.ReadTimeMs,
+		&c.WritesCompleted, &c.WritesMerged, &c.SectorsWritten, &c.WriteTimeMs,
+		&c.IOsInProgress, &c.IOTimeMs, &c.WeightedIOTimeMs,
+		&c.DiscardsCompleted, &c.DiscardsMerged, &c.SectorsDiscarded, &c.DiscardTimeMs,
+		&c.FlushesCompleted, &c.FlushTimeMs,
+	}
+
+	for i, f := range fields {
+		if i >= len(dst) {
+			break
+		}
+
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		*dst[i] = v
+	}
+
+	return nil
+}
+
+// ParseDiskStats parses the contents of /proc/diskstats. Lines look like:
+//
+//	8       0 sda 8793 2741 698316 4123 12400 9650 542786 20370 0 13112 26203 0 0 0 0 771 1708
+func ParseDiskStats(r io.Reader) ([]*IOCounters, error) {
+	var out []*IOCounters
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 {
+			continue
+		}
+
+		if len(fields) < 14 {
+			return nil, fmt.Errorf("invalid diskstats line: %s", scanner.Text())
+		}
+
+		devID, err := ParseDevNum(fields[0] + ":" + fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		c := &IOCounters{
+			Name:  fields[2],
+			DevID: devID,
+		}
+
+		if err = c.setFields(fields[3:]); err != nil {
+			return nil, err
+		}
+
+		out = append(out, c)
+	}
+
+	return out, scanner.Err()
+}
+
+// ParseBlockStat parses the contents of /sys/block/<dev>/stat, which holds the
+// same counters as /proc/diskstats without the device number and name
+func ParseBlockStat(name string, v string) (*IOCounters, error) {
+	c := &IOCounters{Name: name}
+
+	if err := c.setFields(strings.Fields(v)); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ReadBlockIOCounters reads the I/O counters of a single disk or partition
+// from /sys/class/block/<name>/stat
+func ReadBlockIOCounters(name string, opt ...Option) (*IOCounters, error) {
+	opts := newOptions(opt...)
+	dir := opts.hostPath(filepath.Join("/sys/class/block", strings.TrimPrefix(name, "/dev/")))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ParseBlockStat(filepath.Base(dir), string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	c.DevID, _ = readDevNum(filepath.Join(dir, "dev"))
+	c.IsPartition = isPartition(dir)
+
+	return c, nil
+}
+
+// isPartition returns true if the sysfs block dir is a partition
+func isPartition(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "partition"))
+	return err == nil
+}
+
+// IOSample holds the I/O counters of every block device at a point in time
+type IOSample struct {
+	Time     time.Time
+	Counters map[string]*IOCounters
+}
+
+// ReadIOSample reads the I/O counters of all disks and partitions from /proc/diskstats
+func ReadIOSample(opt ...Option) (*IOSample, error) {
+	opts := newOptions(opt...)
+
+	f, err := os.Open(opts.hostPath("/proc/diskstats"))
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	counters, err := ParseDiskStats(f)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &IOSample{
+		Time:     time.Now(),
+		Counters: make(map[string]*IOCounters, len(counters)),
+	}
+
+	for _, c := range counters {
+		c.IsPartition = isPartition(opts.hostPath(filepath.Join("/sys/class/block", c.Name)))
+		s.Counters[c.Name] = c
+	}
+
+	return s, nil
+}
+
+// IOStats are the I/O rates of a block device between two samples, matching
+// the extended statistics of iostat -x. Throughput is in bytes per second,
+// iostat's rkB/s, wkB/s and dkB/s are ReadKiBPerSec, WriteKiBPerSec and
+// DiscardKiBPerSec
+type IOStats struct {
+	Name               string        `yaml:"name" json:"name"`
+	DevID              DevNum        `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
+	IsPartition        bool          `yaml:"is_partition" json:"is_partition"`
+	Interval           time.Duration `yaml:"interval" json:"interval"`
+	ReadsPerSec        float64       `yaml:"reads_per_sec" json:"reads_per_sec"`
+	WritesPerSec       float64       `yaml:"writes_per_sec" json:"writes_per_sec"`
+	DiscardsPerSec     float64       `yaml:"discards_per_sec" json:"discards_per_sec"`
+	FlushesPerSec      float64       `yaml:"flushes_per_sec" json:"flushes_per_sec"`
+	ReadMergesPerSec   float64       `yaml:"read_merges_per_sec" json:"read_merges_per_sec"`
+	WriteMergesPerSec  float64       `yaml:"write_merges_per_sec" json:"write_merges_per_sec"`
+	ReadBytesPerSec    cap.Capacity  `yaml:"read_bytes_per_sec" json:"read_bytes_per_sec"`
+	WriteBytesPerSec   cap.Capacity  `yaml:"write_bytes_per_sec" json:"write_bytes_per_sec"`
+	DiscardBytesPerSec cap.Capacity  `yaml:"discard_bytes_per_sec" json:"discard_bytes_per_sec"`
+	AvgReadSize        cap.Capacity  `yaml:"avg_read_size" json:"avg_read_size"`
+	AvgWriteSize       cap.Capacity  `yaml:"avg_write_size" json:"avg_write_size"`
+	AvgDiscardSize     cap.Capacity  `yaml:"avg_discard_size" json:"avg_discard_size"`
+	AvgRequestSize     cap.Capacity  `yaml:"avg_request_size" json:"avg_request_size"`
+	AwaitMs            float64       `yaml:"await_ms" json:"await_ms"`
+	ReadAwaitMs        float64       `yaml:"read_await_ms" json:"read_await_ms"`
+	WriteAwaitMs       float64       `yaml:"write_await_ms" json:"write_await_ms"`
+	DiscardAwaitMs     float64       `yaml:"discard_await_ms" json:"discard_await_ms"`
+	FlushAwaitMs       float64       `yaml:"flush_await_ms" json:"flush_await_ms"`
+	QueueDepth         float64       `yaml:"queue_depth" json:"queue_depth"`
+	Utilization        float64       `yaml:"utilization" json:"utilization"`
+}
+
+// NewIOStats computes the I/O rates between the prev and cur counters of a
+// device taken interval apart
+func NewIOStats(prev, cur *IOCounters, interval time.Duration) *IOStats {
+	st := &IOStats{
+		Name:        cur.Name,
+		DevID:       cur.DevID,
+		IsPartition: cur.IsPartition,
+		Interval:    interval,
+	}
+
+	secs := interval.Seconds()
+	if secs <= 0 {
+		return st
+	}
+
+	reads := counterDelta(prev.ReadsCompleted, cur.ReadsCompleted)
+	writes := counterDelta(prev.WritesCompleted, cur.WritesCompleted)
+	discards := counterDelta(prev.DiscardsCompleted, cur.DiscardsCompleted)
+	flushes := counterDelta(prev.FlushesCompleted, cur.FlushesCompleted)
+	readSectors := counterDelta(prev.SectorsRead, cur.SectorsRead)
+	writeSectors := counterDelta(prev.SectorsWritten, cur.SectorsWritten)
+	discardSectors := counterDelta(prev.SectorsDiscarded, cur.SectorsDiscarded)
+	readTicks := counterDelta(prev.ReadTimeMs, cur.ReadTimeMs)
+	writeTicks := counterDelta(prev.WriteTimeMs, cur.WriteTimeMs)
+	discardTicks := counterDelta(prev.DiscardTimeMs, cur.DiscardTimeMs)
+	flushTicks := counterDelta(prev.FlushTimeMs, cur.FlushTimeMs)
+
+	st.ReadsPerSec = float64(reads) / secs
+	st.WritesPerSec = float64(writes) / secs
+	st.DiscardsPerSec = float64(discards) / secs
+	st.FlushesPerSec = float64(flushes) / secs
+	st.ReadMergesPerSec = float64(counterDelta(prev.ReadsMerged, cur.ReadsMerged)) / secs
+	st.WriteMergesPerSec = float64(counterDelta(prev.WritesMerged, cur.WritesMerged)) / secs
+	st.ReadBytesPerSec = cap.Capacity(float64(readSectors*sectorSize) / secs)
+	st.WriteBytesPerSec = cap.Capacity(float64(writeSectors*sectorSize) / secs)
+	st.DiscardBytesPerSec = cap.Capacity(float64(discardSectors*sectorSize) / secs)
+	st.AvgReadSize = cap.Capacity(ratio(readSectors*sectorSize, reads))
+	st.AvgWriteSize = cap.Capacity(ratio(writeSectors*sectorSize, writes))
+	st.AvgDiscardSize = cap.Capacity(ratio(discardSectors*sectorSize, discards))
+	st.AvgRequestSize = cap.Capacity(ratio((readSectors+writeSectors+discardSectors)*sectorSize, reads+writes+discards))
+	st.AwaitMs = ratio(readTicks+writeTicks+discardTicks, reads+writes+discards)
+	st.ReadAwaitMs = ratio(readTicks, reads)
+	st.WriteAwaitMs = ratio(writeTicks, writes)
+	st.DiscardAwaitMs = ratio(discardTicks, discards)
+	st.FlushAwaitMs = ratio(flushTicks, flushes)
+
+	ms := float64(interval) / float64(time.Millisecond)
+	st.QueueDepth = float64(counterDelta(prev.WeightedIOTimeMs, cur.WeightedIOTimeMs)) / ms
+	st.Utilization = float64(counterDelta(prev.IOTimeMs, cur.IOTimeMs)) / ms * 100
+
+	if st.Utilization > 100 {
+		st.Utilization = 100
+	}
+
+	return st
+}
+
+// ReadKiBPerSec returns the read throughput in KiB/s like iostat's rkB/s
+func (st *IOStats) ReadKiBPerSec() float64 {
+	return st.ReadBytesPerSec.KiB()
+}
+
+// WriteKiBPerSec returns the write throughput in KiB/s like iostat's wkB/s
+func (st *IOStats) WriteKiBPerSec() float64 {
+	return st.WriteBytesPerSec.KiB()
+}
+
+// DiscardKiBPerSec returns the discard throughput in KiB/s like iostat's
+// dkB/s
+func (st *IOStats) DiscardKiBPerSec() float64 {
+	return st.DiscardBytesPerSec.KiB()
+}
+
+// String implements stringer and returns a yaml formatted string
+func (st *IOStats) String() string {
+	b, err := yaml.Marshal(st)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// IOStatsList is a list of IOStats sorted by device name
+type IOStatsList []*IOStats
+
+// String implements stringer and returns a yaml formatted string
+func (l IOStatsList) String() string {
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// IOStatsBetween computes the I/O rates of every device present in both samples
+func IOStatsBetween(prev, cur *IOSample) IOStatsList {
+	var out IOStatsList
+
+	interval := cur.Time.Sub(prev.Time)
+
+	for name, c := range cur.Counters {
+		p, ok := prev.Counters[name]
+		if !ok {
+			// device appeared between the samples
+			continue
+		}
+
+		out = append(out, NewIOStats(p, c, interval))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// GetIOStats samples /proc/diskstats twice, sleepDur apart, and returns the
+// I/O rates of every disk and partition
+func GetIOStats(sleepDur time.Duration, opts ...Option) (IOStatsList, error) {
+	prev, err := ReadIOSample(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(sleepDur)
+
+	cur, err := ReadIOSample(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return IOStatsBetween(prev, cur), nil
+}
+
+// IOSampler computes I/O rates since the last time it was sampled
+type IOSampler struct {
+	opts []Option
+	prev *IOSample
+	mu   sync.Mutex
+}
+
+// NewIOSampler creates a new IOSampler and takes its first sample
+func NewIOSampler(opts ...Option) (*IOSampler, error) {
+	prev, err := ReadIOSample(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IOSampler{
+		opts: opts,
+		prev: prev,
+	}, nil
+}
+
+// Sample returns the I/O rates since the previous sample
+func (s *IOSampler) Sample() (IOStatsList, error) {
+	cur, err := ReadIOSample(s.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := IOStatsBetween(s.prev, cur)
+	s.prev = cur
+
+	return out, nil
+}
+
+// counterDelta returns the change of a counter, treating a decrease as the
+// counter having wrapped or been reset
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+
+	return cur - prev
+}
+
+func ratio(v, n uint64) float64 {
+	if n == 0 {
+		return 0
+	}
+
+	return float64(v) / float64(n)
+}
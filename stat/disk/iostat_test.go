@@ -0,0 +1,117 @@
+//+build linux
+
+package disk
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// diskstats from kernels with 11 (pre 4.18), 15 (4.18+) and 17 (5.5+) fields
+var sampleDiskStats = `   8       0 sda 1000 10 80000 2000 500 50 40000 3000 0 4000 5000
+   8       1 sda1 900 10 72000 1800 400 50 32000 2500 0 3500 4300 0 0 0 0
+ 259       0 nvme0n1 2000 0 160000 1000 1000 0 80000 2000 1 2500 3000 100 0 8000 50 20 40
+`
+
+var sampleDiskStatsLater = `   8       0 sda 1100 20 96000 2300 600 60 56000 3500 0 4500 5900
+   8       1 sda1 1000 20 88000 2100 450 55 36000 2700 0 3900 4800 0 0 0 0
+ 259       0 nvme0n1 4000 0 320000 2000 2000 0 240000 5000 2 3500 7000 150 0 16000 100 30 50
+`
+
+func TestParseDiskStats(t *testing.T) {
+	counters, err := ParseDiskStats(strings.NewReader(sampleDiskStats))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counters) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(counters))
+	}
+
+	nvme := counters[2]
+	if nvme.Name != "nvme0n1" || nvme.DevID != NewDevNum(259, 0) {
+		t.Errorf("unexpected device %s %s", nvme.Name, nvme.DevID)
+	}
+
+	if nvme.SectorsRead != 160000 || nvme.WeightedIOTimeMs != 3000 || nvme.SectorsDiscarded != 8000 ||
+		nvme.FlushesCompleted != 20 || nvme.FlushTimeMs != 40 {
+		t.Errorf("unexpected counters %+v", nvme)
+	}
+
+	if _, err = ParseDiskStats(strings.NewReader("8 0 sda 1 2 3\n")); err == nil {
+		t.Error("expected an error for a short line")
+	}
+}
+
+func TestParseBlockStat(t *testing.T) {
+	c, err := ParseBlockStat("sda", "    1000       10    80000     2000      500       50    40000     3000        0     4000     5000\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ReadsCompleted != 1000 || c.IOTimeMs != 4000 || c.DiscardsCompleted != 0 {
+		t.Errorf("unexpected counters %+v", c)
+	}
+}
+
+func TestIOStatsBetween(t *testing.T) {
+	prev, err := ParseDiskStats(strings.NewReader(sampleDiskStats))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cur, err := ParseDiskStats(strings.NewReader(sampleDiskStatsLater))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	prevSample := &IOSample{Time: now, Counters: map[string]*IOCounters{}}
+	curSample := &IOSample{Time: now.Add(time.Second), Counters: map[string]*IOCounters{}}
+
+	for _, c := range prev {
+		prevSample.Counters[c.Name] = c
+	}
+
+	for _, c := range cur {
+		curSample.Counters[c.Name] = c
+	}
+
+	stats := IOStatsBetween(prevSample, curSample)
+	if len(stats) != 3 || stats[0].Name != "nvme0n1" {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+
+	nvme := stats[0]
+
+	expect := map[string][2]float64{
+		"reads/s":    {nvme.ReadsPerSec, 2000},
+		"writes/s":   {nvme.WritesPerSec, 1000},
+		"discards/s": {nvme.DiscardsPerSec, 50},
+		"flushes/s":  {nvme.FlushesPerSec, 10},
+		"rkB/s":      {nvme.ReadKiBPerSec(), 80000},
+		"wkB/s":      {nvme.WriteKiBPerSec(), 80000},
+		"dkB/s":      {nvme.DiscardKiBPerSec(), 4000},
+		"rareq-sz":   {float64(nvme.AvgReadSize), 40960},
+		"wareq-sz":   {float64(nvme.AvgWriteSize), 81920},
+		"r_await":    {nvme.ReadAwaitMs, 0.5},
+		"w_await":    {nvme.WriteAwaitMs, 3},
+		"d_await":    {nvme.DiscardAwaitMs, 1},
+		"f_await":    {nvme.FlushAwaitMs, 1},
+		"await":      {nvme.AwaitMs, 4050.0 / 3050},
+		"aqu-sz":     {nvme.QueueDepth, 4},
+		"%util":      {nvme.Utilization, 100},
+	}
+
+	for name, v := range expect {
+		if v[0] != v[1] {
+			t.Errorf("%s: expected %v, got %v", name, v[1], v[0])
+		}
+	}
+
+	sda1 := stats[2]
+	if sda1.Name != "sda1" || sda1.ReadsPerSec != 100 || sda1.Utilization != 40 {
+		t.Errorf("unexpected partition stats %+v", sda1)
+	}
+}
@@ -0,0 +1,93 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// MountFlags are the flags a filesystem is mounted with as reported by statfs
+type MountFlags uint64
+
+const (
+	MountReadOnly MountFlags = 1 << iota
+	MountNoSUID
+	MountNoDev
+	MountNoExec
+	MountSynchronous
+	MountMandatoryLock
+	MountNoAtime
+	MountNoDirAtime
+	MountRelatime
+	MountNoSymFollow
+)
+
+var mountFlagNames = []struct {
+	flag MountFlags
+	name string
+}{
+	{MountReadOnly, "ro"},
+	{MountNoSUID, "nosuid"},
+	{MountNoDev, "nodev"},
+	{MountNoExec, "noexec"},
+	{MountSynchronous, "sync"},
+	{MountMandatoryLock, "mand"},
+	{MountNoAtime, "noatime"},
+	{MountNoDirAtime, "nodiratime"},
+	{MountRelatime, "relatime"},
+	{MountNoSymFollow, "nosymfollow"},
+}
+
+// Has returns true if all of the given flags are set
+func (f MountFlags) Has(flag MountFlags) bool {
+	return f&flag == flag
+}
+
+// Strings returns the flags as mount option names, starting with rw or ro
+func (f MountFlags) Strings() []string {
+	out := []string{"rw"}
+
+	for _, n := range mountFlagNames {
+		if !f.Has(n.flag) {
+			continue
+		}
+
+		if n.flag == MountReadOnly {
+			out[0] = n.name
+			continue
+		}
+
+		out = append(out, n.name)
+	}
+
+	return out
+}
+
+// String returns the flags as a comma separated list of mount options
+func (f MountFlags) String() string {
+	return strings.Join(f.Strings(), ",")
+}
+
+// MarshalYAML implements the yaml Marshaler
+func (f MountFlags) MarshalYAML() (interface{}, error) {
+	return f.Strings(), nil
+}
+
+// MarshalJSON implements the json Marshaler
+func (f MountFlags) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Strings())
+}
+
+// decodeMountFlags maps platform specific flag bits to MountFlags
+func decodeMountFlags(raw uint64, bits map[uint64]MountFlags) MountFlags {
+	var f MountFlags
+
+	for bit, flag := range bits {
+		if raw&bit != 0 {
+			f |= flag
+		}
+	}
+
+	return f
+}
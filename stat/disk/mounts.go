@@ -0,0 +1,398 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"bufio"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mount is a single entry of the mount table as described in proc(5) under
+// /proc/[pid]/mountinfo
+type Mount struct {
+	ID             int         `yaml:"id" json:"id"`
+	ParentID       int         `yaml:"parent_id" json:"parent_id"`
+	DevID          DevNum      `yaml:"dev_id" json:"dev_id"`
+	Root           string      `yaml:"root" json:"root"`
+	MountPoint     string      `yaml:"mount_point" json:"mount_point"`
+	Options        []string    `yaml:"options" json:"options"`
+	OptionalFields []string    `yaml:"optional_fields,omitempty" json:"optional_fields,omitempty"`
+	FsType         string      `yaml:"fs_type" json:"fs_type"`
+	Source         string      `yaml:"source" json:"source"`
+	SuperOptions   []string    `yaml:"super_options" json:"super_options"`
+	Propagation    string      `yaml:"propagation" json:"propagation"`
+	PeerGroup      int         `yaml:"peer_group,omitempty" json:"peer_group,omitempty"`
+	MasterGroup    int         `yaml:"master_group,omitempty" json:"master_group,omitempty"`
+	IsBind         bool        `yaml:"is_bind" json:"is_bind"`
+	BindSource     string      `yaml:"bind_source,omitempty" json:"bind_source,omitempty"`
+	Capacity       *FsCapacity `yaml:"capacity,omitempty" json:"capacity,omitempty"`
+	Parent         *Mount      `yaml:"-" json:"-"`
+}
+
+// String implements stringer and returns a yaml formatted string
+func (m *Mount) String() string {
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// HasOption returns true if the option is set on either the mount or the super block
+func (m *Mount) HasOption(opt string) bool {
+	for _, opts := range [][]string{m.Options, m.SuperOptions} {
+		for _, o := range opts {
+			if o == opt || strings.HasPrefix(o, opt+"=") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsReadOnly returns true if the mount is read-only
+func (m *Mount) IsReadOnly() bool {
+	return m.HasOption("ro")
+}
+
+// IsPseudo returns true if the mount is a kernel or memory backed filesystem
+// that doesn't store data on a device
+func (m *Mount) IsPseudo() bool {
+	return pseudoFsTypes[m.FsType]
+}
+
+// IsNetwork returns true if the mount is a network filesystem
+func (m *Mount) IsNetwork() bool {
+	if networkFsTypes[m.FsType] {
+		return true
+	}
+
+	return m.FsType == "fuse.sshfs" || m.FsType == "fuse.glusterfs" || m.FsType == "fuse.ceph"
+}
+
+// IsReal returns true if the mount stores data on a block device, a storage
+// pool or across the network
+func (m *Mount) IsReal() bool {
+	return !m.IsPseudo()
+}
+
+// pseudoFsTypes are the filesystem types that have no backing storage
+var pseudoFsTypes = map[string]bool{
+	"autofs":      true,
+	"binfmt_misc": true,
+	"bpf":         true,
+	"cgroup":      true,
+	"cgroup2":     true,
+	"configfs":    true,
+	"debugfs":     true,
+	"devfs":       true,
+	"devpts":      true,
+	"devtmpfs":    true,
+	"efivarfs":    true,
+	"fusectl":     true,
+	"hugetlbfs":   true,
+	"mqueue":      true,
+	"nsfs":        true,
+	"proc":        true,
+	"pstore":      true,
+	"ramfs":       true,
+	"rpc_pipefs":  true,
+	"securityfs":  true,
+	"selinuxfs":   true,
+	"sysfs":       true,
+	"tmpfs":       true,
+	"tracefs":     true,
+}
+
+// networkFsTypes are the filesystem types that are mounted over the network
+var networkFsTypes = map[string]bool{
+	"9p":        true,
+	"afs":       true,
+	"ceph":      true,
+	"cifs":      true,
+	"glusterfs": true,
+	"lustre":    true,
+	"nfs":       true,
+	"nfs4":      true,
+	"smb3":      true,
+	"smbfs":     true,
+}
+
+// Mounts is a mount table
+type Mounts []*Mount
+
+// String implements stringer and returns a yaml formatted string
+func (ms Mounts) String() string {
+	b, err := yaml.Marshal(ms)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// Filter returns the mounts fn returns true for
+func (ms Mounts) Filter(fn func(m *Mount) bool) Mounts {
+	var out Mounts
+
+	for _, m := range ms {
+		if fn(m) {
+			out = append(out, m)
+		}
+	}
+
+	return out
+}
+
+// Real returns the mounts that store data on a device, pool or network
+func (ms Mounts) Real() Mounts {
+	return ms.Filter((*Mount).IsReal)
+}
+
+// Pseudo returns the kernel and memory backed mounts
+func (ms Mounts) Pseudo() Mounts {
+	return ms.Filter((*Mount).IsPseudo)
+}
+
+// FromDir returns the mount with the longest mount point containing dir.
+// Later mounts over-mount earlier ones at the same point
+func (ms Mounts) FromDir(dir string) *Mount {
+	var found *Mount
+
+	dir = filepath.Clean(dir)
+
+	for _, m := range ms {
+		if !pathHasPrefix(dir, m.MountPoint) {
+			continue
+		}
+
+		if found == nil || len(m.MountPoint) >= len(found.MountPoint) {
+			found = m
+		}
+	}
+
+	return found
+}
+
+// GetMounts reads the host's mount table and attaches the capacity of every
+// mount. Mounts that can't be stat'd have no capacity
+func GetMounts(opt ...Option) (Mounts, error) {
+	opts := newOptions(opt...)
+
+	mounts, err := opts.readHostMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range mounts {
+		m.Capacity, _ = GetFSCapacity(opts.hostPath(m.MountPoint))
+	}
+
+	return mounts, nil
+}
+
+// GetMountFromDir gets the mount the given dir is on
+func GetMountFromDir(dir string, opt ...Option) (*Mount, error) {
+	mounts, err := GetMounts(opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	if m := mounts.FromDir(dir); m != nil {
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("could not find mount for %s", dir)
+}
+
+// hostMountInfoPath returns the mountinfo file of the host's mount namespace.
+// Under an alternate root /proc/self is the calling process, which is often in
+// a container with its own mounts, so the host's init process is read instead
+func (o *Options) hostMountInfoPath() string {
+	if filepath.Clean(o.Root) == "/" {
+		return "/proc/self/mountinfo"
+	}
+
+	return o.hostPath("/proc/1/mountinfo")
+}
+
+// readHostMounts reads the mount table of the host's mount namespace
+func (o *Options) readHostMounts() (Mounts, error) {
+	return ReadMounts(o.hostMountInfoPath())
+}
+
+// ReadHostMounts reads the host's mount table without the capacity of each
+// mount, which can block on unreachable network filesystems
+func ReadHostMounts(opt ...Option) (Mounts, error) {
+	return newOptions(opt...).readHostMounts()
+}
+
+// ReadMounts reads and parses a mountinfo file
+func ReadMounts(path string) (Mounts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return ParseMounts(f)
+}
+
+// ParseMounts parses the contents of a mountinfo file. Lines look like:
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func ParseMounts(r io.Reader) (Mounts, error) {
+	var out Mounts
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(strings.TrimSpace(line)) < 1 {
+			continue
+		}
+
+		m, err := parseMountLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, m)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	resolveMounts(out)
+
+	return out, nil
+}
+
+func parseMountLine(line string) (*Mount, error) {
+	var err error
+
+	fields := strings.Fields(line)
+
+	// the optional fields are terminated by a single hyphen
+	sep := -1
+
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+
+	if len(fields) < 6 || sep < 0 || len(fields) < sep+3 {
+		return nil, fmt.Errorf("invalid mountinfo line: %s", line)
+	}
+
+	m := &Mount{
+		Root:           unescapeMountPath(fields[3]),
+		MountPoint:     unescapeMountPath(fields[4]),
+		Options:        strings.Split(fields[5], ","),
+		OptionalFields: fields[6:sep],
+		FsType:         fields[sep+1],
+		Source:         unescapeMountPath(fields[sep+2]),
+		Propagation:    "private",
+	}
+
+	if m.ID, err = strconv.Atoi(fields[0]); err != nil {
+		return nil, err
+	}
+
+	if m.ParentID, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, err
+	}
+
+	if m.DevID, err = ParseDevNum(fields[2]); err != nil {
+		return nil, err
+	}
+
+	if len(fields) > sep+3 {
+		m.SuperOptions = strings.Split(fields[sep+3], ",")
+	}
+
+	if len(m.OptionalFields) < 1 {
+		m.OptionalFields = nil
+	}
+
+	var propagation []string
+
+	for _, f := range m.OptionalFields {
+		tag := strings.SplitN(f, ":", 2)
+
+		switch tag[0] {
+		case "shared":
+			propagation = append(propagation, "shared")
+			m.PeerGroup, _ = strconv.Atoi(tag[len(tag)-1])
+		case "master":
+			propagation = append(propagation, "slave")
+			m.MasterGroup, _ = strconv.Atoi(tag[len(tag)-1])
+		case "unbindable":
+			propagation = append(propagation, "unbindable")
+		}
+	}
+
+	if len(propagation) > 0 {
+		m.Propagation = strings.Join(propagation, ",")
+	}
+
+	return m, nil
+}
+
+// resolveMounts links mounts to their parents and marks bind mounts, which
+// are mounts of a part of a filesystem or of a filesystem that was already
+// mounted elsewhere
+func resolveMounts(mounts Mounts) {
+	byID := make(map[int]*Mount, len(mounts))
+
+	for _, m := range mounts {
+		byID[m.ID] = m
+	}
+
+	for i, m := range mounts {
+		m.Parent = byID[m.ParentID]
+
+		var src *Mount
+
+		for _, o := range mounts[:i] {
+			if o.DevID != m.DevID || !pathHasPrefix(m.Root, o.Root) {
+				continue
+			}
+
+			if src == nil || len(o.Root) > len(src.Root) {
+				src = o
+			}
+		}
+
+		if src == nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(src.Root, m.Root)
+		if err != nil {
+			continue
+		}
+
+		m.IsBind = true
+		m.BindSource = filepath.Join(src.MountPoint, rel)
+	}
+}
+
+var mountPathReplacer = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+// unescapeMountPath decodes the octal escapes the kernel uses for spaces, tabs,
+// newlines and backslashes in mount paths
+func unescapeMountPath(v string) string {
+	return mountPathReplacer.Replace(v)
+}
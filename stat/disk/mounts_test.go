@@ -0,0 +1,119 @@
+//+build linux
+
+package disk
+
+import (
+	"strings"
+	"testing"
+)
+
+var sampleMountInfo = `22 28 0:21 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+23 28 0:22 / /proc rw,nosuid,nodev,noexec,relatime shared:13 - proc proc rw
+28 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw,errors=remount-ro
+40 28 8:1 / /boot/efi rw,relatime shared:30 - vfat /dev/sda1 rw,fmask=0077,dmask=0077
+41 28 0:38 / /run rw,nosuid,nodev,noexec,relatime shared:5 - tmpfs tmpfs rw,size=1634596k,mode=755
+55 28 0:45 / /mnt/nfs rw,relatime shared:31 - nfs4 fileserver:/export rw,vers=4.2,addr=10.0.0.2
+56 28 8:2 /srv/data /mnt/my\040data rw,relatime master:1 - ext4 /dev/sda2 rw,errors=remount-ro
+57 28 0:46 / /tank rw,noatime shared:32 - zfs tank rw,xattr,noacl
+58 57 0:47 / /tank/home rw,noatime shared:33 - zfs tank/home rw,xattr,noacl
+59 28 0:48 / /var/lib/docker/overlay2/abc/merged rw,relatime - overlay overlay rw,lowerdir=/l,upperdir=/u,workdir=/w
+60 28 8:2 / /chroot/root ro,relatime unbindable - ext4 /dev/sda2 rw,errors=remount-ro
+`
+
+func TestParseMounts(t *testing.T) {
+	mounts, err := ParseMounts(strings.NewReader(sampleMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mounts) != 11 {
+		t.Fatalf("expected 11 mounts, got %d", len(mounts))
+	}
+
+	root := mounts[2]
+	if root.ID != 28 || root.ParentID != 1 || root.DevID != NewDevNum(8, 2) || root.MountPoint != "/" ||
+		root.FsType != "ext4" || root.Source != "/dev/sda2" || root.Propagation != "shared" || root.PeerGroup != 1 {
+		t.Errorf("unexpected root mount %+v", root)
+	}
+
+	if !root.HasOption("errors") || root.HasOption("ro") || root.IsBind {
+		t.Errorf("unexpected root mount options %v %v", root.Options, root.SuperOptions)
+	}
+
+	bind := mounts[6]
+	if bind.MountPoint != "/mnt/my data" || !bind.IsBind || bind.BindSource != "/srv/data" ||
+		bind.Propagation != "slave" || bind.MasterGroup != 1 || bind.Parent != root {
+		t.Errorf("unexpected bind mount %+v", bind)
+	}
+
+	chroot := mounts[10]
+	if !chroot.IsBind || chroot.BindSource != "/" || !chroot.IsReadOnly() || chroot.Propagation != "unbindable" {
+		t.Errorf("unexpected bind mount %+v", chroot)
+	}
+
+	if mounts[8].IsBind {
+		t.Error("zfs datasets should not be bind mounts")
+	}
+
+	if !mounts[5].IsNetwork() || mounts[5].IsPseudo() {
+		t.Error("expected nfs to be a real network mount")
+	}
+
+	real := mounts.Real()
+	if len(real) != 8 {
+		t.Errorf("expected 8 real mounts, got %d", len(real))
+	}
+
+	if len(mounts.Pseudo()) != 3 {
+		t.Errorf("expected 3 pseudo mounts, got %d", len(mounts.Pseudo()))
+	}
+
+	for dir, expect := range map[string]string{
+		"/tank/home/user": "/tank/home",
+		"/tank/homework":  "/tank",
+		"/etc":            "/",
+		"/mnt/nfs":        "/mnt/nfs",
+	} {
+		if m := mounts.FromDir(dir); m == nil || m.MountPoint != expect {
+			t.Errorf("expected %s to be on %s, got %v", dir, expect, m)
+		}
+	}
+
+	if _, err = ParseMounts(strings.NewReader("36 35 98:0 /mnt1 /mnt2 rw\n")); err == nil {
+		t.Error("expected an error for a line without a separator")
+	}
+}
+
+func TestGetMounts(t *testing.T) {
+	mounts, err := GetMounts()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	if m := mounts.FromDir("/"); m == nil || m.Capacity == nil {
+		t.Errorf("expected a root mount with capacity, got %v", m)
+	}
+}
+
+func TestGetMountsWithRoot(t *testing.T) {
+	root := writeFakeTree(t, map[string]string{
+		"proc/1/mountinfo": "28 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw\n" +
+			"40 28 8:1 / /data rw,relatime shared:30 - xfs /dev/sda1 rw\n",
+		// the mounts of the calling process, e.g. a container
+		"proc/self/mountinfo": "500 400 0:90 / / rw,relatime - overlay overlay rw\n",
+		"data/file":           "",
+	})
+
+	mounts, err := GetMounts(WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mounts) != 2 || mounts[0].Source != "/dev/sda2" {
+		t.Fatalf("expected the host's mounts, got %v", mounts)
+	}
+
+	if m := mounts.FromDir("/data/file"); m == nil || m.Source != "/dev/sda1" || m.Capacity == nil {
+		t.Errorf("expected /data on sda1 with capacity, got %v", m)
+	}
+}
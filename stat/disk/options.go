@@ -0,0 +1,85 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"github.com/jaypipes/ghw/pkg/option"
+	"path/filepath"
+)
+
+// Options control how the disk inventory is discovered
+type Options struct {
+	// Root is the directory the host's filesystem is mounted at, e.g. /host
+	// when running in a container. /proc, /sys and all mount points are
+	// resolved relative to it. Defaults to the GHW_CHROOT env var or /
+	Root string
+	// SnapshotPath is the path to a ghw snapshot tarball to build the
+	// inventory from instead of the running system
+	SnapshotPath string
+	// SMARTCache caches the disks' SMART data. Defaults to DefaultSMARTCache
+	SMARTCache *SMARTCache
+}
+
+// Option sets a value on Options
+type Option func(o *Options)
+
+// WithRoot sets an alternate root the host's filesystem is mounted at
+func WithRoot(dir string) Option {
+	return func(o *Options) {
+		o.Root = dir
+	}
+}
+
+// WithSnapshot loads the inventory from a ghw snapshot tarball
+func WithSnapshot(path string) Option {
+	return func(o *Options) {
+		o.SnapshotPath = path
+	}
+}
+
+// WithSMARTCache caches the disks' SMART data in c, e.g. to change the TTL
+// or not wake disks in standby
+func WithSMARTCache(c *SMARTCache) Option {
+	return func(o *Options) {
+		o.SMARTCache = c
+	}
+}
+
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		Root: option.EnvOrDefaultChroot(),
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if len(o.Root) < 1 {
+		o.Root = "/"
+	}
+
+	return o
+}
+
+// hostPath returns the given path relative to the root
+func (o *Options) hostPath(path string) string {
+	return filepath.Join(o.Root, path)
+}
+
+// hostDevicePath returns the device node of a name under /dev, or a path,
+// relative to the root
+func (o *Options) hostDevicePath(dev string) string {
+	return o.hostPath(devicePath(dev))
+}
+
+// ghwOptions returns the ghw options for the configured root
+func (o *Options) ghwOptions() []*option.Option {
+	opts := []*option.Option{option.WithChroot(o.Root)}
+
+	if len(o.SnapshotPath) > 0 {
+		// never run tools like blkid against local devices for a captured machine
+		opts = append(opts, option.WithDisableTools(), option.WithNullAlerter())
+	}
+
+	return opts
+}
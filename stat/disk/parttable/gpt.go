@@ -0,0 +1,292 @@
+package parttable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	gptSignature   = "EFI PART"
+	gptHeaderSize  = 92
+	gptMaxEntries  = 1024
+	gptEntryOffset = 32
+)
+
+// GUID is a GPT GUID, stored with its first three fields little endian
+type GUID [16]byte
+
+// String formats the GUID the way Linux tools print it
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10], g[10:16])
+}
+
+// IsZero returns true for an unused entry's type GUID
+func (g GUID) IsZero() bool {
+	return g == GUID{}
+}
+
+// ParseGUID parses a GUID in its string form
+func ParseGUID(v string) (GUID, error) {
+	var g GUID
+
+	var a uint32
+	var b, c uint16
+	var d, e []byte
+
+	s := strings.Replace(strings.TrimSpace(v), "-", " ", -1)
+
+	if n, err := fmt.Sscanf(s, "%08x %04x %04x %x %x", &a, &b, &c, &d, &e); err != nil || n != 5 ||
+		len(d) != 2 || len(e) != 6 {
+		return g, fmt.Errorf("%s is not a valid GUID", v)
+	}
+
+	binary.LittleEndian.PutUint32(g[0:4], a)
+	binary.LittleEndian.PutUint16(g[4:6], b)
+	binary.LittleEndian.PutUint16(g[6:8], c)
+	copy(g[8:10], d)
+	copy(g[10:16], e)
+
+	return g, nil
+}
+
+// GPTHeader is a primary or backup GPT header
+type GPTHeader struct {
+	Revision       uint32 `yaml:"revision" json:"revision"`
+	HeaderSize     uint32 `yaml:"header_size" json:"header_size"`
+	HeaderCRC      uint32 `yaml:"header_crc" json:"header_crc"`
+	CurrentLBA     uint64 `yaml:"current_lba" json:"current_lba"`
+	BackupLBA      uint64 `yaml:"backup_lba" json:"backup_lba"`
+	FirstUsableLBA uint64 `yaml:"first_usable_lba" json:"first_usable_lba"`
+	LastUsableLBA  uint64 `yaml:"last_usable_lba" json:"last_usable_lba"`
+	DiskGUID       GUID   `yaml:"-" json:"-"`
+	EntriesLBA     uint64 `yaml:"entries_lba" json:"entries_lba"`
+	NumEntries     uint32 `yaml:"num_entries" json:"num_entries"`
+	EntrySize      uint32 `yaml:"entry_size" json:"entry_size"`
+	EntriesCRC     uint32 `yaml:"entries_crc" json:"entries_crc"`
+	// HeaderValid and EntriesValid are true if the checksums match
+	HeaderValid  bool `yaml:"header_valid" json:"header_valid"`
+	EntriesValid bool `yaml:"entries_valid" json:"entries_valid"`
+
+	entries []byte
+}
+
+// Valid returns true if both the header and its entries checksums match
+func (h *GPTHeader) Valid() bool {
+	return h != nil && h.HeaderValid && h.EntriesValid
+}
+
+// hasGPTSignature returns true if there's a GPT header at the offset
+func hasGPTSignature(r io.ReaderAt, offset int64) bool {
+	b := make([]byte, len(gptSignature))
+
+	if offset < 0 {
+		return false
+	}
+
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return false
+	}
+
+	return string(b) == gptSignature
+}
+
+// readGPTHeader reads the header at an LBA and its entries, returning nil if
+// there isn't one
+func readGPTHeader(r io.ReaderAt, lba uint64, sectorSize int64) *GPTHeader {
+	b := make([]byte, sectorSize)
+	if _, err := r.ReadAt(b, int64(lba)*sectorSize); err != nil {
+		return nil
+	}
+
+	if string(b[:8]) != gptSignature {
+		return nil
+	}
+
+	le := binary.LittleEndian
+
+	h := &GPTHeader{
+		Revision:       le.Uint32(b[8:]),
+		HeaderSize:     le.Uint32(b[12:]),
+		HeaderCRC:      le.Uint32(b[16:]),
+		CurrentLBA:     le.Uint64(b[24:]),
+		BackupLBA:      le.Uint64(b[32:]),
+		FirstUsableLBA: le.Uint64(b[40:]),
+		LastUsableLBA:  le.Uint64(b[48:]),
+		EntriesLBA:     le.Uint64(b[72:]),
+		NumEntries:     le.Uint32(b[80:]),
+		EntrySize:      le.Uint32(b[84:]),
+		EntriesCRC:     le.Uint32(b[88:]),
+	}
+
+	copy(h.DiskGUID[:], b[56:72])
+
+	if h.HeaderSize >= gptHeaderSize && int64(h.HeaderSize) <= sectorSize {
+		hdr := append([]byte{}, b[:h.HeaderSize]...)
+		le.PutUint32(hdr[16:], 0)
+		h.HeaderValid = crc32.ChecksumIEEE(hdr) == h.HeaderCRC
+	}
+
+	if h.NumEntries > gptMaxEntries || h.EntrySize < 128 || h.EntrySize%8 != 0 || h.EntrySize > 1024 {
+		return h
+	}
+
+	h.entries = make([]byte, int(h.NumEntries)*int(h.EntrySize))
+
+	if _, err := r.ReadAt(h.entries, int64(h.EntriesLBA)*sectorSize); err != nil {
+		h.entries = nil
+		return h
+	}
+
+	h.EntriesValid = crc32.ChecksumIEEE(h.entries) == h.EntriesCRC
+
+	return h
+}
+
+// partitions returns the used entries of a header
+func (h *GPTHeader) partitions(t *Table) []*Partition {
+	var parts []*Partition
+
+	le := binary.LittleEndian
+
+	for i := 0; i < int(h.NumEntries) && len(h.entries) >= (i+1)*int(h.EntrySize); i++ {
+		e := h.entries[i*int(h.EntrySize):]
+
+		var typ, id GUID
+		copy(typ[:], e[0:16])
+		copy(id[:], e[16:32])
+
+		if typ.IsZero() {
+			continue
+		}
+
+		p := t.newPartition(i+1, le.Uint64(e[gptEntryOffset:]), le.Uint64(e[gptEntryOffset+8:]))
+		p.Type = typ.String()
+		p.TypeName = gptTypeNames[p.Type]
+		p.GUID = id.String()
+		p.Attributes = le.Uint64(e[48:])
+		p.Name = decodeUTF16(e[56:128])
+
+		parts = append(parts, p)
+	}
+
+	return parts
+}
+
+// decodeUTF16 decodes a NUL terminated UTF-16LE string
+func decodeUTF16(b []byte) string {
+	var u []uint16
+
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+
+		u = append(u, c)
+	}
+
+	return string(utf16.Decode(u))
+}
+
+// readGPT reads both GPT headers, using the primary unless only the backup
+// is valid
+func (t *Table) readGPT(r io.ReaderAt, size int64, mbr []byte, hasMBR bool) error {
+	lastLBA := uint64(size/t.SectorSize - 1)
+
+	t.Primary = readGPTHeader(r, 1, t.SectorSize)
+
+	if t.Primary != nil && t.Primary.HeaderValid && t.Primary.BackupLBA != lastLBA {
+		t.Backup = readGPTHeader(r, t.Primary.BackupLBA, t.SectorSize)
+	}
+
+	if t.Backup == nil {
+		t.Backup = readGPTHeader(r, lastLBA, t.SectorSize)
+	}
+
+	use := t.Primary
+
+	switch {
+	case t.Primary.Valid():
+	case t.Backup.Valid():
+		use = t.Backup
+	case t.Primary == nil && t.Backup == nil:
+		return ErrInvalidGPT
+	case t.Primary == nil:
+		use = t.Backup
+	}
+
+	t.checkGPT(lastLBA, mbr, hasMBR)
+
+	t.header = use
+	t.ID = use.DiskGUID.String()
+	t.Partitions = use.partitions(t)
+
+	return nil
+}
+
+// checkGPT reports checksum errors and differences between the headers
+func (t *Table) checkGPT(lastLBA uint64, mbr []byte, hasMBR bool) {
+	if !hasMBR || !hasProtectiveMBR(mbr) {
+		t.problem("no protective MBR")
+	}
+
+	for _, h := range []struct {
+		name string
+		h    *GPTHeader
+	}{{"primary", t.Primary}, {"backup", t.Backup}} {
+		switch {
+		case h.h == nil:
+			t.problem("%s GPT header not found", h.name)
+			continue
+		case !h.h.HeaderValid:
+			t.problem("%s GPT header checksum is invalid", h.name)
+		case h.h.entries == nil:
+			t.problem("%s GPT partition entries can't be read", h.name)
+		case !h.h.EntriesValid:
+			t.problem("%s GPT partition entries checksum is invalid", h.name)
+		}
+	}
+
+	p, b := t.Primary, t.Backup
+
+	if b != nil && b.CurrentLBA != lastLBA {
+		t.problem("backup GPT header is at LBA %d instead of the last LBA %d", b.CurrentLBA, lastLBA)
+	}
+
+	if p == nil || b == nil {
+		return
+	}
+
+	if p.CurrentLBA != 1 || b.BackupLBA != p.CurrentLBA || p.BackupLBA != b.CurrentLBA {
+		t.problem("GPT headers don't point at each other")
+	}
+
+	for _, f := range []struct {
+		name string
+		p, b interface{}
+	}{
+		{"disk GUID", p.DiskGUID, b.DiskGUID},
+		{"first usable LBA", p.FirstUsableLBA, b.FirstUsableLBA},
+		{"last usable LBA", p.LastUsableLBA, b.LastUsableLBA},
+		{"number of entries", p.NumEntries, b.NumEntries},
+		{"entry size", p.EntrySize, b.EntrySize},
+		{"entries checksum", p.EntriesCRC, b.EntriesCRC},
+	} {
+		if f.p != f.b {
+			t.problem("backup GPT header %s %v doesn't match the primary %v", f.name, f.b, f.p)
+		}
+	}
+
+	if p.EntriesValid && b.EntriesValid && !bytes.Equal(p.entries, b.entries) {
+		t.problem("backup GPT partition entries don't match the primary")
+	}
+}
@@ -0,0 +1,152 @@
+package parttable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	mbrSize         = 512
+	mbrEntriesStart = 446
+	mbrEntrySize    = 16
+	// mbrMaxLogical stops a looping chain of extended boot records
+	mbrMaxLogical = 128
+
+	mbrTypeProtective = 0xee
+)
+
+// mbrEntry is a partition entry of an MBR or EBR
+type mbrEntry struct {
+	status  byte
+	typ     byte
+	start   uint32
+	sectors uint32
+}
+
+func parseMBREntries(b []byte) [4]mbrEntry {
+	var out [4]mbrEntry
+
+	for i := range out {
+		e := b[mbrEntriesStart+i*mbrEntrySize:]
+
+		out[i] = mbrEntry{
+			status:  e[0],
+			typ:     e[4],
+			start:   binary.LittleEndian.Uint32(e[8:]),
+			sectors: binary.LittleEndian.Uint32(e[12:]),
+		}
+	}
+
+	return out
+}
+
+// isExtended returns true for the types of extended partitions
+func (e mbrEntry) isExtended() bool {
+	return e.typ == 0x05 || e.typ == 0x0f || e.typ == 0x85
+}
+
+// hasProtectiveMBR returns true if the MBR has a GPT protective partition
+func hasProtectiveMBR(mbr []byte) bool {
+	for _, e := range parseMBREntries(mbr) {
+		if e.typ == mbrTypeProtective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newMBRPartition returns a partition for an entry starting at an LBA
+func (t *Table) newMBRPartition(number int, e mbrEntry, start uint64) *Partition {
+	p := t.newPartition(number, start, start+uint64(e.sectors)-1)
+	p.Type = fmt.Sprintf("0x%02x", e.typ)
+	p.TypeName = mbrTypeNames[e.typ]
+	p.Bootable = e.status == 0x80
+
+	return p
+}
+
+// readMBR reads the primary partitions and follows the chain of extended
+// boot records in an extended partition
+func (t *Table) readMBR(r io.ReaderAt, mbr []byte) error {
+	t.ID = fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(mbr[440:]))
+
+	var extended *Partition
+
+	for i, e := range parseMBREntries(mbr) {
+		if e.typ == 0 || e.sectors == 0 {
+			continue
+		}
+
+		if e.status != 0 && e.status != 0x80 {
+			t.problem("partition %d has an invalid status 0x%02x", i+1, e.status)
+		}
+
+		p := t.newMBRPartition(i+1, e, uint64(e.start))
+		t.Partitions = append(t.Partitions, p)
+
+		if !e.isExtended() {
+			continue
+		}
+
+		p.Extended = true
+
+		if extended != nil {
+			t.problem("partitions %d and %d are both extended", extended.Number, p.Number)
+			continue
+		}
+
+		extended = p
+	}
+
+	if extended == nil {
+		return nil
+	}
+
+	ebr := make([]byte, mbrSize)
+	next := extended.FirstLBA
+	number := 5
+
+	for seen := make(map[uint64]bool); ; {
+		if seen[next] || number-5 >= mbrMaxLogical {
+			t.problem("extended boot records at LBA %d loop", next)
+			return nil
+		}
+
+		seen[next] = true
+
+		if _, err := r.ReadAt(ebr, int64(next)*t.SectorSize); err != nil {
+			t.problem("extended boot record at LBA %d can't be read: %v", next, err)
+			return nil
+		}
+
+		if ebr[510] != 0x55 || ebr[511] != 0xaa {
+			t.problem("extended boot record at LBA %d has no signature", next)
+			return nil
+		}
+
+		entries := parseMBREntries(ebr)
+
+		// the first entry is relative to this EBR, the second to the start of
+		// the extended partition
+		if e := entries[0]; e.typ != 0 && e.sectors != 0 {
+			p := t.newMBRPartition(number, e, next+uint64(e.start))
+			p.Logical = true
+			number++
+
+			if p.FirstLBA < extended.FirstLBA || p.LastLBA > extended.LastLBA {
+				t.problem("logical partition %d is outside extended partition %d", p.Number, extended.Number)
+			}
+
+			t.Partitions = append(t.Partitions, p)
+		}
+
+		if e := entries[1]; e.isExtended() {
+			next = extended.FirstLBA + uint64(e.start)
+			continue
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,242 @@
+// Package parttable reads GPT and MBR partition tables from disks and image
+// files without going through the kernel's view of them
+package parttable
+
+import (
+	"errors"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+	"os"
+	"sort"
+)
+
+// DefaultAlignment is the partition alignment checked by default, the 1 MiB
+// partitioning tools have used since 4K sector disks
+const DefaultAlignment = 1 << 20
+
+var (
+	// ErrNoPartitionTable is returned when there's neither a GPT nor an MBR
+	ErrNoPartitionTable = errors.New("no partition table found")
+	// ErrInvalidGPT is returned when a protective MBR is found but neither GPT
+	// header can be read
+	ErrInvalidGPT = errors.New("no valid GPT header found")
+)
+
+// Scheme is the partitioning scheme of a table
+type Scheme string
+
+const (
+	// SchemeGPT is a GUID partition table
+	SchemeGPT Scheme = "gpt"
+	// SchemeMBR is an MS-DOS master boot record
+	SchemeMBR Scheme = "mbr"
+)
+
+// Option configures Read
+type Option func(o *options)
+
+type options struct {
+	sectorSize int64
+	alignment  int64
+}
+
+// WithSectorSize sets the logical sector size instead of detecting it, which
+// is only possible for GPT
+func WithSectorSize(size int64) Option {
+	return func(o *options) {
+		o.sectorSize = size
+	}
+}
+
+// WithAlignment sets the alignment partition starts are checked against. 0
+// disables the check
+func WithAlignment(alignment int64) Option {
+	return func(o *options) {
+		o.alignment = alignment
+	}
+}
+
+// Table is a partition table
+type Table struct {
+	Scheme     Scheme       `yaml:"scheme" json:"scheme"`
+	SectorSize int64        `yaml:"sector_size" json:"sector_size"`
+	Size       cap.Capacity `yaml:"size" json:"size"`
+	// ID is the GPT disk GUID or the MBR disk signature
+	ID string `yaml:"id,omitempty" json:"id,omitempty"`
+	// Primary and Backup are the GPT headers
+	Primary    *GPTHeader   `yaml:"primary,omitempty" json:"primary,omitempty"`
+	Backup     *GPTHeader   `yaml:"backup,omitempty" json:"backup,omitempty"`
+	Partitions []*Partition `yaml:"partitions" json:"partitions"`
+	// Problems are the inconsistencies found, such as checksum errors,
+	// overlapping or misaligned partitions
+	Problems []string `yaml:"problems,omitempty" json:"problems,omitempty"`
+	// header is the GPT header the partitions were read from
+	header *GPTHeader
+}
+
+// Partition is an entry in a partition table
+type Partition struct {
+	// Number is the partition number as the kernel names it, so MBR logical
+	// partitions start at 5
+	Number   int          `yaml:"number" json:"number"`
+	FirstLBA uint64       `yaml:"first_lba" json:"first_lba"`
+	LastLBA  uint64       `yaml:"last_lba" json:"last_lba"`
+	Start    cap.Capacity `yaml:"start" json:"start"`
+	Size     cap.Capacity `yaml:"size" json:"size"`
+	// Type is the type GUID for GPT or the type byte as 0x83 for MBR
+	Type     string `yaml:"type" json:"type"`
+	TypeName string `yaml:"type_name,omitempty" json:"type_name,omitempty"`
+	// GUID, Name and Attributes are only set for GPT
+	GUID       string `yaml:"guid,omitempty" json:"guid,omitempty"`
+	Name       string `yaml:"name,omitempty" json:"name,omitempty"`
+	Attributes uint64 `yaml:"attributes,omitempty" json:"attributes,omitempty"`
+	// Bootable, Extended and Logical are only set for MBR
+	Bootable bool `yaml:"bootable,omitempty" json:"bootable,omitempty"`
+	Extended bool `yaml:"extended,omitempty" json:"extended,omitempty"`
+	Logical  bool `yaml:"logical,omitempty" json:"logical,omitempty"`
+}
+
+// Partition returns the partition with the given number
+func (t *Table) Partition(number int) *Partition {
+	for _, p := range t.Partitions {
+		if p.Number == number {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// problem adds an inconsistency
+func (t *Table) problem(format string, args ...interface{}) {
+	t.Problems = append(t.Problems, fmt.Sprintf(format, args...))
+}
+
+// newPartition returns a partition with its byte offsets set
+func (t *Table) newPartition(number int, first, last uint64) *Partition {
+	p := &Partition{
+		Number:   number,
+		FirstLBA: first,
+		LastLBA:  last,
+		Start:    cap.Capacity(int64(first) * t.SectorSize),
+	}
+
+	if last >= first {
+		p.Size = cap.Capacity(int64(last-first+1) * t.SectorSize)
+	}
+
+	return p
+}
+
+// Read reads the partition table of a disk or image of the given size
+func Read(r io.ReaderAt, size int64, opts ...Option) (*Table, error) {
+	o := &options{alignment: DefaultAlignment}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	mbr := make([]byte, mbrSize)
+	if _, err := r.ReadAt(mbr, 0); err != nil {
+		return nil, err
+	}
+
+	hasMBR := mbr[510] == 0x55 && mbr[511] == 0xaa
+
+	sectorSizes := []int64{512, 4096}
+	if o.sectorSize > 0 {
+		sectorSizes = []int64{o.sectorSize}
+	}
+
+	for _, ss := range sectorSizes {
+		if !hasGPTSignature(r, ss) && !hasGPTSignature(r, (size/ss-1)*ss) {
+			continue
+		}
+
+		t := &Table{Scheme: SchemeGPT, SectorSize: ss, Size: cap.Capacity(size)}
+
+		if err := t.readGPT(r, size, mbr, hasMBR); err != nil {
+			return nil, err
+		}
+
+		t.check(o.alignment)
+
+		return t, nil
+	}
+
+	if !hasMBR {
+		return nil, ErrNoPartitionTable
+	}
+
+	t := &Table{Scheme: SchemeMBR, SectorSize: sectorSizes[0], Size: cap.Capacity(size)}
+
+	if err := t.readMBR(r, mbr); err != nil {
+		return nil, err
+	}
+
+	t.check(o.alignment)
+
+	return t, nil
+}
+
+// ReadFile reads the partition table of a block device or image file
+func ReadFile(path string, opts ...Option) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	// Stat reports 0 for block devices, seeking to the end works for both
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return Read(f, size, opts...)
+}
+
+// check reports partitions outside the disk, overlapping or misaligned
+func (t *Table) check(alignment int64) {
+	first, last := uint64(1), uint64(int64(t.Size)/t.SectorSize-1)
+
+	if t.header != nil && t.Scheme == SchemeGPT {
+		first, last = t.header.FirstUsableLBA, t.header.LastUsableLBA
+	}
+
+	parts := append([]*Partition{}, t.Partitions...)
+
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].FirstLBA < parts[j].FirstLBA
+	})
+
+	for i, p := range parts {
+		if p.LastLBA < p.FirstLBA {
+			t.problem("partition %d ends at LBA %d before it starts at %d", p.Number, p.LastLBA, p.FirstLBA)
+			continue
+		}
+
+		if p.FirstLBA < first || p.LastLBA > last {
+			t.problem("partition %d at LBAs %d-%d is outside the usable LBAs %d-%d",
+				p.Number, p.FirstLBA, p.LastLBA, first, last)
+		}
+
+		if alignment > 0 && int64(p.FirstLBA)*t.SectorSize%alignment != 0 {
+			t.problem("partition %d at LBA %d isn't aligned to %s",
+				p.Number, p.FirstLBA, cap.Capacity(alignment).FormatBase2Bytes())
+		}
+
+		for _, q := range parts[i+1:] {
+			// logical partitions are inside their extended partition
+			if p.Extended && q.Logical || p.Logical && q.Extended {
+				continue
+			}
+
+			if q.FirstLBA <= p.LastLBA && q.LastLBA >= q.FirstLBA {
+				t.problem("partitions %d and %d overlap", p.Number, q.Number)
+			}
+		}
+	}
+}
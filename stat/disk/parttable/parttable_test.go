@@ -0,0 +1,340 @@
+package parttable
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const (
+	testSectorSize = 512
+	testImageSize  = 8 << 20
+	testLastLBA    = testImageSize/testSectorSize - 1
+	// 128 entries of 128 bytes
+	testEntrySectors = 32
+)
+
+type testPart struct {
+	typ         string
+	first, last uint64
+	name        string
+}
+
+// putGPTHeader writes a GPT header at an LBA and sets its checksum
+func putGPTHeader(img []byte, lba, backup, entries uint64, diskGUID GUID) {
+	h := img[lba*testSectorSize:]
+	le := binary.LittleEndian
+
+	copy(h, gptSignature)
+	le.PutUint32(h[8:], 0x00010000)
+	le.PutUint32(h[12:], gptHeaderSize)
+	le.PutUint64(h[24:], lba)
+	le.PutUint64(h[32:], backup)
+	le.PutUint64(h[40:], 2+testEntrySectors)
+	le.PutUint64(h[48:], testLastLBA-testEntrySectors-1)
+	copy(h[56:], diskGUID[:])
+	le.PutUint64(h[72:], entries)
+	le.PutUint32(h[80:], 128)
+	le.PutUint32(h[84:], 128)
+	le.PutUint32(h[88:], crc32.ChecksumIEEE(img[entries*testSectorSize:(entries+testEntrySectors)*testSectorSize]))
+	fixGPTHeaderCRC(img, lba)
+}
+
+// fixGPTHeaderCRC recalculates the checksum of the header at an LBA
+func fixGPTHeaderCRC(img []byte, lba uint64) {
+	h := img[lba*testSectorSize : lba*testSectorSize+gptHeaderSize]
+	binary.LittleEndian.PutUint32(h[16:], 0)
+	binary.LittleEndian.PutUint32(h[16:], crc32.ChecksumIEEE(h))
+}
+
+// gptImage builds an image with a protective MBR and both GPT headers
+func gptImage(t *testing.T, parts []testPart) []byte {
+	img := make([]byte, testImageSize)
+
+	mbr := img[mbrEntriesStart:]
+	mbr[4] = mbrTypeProtective
+	binary.LittleEndian.PutUint32(mbr[8:], 1)
+	binary.LittleEndian.PutUint32(mbr[12:], testLastLBA)
+	img[510], img[511] = 0x55, 0xaa
+
+	entries := make([]byte, testEntrySectors*testSectorSize)
+
+	for i, p := range parts {
+		typ, err := ParseGUID(p.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := entries[i*128:]
+		copy(e, typ[:])
+		e[16], e[31] = byte(i+1), 0xaa
+		binary.LittleEndian.PutUint64(e[32:], p.first)
+		binary.LittleEndian.PutUint64(e[40:], p.last)
+
+		for j, c := range utf16.Encode([]rune(p.name)) {
+			binary.LittleEndian.PutUint16(e[56+j*2:], c)
+		}
+	}
+
+	diskGUID, _ := ParseGUID("2c4d1bd6-3e0a-4f1b-9a8e-5b6c7d8e9f01")
+	backupEntries := uint64(testLastLBA - testEntrySectors)
+
+	copy(img[2*testSectorSize:], entries)
+	copy(img[backupEntries*testSectorSize:], entries)
+	putGPTHeader(img, 1, testLastLBA, 2, diskGUID)
+	putGPTHeader(img, testLastLBA, 1, backupEntries, diskGUID)
+
+	return img
+}
+
+// readImage writes the image to a file and reads its partition table back
+func readImage(t *testing.T, img []byte, opts ...Option) (*Table, error) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+
+	if err := os.WriteFile(path, img, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return ReadFile(path, opts...)
+}
+
+var testGPTParts = []testPart{
+	{"c12a7328-f81f-11d2-ba4b-00a0c93ec93b", 2048, 4095, "EFI system partition"},
+	{"0fc63daf-8483-4772-8e79-3d69d8477de4", 4096, 14335, "root"},
+}
+
+func TestGUID(t *testing.T) {
+	const v = "c12a7328-f81f-11d2-ba4b-00a0c93ec93b"
+
+	g, err := ParseGUID(strings.ToUpper(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first three fields are little endian on disk
+	if g[0] != 0x28 || g[3] != 0xc1 || g[4] != 0x1f || g[8] != 0xba || g.String() != v {
+		t.Errorf("unexpected GUID % x formatted as %s", g[:], g)
+	}
+
+	for _, v := range []string{"", "c12a7328-f81f-11d2-ba4b", "c12a7328-f81f-11d2-ba4b-00a0c93ec93b00"} {
+		if _, err := ParseGUID(v); err == nil {
+			t.Errorf("expected %q to be invalid", v)
+		}
+	}
+}
+
+func TestReadGPT(t *testing.T) {
+	table, err := readImage(t, gptImage(t, testGPTParts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if table.Scheme != SchemeGPT || table.SectorSize != 512 || table.ID != "2c4d1bd6-3e0a-4f1b-9a8e-5b6c7d8e9f01" {
+		t.Errorf("unexpected table %+v", table)
+	}
+
+	if len(table.Problems) > 0 {
+		t.Errorf("unexpected problems %v", table.Problems)
+	}
+
+	if !table.Primary.Valid() || !table.Backup.Valid() || table.Backup.CurrentLBA != testLastLBA {
+		t.Errorf("unexpected headers %+v and %+v", table.Primary, table.Backup)
+	}
+
+	if len(table.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(table.Partitions))
+	}
+
+	p := table.Partition(1)
+	if p.TypeName != "EFI System" || p.Name != "EFI system partition" || p.Start != 1<<20 || p.Size != 1<<20 {
+		t.Errorf("unexpected partition %+v", p)
+	}
+
+	if p.GUID != "00000001-0000-0000-0000-0000000000aa" {
+		t.Errorf("unexpected partition GUID %s", p.GUID)
+	}
+
+	if p := table.Partition(2); p.TypeName != "Linux filesystem" || p.Size != 5<<20 {
+		t.Errorf("unexpected partition %+v", p)
+	}
+}
+
+func TestReadGPTBackup(t *testing.T) {
+	img := gptImage(t, testGPTParts)
+
+	// corrupt the primary header, the backup is used instead
+	img[testSectorSize+20] ^= 0xff
+
+	table, err := readImage(t, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if table.Primary.HeaderValid || len(table.Partitions) != 2 {
+		t.Errorf("expected the backup to be used, got %+v", table)
+	}
+
+	if len(table.Problems) != 1 || table.Problems[0] != "primary GPT header checksum is invalid" {
+		t.Errorf("unexpected problems %v", table.Problems)
+	}
+
+	// the partitions are checked against the backup's usable LBAs, not the
+	// corrupt primary's
+	img = gptImage(t, testGPTParts)
+	binary.LittleEndian.PutUint64(img[testSectorSize+48:], 8192)
+
+	if table, err = readImage(t, img); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, problem := range table.Problems {
+		if strings.Contains(problem, "outside the usable LBAs") {
+			t.Errorf("unexpected problem %q", problem)
+		}
+	}
+
+	// a valid backup that differs from the primary
+	img = gptImage(t, testGPTParts)
+	binary.LittleEndian.PutUint64(img[testLastLBA*testSectorSize+48:], testLastLBA-testEntrySectors-100)
+	fixGPTHeaderCRC(img, testLastLBA)
+
+	if table, err = readImage(t, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.Problems) != 1 || !strings.HasPrefix(table.Problems[0], "backup GPT header last usable LBA") {
+		t.Errorf("unexpected problems %v", table.Problems)
+	}
+
+	// an image that was grown without moving the backup header
+	img = append(gptImage(t, testGPTParts), make([]byte, 1<<20)...)
+
+	if table, err = readImage(t, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.Problems) != 1 || !strings.HasPrefix(table.Problems[0], "backup GPT header is at LBA 16383") {
+		t.Errorf("unexpected problems %v", table.Problems)
+	}
+
+	// corrupt entries in both copies
+	img = gptImage(t, testGPTParts)
+	img[2*testSectorSize] ^= 0xff
+	img[(testLastLBA-testEntrySectors)*testSectorSize] ^= 0xff
+
+	if table, err = readImage(t, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.Problems) != 2 || table.Problems[1] != "backup GPT partition entries checksum is invalid" {
+		t.Errorf("unexpected problems %v", table.Problems)
+	}
+}
+
+func TestReadGPTProblems(t *testing.T) {
+	table, err := readImage(t, gptImage(t, []testPart{
+		{"0fc63daf-8483-4772-8e79-3d69d8477de4", 2048, 8191, "a"},
+		{"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f", 8000, 9999, "b"},
+		{"0fc63daf-8483-4772-8e79-3d69d8477de4", 16300, 16383, "c"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"partitions 1 and 2 overlap",
+		"partition 2 at LBA 8000 isn't aligned to 1 MiB",
+		"partition 3 at LBAs 16300-16383 is outside the usable LBAs 34-16350",
+		"partition 3 at LBA 16300 isn't aligned to 1 MiB",
+	}
+
+	if strings.Join(table.Problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected problems %q", table.Problems)
+	}
+
+	table, err = readImage(t, gptImage(t, testGPTParts), WithAlignment(1<<22))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.Problems) != 2 {
+		t.Errorf("expected both partitions to be misaligned, got %v", table.Problems)
+	}
+}
+
+// putMBREntry writes a partition entry into an MBR or EBR sector
+func putMBREntry(sector []byte, i int, status, typ byte, start, sectors uint32) {
+	e := sector[mbrEntriesStart+i*mbrEntrySize:]
+	e[0], e[4] = status, typ
+	binary.LittleEndian.PutUint32(e[8:], start)
+	binary.LittleEndian.PutUint32(e[12:], sectors)
+	sector[510], sector[511] = 0x55, 0xaa
+}
+
+func TestReadMBR(t *testing.T) {
+	img := make([]byte, testImageSize)
+	binary.LittleEndian.PutUint32(img[440:], 0xdeadbeef)
+
+	putMBREntry(img, 0, 0x80, 0x83, 2048, 2048)
+	putMBREntry(img, 1, 0, 0x05, 4096, 8192)
+
+	// logical partition 5 at 6144, the next EBR at 8192 with partition 6 at
+	// the old DOS offset of 63
+	ebr := img[4096*testSectorSize:]
+	putMBREntry(ebr, 0, 0, 0x82, 2048, 2048)
+	putMBREntry(ebr, 1, 0, 0x05, 4096, 4096)
+
+	ebr = img[8192*testSectorSize:]
+	putMBREntry(ebr, 0, 0, 0x8e, 63, 2048)
+
+	table, err := readImage(t, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if table.Scheme != SchemeMBR || table.ID != "0xdeadbeef" || len(table.Partitions) != 4 {
+		t.Fatalf("unexpected table %+v", table)
+	}
+
+	if p := table.Partition(1); !p.Bootable || p.TypeName != "Linux" || p.Type != "0x83" || p.Size != 1<<20 {
+		t.Errorf("unexpected partition %+v", p)
+	}
+
+	if p := table.Partition(2); !p.Extended || p.TypeName != "Extended" {
+		t.Errorf("unexpected partition %+v", p)
+	}
+
+	if p := table.Partition(5); !p.Logical || p.FirstLBA != 6144 || p.TypeName != "Linux swap / Solaris" {
+		t.Errorf("unexpected partition %+v", p)
+	}
+
+	if p := table.Partition(6); !p.Logical || p.FirstLBA != 8255 || p.TypeName != "Linux LVM" {
+		t.Errorf("unexpected partition %+v", p)
+	}
+
+	if len(table.Problems) != 1 || table.Problems[0] != "partition 6 at LBA 8255 isn't aligned to 1 MiB" {
+		t.Errorf("unexpected problems %v", table.Problems)
+	}
+
+	// point the last EBR back at the first
+	putMBREntry(ebr, 1, 0, 0x05, 0, 4096)
+
+	if table, err = readImage(t, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.Partitions) != 4 || table.Problems[0] != "extended boot records at LBA 4096 loop" {
+		t.Errorf("unexpected problems %v", table.Problems)
+	}
+}
+
+func TestReadNoTable(t *testing.T) {
+	if _, err := readImage(t, make([]byte, 1<<20)); !errors.Is(err, ErrNoPartitionTable) {
+		t.Errorf("expected ErrNoPartitionTable, got %v", err)
+	}
+}
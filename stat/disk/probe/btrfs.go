@@ -0,0 +1,36 @@
+package probe
+
+import (
+	"encoding/binary"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+const (
+	btrfsSuperblockOffset = 64 << 10
+	btrfsMagic            = "_BHRfS_M"
+	// btrfsDevItem is the offset of the superblock's own device item
+	btrfsDevItem = 0xc9
+)
+
+// probeBtrfs finds the primary btrfs superblock. UUID is the filesystem's
+// and SubUUID this device's
+func probeBtrfs(r io.ReaderAt, size int64) *Result {
+	sb := readAt(r, btrfsSuperblockOffset, 4096)
+	if sb == nil || string(sb[0x40:0x48]) != btrfsMagic {
+		return nil
+	}
+
+	le := binary.LittleEndian
+
+	return &Result{
+		Type:      "btrfs",
+		Usage:     UsageFilesystem,
+		UUID:      formatUUID(sb[0x20:0x30]),
+		SubUUID:   formatUUID(sb[btrfsDevItem+0x42 : btrfsDevItem+0x52]),
+		Label:     cString(sb[0x12b : 0x12b+256]),
+		Size:      cap.Capacity(le.Uint64(sb[0x70:])),
+		BlockSize: int64(le.Uint32(sb[0x90:])),
+		Offset:    btrfsSuperblockOffset,
+	}
+}
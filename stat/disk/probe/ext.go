@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+const (
+	extSuperblockOffset = 1024
+	extMagic            = 0xef53
+
+	extCompatHasJournal    = 0x0004
+	extIncompatJournalDev  = 0x0008
+	extIncompatExtents     = 0x0040
+	extIncompat64Bit       = 0x0080
+	extIncompatFlexBG      = 0x0200
+	extIncompatInlineData  = 0x8000
+	extROCompatHugeFile    = 0x0008
+	extROCompatDirNlink    = 0x0020
+	extROCompatExtraIsize  = 0x0040
+	extROCompatMetadataCsm = 0x0400
+
+	// ext4Incompat and ext4ROCompat are the features ext3 doesn't support
+	ext4Incompat = extIncompatExtents | extIncompat64Bit | extIncompatFlexBG | extIncompatInlineData
+	ext4ROCompat = extROCompatHugeFile | extROCompatDirNlink | extROCompatExtraIsize | extROCompatMetadataCsm
+)
+
+// probeExt finds an ext2, ext3 or ext4 superblock, telling them apart by
+// their features like blkid
+func probeExt(r io.ReaderAt, size int64) *Result {
+	sb := readAt(r, extSuperblockOffset, 1024)
+	if sb == nil || binary.LittleEndian.Uint16(sb[0x38:]) != extMagic {
+		return nil
+	}
+
+	le := binary.LittleEndian
+
+	compat := le.Uint32(sb[0x5c:])
+	incompat := le.Uint32(sb[0x60:])
+	roCompat := le.Uint32(sb[0x64:])
+
+	res := &Result{
+		Type:      "ext2",
+		Usage:     UsageFilesystem,
+		UUID:      formatUUID(sb[0x68:0x78]),
+		Label:     cString(sb[0x78:0x88]),
+		Version:   fmt.Sprintf("%d.%d", le.Uint32(sb[0x4c:]), le.Uint16(sb[0x3e:])),
+		BlockSize: 1024 << le.Uint32(sb[0x18:]),
+		Offset:    extSuperblockOffset,
+	}
+
+	blocks := uint64(le.Uint32(sb[0x04:]))
+	if incompat&extIncompat64Bit != 0 {
+		blocks |= uint64(le.Uint32(sb[0x150:])) << 32
+	}
+
+	res.Size = cap.Capacity(int64(blocks) * res.BlockSize)
+
+	switch {
+	case incompat&extIncompatJournalDev != 0:
+		res.Type = "jbd"
+		res.Usage = UsageOther
+	case incompat&ext4Incompat != 0 || roCompat&ext4ROCompat != 0:
+		res.Type = "ext4"
+	case compat&extCompatHasJournal != 0:
+		res.Type = "ext3"
+	}
+
+	return res
+}
@@ -0,0 +1,152 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+const (
+	exfatOEM = "EXFAT   "
+	ntfsOEM  = "NTFS    "
+
+	fatExtendedSignature = 0x29
+	// fat12MaxClusters is the most clusters FAT12 can address, more need
+	// FAT16
+	fat12MaxClusters = 4084
+)
+
+// formatVolumeID formats a FAT or exFAT volume serial number as blkid does
+func formatVolumeID(id uint32) string {
+	return fmt.Sprintf("%04X-%04X", id>>16, id&0xffff)
+}
+
+// probeFAT finds a FAT12, FAT16 or FAT32 boot sector, reported as vfat with
+// the FAT size as the version
+func probeFAT(r io.ReaderAt, size int64) *Result {
+	b := readAt(r, 0, 512)
+	if b == nil || b[510] != 0x55 || b[511] != 0xaa {
+		return nil
+	}
+
+	if oem := string(b[3:11]); oem == exfatOEM || oem == ntfsOEM {
+		return nil
+	}
+
+	le := binary.LittleEndian
+
+	bps := int64(le.Uint16(b[11:]))
+	spc := int64(b[13])
+	reserved := int64(le.Uint16(b[14:]))
+	fats := int64(b[16])
+	rootEntries := int64(le.Uint16(b[17:]))
+
+	if bps != 512 && bps != 1024 && bps != 2048 && bps != 4096 {
+		return nil
+	}
+
+	if spc == 0 || spc&(spc-1) != 0 || reserved == 0 || (fats != 1 && fats != 2) {
+		return nil
+	}
+
+	sectors := int64(le.Uint16(b[19:]))
+	if sectors == 0 {
+		sectors = int64(le.Uint32(b[32:]))
+	}
+
+	fatLength := int64(le.Uint16(b[22:]))
+	ebpb := 36
+	version := "FAT32"
+
+	if fatLength == 0 {
+		fatLength = int64(le.Uint32(b[36:]))
+		ebpb = 64
+	} else {
+		rootSectors := (rootEntries*32 + bps - 1) / bps
+		clusters := (sectors - reserved - fats*fatLength - rootSectors) / spc
+
+		version = "FAT16"
+		if clusters <= fat12MaxClusters {
+			version = "FAT12"
+		}
+	}
+
+	if fatLength == 0 || sectors == 0 {
+		return nil
+	}
+
+	res := &Result{
+		Type:      "vfat",
+		Usage:     UsageFilesystem,
+		Version:   version,
+		Size:      cap.Capacity(sectors * bps),
+		BlockSize: bps * spc,
+	}
+
+	if b[ebpb+2] == fatExtendedSignature {
+		res.UUID = formatVolumeID(le.Uint32(b[ebpb+3:]))
+
+		if label := cString(b[ebpb+7 : ebpb+18]); label != "NO NAME" {
+			res.Label = label
+		}
+	}
+
+	return res
+}
+
+// probeExFAT finds an exFAT boot sector and reads the label from the root
+// directory
+func probeExFAT(r io.ReaderAt, size int64) *Result {
+	b := readAt(r, 0, 512)
+	if b == nil || string(b[3:11]) != exfatOEM {
+		return nil
+	}
+
+	le := binary.LittleEndian
+
+	sectorShift, clusterShift := b[108], b[109]
+	if sectorShift < 9 || sectorShift > 12 || sectorShift+clusterShift > 25 {
+		return nil
+	}
+
+	bps := int64(1) << sectorShift
+	clusterSize := bps << clusterShift
+	revision := le.Uint16(b[104:])
+
+	res := &Result{
+		Type:      "exfat",
+		Usage:     UsageFilesystem,
+		UUID:      formatVolumeID(le.Uint32(b[100:])),
+		Version:   fmt.Sprintf("%d.%d", revision>>8, revision&0xff),
+		Size:      cap.Capacity(int64(le.Uint64(b[72:])) * bps),
+		BlockSize: clusterSize,
+	}
+
+	heap := int64(le.Uint32(b[88:])) * bps
+	root := int64(le.Uint32(b[96:]))
+
+	if root < 2 {
+		return res
+	}
+
+	dir := readAt(r, heap+(root-2)*clusterSize, int(clusterSize))
+
+	for i := 0; i+32 <= len(dir); i += 32 {
+		switch dir[i] {
+		case 0x00:
+			return res
+		case 0x83:
+			n := int(dir[i+1])
+			if n > 11 {
+				n = 11
+			}
+
+			res.Label = decodeUTF16(dir[i+2 : i+2+n*2])
+
+			return res
+		}
+	}
+
+	return res
+}
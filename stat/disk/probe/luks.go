@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	luksMagic = "LUKS\xba\xbe"
+	// luks2SecondaryMagic is the magic of the LUKS2 secondary header, used if
+	// the primary is damaged
+	luks2SecondaryMagic = "SKUL\xba\xbe"
+)
+
+// luks2SecondaryOffsets are where the LUKS2 secondary header may be
+var luks2SecondaryOffsets = []int64{
+	0x4000, 0x8000, 0x10000, 0x20000, 0x40000, 0x80000, 0x100000, 0x200000, 0x400000,
+}
+
+// probeLUKS finds a LUKS1 or LUKS2 header. Only LUKS2 has a label
+func probeLUKS(r io.ReaderAt, size int64) *Result {
+	offsets := append([]int64{0}, luks2SecondaryOffsets...)
+
+	for _, off := range offsets {
+		b := readAt(r, off, 512)
+		if b == nil {
+			continue
+		}
+
+		magic := string(b[0:6])
+
+		if !(off == 0 && magic == luksMagic) && !(off > 0 && magic == luks2SecondaryMagic) {
+			continue
+		}
+
+		version := binary.BigEndian.Uint16(b[6:])
+
+		res := &Result{
+			Type:    "crypto_LUKS",
+			Usage:   UsageCrypto,
+			UUID:    cString(b[168:208]),
+			Version: fmt.Sprintf("%d", version),
+			Offset:  off,
+		}
+
+		switch version {
+		case 1:
+			if off > 0 {
+				continue
+			}
+		case 2:
+			res.Label = cString(b[24:72])
+		default:
+			continue
+		}
+
+		return res
+	}
+
+	return nil
+}
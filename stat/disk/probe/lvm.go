@@ -0,0 +1,50 @@
+package probe
+
+import (
+	"encoding/binary"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+const (
+	lvmLabelMagic = "LABELONE"
+	lvmLabelType  = "LVM2 001"
+	// the label is in one of the first four sectors
+	lvmLabelSectors = 4
+)
+
+// probeLVM2 finds an LVM2 physical volume label
+func probeLVM2(r io.ReaderAt, size int64) *Result {
+	for sector := int64(0); sector < lvmLabelSectors; sector++ {
+		b := readAt(r, sector*512, 512)
+		if b == nil || string(b[0:8]) != lvmLabelMagic || string(b[24:32]) != lvmLabelType {
+			continue
+		}
+
+		// the PV header follows the label at offset_xl
+		off := int(binary.LittleEndian.Uint32(b[20:]))
+		if off+40 > len(b) {
+			return nil
+		}
+
+		return &Result{
+			Type:    "LVM2_member",
+			Usage:   UsageRAID,
+			UUID:    formatLVMUUID(string(b[off : off+32])),
+			Version: lvmLabelType,
+			Size:    cap.Capacity(binary.LittleEndian.Uint64(b[off+32:])),
+			Offset:  sector * 512,
+		}
+	}
+
+	return nil
+}
+
+// formatLVMUUID adds the dashes LVM prints its 32 character UUIDs with
+func formatLVMUUID(v string) string {
+	if len(v) != 32 {
+		return v
+	}
+
+	return v[0:6] + "-" + v[6:10] + "-" + v[10:14] + "-" + v[14:18] + "-" + v[18:22] + "-" + v[22:26] + "-" + v[26:32]
+}
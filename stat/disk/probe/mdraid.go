@@ -0,0 +1,98 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+const mdMagic = 0xa92b4efc
+
+// probeMDRaid finds a Linux software RAID superblock. Version 1.1 and 1.2
+// superblocks are at the start, 1.0 and 0.90 at the end of the device
+func probeMDRaid(r io.ReaderAt, size int64) *Result {
+	for _, sb := range []struct {
+		version string
+		offset  int64
+	}{
+		{"1.2", 4096},
+		{"1.1", 0},
+		{"1.0", (size - 8192) &^ 4095},
+	} {
+		if res := probeMDRaid1(r, sb.offset, sb.version); res != nil {
+			return res
+		}
+	}
+
+	return probeMDRaid090(r, size)
+}
+
+// probeMDRaid1 reads a version 1 superblock
+func probeMDRaid1(r io.ReaderAt, off int64, version string) *Result {
+	b := readAt(r, off, 256)
+
+	le := binary.LittleEndian
+
+	if b == nil || le.Uint32(b[0:]) != mdMagic || le.Uint32(b[4:]) != 1 {
+		return nil
+	}
+
+	// the superblock records its own offset in sectors
+	if int64(le.Uint64(b[144:]))*512 != off {
+		return nil
+	}
+
+	return &Result{
+		Type:    "linux_raid_member",
+		Usage:   UsageRAID,
+		UUID:    formatUUID(b[16:32]),
+		SubUUID: formatUUID(b[168:184]),
+		Label:   cString(b[32:64]),
+		Version: version,
+		Size:    cap.Capacity(int64(le.Uint64(b[136:])) * 512),
+		Offset:  off,
+	}
+}
+
+// probeMDRaid090 reads a version 0.90 superblock, which is in the host's
+// byte order in the last 64 KiB aligned block
+func probeMDRaid090(r io.ReaderAt, size int64) *Result {
+	off := (size &^ (64<<10 - 1)) - 64<<10
+
+	b := readAt(r, off, 64)
+	if b == nil {
+		return nil
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+
+	if order.Uint32(b) != mdMagic {
+		order = binary.BigEndian
+
+		if order.Uint32(b) != mdMagic {
+			return nil
+		}
+	}
+
+	if order.Uint32(b[4:]) != 0 {
+		return nil
+	}
+
+	// the UUID is split between set_uuid0 and set_uuid1-3
+	uuid := make([]byte, 16)
+	binary.BigEndian.PutUint32(uuid[0:], order.Uint32(b[20:]))
+
+	for i := 1; i < 4; i++ {
+		binary.BigEndian.PutUint32(uuid[i*4:], order.Uint32(b[48+i*4:]))
+	}
+
+	return &Result{
+		Type:    "linux_raid_member",
+		Usage:   UsageRAID,
+		UUID:    formatUUID(uuid),
+		Version: fmt.Sprintf("0.%d.%d", order.Uint32(b[8:]), order.Uint32(b[12:])),
+		Size:    cap.Capacity(int64(order.Uint32(b[32:])) << 10),
+		Offset:  off,
+	}
+}
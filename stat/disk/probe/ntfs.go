@@ -0,0 +1,126 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+const (
+	ntfsVolumeRecord    = 3
+	ntfsAttrVolumeName  = 0x60
+	ntfsAttrVolumeInfo  = 0x70
+	ntfsAttrEnd         = 0xffffffff
+	ntfsMaxRecordSize   = 64 << 10
+	ntfsFixupSectorSize = 512
+)
+
+// probeNTFS finds an NTFS boot sector and reads the label and version from
+// the $Volume record of the MFT
+func probeNTFS(r io.ReaderAt, size int64) *Result {
+	b := readAt(r, 0, 512)
+	if b == nil || string(b[3:11]) != ntfsOEM {
+		return nil
+	}
+
+	le := binary.LittleEndian
+
+	bps := int64(le.Uint16(b[11:]))
+	if bps < 256 || bps > 4096 || bps&(bps-1) != 0 {
+		return nil
+	}
+
+	// large cluster sizes are stored as a negative shift
+	clusterSize := bps * int64(b[13])
+	if b[13] > 0x80 {
+		clusterSize = 1 << (256 - int(b[13]))
+	}
+
+	res := &Result{
+		Type:      "ntfs",
+		Usage:     UsageFilesystem,
+		UUID:      fmt.Sprintf("%016X", le.Uint64(b[72:])),
+		Size:      cap.Capacity(int64(le.Uint64(b[40:])) * bps),
+		BlockSize: clusterSize,
+	}
+
+	recordSize := int64(int8(b[64]))
+	if recordSize > 0 {
+		recordSize *= clusterSize
+	} else {
+		recordSize = 1 << uint(-recordSize)
+	}
+
+	if recordSize < ntfsFixupSectorSize || recordSize > ntfsMaxRecordSize {
+		return res
+	}
+
+	mft := int64(le.Uint64(b[48:])) * clusterSize
+
+	rec := readAt(r, mft+ntfsVolumeRecord*recordSize, int(recordSize))
+	if rec == nil || string(rec[0:4]) != "FILE" || !applyNTFSFixups(rec) {
+		return res
+	}
+
+	for off := int(le.Uint16(rec[20:])); off+24 <= len(rec); {
+		typ := le.Uint32(rec[off:])
+		length := int(le.Uint32(rec[off+4:]))
+
+		if typ == ntfsAttrEnd || length < 24 || off+length > len(rec) {
+			break
+		}
+
+		attr := rec[off : off+length]
+		off += length
+
+		// both attributes are always resident
+		if attr[8] != 0 {
+			continue
+		}
+
+		valueLen, valueOff := int(le.Uint32(attr[16:])), int(le.Uint16(attr[20:]))
+		if valueOff+valueLen > len(attr) {
+			continue
+		}
+
+		value := attr[valueOff : valueOff+valueLen]
+
+		switch typ {
+		case ntfsAttrVolumeName:
+			res.Label = decodeUTF16(value)
+		case ntfsAttrVolumeInfo:
+			if len(value) >= 10 {
+				res.Version = fmt.Sprintf("%d.%d", value[8], value[9])
+			}
+		}
+	}
+
+	return res
+}
+
+// applyNTFSFixups restores the last two bytes of each sector of an MFT
+// record from its update sequence array, returning false if they don't
+// match the update sequence number
+func applyNTFSFixups(rec []byte) bool {
+	le := binary.LittleEndian
+
+	off, count := int(le.Uint16(rec[4:])), int(le.Uint16(rec[6:]))
+	if count < 1 || off+count*2 > len(rec) || (count-1)*ntfsFixupSectorSize > len(rec) {
+		return false
+	}
+
+	usn := rec[off : off+2]
+
+	for i := 1; i < count; i++ {
+		end := i*ntfsFixupSectorSize - 2
+
+		if rec[end] != usn[0] || rec[end+1] != usn[1] {
+			return false
+		}
+
+		copy(rec[end:end+2], rec[off+i*2:off+i*2+2])
+	}
+
+	return true
+}
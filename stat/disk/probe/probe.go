@@ -0,0 +1,185 @@
+// Package probe identifies filesystems, volume managers and RAID members from
+// their on-disk signatures like blkid, reading from a device or image
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrNoSignature is returned when nothing is recognised
+var ErrNoSignature = errors.New("no known signature found")
+
+// Usage is what a signature is used for, like blkid's USAGE
+type Usage string
+
+const (
+	// UsageFilesystem is a mountable filesystem
+	UsageFilesystem Usage = "filesystem"
+	// UsageRAID is a member of a RAID array or volume group
+	UsageRAID Usage = "raid"
+	// UsageCrypto is an encrypted volume
+	UsageCrypto Usage = "crypto"
+	// UsageOther is anything else, such as swap
+	UsageOther Usage = "other"
+)
+
+// Result is a recognised signature. Type uses the names blkid does, such as
+// ext4, LVM2_member or crypto_LUKS
+type Result struct {
+	Type  string `yaml:"type" json:"type"`
+	Usage Usage  `yaml:"usage" json:"usage"`
+	UUID  string `yaml:"uuid,omitempty" json:"uuid,omitempty"`
+	// SubUUID identifies the device within a multi-device volume, such as a
+	// btrfs device, RAID member or ZFS vdev
+	SubUUID string `yaml:"sub_uuid,omitempty" json:"sub_uuid,omitempty"`
+	Label   string `yaml:"label,omitempty" json:"label,omitempty"`
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	// Size is the size of the filesystem or volume from its superblock
+	Size      cap.Capacity `yaml:"size,omitempty" json:"size,omitempty"`
+	BlockSize int64        `yaml:"block_size,omitempty" json:"block_size,omitempty"`
+	// Offset is where the signature was found
+	Offset int64 `yaml:"offset" json:"offset"`
+}
+
+// String formats the result like blkid's output
+func (r *Result) String() string {
+	s := fmt.Sprintf("TYPE=%q USAGE=%q", r.Type, r.Usage)
+
+	if len(r.UUID) > 0 {
+		s += fmt.Sprintf(" UUID=%q", r.UUID)
+	}
+
+	if len(r.SubUUID) > 0 {
+		s += fmt.Sprintf(" UUID_SUB=%q", r.SubUUID)
+	}
+
+	if len(r.Label) > 0 {
+		s += fmt.Sprintf(" LABEL=%q", r.Label)
+	}
+
+	if len(r.Version) > 0 {
+		s += fmt.Sprintf(" VERSION=%q", r.Version)
+	}
+
+	return s
+}
+
+// prober returns a result if its signature is found in a device of the
+// given size
+type prober func(r io.ReaderAt, size int64) *Result
+
+// probers are tried in order. RAID members and encrypted or LVM volumes come
+// first as they may also hold a filesystem's signature, as with an mdraid
+// 1.0 mirror
+var probers = []prober{
+	probeMDRaid,
+	probeLUKS,
+	probeLVM2,
+	probeZFS,
+	probeSwap,
+	probeBtrfs,
+	probeXFS,
+	probeExt,
+	probeExFAT,
+	probeNTFS,
+	probeFAT,
+}
+
+// Probe identifies the signature on a device or image of the given size
+func Probe(r io.ReaderAt, size int64) (*Result, error) {
+	results := ProbeAll(r, size)
+	if len(results) < 1 {
+		return nil, ErrNoSignature
+	}
+
+	return results[0], nil
+}
+
+// ProbeAll returns every signature found, most specific first. More than
+// one usually means a device was reformatted without being wiped
+func ProbeAll(r io.ReaderAt, size int64) []*Result {
+	var out []*Result
+
+	for _, p := range probers {
+		if res := p(r, size); res != nil {
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
+
+// ProbeFile identifies the signature on a block device or image file
+func ProbeFile(path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	// Stat reports 0 for block devices, seeking to the end works for both
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return Probe(f, size)
+}
+
+// readAt reads n bytes at an offset, returning nil if they can't be read
+func readAt(r io.ReaderAt, off int64, n int) []byte {
+	if off < 0 {
+		return nil
+	}
+
+	b := make([]byte, n)
+
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil
+	}
+
+	return b
+}
+
+// formatUUID formats 16 bytes as a UUID
+func formatUUID(b []byte) string {
+	if bytes.Equal(b, make([]byte, 16)) {
+		return ""
+	}
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// cString returns a NUL padded string with trailing spaces removed
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return strings.TrimRight(string(b), " ")
+}
+
+// decodeUTF16 decodes a UTF-16LE string, stopping at a NUL
+func decodeUTF16(b []byte) string {
+	var u []uint16
+
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+
+		u = append(u, c)
+	}
+
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,383 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const (
+	testUUID    = "5f2a9c4e-8b1d-4e7a-9c3f-1a2b3c4d5e6f"
+	testSubUUID = "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+	testSize    = 4 << 20
+)
+
+func uuidBytes(t *testing.T, v string) []byte {
+	b, err := hex.DecodeString(strings.Replace(v, "-", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func utf16Bytes(v string) []byte {
+	var b []byte
+
+	for _, c := range utf16.Encode([]rune(v)) {
+		b = append(b, byte(c), byte(c>>8))
+	}
+
+	return b
+}
+
+func extImage(t *testing.T, compat, incompat uint32) []byte {
+	img := make([]byte, testSize)
+	sb := img[1024:]
+	le := binary.LittleEndian
+
+	le.PutUint32(sb[0x04:], 1024)
+	le.PutUint32(sb[0x18:], 2)
+	le.PutUint16(sb[0x38:], extMagic)
+	le.PutUint32(sb[0x4c:], 1)
+	le.PutUint32(sb[0x5c:], compat)
+	le.PutUint32(sb[0x60:], incompat)
+	copy(sb[0x68:], uuidBytes(t, testUUID))
+	copy(sb[0x78:], "rootfs")
+
+	return img
+}
+
+func xfsImage(t *testing.T) []byte {
+	img := make([]byte, testSize)
+	be := binary.BigEndian
+
+	copy(img, xfsMagic)
+	be.PutUint32(img[4:], 4096)
+	be.PutUint64(img[8:], 1024)
+	copy(img[32:], uuidBytes(t, testUUID))
+	be.PutUint16(img[100:], 0xb4a5)
+	copy(img[108:], "data")
+
+	return img
+}
+
+func btrfsImage(t *testing.T) []byte {
+	img := make([]byte, testSize)
+	sb := img[btrfsSuperblockOffset:]
+
+	copy(sb[0x20:], uuidBytes(t, testUUID))
+	copy(sb[0x40:], btrfsMagic)
+	binary.LittleEndian.PutUint64(sb[0x70:], testSize)
+	binary.LittleEndian.PutUint32(sb[0x90:], 4096)
+	copy(sb[btrfsDevItem+0x42:], uuidBytes(t, testSubUUID))
+	copy(sb[0x12b:], "pool")
+
+	return img
+}
+
+// zfsPair encodes an XDR nvpair
+func zfsPair(name string, value interface{}) []byte {
+	be := binary.BigEndian
+	padded := (len(name) + 3) &^ 3
+
+	b := make([]byte, 12+padded+8)
+	be.PutUint32(b[8:], uint32(len(name)))
+	copy(b[12:], name)
+
+	switch v := value.(type) {
+	case uint64:
+		be.PutUint32(b[12+padded:], zfsTypeUint64)
+		b = append(b, make([]byte, 8)...)
+		be.PutUint64(b[len(b)-8:], v)
+	case string:
+		be.PutUint32(b[12+padded:], zfsTypeString)
+		s := make([]byte, 4+(len(v)+3)&^3)
+		be.PutUint32(s, uint32(len(v)))
+		copy(s[4:], v)
+		b = append(b, s...)
+	}
+
+	be.PutUint32(b[12+padded+4:], 1)
+	be.PutUint32(b[0:], uint32(len(b)))
+	be.PutUint32(b[4:], uint32(len(b)))
+
+	return b
+}
+
+func zfsImage(t *testing.T) []byte {
+	img := make([]byte, testSize)
+
+	// only the last label survives
+	label := img[zfsLabelOffsets(testSize)[3]:]
+
+	nvlist := []byte{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	nvlist = append(nvlist, zfsPair("version", uint64(5000))...)
+	nvlist = append(nvlist, zfsPair("name", "tank")...)
+	nvlist = append(nvlist, zfsPair("state", uint64(0))...)
+	nvlist = append(nvlist, zfsPair("pool_guid", uint64(12345678901234567890))...)
+	nvlist = append(nvlist, zfsPair("guid", uint64(9876543210))...)
+	copy(label[zfsNVListOffset:], nvlist)
+
+	binary.LittleEndian.PutUint64(label[zfsUberblockStart+5*zfsUberblockSlot:], zfsUberblockMagic)
+
+	return img
+}
+
+func lvmImage() []byte {
+	img := make([]byte, testSize)
+	label := img[512:]
+
+	copy(label, lvmLabelMagic)
+	binary.LittleEndian.PutUint64(label[8:], 1)
+	binary.LittleEndian.PutUint32(label[20:], 32)
+	copy(label[24:], lvmLabelType)
+	copy(label[32:], "Xq3vE2kR7mT9pL1wZ8yN4bC6dF0gH5jA")
+	binary.LittleEndian.PutUint64(label[64:], testSize)
+
+	return img
+}
+
+func luksImage(version uint16) []byte {
+	img := make([]byte, testSize)
+
+	copy(img, luksMagic)
+	binary.BigEndian.PutUint16(img[6:], version)
+	copy(img[168:], testUUID)
+
+	if version == 2 {
+		copy(img[24:], "secret")
+	}
+
+	return img
+}
+
+func mdImage(t *testing.T, off int64) []byte {
+	img := make([]byte, testSize)
+	sb := img[off:]
+	le := binary.LittleEndian
+
+	le.PutUint32(sb[0:], mdMagic)
+	le.PutUint32(sb[4:], 1)
+	copy(sb[16:], uuidBytes(t, testUUID))
+	copy(sb[32:], "host:0")
+	le.PutUint64(sb[136:], 4096)
+	le.PutUint64(sb[144:], uint64(off/512))
+	copy(sb[168:], uuidBytes(t, testSubUUID))
+
+	return img
+}
+
+func md090Image() []byte {
+	img := make([]byte, testSize)
+	sb := img[testSize-64<<10:]
+	le := binary.LittleEndian
+
+	le.PutUint32(sb[0:], mdMagic)
+	le.PutUint32(sb[8:], 90)
+	le.PutUint32(sb[20:], 0x5f2a9c4e)
+	le.PutUint32(sb[32:], 2048)
+	le.PutUint32(sb[52:], 0x8b1d4e7a)
+	le.PutUint32(sb[56:], 0x9c3f1a2b)
+	le.PutUint32(sb[60:], 0x3c4d5e6f)
+
+	return img
+}
+
+func swapImage(t *testing.T) []byte {
+	img := make([]byte, testSize)
+
+	copy(img[4096-10:], "SWAPSPACE2")
+	binary.LittleEndian.PutUint32(img[1024:], 1)
+	binary.LittleEndian.PutUint32(img[1028:], testSize/4096-1)
+	copy(img[1036:], uuidBytes(t, testUUID))
+	copy(img[1052:], "swap0")
+
+	return img
+}
+
+func fatImage(fat32 bool) []byte {
+	img := make([]byte, testSize)
+	le := binary.LittleEndian
+
+	copy(img[3:], "mkfs.fat")
+	le.PutUint16(img[11:], 512)
+	img[13] = 4
+	le.PutUint16(img[14:], 4)
+	img[16] = 2
+	le.PutUint16(img[19:], testSize/512)
+
+	ebpb := 36
+
+	if fat32 {
+		le.PutUint16(img[19:], 0)
+		le.PutUint32(img[32:], testSize/512)
+		le.PutUint32(img[36:], 16)
+		ebpb = 64
+	} else {
+		// small enough clusters that there are too many for FAT12
+		img[13] = 1
+		le.PutUint16(img[17:], 512)
+		le.PutUint16(img[22:], 8)
+	}
+
+	img[ebpb+2] = fatExtendedSignature
+	le.PutUint32(img[ebpb+3:], 0x1a2b3c4d)
+	copy(img[ebpb+7:], "BOOT       ")
+	img[510], img[511] = 0x55, 0xaa
+
+	return img
+}
+
+func exfatImage() []byte {
+	img := make([]byte, testSize)
+	le := binary.LittleEndian
+
+	copy(img[3:], exfatOEM)
+	le.PutUint64(img[72:], testSize/512)
+	le.PutUint32(img[88:], 64)
+	le.PutUint32(img[96:], 4)
+	le.PutUint32(img[100:], 0xcafe0123)
+	le.PutUint16(img[104:], 0x0100)
+	img[108], img[109] = 9, 3
+	img[510], img[511] = 0x55, 0xaa
+
+	// the root directory is cluster 4, after a bitmap entry
+	dir := img[64*512+2*4096:]
+	dir[0] = 0x81
+	dir[32] = 0x83
+	dir[33] = 5
+	copy(dir[34:], utf16Bytes("media"))
+
+	return img
+}
+
+func ntfsImage() []byte {
+	img := make([]byte, testSize)
+	le := binary.LittleEndian
+
+	copy(img[3:], ntfsOEM)
+	le.PutUint16(img[11:], 512)
+	img[13] = 8
+	le.PutUint64(img[40:], testSize/512-1)
+	le.PutUint64(img[48:], 4)
+	img[64] = 0xf6
+	le.PutUint64(img[72:], 0x0123456789abcdef)
+	img[510], img[511] = 0x55, 0xaa
+
+	// $Volume is the fourth 1 KiB record of the MFT at cluster 4
+	rec := img[4*4096+3*1024 : 4*4096+4*1024]
+	copy(rec, "FILE")
+	le.PutUint16(rec[4:], 48)
+	le.PutUint16(rec[6:], 3)
+	le.PutUint16(rec[20:], 56)
+
+	name := utf16Bytes("Windows")
+
+	attr := rec[56:]
+	le.PutUint32(attr[0:], ntfsAttrVolumeName)
+	le.PutUint32(attr[4:], 40)
+	le.PutUint32(attr[16:], uint32(len(name)))
+	le.PutUint16(attr[20:], 24)
+	copy(attr[24:], name)
+
+	attr = rec[96:]
+	le.PutUint32(attr[0:], ntfsAttrVolumeInfo)
+	le.PutUint32(attr[4:], 40)
+	le.PutUint32(attr[16:], 12)
+	le.PutUint16(attr[20:], 24)
+	attr[24+8], attr[24+9] = 3, 1
+
+	le.PutUint32(rec[136:], ntfsAttrEnd)
+
+	// the update sequence number replaces the end of each sector
+	copy(rec[48:], []byte{0x07, 0x00, 0xaa, 0xbb, 0xcc, 0xdd})
+	rec[510], rec[511] = rec[48], rec[49]
+	rec[1022], rec[1023] = rec[48], rec[49]
+
+	return img
+}
+
+func TestProbe(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		img  []byte
+		want Result
+	}{
+		{"ext2", extImage(t, 0, 0), Result{Type: "ext2", Usage: UsageFilesystem, UUID: testUUID,
+			Label: "rootfs", Version: "1.0", Size: 4 << 20, BlockSize: 4096, Offset: 1024}},
+		{"ext3", extImage(t, extCompatHasJournal, 0), Result{Type: "ext3", Usage: UsageFilesystem, UUID: testUUID,
+			Label: "rootfs", Version: "1.0", Size: 4 << 20, BlockSize: 4096, Offset: 1024}},
+		{"ext4", extImage(t, extCompatHasJournal, extIncompatExtents), Result{Type: "ext4", Usage: UsageFilesystem,
+			UUID: testUUID, Label: "rootfs", Version: "1.0", Size: 4 << 20, BlockSize: 4096, Offset: 1024}},
+		{"xfs", xfsImage(t), Result{Type: "xfs", Usage: UsageFilesystem, UUID: testUUID, Label: "data",
+			Version: "5", Size: 4 << 20, BlockSize: 4096}},
+		{"btrfs", btrfsImage(t), Result{Type: "btrfs", Usage: UsageFilesystem, UUID: testUUID, SubUUID: testSubUUID,
+			Label: "pool", Size: 4 << 20, BlockSize: 4096, Offset: btrfsSuperblockOffset}},
+		{"zfs", zfsImage(t), Result{Type: "zfs_member", Usage: UsageFilesystem, UUID: "12345678901234567890",
+			SubUUID: "9876543210", Label: "tank", Version: "5000", Offset: testSize - zfsLabelSize}},
+		{"lvm", lvmImage(), Result{Type: "LVM2_member", Usage: UsageRAID, UUID: "Xq3vE2-kR7m-T9pL-1wZ8-yN4b-C6dF-0gH5jA",
+			Version: "LVM2 001", Size: 4 << 20, Offset: 512}},
+		{"luks1", luksImage(1), Result{Type: "crypto_LUKS", Usage: UsageCrypto, UUID: testUUID, Version: "1"}},
+		{"luks2", luksImage(2), Result{Type: "crypto_LUKS", Usage: UsageCrypto, UUID: testUUID, Label: "secret", Version: "2"}},
+		{"md1.2", mdImage(t, 4096), Result{Type: "linux_raid_member", Usage: UsageRAID, UUID: testUUID,
+			SubUUID: testSubUUID, Label: "host:0", Version: "1.2", Size: 2 << 20, Offset: 4096}},
+		{"md1.0", mdImage(t, testSize-8192), Result{Type: "linux_raid_member", Usage: UsageRAID, UUID: testUUID,
+			SubUUID: testSubUUID, Label: "host:0", Version: "1.0", Size: 2 << 20, Offset: testSize - 8192}},
+		{"md0.90", md090Image(), Result{Type: "linux_raid_member", Usage: UsageRAID, UUID: testUUID,
+			Version: "0.90.0", Size: 2 << 20, Offset: testSize - 64<<10}},
+		{"swap", swapImage(t), Result{Type: "swap", Usage: UsageOther, UUID: testUUID, Label: "swap0",
+			Version: "1", Size: 4 << 20, BlockSize: 4096, Offset: 4086}},
+		{"fat16", fatImage(false), Result{Type: "vfat", Usage: UsageFilesystem, UUID: "1A2B-3C4D", Label: "BOOT",
+			Version: "FAT16", Size: 4 << 20, BlockSize: 512}},
+		{"fat32", fatImage(true), Result{Type: "vfat", Usage: UsageFilesystem, UUID: "1A2B-3C4D", Label: "BOOT",
+			Version: "FAT32", Size: 4 << 20, BlockSize: 2048}},
+		{"exfat", exfatImage(), Result{Type: "exfat", Usage: UsageFilesystem, UUID: "CAFE-0123", Label: "media",
+			Version: "1.0", Size: 4 << 20, BlockSize: 4096}},
+		{"ntfs", ntfsImage(), Result{Type: "ntfs", Usage: UsageFilesystem, UUID: "0123456789ABCDEF", Label: "Windows",
+			Version: "3.1", Size: 4<<20 - 512, BlockSize: 4096}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name+".img")
+
+			if err := os.WriteFile(path, tc.img, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := ProbeFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *res != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, *res)
+			}
+		})
+	}
+}
+
+func TestProbeAmbiguous(t *testing.T) {
+	// an ext4 filesystem inside an mdraid 1.0 mirror member
+	img := mdImage(t, testSize-8192)
+	copy(img[1024:2048], extImage(t, extCompatHasJournal, extIncompatExtents)[1024:2048])
+
+	results := ProbeAll(bytes.NewReader(img), testSize)
+	if len(results) != 2 || results[0].Type != "linux_raid_member" || results[1].Type != "ext4" {
+		t.Errorf("unexpected results %v", results)
+	}
+
+	if _, err := Probe(bytes.NewReader(make([]byte, testSize)), testSize); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("expected ErrNoSignature, got %v", err)
+	}
+
+	if s := results[0].String(); s != `TYPE="linux_raid_member" USAGE="raid" UUID="`+testUUID+`" UUID_SUB="`+testSubUUID+
+		`" LABEL="host:0" VERSION="1.0"` {
+		t.Errorf("unexpected string %s", s)
+	}
+}
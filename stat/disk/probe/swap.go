@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"encoding/binary"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+// swapPageSizes are the page sizes the swap signature may end
+var swapPageSizes = []int64{4096, 8192, 16384, 65536}
+
+// probeSwap finds a Linux swap signature at the end of the first page
+func probeSwap(r io.ReaderAt, size int64) *Result {
+	for _, page := range swapPageSizes {
+		b := readAt(r, page-10, 10)
+		if b == nil {
+			continue
+		}
+
+		switch string(b) {
+		case "SWAP-SPACE":
+			return &Result{Type: "swap", Usage: UsageOther, Version: "0", BlockSize: page, Offset: page - 10}
+		case "SWAPSPACE2":
+		default:
+			continue
+		}
+
+		hdr := readAt(r, 1024, 44)
+		if hdr == nil {
+			return nil
+		}
+
+		le := binary.LittleEndian
+
+		return &Result{
+			Type:      "swap",
+			Usage:     UsageOther,
+			UUID:      formatUUID(hdr[12:28]),
+			Label:     cString(hdr[28:44]),
+			Version:   "1",
+			Size:      cap.Capacity(int64(le.Uint32(hdr[4:])+1) * page),
+			BlockSize: page,
+			Offset:    page - 10,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io"
+)
+
+const xfsMagic = "XFSB"
+
+// probeXFS finds an XFS superblock at the start of the device
+func probeXFS(r io.ReaderAt, size int64) *Result {
+	sb := readAt(r, 0, 512)
+	if sb == nil || string(sb[0:4]) != xfsMagic {
+		return nil
+	}
+
+	be := binary.BigEndian
+
+	blockSize := int64(be.Uint32(sb[4:]))
+	if blockSize < 512 || blockSize > 65536 {
+		return nil
+	}
+
+	return &Result{
+		Type:      "xfs",
+		Usage:     UsageFilesystem,
+		UUID:      formatUUID(sb[32:48]),
+		Label:     cString(sb[108:120]),
+		Version:   fmt.Sprintf("%d", be.Uint16(sb[100:])&0x000f),
+		Size:      cap.Capacity(int64(be.Uint64(sb[8:])) * blockSize),
+		BlockSize: blockSize,
+	}
+}
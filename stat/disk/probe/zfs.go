@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+const (
+	zfsLabelSize      = 256 << 10
+	zfsNVListOffset   = 16 << 10
+	zfsNVListSize     = 112 << 10
+	zfsUberblockStart = 128 << 10
+	zfsUberblockSlot  = 1 << 10
+	zfsUberblockMagic = 0x00bab10c
+
+	zfsTypeUint64 = 8
+	zfsTypeString = 9
+)
+
+// zfsLabelOffsets returns the offsets of the four vdev labels, two at the
+// start and two at the end of the device
+func zfsLabelOffsets(size int64) []int64 {
+	end := size &^ (zfsLabelSize - 1)
+
+	return []int64{0, zfsLabelSize, end - 2*zfsLabelSize, end - zfsLabelSize}
+}
+
+// probeZFS finds a vdev label with a valid uberblock and reads the pool's
+// name and GUIDs from its config. Like blkid, the GUIDs are decimal
+func probeZFS(r io.ReaderAt, size int64) *Result {
+	for _, off := range zfsLabelOffsets(size) {
+		if off < 0 || !hasZFSUberblock(r, off) {
+			continue
+		}
+
+		b := readAt(r, off+zfsNVListOffset, zfsNVListSize)
+		if b == nil {
+			continue
+		}
+
+		config := parseZFSNVList(b)
+
+		name, _ := config["name"].(string)
+		pool, _ := config["pool_guid"].(uint64)
+		guid, _ := config["guid"].(uint64)
+		version, _ := config["version"].(uint64)
+
+		res := &Result{
+			Type:    "zfs_member",
+			Usage:   UsageFilesystem,
+			Label:   name,
+			Version: strconv.FormatUint(version, 10),
+			Offset:  off,
+		}
+
+		if pool > 0 {
+			res.UUID = strconv.FormatUint(pool, 10)
+		}
+
+		if guid > 0 {
+			res.SubUUID = strconv.FormatUint(guid, 10)
+		}
+
+		return res
+	}
+
+	return nil
+}
+
+// hasZFSUberblock returns true if any uberblock slot in the label at off has
+// the uberblock magic in either byte order
+func hasZFSUberblock(r io.ReaderAt, off int64) bool {
+	b := readAt(r, off+zfsUberblockStart, zfsLabelSize-zfsUberblockStart)
+	if b == nil {
+		return false
+	}
+
+	for i := 0; i+8 <= len(b); i += zfsUberblockSlot {
+		if binary.LittleEndian.Uint64(b[i:]) == zfsUberblockMagic || binary.BigEndian.Uint64(b[i:]) == zfsUberblockMagic {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseZFSNVList returns the top level uint64 and string values of an XDR
+// encoded nvlist
+func parseZFSNVList(b []byte) map[string]interface{} {
+	out := make(map[string]interface{})
+
+	// 4 byte encoding header, then the nvlist's version and flags
+	if len(b) < 12 || b[0] != 1 {
+		return out
+	}
+
+	be := binary.BigEndian
+
+	for pos := 12; pos+8 <= len(b); {
+		encoded := int(be.Uint32(b[pos:]))
+		if encoded == 0 || pos+encoded > len(b) {
+			break
+		}
+
+		pair := b[pos : pos+encoded]
+		pos += encoded
+
+		if len(pair) < 12 {
+			break
+		}
+
+		n := int(be.Uint32(pair[8:]))
+		valueStart := 12 + (n+3)&^3
+
+		if valueStart+8 > len(pair) || n > len(pair)-12 {
+			continue
+		}
+
+		name := string(pair[12 : 12+n])
+		typ := be.Uint32(pair[valueStart:])
+		value := pair[valueStart+8:]
+
+		switch {
+		case typ == zfsTypeUint64 && len(value) >= 8:
+			out[name] = be.Uint64(value)
+		case typ == zfsTypeString && len(value) >= 4:
+			if l := int(be.Uint32(value)); l <= len(value)-4 {
+				out[name] = string(value[4 : 4+l])
+			}
+		}
+	}
+
+	return out
+}
@@ -7,65 +7,218 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"os/exec"
+	"strings"
 )
 
 var ErrSmartctlNotInstalled = errors.New("smartctl is not installed on this system")
 
+// SMARTExitCode is the exit status of smartctl, a bitmask of the flags below
 type SMARTExitCode int
 
 const (
 	SmartOK                SMARTExitCode = 0
-	SmartCmdFailed                       = 1
-	DeviceOpenFailed                     = 2
-	SmartResponseError                   = 4
-	SmartDiskFailing                     = 8
-	SmartPrefail                         = 16
-	SmartPreviousPrefail                 = 32
-	SmartErrorLogHasErrors               = 64
-	SmartSelfTestErrors                  = 128
+	SmartCmdFailed         SMARTExitCode = 1
+	DeviceOpenFailed       SMARTExitCode = 2
+	SmartResponseError     SMARTExitCode = 4
+	SmartDiskFailing       SMARTExitCode = 8
+	SmartPrefail           SMARTExitCode = 16
+	SmartPreviousPrefail   SMARTExitCode = 32
+	SmartErrorLogHasErrors SMARTExitCode = 64
+	SmartSelfTestErrors    SMARTExitCode = 128
 )
 
+// errors returned by SMARTInfo.Error for each SMARTExitCode flag, to be
+// checked with errors.Is
 var (
-	smartExitCodeString = map[SMARTExitCode]string{
-		SmartOK:                "OK",
-		SmartCmdFailed:         "Command failed",
-		DeviceOpenFailed:       "Device open failed, device did not return an IDENTIFY DEVICE structure, or device is in a low-power mode",
-		SmartResponseError:     "Some SMART or other ATA command to the disk failed, or there was a checksum error in a SMART data structure",
-		SmartDiskFailing:       "DISK FAILING",
-		SmartPrefail:           "prefail Attributes <= threshold",
-		SmartPreviousPrefail:   "SMART status check returned \"DISK OK\" but we found that some (usage or prefail) Attributes have been <= threshold at some time in the past",
-		SmartErrorLogHasErrors: "The device error log contains records of errors",
-		SmartSelfTestErrors:    "The device self-test log contains records of errors",
-	}
+	ErrSmartCmdFailed         = errors.New("command failed")
+	ErrDeviceOpenFailed       = errors.New("device open failed")
+	ErrSmartResponseError     = errors.New("SMART command failed or checksum error")
+	ErrSmartDiskFailing       = errors.New("disk failing")
+	ErrSmartPrefail           = errors.New("prefail attributes <= threshold")
+	ErrSmartPreviousPrefail   = errors.New("attributes <= threshold in the past")
+	ErrSmartErrorLogHasErrors = errors.New("error log contains errors")
+	ErrSmartSelfTestErrors    = errors.New("self-test log contains errors")
 )
 
+var smartExitCodeFlags = []struct {
+	flag SMARTExitCode
+	name string
+	desc string
+	err  error
+}{
+	{SmartCmdFailed, "cmd_failed", "Command failed", ErrSmartCmdFailed},
+	{DeviceOpenFailed, "device_open_failed", "Device open failed, device did not return an IDENTIFY DEVICE structure, or device is in a low-power mode", ErrDeviceOpenFailed},
+	{SmartResponseError, "response_error", "Some SMART or other ATA command to the disk failed, or there was a checksum error in a SMART data structure", ErrSmartResponseError},
+	{SmartDiskFailing, "disk_failing", "DISK FAILING", ErrSmartDiskFailing},
+	{SmartPrefail, "prefail", "prefail Attributes <= threshold", ErrSmartPrefail},
+	{SmartPreviousPrefail, "previous_prefail", "SMART status check returned \"DISK OK\" but we found that some (usage or prefail) Attributes have been <= threshold at some time in the past", ErrSmartPreviousPrefail},
+	{SmartErrorLogHasErrors, "error_log_has_errors", "The device error log contains records of errors", ErrSmartErrorLogHasErrors},
+	{SmartSelfTestErrors, "self_test_errors", "The device self-test log contains records of errors", ErrSmartSelfTestErrors},
+}
+
+// Has returns true if all of the given flags are set
+func (ec SMARTExitCode) Has(flag SMARTExitCode) bool {
+	return ec&flag == flag
+}
+
+// Flags returns each flag that is set
+func (ec SMARTExitCode) Flags() []SMARTExitCode {
+	var out []SMARTExitCode
+
+	for _, f := range smartExitCodeFlags {
+		if ec.Has(f.flag) {
+			out = append(out, f.flag)
+		}
+	}
+
+	return out
+}
+
+// Names returns the short name of each flag that is set
+func (ec SMARTExitCode) Names() []string {
+	out := []string{}
+
+	for _, f := range smartExitCodeFlags {
+		if ec.Has(f.flag) {
+			out = append(out, f.name)
+		}
+	}
+
+	return out
+}
+
+// String returns a description of each flag that is set separated by
+// semicolons, or OK if none are set
 func (ec SMARTExitCode) String() string {
-	return smartExitCodeString[ec]
+	if ec == SmartOK {
+		return "OK"
+	}
+
+	var out []string
+
+	for _, f := range smartExitCodeFlags {
+		if ec.Has(f.flag) {
+			out = append(out, f.desc)
+		}
+	}
+
+	return strings.Join(out, "; ")
+}
+
+// MarshalYAML implements the yaml Marshaler
+func (ec SMARTExitCode) MarshalYAML() (interface{}, error) {
+	return ec.Names(), nil
+}
+
+// UnmarshalYAML implements the yaml Unmarshaler, accepting a list of flag
+// names or the exit status
+func (ec *SMARTExitCode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v int
+	if err := unmarshal(&v); err == nil {
+		*ec = SMARTExitCode(v)
+		return nil
+	}
+
+	var names []string
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+
+	return ec.setNames(names)
 }
 
+// MarshalJSON implements the json Marshaler
 func (ec SMARTExitCode) MarshalJSON() ([]byte, error) {
-	return []byte(ec.String()), nil
+	return json.Marshal(ec.Names())
+}
+
+// UnmarshalJSON implements the json Unmarshaler, accepting a list of flag
+// names or the exit status
+func (ec *SMARTExitCode) UnmarshalJSON(b []byte) error {
+	var v int
+	if err := json.Unmarshal(b, &v); err == nil {
+		*ec = SMARTExitCode(v)
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+
+	return ec.setNames(names)
+}
+
+// setNames sets the exit code from a list of flag names
+func (ec *SMARTExitCode) setNames(names []string) error {
+	var v SMARTExitCode
+
+	for _, name := range names {
+		found := false
+
+		for _, f := range smartExitCodeFlags {
+			if f.name == name {
+				v |= f.flag
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("unknown smartctl exit code flag %q", name)
+		}
+	}
+
+	*ec = v
+
+	return nil
+}
+
+// SMARTError is the error returned by SMARTInfo.Error. errors.Is matches the
+// ErrSmart errors for each flag of the exit code
+type SMARTError struct {
+	ExitCode SMARTExitCode
+	Messages []SMARTMessage
+}
+
+// Error implements error
+func (e *SMARTError) Error() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "smartctl error: %s", e.ExitCode)
+
+	for _, msg := range e.Messages {
+		fmt.Fprintf(&buf, " [%s] %s", msg.Severity, msg.String)
+	}
+
+	return buf.String()
+}
+
+// Is returns true if target is the error for one of the exit code flags
+func (e *SMARTError) Is(target error) bool {
+	for _, f := range smartExitCodeFlags {
+		if e.ExitCode.Has(f.flag) && f.err == target {
+			return true
+		}
+	}
+
+	return false
 }
 
 type SMARTInfo struct {
 	ExitCode SMARTExitCode `yaml:"exit_code" json:"exit_code"`
 	Smartctl struct {
-		Version      []int    `yaml:"version" json:"version"`
-		SvnRevision  string   `yaml:"svn_revision" json:"svn_revision"`
-		PlatformInfo string   `yaml:"platform_info" json:"platform_info"`
-		BuildInfo    string   `yaml:"build_info" json:"build_info"`
-		Argv         []string `yaml:"argv" json:"argv"`
-		ExitStatus   int      `yaml:"exit_status" json:"exit_status"`
+		Version      []int          `yaml:"version" json:"version"`
+		SvnRevision  string         `yaml:"svn_revision" json:"svn_revision"`
+		PlatformInfo string         `yaml:"platform_info" json:"platform_info"`
+		BuildInfo    string         `yaml:"build_info" json:"build_info"`
+		Argv         []string       `yaml:"argv" json:"argv"`
+		ExitStatus   int            `yaml:"exit_status" json:"exit_status"`
+		Messages     []SMARTMessage `yaml:"messages,omitempty" json:"messages,omitempty"`
 	} `yaml:"smartctl" json:"smartctl"`
-	Device struct {
-		Name     string `yaml:"name" json:"name"`
-		InfoName string `yaml:"info_name" json:"info_name"`
-		Type     string `yaml:"type" json:"type"`
-		Protocol string `yaml:"protocol" json:"protocol"`
-	} `yaml:"device" json:"device"`
-	ModelFamily  string `yaml:"model_family" json:"model_family"`
-	ModelName    string `yaml:"model_name" json:"model_name"`
-	SerialNumber string `yaml:"serial_number" json:"serial_number"`
+	Device       SMARTDevice `yaml:"device" json:"device"`
+	ModelFamily  string      `yaml:"model_family" json:"model_family"`
+	ModelName    string      `yaml:"model_name" json:"model_name"`
+	SerialNumber string      `yaml:"serial_number" json:"serial_number"`
 	Wwn          struct {
 		Naa int   `yaml:"naa" json:"naa"`
 		Oui int   `yaml:"oui" json:"oui"`
@@ -111,9 +264,9 @@ type SMARTInfo struct {
 		TimeT   int    `yaml:"time_t" json:"time_t"`
 		Asctime string `yaml:"asctime" json:"asctime"`
 	} `yaml:"local_time" json:"local_time"`
-	SmartStatus struct {
-		Passed bool `yaml:"passed" json:"passed"`
-	} `yaml:"smart_status" json:"smart_status"`
+	// SmartStatus is nil when the drive didn't report an overall health
+	// self-assessment
+	SmartStatus  *SMARTStatus `yaml:"smart_status,omitempty" json:"smart_status,omitempty"`
 	AtaSmartData struct {
 		OfflineDataCollection struct {
 			Status struct {
@@ -125,9 +278,10 @@ type SMARTInfo struct {
 		} `yaml:"offline_data_collection" json:"offline_data_collection"`
 		SelfTest struct {
 			Status struct {
-				Value  int    `yaml:"value" json:"value"`
-				String string `yaml:"string" json:"string"`
-				Passed bool   `yaml:"passed" json:"passed"`
+				Value            int    `yaml:"value" json:"value"`
+				String           string `yaml:"string" json:"string"`
+				RemainingPercent int    `yaml:"remaining_percent,omitempty" json:"remaining_percent,omitempty"`
+				Passed           bool   `yaml:"passed" json:"passed"`
 			} `yaml:"status" json:"status"`
 			PollingMinutes struct {
 				Short      int `yaml:"short" json:"short"`
@@ -155,36 +309,29 @@ type SMARTInfo struct {
 		DataTableSupported            bool `yaml:"data_table_supported" json:"data_table_supported"`
 	} `yaml:"ata_sct_capabilities" json:"ata_sct_capabilities"`
 	AtaSmartAttributes struct {
-		Revision int `yaml:"revision" json:"revision"`
-		Table    []struct {
-			ID         int    `yaml:"id" json:"id"`
-			Name       string `yaml:"name" json:"name"`
-			Value      int    `yaml:"value" json:"value"`
-			Worst      int    `yaml:"worst" json:"worst"`
-			Thresh     int    `yaml:"thresh" json:"thresh"`
-			WhenFailed string `yaml:"when_failed" json:"when_failed"`
-			Flags      struct {
-				Value         int    `yaml:"value" json:"value"`
-				String        string `yaml:"string" json:"string"`
-				Prefailure    bool   `yaml:"prefailure" json:"prefailure"`
-				UpdatedOnline bool   `yaml:"updated_online" json:"updated_online"`
-				Performance   bool   `yaml:"performance" json:"performance"`
-				ErrorRate     bool   `yaml:"error_rate" json:"error_rate"`
-				EventCount    bool   `yaml:"event_count" json:"event_count"`
-				AutoKeep      bool   `yaml:"auto_keep" json:"auto_keep"`
-			} `yaml:"flags" json:"flags"`
-			Raw struct {
-				Value  int    `yaml:"value" json:"value"`
-				String string `yaml:"string" json:"string"`
-			} `yaml:"raw" json:"raw"`
-		} `yaml:"table" json:"table"`
+		Revision int              `yaml:"revision" json:"revision"`
+		Table    []SMARTAttribute `yaml:"table" json:"table"`
 	} `yaml:"ata_smart_attributes" json:"ata_smart_attributes"`
 	PowerOnTime struct {
-		Hours int `yaml:"hours" json:"hours"`
+		Hours   int `yaml:"hours" json:"hours"`
+		Minutes int `yaml:"minutes,omitempty" json:"minutes,omitempty"`
 	} `yaml:"power_on_time" json:"power_on_time"`
 	PowerCycleCount int `yaml:"power_cycle_count" json:"power_cycle_count"`
 	Temperature     struct {
-		Current int `yaml:"current" json:"current"`
+		Current   int `yaml:"current" json:"current"`
+		DriveTrip int `yaml:"drive_trip,omitempty" json:"drive_trip,omitempty"`
+		// the history and limits below are nil unless the drive reports them,
+		// e.g. ATA drives with SCT status and NVMe drives
+		PowerCycleMin    *int `yaml:"power_cycle_min,omitempty" json:"power_cycle_min,omitempty"`
+		PowerCycleMax    *int `yaml:"power_cycle_max,omitempty" json:"power_cycle_max,omitempty"`
+		LifetimeMin      *int `yaml:"lifetime_min,omitempty" json:"lifetime_min,omitempty"`
+		LifetimeMax      *int `yaml:"lifetime_max,omitempty" json:"lifetime_max,omitempty"`
+		OpLimitMin       *int `yaml:"op_limit_min,omitempty" json:"op_limit_min,omitempty"`
+		OpLimitMax       *int `yaml:"op_limit_max,omitempty" json:"op_limit_max,omitempty"`
+		LimitMin         *int `yaml:"limit_min,omitempty" json:"limit_min,omitempty"`
+		LimitMax         *int `yaml:"limit_max,omitempty" json:"limit_max,omitempty"`
+		CriticalLimitMin *int `yaml:"critical_limit_min,omitempty" json:"critical_limit_min,omitempty"`
+		CriticalLimitMax *int `yaml:"critical_limit_max,omitempty" json:"critical_limit_max,omitempty"`
 	} `yaml:"temperature" json:"temperature"`
 	AtaSmartErrorLog struct {
 		Summary struct {
@@ -194,8 +341,11 @@ type SMARTInfo struct {
 	} `yaml:"ata_smart_error_log" json:"ata_smart_error_log"`
 	AtaSmartSelfTestLog struct {
 		Standard struct {
-			Revision int `yaml:"revision" json:"revision"`
-			Count    int `yaml:"count" json:"count"`
+			Revision           int                  `yaml:"revision" json:"revision"`
+			Table              []SMARTSelfTestEntry `yaml:"table,omitempty" json:"table,omitempty"`
+			Count              int                  `yaml:"count" json:"count"`
+			ErrorCountTotal    int                  `yaml:"error_count_total" json:"error_count_total"`
+			ErrorCountOutdated int                  `yaml:"error_count_outdated" json:"error_count_outdated"`
 		} `yaml:"standard" json:"standard"`
 	} `yaml:"ata_smart_self_test_log" json:"ata_smart_self_test_log"`
 	AtaSmartSelectiveSelfTestLog struct {
@@ -214,10 +364,69 @@ type SMARTInfo struct {
 		} `yaml:"flags" json:"flags"`
 		PowerUpScanResumeMinutes int `yaml:"power_up_scan_resume_minutes" json:"power_up_scan_resume_minutes"`
 	} `yaml:"ata_smart_selective_self_test_log" json:"ata_smart_selective_self_test_log"`
-	Messages []struct {
-		String   string `yaml:"string,omitempty" json:"string,omitempty"`
-		Severity string `yaml:"severity,omitempty" json:"severity,omitempty"`
-	} `yaml:"messages,omitempty" json:"messages,omitempty"`
+	NvmePciVendor                 *NVMePciVendor             `yaml:"nvme_pci_vendor,omitempty" json:"nvme_pci_vendor,omitempty"`
+	NvmeIeeeOuiIdentifier         int                        `yaml:"nvme_ieee_oui_identifier,omitempty" json:"nvme_ieee_oui_identifier,omitempty"`
+	NvmeTotalCapacity             int64                      `yaml:"nvme_total_capacity,omitempty" json:"nvme_total_capacity,omitempty"`
+	NvmeUnallocatedCapacity       int64                      `yaml:"nvme_unallocated_capacity,omitempty" json:"nvme_unallocated_capacity,omitempty"`
+	NvmeControllerID              int                        `yaml:"nvme_controller_id,omitempty" json:"nvme_controller_id,omitempty"`
+	NvmeVersion                   *NVMeVersion               `yaml:"nvme_version,omitempty" json:"nvme_version,omitempty"`
+	NvmeNumberOfNamespaces        int                        `yaml:"nvme_number_of_namespaces,omitempty" json:"nvme_number_of_namespaces,omitempty"`
+	NvmeNamespaces                []NVMeNamespace            `yaml:"nvme_namespaces,omitempty" json:"nvme_namespaces,omitempty"`
+	NvmeSmartHealthInformationLog *NVMeHealthInformationLog  `yaml:"nvme_smart_health_information_log,omitempty" json:"nvme_smart_health_information_log,omitempty"`
+	NvmeSelfTestLog               *NVMeSelfTestLog           `yaml:"nvme_self_test_log,omitempty" json:"nvme_self_test_log,omitempty"`
+	ScsiVendor                    string                     `yaml:"scsi_vendor,omitempty" json:"scsi_vendor,omitempty"`
+	ScsiProduct                   string                     `yaml:"scsi_product,omitempty" json:"scsi_product,omitempty"`
+	ScsiRevision                  string                     `yaml:"scsi_revision,omitempty" json:"scsi_revision,omitempty"`
+	ScsiGrownDefectList           *int64                     `yaml:"scsi_grown_defect_list,omitempty" json:"scsi_grown_defect_list,omitempty"`
+	ScsiErrorCounterLog           *ScsiErrorCounterLog       `yaml:"scsi_error_counter_log,omitempty" json:"scsi_error_counter_log,omitempty"`
+	ScsiStartStopCycleCounter     *ScsiStartStopCycleCounter `yaml:"scsi_start_stop_cycle_counter,omitempty" json:"scsi_start_stop_cycle_counter,omitempty"`
+	ScsiBackgroundScan            *ScsiBackgroundScan        `yaml:"scsi_background_scan,omitempty" json:"scsi_background_scan,omitempty"`
+	Messages                      []SMARTMessage             `yaml:"messages,omitempty" json:"messages,omitempty"`
+}
+
+// SMARTAttribute is a row of the ATA SMART attribute table
+type SMARTAttribute struct {
+	ID         int    `yaml:"id" json:"id"`
+	Name       string `yaml:"name" json:"name"`
+	Value      int    `yaml:"value" json:"value"`
+	Worst      int    `yaml:"worst" json:"worst"`
+	Thresh     int    `yaml:"thresh" json:"thresh"`
+	WhenFailed string `yaml:"when_failed" json:"when_failed"`
+	Flags      struct {
+		Value         int    `yaml:"value" json:"value"`
+		String        string `yaml:"string" json:"string"`
+		Prefailure    bool   `yaml:"prefailure" json:"prefailure"`
+		UpdatedOnline bool   `yaml:"updated_online" json:"updated_online"`
+		Performance   bool   `yaml:"performance" json:"performance"`
+		ErrorRate     bool   `yaml:"error_rate" json:"error_rate"`
+		EventCount    bool   `yaml:"event_count" json:"event_count"`
+		AutoKeep      bool   `yaml:"auto_keep" json:"auto_keep"`
+	} `yaml:"flags" json:"flags"`
+	Raw struct {
+		Value  int64  `yaml:"value" json:"value"`
+		String string `yaml:"string" json:"string"`
+	} `yaml:"raw" json:"raw"`
+}
+
+// SMARTDevice is a device smartctl can read, with the device type to read it
+// with
+type SMARTDevice struct {
+	Name      string `yaml:"name" json:"name"`
+	InfoName  string `yaml:"info_name" json:"info_name"`
+	Type      string `yaml:"type" json:"type"`
+	Protocol  string `yaml:"protocol" json:"protocol"`
+	OpenError string `yaml:"open_error,omitempty" json:"open_error,omitempty"`
+}
+
+// SMARTStatus is the drive's overall health self-assessment
+type SMARTStatus struct {
+	Passed bool `yaml:"passed" json:"passed"`
+}
+
+// SMARTMessage is a message reported while reading SMART data
+type SMARTMessage struct {
+	String   string `yaml:"string,omitempty" json:"string,omitempty"`
+	Severity string `yaml:"severity,omitempty" json:"severity,omitempty"`
 }
 
 // String implements stringer and returns a yaml formatted string
@@ -230,26 +439,44 @@ func (s *SMARTInfo) String() string {
 	return string(b)
 }
 
-// Healthy returns true if SMARTInfo.SmartStatus.Passed is true
-func (s *SMARTInfo) Healthy() bool {
-	return s.SmartStatus.Passed
+// WWN returns the world wide name in the form udev reports it, e.g.
+// 0x5000c500a1b2c3d4, or an empty string if the drive has none
+func (s *SMARTInfo) WWN() string {
+	if s.Wwn.Naa == 0 && s.Wwn.Oui == 0 && s.Wwn.ID == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("0x%x%06x%09x", s.Wwn.Naa, s.Wwn.Oui, s.Wwn.ID)
 }
 
-// Error returns true if SMARTInfo.Messages has an error value
-func (s *SMARTInfo) Error() error {
-	if s.Smartctl.ExitStatus == 0 {
-		return nil
+// Healthy returns true if the drive reported a passing overall health
+// self-assessment, an NVMe drive reports no critical warnings and a SCSI drive
+// has no health problems
+func (s *SMARTInfo) Healthy() bool {
+	if s.IsNVMe() && s.NvmeSmartHealthInformationLog.CriticalWarning != 0 {
+		return false
 	}
 
-	var buf bytes.Buffer
+	if s.IsSCSI() && len(s.SCSIHealthProblems()) > 0 {
+		return false
+	}
 
-	fmt.Fprintf(&buf, "smartctl error: %s", s.ExitCode)
+	return s.SmartStatus != nil && s.SmartStatus.Passed
+}
 
-	for _, msg := range s.Messages {
-		fmt.Fprintf(&buf, " [%s] %s", msg.Severity, msg.String)
+// StatusFailed returns true if the drive reported a failing overall health
+// self-assessment. A drive that didn't report one hasn't failed it
+func (s *SMARTInfo) StatusFailed() bool {
+	return s.SmartStatus != nil && !s.SmartStatus.Passed
+}
+
+// Error returns a *SMARTError if the smartctl exit code has any flags set
+func (s *SMARTInfo) Error() error {
+	if s.ExitCode == SmartOK {
+		return nil
 	}
 
-	return errors.New(buf.String())
+	return &SMARTError{ExitCode: s.ExitCode, Messages: s.allMessages()}
 }
 
 // JSON marshals SMARTInfo to json
@@ -257,15 +484,107 @@ func (s *SMARTInfo) JSON() ([]byte, error) {
 	return json.Marshal(s)
 }
 
-// GetSMARTInfo creates a new SMARTInfo for given device
-func GetSMARTInfo(dev string) (*SMARTInfo, error) {
+// ErrDeviceInStandby is returned when SMART data isn't read to avoid waking a
+// disk in standby or sleep
+var ErrDeviceInStandby = errors.New("device is in standby")
+
+// SMARTOption sets an option on how SMART data is read
+type SMARTOption func(o *smartOptions)
+
+type smartOptions struct {
+	noWake     bool
+	deviceType string
+}
+
+// WithNoWake doesn't wake disks that are spun down, returning
+// ErrDeviceInStandby instead. Only supported when smartctl is installed
+func WithNoWake() SMARTOption {
+	return func(o *smartOptions) {
+		o.noWake = true
+	}
+}
+
+// WithDeviceType sets the smartctl device type, e.g. sat, megaraid,N or
+// cciss,N for disks behind a USB bridge or RAID controller. Only sat, scsi and
+// nvme are supported without smartctl
+func WithDeviceType(t string) SMARTOption {
+	return func(o *smartOptions) {
+		o.deviceType = t
+	}
+}
+
+func newSMARTOptions(opts ...SMARTOption) *smartOptions {
+	o := new(smartOptions)
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// devicePath returns the path of a device given by name, e.g. sda is /dev/sda
+func devicePath(dev string) string {
+	if len(dev) < 1 || strings.HasPrefix(dev, "/") {
+		return dev
+	}
+
+	return "/dev/" + dev
+}
+
+// GetSMARTInfo creates a new SMARTInfo for given device with smartctl, or
+// reads it natively if smartctl isn't installed. dev is a path or a name
+// under /dev
+func GetSMARTInfo(dev string, opts ...SMARTOption) (*SMARTInfo, error) {
+	o := newSMARTOptions(opts...)
+	dev = devicePath(dev)
+
 	if !smartctlInstalled {
-		return nil, ErrSmartctlNotInstalled
+		if !nativeSMARTSupported || !nativeDeviceType(o.deviceType) {
+			return nil, ErrSmartctlNotInstalled
+		}
+
+		return GetNativeSMARTInfo(dev)
+	}
+
+	args := []string{"-a"}
+
+	if len(o.deviceType) > 0 {
+		args = append(args, "-d", o.deviceType)
+	}
+
+	if o.noWake {
+		args = append(args, "-n", "standby")
+	}
+
+	info, err := execSmartctl(dev, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.noWake && info.inStandby() {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceInStandby, dev)
 	}
 
+	return info, nil
+}
+
+// nativeDeviceType returns true if a smartctl device type can be read
+// natively
+func nativeDeviceType(t string) bool {
+	switch t {
+	case "", "auto", "sat", "scsi", "nvme":
+		return true
+	}
+
+	return false
+}
+
+// execSmartctl runs smartctl with the given arguments and --json
+func execSmartctl(dev string, args ...string) (*SMARTInfo, error) {
 	var out bytes.Buffer
 
-	cmd := exec.Command("smartctl", "-a", dev, "--json")
+	cmd := exec.Command("smartctl", append(append(args, dev), "--json")...)
 	cmd.Stdout = &out
 	err := cmd.Run()
 
@@ -273,8 +592,34 @@ func GetSMARTInfo(dev string) (*SMARTInfo, error) {
 		return nil, err
 	}
 
+	return parseSMARTInfo(out.Bytes())
+}
+
+// allMessages returns the smartctl messages and the device messages
+func (s *SMARTInfo) allMessages() []SMARTMessage {
+	out := make([]SMARTMessage, 0, len(s.Smartctl.Messages)+len(s.Messages))
+	return append(append(out, s.Smartctl.Messages...), s.Messages...)
+}
+
+// inStandby returns true if smartctl -n skipped a disk that is spun down
+func (s *SMARTInfo) inStandby() bool {
+	if !s.ExitCode.Has(DeviceOpenFailed) {
+		return false
+	}
+
+	for _, msg := range s.allMessages() {
+		if strings.Contains(msg.String, "STANDBY") || strings.Contains(msg.String, "SLEEP") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSMARTInfo parses the output of smartctl --json
+func parseSMARTInfo(b []byte) (*SMARTInfo, error) {
 	info := new(SMARTInfo)
-	if err = json.Unmarshal(out.Bytes(), info); err != nil {
+	if err := json.Unmarshal(b, info); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,263 @@
+package disk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ATA SMART attribute IDs
+const (
+	AttrRawReadErrorRate     = 1
+	AttrReallocatedSectors   = 5
+	AttrSeekErrorRate        = 7
+	AttrPowerOnHours         = 9
+	AttrSpinRetryCount       = 10
+	AttrPowerCycleCount      = 12
+	AttrReportedUncorrect    = 187
+	AttrCommandTimeout       = 188
+	AttrTemperature          = 194
+	AttrReallocatedEvents    = 196
+	AttrPendingSectors       = 197
+	AttrOfflineUncorrectable = 198
+	AttrUDMACRCErrors        = 199
+)
+
+// Attribute returns the ATA SMART attribute with the given ID
+func (s *SMARTInfo) Attribute(id int) (*SMARTAttribute, bool) {
+	for i := range s.AtaSmartAttributes.Table {
+		if s.AtaSmartAttributes.Table[i].ID == id {
+			return &s.AtaSmartAttributes.Table[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// isSeagate returns true if the drive is a Seagate, which packs several
+// counters into the raw value of some attributes
+func (s *SMARTInfo) isSeagate() bool {
+	return strings.HasPrefix(s.ModelFamily, "Seagate") ||
+		strings.HasPrefix(s.ModelName, "ST") ||
+		strings.HasPrefix(s.ModelName, "Seagate")
+}
+
+// AttributeRaw returns the decoded raw value of the ATA SMART attribute with
+// the given ID. Seagate drives pack an operation count into the low 32 bits
+// of the error rate attributes and three counters into Command_Timeout, and
+// smartctl formats attributes like Power_On_Hours and temperatures with extra
+// values after the count, so the raw value is decoded by vendor and format
+// rather than returned as is
+func (s *SMARTInfo) AttributeRaw(id int) (int64, bool) {
+	a, ok := s.Attribute(id)
+	if !ok {
+		return 0, false
+	}
+
+	raw := a.Raw.Value
+
+	if s.isSeagate() {
+		switch id {
+		case AttrRawReadErrorRate, AttrSeekErrorRate:
+			// the high 16 bits are the error count
+			return (raw >> 32) & 0xffff, true
+		case AttrCommandTimeout:
+			// the low word counts commands that timed out
+			return raw & 0xffff, true
+		case AttrPowerOnHours:
+			return raw & 0xffffffff, true
+		}
+	}
+
+	return leadingRawCount(a.Raw.String, raw), true
+}
+
+// leadingRawCount returns the count smartctl formats first in a raw string
+// like "12345 (23 145 0)" or "36 (Min/Max 20/45)", or raw if the string
+// doesn't start with a count
+func leadingRawCount(s string, raw int64) int64 {
+	s = strings.TrimSpace(s)
+
+	if i := strings.IndexAny(s, " (h"); i > 0 {
+		s = s[:i]
+	}
+
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+
+	return raw
+}
+
+// ReallocatedSectors returns the raw Reallocated_Sector_Ct
+func (s *SMARTInfo) ReallocatedSectors() (int64, bool) {
+	return s.AttributeRaw(AttrReallocatedSectors)
+}
+
+// ReallocatedEvents returns the raw Reallocated_Event_Count
+func (s *SMARTInfo) ReallocatedEvents() (int64, bool) {
+	return s.AttributeRaw(AttrReallocatedEvents)
+}
+
+// PendingSectors returns the raw Current_Pending_Sector
+func (s *SMARTInfo) PendingSectors() (int64, bool) {
+	return s.AttributeRaw(AttrPendingSectors)
+}
+
+// OfflineUncorrectable returns the raw Offline_Uncorrectable
+func (s *SMARTInfo) OfflineUncorrectable() (int64, bool) {
+	return s.AttributeRaw(AttrOfflineUncorrectable)
+}
+
+// ReportedUncorrectable returns the raw Reported_Uncorrect
+func (s *SMARTInfo) ReportedUncorrectable() (int64, bool) {
+	return s.AttributeRaw(AttrReportedUncorrect)
+}
+
+// CommandTimeout returns the raw Command_Timeout
+func (s *SMARTInfo) CommandTimeout() (int64, bool) {
+	return s.AttributeRaw(AttrCommandTimeout)
+}
+
+// UDMACRCErrors returns the raw UDMA_CRC_Error_Count, which usually points at
+// a bad cable rather than a failing drive
+func (s *SMARTInfo) UDMACRCErrors() (int64, bool) {
+	return s.AttributeRaw(AttrUDMACRCErrors)
+}
+
+// SpinRetries returns the raw Spin_Retry_Count
+func (s *SMARTInfo) SpinRetries() (int64, bool) {
+	return s.AttributeRaw(AttrSpinRetryCount)
+}
+
+// SMARTRiskLevel classifies a SMARTRisk score
+type SMARTRiskLevel int
+
+const (
+	SMARTRiskLow SMARTRiskLevel = iota
+	SMARTRiskModerate
+	SMARTRiskHigh
+	SMARTRiskCritical
+)
+
+var smartRiskLevelString = map[SMARTRiskLevel]string{
+	SMARTRiskLow:      "low",
+	SMARTRiskModerate: "moderate",
+	SMARTRiskHigh:     "high",
+	SMARTRiskCritical: "critical",
+}
+
+func (l SMARTRiskLevel) String() string {
+	return smartRiskLevelString[l]
+}
+
+// MarshalYAML implements the yaml Marshaler
+func (l SMARTRiskLevel) MarshalYAML() (interface{}, error) {
+	return l.String(), nil
+}
+
+// MarshalJSON implements the json Marshaler
+func (l SMARTRiskLevel) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(l.String())), nil
+}
+
+// SMARTRisk is an estimate of how likely a drive is to fail, from 0 to 100,
+// with the reasons behind it
+type SMARTRisk struct {
+	Score   int            `yaml:"score" json:"score"`
+	Level   SMARTRiskLevel `yaml:"level" json:"level"`
+	Reasons []string       `yaml:"reasons" json:"reasons"`
+}
+
+func (r *SMARTRisk) add(score int, format string, args ...interface{}) {
+	r.Score += score
+	r.Reasons = append(r.Reasons, fmt.Sprintf(format, args...))
+}
+
+// smartRiskAttributes are the ATA attributes field failure studies found
+// most correlated with drive failure, with the score added when the raw
+// value is non zero and when it reaches a count that makes failure likely
+var smartRiskAttributes = []struct {
+	id       int
+	name     string
+	score    int
+	many     int64
+	scoreMax int
+}{
+	{AttrReallocatedSectors, "reallocated sectors", 20, 100, 40},
+	{AttrReportedUncorrect, "reported uncorrectable errors", 20, 10, 35},
+	{AttrCommandTimeout, "command timeouts", 10, 100, 20},
+	{AttrPendingSectors, "pending sectors", 25, 10, 40},
+	{AttrOfflineUncorrectable, "offline uncorrectable sectors", 25, 10, 40},
+	{AttrSpinRetryCount, "spin retries", 15, 10, 25},
+	{AttrUDMACRCErrors, "UDMA CRC errors, check the cable", 5, 1000, 10},
+}
+
+// Risk scores the drive's failure risk from the overall SMART status, failing
+// attributes, the attributes most correlated with failure, NVMe critical
+// warnings and wear, and SAS health problems
+func (s *SMARTInfo) Risk() *SMARTRisk {
+	r := &SMARTRisk{Reasons: []string{}}
+
+	if s.StatusFailed() {
+		r.add(100, "SMART overall health self-assessment failed")
+	}
+
+	for _, a := range s.AtaSmartAttributes.Table {
+		switch a.WhenFailed {
+		case "now":
+			r.add(100, "attribute %d %s is failing now", a.ID, a.Name)
+		case "past":
+			r.add(25, "attribute %d %s failed in the past", a.ID, a.Name)
+		}
+	}
+
+	for _, ra := range smartRiskAttributes {
+		n, ok := s.AttributeRaw(ra.id)
+		if !ok || n <= 0 {
+			continue
+		}
+
+		score := ra.score
+		if n >= ra.many {
+			score = ra.scoreMax
+		}
+
+		r.add(score, "%d %s", n, ra.name)
+	}
+
+	if l := s.NvmeSmartHealthInformationLog; l != nil {
+		if l.CriticalWarning != 0 {
+			r.add(100, "critical warning: %s", l.CriticalWarning)
+		}
+
+		if l.PercentageUsed >= 100 {
+			r.add(30, "%d%% of the rated endurance used", l.PercentageUsed)
+		}
+
+		if l.MediaErrors > 0 {
+			r.add(25, "%d media errors", l.MediaErrors)
+		}
+	}
+
+	if s.IsSCSI() {
+		for _, p := range s.SCSIHealthProblems() {
+			r.add(40, "%s", p)
+		}
+	}
+
+	if r.Score > 100 {
+		r.Score = 100
+	}
+
+	switch {
+	case r.Score >= 70:
+		r.Level = SMARTRiskCritical
+	case r.Score >= 30:
+		r.Level = SMARTRiskHigh
+	case r.Score > 0:
+		r.Level = SMARTRiskModerate
+	}
+
+	return r
+}
@@ -0,0 +1,92 @@
+package disk
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultSMARTCacheTTL is how long SMART data is cached by default
+const DefaultSMARTCacheTTL = time.Minute
+
+// DefaultSMARTCache is the cache used by BlockDevice.SMARTInfo unless the
+// inventory is given another with WithSMARTCache
+var DefaultSMARTCache = NewSMARTCache(DefaultSMARTCacheTTL)
+
+// SMARTCache caches SMART data by device for a TTL. Concurrent reads of the
+// same device share a single smartctl run
+type SMARTCache struct {
+	cache *ttlCache
+	opts  []SMARTOption
+	get   func(dev string, opts ...SMARTOption) (*SMARTInfo, error)
+}
+
+// NewSMARTCache returns a SMARTCache that reads SMART data with the given
+// options at most once per ttl. Failed reads are retried after a few seconds.
+// With WithNoWake, data cached before a disk spun down is returned along with
+// ErrDeviceInStandby
+func NewSMARTCache(ttl time.Duration, opts ...SMARTOption) *SMARTCache {
+	return &SMARTCache{
+		cache: newTTLCache(ttl),
+		opts:  opts,
+		get:   GetSMARTInfo,
+	}
+}
+
+// key returns the cache key of a device read with the given options
+func (c *SMARTCache) key(dev string, opts []SMARTOption) (string, []SMARTOption) {
+	opts = append(append([]SMARTOption{}, c.opts...), opts...)
+	key := devicePath(dev)
+
+	if o := newSMARTOptions(opts...); len(o.deviceType) > 0 {
+		key += " -d " + o.deviceType
+	}
+
+	return key, opts
+}
+
+// Get returns the SMART data for a device. opts are added to the cache's
+// options, e.g. WithDeviceType for a disk behind a RAID controller
+func (c *SMARTCache) Get(dev string, opts ...SMARTOption) (*SMARTInfo, error) {
+	info, _, err := c.GetWithAge(dev, opts...)
+	return info, err
+}
+
+// GetWithAge returns the SMART data for a device and how long ago it was
+// read
+func (c *SMARTCache) GetWithAge(dev string, opts ...SMARTOption) (*SMARTInfo, time.Duration, error) {
+	key, opts := c.key(dev, opts)
+	dev = devicePath(dev)
+
+	v, updated, err := c.cache.get(key, func() (interface{}, error) {
+		return c.get(dev, opts...)
+	}, func(err error) bool {
+		return errors.Is(err, ErrDeviceInStandby)
+	})
+
+	info, _ := v.(*SMARTInfo)
+	if info == nil {
+		return nil, 0, err
+	}
+
+	return info, c.cache.now().Sub(updated), err
+}
+
+// Age returns how long ago the SMART data for a device was read, or false if
+// it isn't cached
+func (c *SMARTCache) Age(dev string, opts ...SMARTOption) (time.Duration, bool) {
+	key, _ := c.key(dev, opts)
+
+	updated, ok := c.cache.updated(key)
+	if !ok {
+		return 0, false
+	}
+
+	return c.cache.now().Sub(updated), true
+}
+
+// Invalidate drops the cached SMART data for a device so the next Get reads
+// it again
+func (c *SMARTCache) Invalidate(dev string, opts ...SMARTOption) {
+	key, _ := c.key(dev, opts)
+	c.cache.invalidate(key)
+}
@@ -0,0 +1,163 @@
+package disk
+
+import (
+	"fmt"
+	"github.com/dswarbrick/smart/drivedb"
+	"strings"
+	"sync"
+)
+
+// defaultAttrConvs are smartmontools' default ATA attribute names and raw
+// value conversions, used for drives not in the loaded drive database
+var defaultAttrConvs = map[string]drivedb.AttrConv{
+	"1":   {Conv: "raw48", Name: "Raw_Read_Error_Rate"},
+	"2":   {Conv: "raw48", Name: "Throughput_Performance"},
+	"3":   {Conv: "raw16(avg16)", Name: "Spin_Up_Time"},
+	"4":   {Conv: "raw48", Name: "Start_Stop_Count"},
+	"5":   {Conv: "raw16(raw16)", Name: "Reallocated_Sector_Ct"},
+	"6":   {Conv: "raw48", Name: "Read_Channel_Margin"},
+	"7":   {Conv: "raw48", Name: "Seek_Error_Rate"},
+	"8":   {Conv: "raw48", Name: "Seek_Time_Performance"},
+	"9":   {Conv: "raw24(raw8)", Name: "Power_On_Hours"},
+	"10":  {Conv: "raw48", Name: "Spin_Retry_Count"},
+	"11":  {Conv: "raw48", Name: "Calibration_Retry_Count"},
+	"12":  {Conv: "raw48", Name: "Power_Cycle_Count"},
+	"13":  {Conv: "raw48", Name: "Read_Soft_Error_Rate"},
+	"175": {Conv: "raw48", Name: "Program_Fail_Count_Chip"},
+	"176": {Conv: "raw48", Name: "Erase_Fail_Count_Chip"},
+	"177": {Conv: "raw48", Name: "Wear_Leveling_Count"},
+	"178": {Conv: "raw48", Name: "Used_Rsvd_Blk_Cnt_Chip"},
+	"179": {Conv: "raw48", Name: "Used_Rsvd_Blk_Cnt_Tot"},
+	"180": {Conv: "raw48", Name: "Unused_Rsvd_Blk_Cnt_Tot"},
+	"181": {Conv: "raw48", Name: "Program_Fail_Cnt_Total"},
+	"182": {Conv: "raw48", Name: "Erase_Fail_Count_Total"},
+	"183": {Conv: "raw48", Name: "Runtime_Bad_Block"},
+	"184": {Conv: "raw48", Name: "End-to-End_Error"},
+	"187": {Conv: "raw48", Name: "Reported_Uncorrect"},
+	"188": {Conv: "raw48", Name: "Command_Timeout"},
+	"189": {Conv: "raw48", Name: "High_Fly_Writes"},
+	"190": {Conv: "tempminmax", Name: "Airflow_Temperature_Cel"},
+	"191": {Conv: "raw48", Name: "G-Sense_Error_Rate"},
+	"192": {Conv: "raw48", Name: "Power-Off_Retract_Count"},
+	"193": {Conv: "raw48", Name: "Load_Cycle_Count"},
+	"194": {Conv: "tempminmax", Name: "Temperature_Celsius"},
+	"195": {Conv: "raw48", Name: "Hardware_ECC_Recovered"},
+	"196": {Conv: "raw16(raw16)", Name: "Reallocated_Event_Count"},
+	"197": {Conv: "raw48", Name: "Current_Pending_Sector"},
+	"198": {Conv: "raw48", Name: "Offline_Uncorrectable"},
+	"199": {Conv: "raw48", Name: "UDMA_CRC_Error_Count"},
+	"200": {Conv: "raw48", Name: "Multi_Zone_Error_Rate"},
+	"201": {Conv: "raw48", Name: "Soft_Read_Error_Rate"},
+	"202": {Conv: "raw48", Name: "Data_Address_Mark_Errs"},
+	"203": {Conv: "raw48", Name: "Run_Out_Cancel"},
+	"204": {Conv: "raw48", Name: "Soft_ECC_Correction"},
+	"205": {Conv: "raw48", Name: "Thermal_Asperity_Rate"},
+	"206": {Conv: "raw48", Name: "Flying_Height"},
+	"207": {Conv: "raw48", Name: "Spin_High_Current"},
+	"208": {Conv: "raw48", Name: "Spin_Buzz"},
+	"209": {Conv: "raw48", Name: "Offline_Seek_Performnce"},
+	"220": {Conv: "raw48", Name: "Disk_Shift"},
+	"221": {Conv: "raw48", Name: "G-Sense_Error_Rate"},
+	"222": {Conv: "raw48", Name: "Loaded_Hours"},
+	"223": {Conv: "raw48", Name: "Load_Retry_Count"},
+	"224": {Conv: "raw48", Name: "Load_Friction"},
+	"225": {Conv: "raw48", Name: "Load_Cycle_Count"},
+	"226": {Conv: "raw48", Name: "Load-in_Time"},
+	"227": {Conv: "raw48", Name: "Torq-amp_Count"},
+	"228": {Conv: "raw48", Name: "Power-off_Retract_Count"},
+	"230": {Conv: "raw48", Name: "Head_Amplitude"},
+	"231": {Conv: "raw48", Name: "Temperature_Celsius"},
+	"232": {Conv: "raw48", Name: "Available_Reservd_Space"},
+	"233": {Conv: "raw48", Name: "Media_Wearout_Indicator"},
+	"240": {Conv: "raw24(raw8)", Name: "Head_Flying_Hours"},
+	"241": {Conv: "raw48", Name: "Total_LBAs_Written"},
+	"242": {Conv: "raw48", Name: "Total_LBAs_Read"},
+	"250": {Conv: "raw48", Name: "Read_Error_Retry_Rate"},
+	"254": {Conv: "raw48", Name: "Free_Fall_Sensor"},
+}
+
+var (
+	driveDb   = &drivedb.DriveDb{}
+	driveDbMu sync.RWMutex
+)
+
+// LoadDriveDb loads a YAML drive database, as generated by dswarbrick/smart's
+// mkdrivedb from smartmontools' drivedb.h, used to name and decode ATA
+// attributes when SMART data is read natively
+func LoadDriveDb(path string) error {
+	db, err := drivedb.OpenDriveDb(path)
+	if err != nil {
+		return err
+	}
+
+	if len(db.Drives) < 1 {
+		return fmt.Errorf("no drives found in drive database %s", path)
+	}
+
+	driveDbMu.Lock()
+	driveDb = &db
+	driveDbMu.Unlock()
+
+	return nil
+}
+
+// lookupDriveModel returns the drive database entry for a model with the
+// default attribute conversions merged in. Unlike drivedb.LookupDrive it
+// never modifies the database's DEFAULT entry
+func lookupDriveModel(model string) drivedb.DriveModel {
+	driveDbMu.RLock()
+	defer driveDbMu.RUnlock()
+
+	out := drivedb.DriveModel{
+		Presets: make(map[string]drivedb.AttrConv, len(defaultAttrConvs)),
+	}
+
+	for id, conv := range defaultAttrConvs {
+		out.Presets[id] = conv
+	}
+
+	var match *drivedb.DriveModel
+
+	for i, d := range driveDb.Drives {
+		if strings.HasPrefix(d.Family, "$Id") {
+			continue
+		}
+
+		if d.Family == "DEFAULT" {
+			mergeAttrConvs(out.Presets, d.Presets)
+			continue
+		}
+
+		// OpenDriveDb leaves the regexp nil for invalid model patterns
+		if match == nil && d.CompiledRegexp != nil && d.CompiledRegexp.MatchString(model) {
+			match = &driveDb.Drives[i]
+		}
+	}
+
+	if match != nil {
+		out.Family = match.Family
+		out.ModelRegex = match.ModelRegex
+		out.FirmwareRegex = match.FirmwareRegex
+		out.WarningMsg = match.WarningMsg
+		out.CompiledRegexp = match.CompiledRegexp
+		mergeAttrConvs(out.Presets, match.Presets)
+	}
+
+	return out
+}
+
+// mergeAttrConvs overrides dst with src, keeping the existing name for
+// entries that only change the conversion
+func mergeAttrConvs(dst, src map[string]drivedb.AttrConv) {
+	for id, conv := range src {
+		if conv.Name == "" {
+			conv.Name = dst[id].Name
+		}
+
+		if conv.Conv == "" {
+			conv.Conv = dst[id].Conv
+		}
+
+		dst[id] = conv
+	}
+}
@@ -0,0 +1,405 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// smartHistoryExt is the extension of the JSON lines file of each drive
+const smartHistoryExt = ".jsonl"
+
+var (
+	// ErrNoSerialNumber is returned when recording SMART data without a serial
+	// number to key it by
+	ErrNoSerialNumber = errors.New("SMART data has no serial number")
+	// ErrNoSMARTHistory is returned when there aren't enough snapshots of a
+	// drive to compare
+	ErrNoSMARTHistory = errors.New("not enough SMART history for drive")
+
+	unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// SMARTSnapshot is SMART data recorded at a point in time
+type SMARTSnapshot struct {
+	Time   time.Time  `yaml:"time" json:"time"`
+	Serial string     `yaml:"serial" json:"serial"`
+	Device string     `yaml:"device" json:"device"`
+	Info   *SMARTInfo `yaml:"info" json:"info"`
+}
+
+// SMARTHistory persists SMART snapshots in a directory with one JSON lines
+// file per drive serial number, so history survives device renames
+type SMARTHistory struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewSMARTHistory returns a SMARTHistory stored in dir, creating it if needed
+func NewSMARTHistory(dir string) (*SMARTHistory, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &SMARTHistory{dir: dir}, nil
+}
+
+// path returns the file a drive's snapshots are stored in
+func (h *SMARTHistory) path(serial string) string {
+	return filepath.Join(h.dir, unsafeFileChars.ReplaceAllString(serial, "_")+smartHistoryExt)
+}
+
+// Record appends a snapshot of info, taken at the smartctl local time or now
+// if it has none
+func (h *SMARTHistory) Record(info *SMARTInfo) (*SMARTSnapshot, error) {
+	t := time.Now()
+	if info.LocalTime.TimeT > 0 {
+		t = time.Unix(int64(info.LocalTime.TimeT), 0)
+	}
+
+	return h.RecordAt(t, info)
+}
+
+// RecordAt appends a snapshot of info taken at t
+func (h *SMARTHistory) RecordAt(t time.Time, info *SMARTInfo) (*SMARTSnapshot, error) {
+	serial := strings.TrimSpace(info.SerialNumber)
+	if len(serial) < 1 {
+		return nil, ErrNoSerialNumber
+	}
+
+	snap := &SMARTSnapshot{
+		Time:   t,
+		Serial: serial,
+		Device: info.Device.Name,
+		Info:   info,
+	}
+
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.path(serial), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return snap, f.Close()
+}
+
+// Snapshots returns the snapshots of the drive with the given serial number,
+// oldest first
+func (h *SMARTHistory) Snapshots(serial string) ([]*SMARTSnapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.Open(h.path(serial))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []*SMARTSnapshot
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) < 1 {
+			continue
+		}
+
+		snap := new(SMARTSnapshot)
+		if err = json.Unmarshal(sc.Bytes(), snap); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", f.Name(), line, err)
+		}
+
+		out = append(out, snap)
+	}
+
+	if err = sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Time.Before(out[j].Time)
+	})
+
+	return out, nil
+}
+
+// Latest returns the most recent snapshot of the drive with the given serial
+// number, or nil if there are none
+func (h *SMARTHistory) Latest(serial string) (*SMARTSnapshot, error) {
+	snaps, err := h.Snapshots(serial)
+	if err != nil || len(snaps) < 1 {
+		return nil, err
+	}
+
+	return snaps[len(snaps)-1], nil
+}
+
+// Serials returns the serial numbers of the drives with history
+func (h *SMARTHistory) Serials() ([]string, error) {
+	files, err := ioutil.ReadDir(h.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), smartHistoryExt) {
+			continue
+		}
+
+		snap, err := h.Latest(strings.TrimSuffix(fi.Name(), smartHistoryExt))
+		if err != nil {
+			return nil, err
+		}
+
+		if snap != nil {
+			out = append(out, snap.Serial)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out, nil
+}
+
+// DiffLatest compares the two most recent snapshots of the drive with the
+// given serial number
+func (h *SMARTHistory) DiffLatest(serial string) (*SMARTDiff, error) {
+	snaps, err := h.Snapshots(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snaps) < 2 {
+		return nil, fmt.Errorf("%w %s", ErrNoSMARTHistory, serial)
+	}
+
+	return DiffSMART(snaps[len(snaps)-2], snaps[len(snaps)-1]), nil
+}
+
+// DiffSince compares the newest snapshot of the drive with the given serial
+// number to the oldest one taken at or after since
+func (h *SMARTHistory) DiffSince(serial string, since time.Time) (*SMARTDiff, error) {
+	snaps, err := h.Snapshots(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, snap := range snaps {
+		if !snap.Time.Before(since) && i < len(snaps)-1 {
+			return DiffSMART(snap, snaps[len(snaps)-1]), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w %s since %s", ErrNoSMARTHistory, serial, since)
+}
+
+// SMARTCounterDelta is the change in a SMART counter between two snapshots.
+// ID is the ATA attribute ID, or 0 for NVMe and SCSI counters
+type SMARTCounterDelta struct {
+	ID    int    `yaml:"id,omitempty" json:"id,omitempty"`
+	Name  string `yaml:"name" json:"name"`
+	Old   int64  `yaml:"old" json:"old"`
+	New   int64  `yaml:"new" json:"new"`
+	Delta int64  `yaml:"delta" json:"delta"`
+	// PerDay is the rate of change
+	PerDay float64 `yaml:"per_day" json:"per_day"`
+}
+
+// SMARTDiff is the change in a drive's SMART data between two snapshots
+type SMARTDiff struct {
+	Serial    string        `yaml:"serial" json:"serial"`
+	From      time.Time     `yaml:"from" json:"from"`
+	To        time.Time     `yaml:"to" json:"to"`
+	Elapsed   time.Duration `yaml:"elapsed" json:"elapsed"`
+	OldDevice string        `yaml:"old_device" json:"old_device"`
+	NewDevice string        `yaml:"new_device" json:"new_device"`
+	// HealthChanged is true if the overall SMART status started or stopped
+	// failing. Passed is false if the newer snapshot reported a failure
+	HealthChanged bool `yaml:"health_changed" json:"health_changed"`
+	Passed        bool `yaml:"passed" json:"passed"`
+	// Counters are the counters that changed
+	Counters           []SMARTCounterDelta `yaml:"counters" json:"counters"`
+	NewErrorLogEntries int64               `yaml:"new_error_log_entries" json:"new_error_log_entries"`
+	NewSelfTests       []SelfTestResult    `yaml:"new_self_tests,omitempty" json:"new_self_tests,omitempty"`
+}
+
+// Renamed returns true if the drive has a different device name
+func (d *SMARTDiff) Renamed() bool {
+	return d.OldDevice != d.NewDevice
+}
+
+// Counter returns the delta of the counter with the given name
+func (d *SMARTDiff) Counter(name string) (SMARTCounterDelta, bool) {
+	for _, c := range d.Counters {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return SMARTCounterDelta{}, false
+}
+
+// Attribute returns the delta of the ATA attribute with the given ID
+func (d *SMARTDiff) Attribute(id int) (SMARTCounterDelta, bool) {
+	for _, c := range d.Counters {
+		if c.ID == id {
+			return c, true
+		}
+	}
+
+	return SMARTCounterDelta{}, false
+}
+
+// smartCounter is a named SMART counter
+type smartCounter struct {
+	id    int
+	name  string
+	value int64
+}
+
+// key identifies the counter across snapshots. ATA attributes are keyed by
+// id since several can share a name such as Unknown_Attribute, the NVMe and
+// SCSI counters have no id and are keyed by name
+func (c smartCounter) key() string {
+	if c.id > 0 {
+		return "#" + strconv.Itoa(c.id)
+	}
+
+	return c.name
+}
+
+// smartCounters returns the counters of SMART data that are compared between
+// snapshots
+func smartCounters(s *SMARTInfo) []smartCounter {
+	var out []smartCounter
+
+	for _, a := range s.AtaSmartAttributes.Table {
+		v, _ := s.AttributeRaw(a.ID)
+		out = append(out, smartCounter{a.ID, a.Name, v})
+	}
+
+	if l := s.NvmeSmartHealthInformationLog; l != nil {
+		out = append(out,
+			smartCounter{0, "percentage_used", int64(l.PercentageUsed)},
+			smartCounter{0, "available_spare", int64(l.AvailableSpare)},
+			smartCounter{0, "data_units_read", int64(l.DataUnitsRead)},
+			smartCounter{0, "data_units_written", int64(l.DataUnitsWritten)},
+			smartCounter{0, "power_on_hours", int64(l.PowerOnHours)},
+			smartCounter{0, "unsafe_shutdowns", int64(l.UnsafeShutdowns)},
+			smartCounter{0, "media_errors", int64(l.MediaErrors)},
+			smartCounter{0, "num_err_log_entries", int64(l.NumErrLogEntries)},
+		)
+	}
+
+	if s.IsSCSI() {
+		if s.ScsiGrownDefectList != nil {
+			out = append(out, smartCounter{0, "scsi_grown_defect_list", *s.ScsiGrownDefectList})
+		}
+
+		if s.ScsiErrorCounterLog != nil {
+			out = append(out, smartCounter{0, "scsi_uncorrected_errors", s.ScsiErrorCounterLog.UncorrectedErrors()})
+		}
+	}
+
+	return out
+}
+
+// DiffSMART compares two snapshots of the same drive
+func DiffSMART(from, to *SMARTSnapshot) *SMARTDiff {
+	d := &SMARTDiff{
+		Serial:        to.Serial,
+		From:          from.Time,
+		To:            to.Time,
+		Elapsed:       to.Time.Sub(from.Time),
+		OldDevice:     from.Device,
+		NewDevice:     to.Device,
+		HealthChanged: from.Info.StatusFailed() != to.Info.StatusFailed(),
+		Passed:        !to.Info.StatusFailed(),
+		Counters:      []SMARTCounterDelta{},
+	}
+
+	days := d.Elapsed.Hours() / 24
+
+	old := make(map[string]int64)
+
+	for _, c := range smartCounters(from.Info) {
+		old[c.key()] = c.value
+	}
+
+	for _, c := range smartCounters(to.Info) {
+		prev, ok := old[c.key()]
+		if !ok || prev == c.value {
+			continue
+		}
+
+		delta := SMARTCounterDelta{
+			ID:    c.id,
+			Name:  c.name,
+			Old:   prev,
+			New:   c.value,
+			Delta: c.value - prev,
+		}
+
+		if days > 0 {
+			delta.PerDay = float64(delta.Delta) / days
+		}
+
+		d.Counters = append(d.Counters, delta)
+	}
+
+	d.NewErrorLogEntries = int64(to.Info.AtaSmartErrorLog.Summary.Count - from.Info.AtaSmartErrorLog.Summary.Count)
+
+	if c, ok := d.Counter("num_err_log_entries"); ok {
+		d.NewErrorLogEntries += c.Delta
+	}
+
+	if d.NewErrorLogEntries < 0 {
+		d.NewErrorLogEntries = 0
+	}
+
+	// self-tests are logged with the power on hours they finished at
+	var lastHours int
+
+	if tests := from.Info.SelfTests(); len(tests) > 0 {
+		lastHours = tests[0].PowerOnHours
+	}
+
+	for _, t := range to.Info.SelfTests() {
+		if t.PowerOnHours <= lastHours {
+			break
+		}
+
+		d.NewSelfTests = append(d.NewSelfTests, t)
+	}
+
+	return d
+}
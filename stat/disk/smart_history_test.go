@@ -0,0 +1,124 @@
+//+build linux
+
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSMARTHistory(t *testing.T) {
+	h, err := NewSMARTHistory(filepath.Join(t.TempDir(), "history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := readSmartctlFixture(t, "smartctl_ata_seagate.json")
+	before.AtaSmartSelfTestLog.Standard.Table = before.AtaSmartSelfTestLog.Standard.Table[1:]
+
+	start := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err = h.RecordAt(start, before); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = h.DiffLatest(before.SerialNumber); !errors.Is(err, ErrNoSMARTHistory) {
+		t.Errorf("expected ErrNoSMARTHistory, got %v", err)
+	}
+
+	after := readSmartctlFixture(t, "smartctl_ata_seagate.json")
+	after.Device.Name = "/dev/sdc"
+	after.AtaSmartErrorLog.Summary.Count = 2
+
+	if _, err = h.RecordAt(start.Add(48*time.Hour), after); err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshots are keyed by serial, older snapshots are read back first
+	before.AtaSmartAttributes.Table[1].Raw.Value = 248
+	before.AtaSmartAttributes.Table[1].Raw.String = "248"
+
+	if _, err = h.RecordAt(start.Add(-24*time.Hour), before); err != nil {
+		t.Fatal(err)
+	}
+
+	snaps, err := h.Snapshots(after.SerialNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snaps) != 3 || !snaps[0].Time.Equal(start.Add(-24*time.Hour)) || snaps[2].Device != "/dev/sdc" {
+		t.Fatalf("unexpected snapshots %+v", snaps)
+	}
+
+	d, err := h.DiffSince(after.SerialNumber, start.Add(-48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !d.Renamed() || d.OldDevice != "/dev/sdb" || d.Elapsed != 72*time.Hour || d.NewErrorLogEntries != 2 {
+		t.Errorf("unexpected diff %+v", d)
+	}
+
+	c, ok := d.Attribute(AttrReallocatedSectors)
+	if !ok || c.Old != 248 || c.New != 264 || c.Delta != 16 || c.PerDay < 5.3 || c.PerDay > 5.4 {
+		t.Errorf("unexpected reallocated sectors delta %+v", c)
+	}
+
+	if len(d.Counters) != 1 {
+		t.Errorf("expected only reallocated sectors to change, got %+v", d.Counters)
+	}
+
+	if len(d.NewSelfTests) != 1 || !d.NewSelfTests[0].Failed {
+		t.Errorf("expected a new failed self-test, got %+v", d.NewSelfTests)
+	}
+
+	if d, err = h.DiffLatest(after.SerialNumber); err != nil || len(d.Counters) != 0 {
+		t.Errorf("expected no counter changes between the latest snapshots, got %+v: %v", d, err)
+	}
+
+	serials, err := h.Serials()
+	if err != nil || len(serials) != 1 || serials[0] != "ZDH1ABCD" {
+		t.Errorf("unexpected serials %v: %v", serials, err)
+	}
+
+	if _, err = h.Record(new(SMARTInfo)); err != ErrNoSerialNumber {
+		t.Errorf("expected ErrNoSerialNumber, got %v", err)
+	}
+
+	if err = os.WriteFile(h.path("bad"), []byte("{\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = h.Snapshots("bad"); err == nil {
+		t.Error("expected an error for a corrupt history file")
+	}
+}
+
+func TestDiffSMARTDuplicateNames(t *testing.T) {
+	snapshot := func(raw230, raw231 int) *SMARTSnapshot {
+		info, err := parseSMARTInfo([]byte(fmt.Sprintf(`{
+  "serial_number": "WD-WX12A3B4C5D6",
+  "smart_status": {"passed": true},
+  "ata_smart_attributes": {"table": [
+    {"id": 230, "name": "Unknown_Attribute", "raw": {"value": %d}},
+    {"id": 231, "name": "Unknown_Attribute", "raw": {"value": %d}}
+  ]}
+}`, raw230, raw231)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &SMARTSnapshot{Serial: info.SerialNumber, Info: info}
+	}
+
+	d := DiffSMART(snapshot(100, 5), snapshot(100, 7))
+
+	if len(d.Counters) != 1 || d.Counters[0].ID != 231 || d.Counters[0].Old != 5 || d.Counters[0].Delta != 2 {
+		t.Errorf("expected only attribute 231 to change, got %+v", d.Counters)
+	}
+}
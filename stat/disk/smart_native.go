@@ -0,0 +1,1116 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dswarbrick/smart/ata"
+	"github.com/dswarbrick/smart/drivedb"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	ataPageSize          = 512
+	nvmeIdentifySize     = 4096
+	nvmeLogPageSize      = 512
+	scsiInquiryReplySize = 36
+)
+
+// ErrNativeSMARTNotSupported is returned when SMART data can't be read
+// without smartctl on this platform
+var ErrNativeSMARTNotSupported = errors.New("native SMART collection is not supported on this platform")
+
+var errShortPage = errors.New("SMART response page is too short")
+
+// ataSmartData is an ATA SMART READ DATA response
+type ataSmartData struct {
+	ata.SmartPage
+	OfflineStatus         uint8
+	SelfTestStatus        uint8
+	OfflineSeconds        int
+	OfflineCapabilities   uint8
+	SmartCapabilities     uint16
+	ErrorLogCapability    uint8
+	ShortPollMinutes      int
+	ExtendedPollMinutes   int
+	ConveyancePollMinutes int
+	ChecksumValid         bool
+}
+
+// parseATASmartData parses the 512 byte SMART READ DATA page
+func parseATASmartData(b []byte) (*ataSmartData, error) {
+	if len(b) < ataPageSize {
+		return nil, errShortPage
+	}
+
+	d := &ataSmartData{
+		OfflineStatus:         b[362],
+		SelfTestStatus:        b[363],
+		OfflineSeconds:        int(binary.LittleEndian.Uint16(b[364:])),
+		OfflineCapabilities:   b[367],
+		SmartCapabilities:     binary.LittleEndian.Uint16(b[368:]),
+		ErrorLogCapability:    b[370],
+		ShortPollMinutes:      int(b[372]),
+		ExtendedPollMinutes:   int(b[373]),
+		ConveyancePollMinutes: int(b[374]),
+		ChecksumValid:         ataChecksumValid(b[:ataPageSize]),
+	}
+
+	if b[373] == 0xff {
+		// drives with long extended tests report the time in words 375-376
+		d.ExtendedPollMinutes = int(binary.LittleEndian.Uint16(b[375:]))
+	}
+
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &d.SmartPage); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// parseATAThresholds parses the 512 byte SMART READ THRESHOLDS page into
+// thresholds keyed by attribute ID
+func parseATAThresholds(b []byte) (map[uint8]uint8, error) {
+	if len(b) < ataPageSize {
+		return nil, errShortPage
+	}
+
+	out := make(map[uint8]uint8)
+
+	for i := 0; i < 30; i++ {
+		off := 2 + i*12
+		if b[off] != 0 {
+			out[b[off]] = b[off+1]
+		}
+	}
+
+	return out, nil
+}
+
+// parseATAStatusSense parses the descriptor format sense data returned by a
+// SAT SMART RETURN STATUS command and returns false if the drive reports that
+// a threshold has been exceeded
+func parseATAStatusSense(sense []byte) (bool, error) {
+	if len(sense) < 8 || sense[0]&0x7f != 0x72 {
+		return false, errors.New("SMART RETURN STATUS did not return descriptor format sense data")
+	}
+
+	end := 8 + int(sense[7])
+	if end > len(sense) {
+		end = len(sense)
+	}
+
+	for off := 8; off+2 <= end; off += 2 + int(sense[off+1]) {
+		// ATA Status Return descriptor
+		if sense[off] != 0x09 || off+14 > end {
+			continue
+		}
+
+		switch mid, high := sense[off+9], sense[off+11]; {
+		case mid == 0x4f && high == 0xc2:
+			return true, nil
+		case mid == 0xf4 && high == 0x2c:
+			return false, nil
+		default:
+			return false, fmt.Errorf("unexpected SMART RETURN STATUS lba %#02x %#02x", mid, high)
+		}
+	}
+
+	return false, errors.New("no ATA status return descriptor in sense data")
+}
+
+// parseATAErrorLog parses the SMART summary error log (log address 01h)
+func parseATAErrorLog(b []byte) (*ata.SmartSummaryErrorLog, error) {
+	if len(b) < ataPageSize {
+		return nil, errShortPage
+	}
+
+	l := new(ata.SmartSummaryErrorLog)
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// parseATASelfTestLog parses the SMART self-test log (log address 06h) and
+// returns the log with the number of logged and failed tests
+func parseATASelfTestLog(b []byte) (l *ata.SmartSelfTestLog, count, failed int, err error) {
+	if len(b) < ataPageSize {
+		return nil, 0, 0, errShortPage
+	}
+
+	l = new(ata.SmartSelfTestLog)
+	if err = binary.Read(bytes.NewReader(b), binary.LittleEndian, l); err != nil {
+		return nil, 0, 0, err
+	}
+
+	for _, e := range l.Entry {
+		if e.LBA_7 == 0 && e.Status == 0 && e.LifeTimestamp == 0 && e.Checkpoint == 0 {
+			continue
+		}
+
+		count++
+
+		// 3 is a fatal error, 4-8 are failed test segments
+		if s := e.Status >> 4; s >= 3 && s <= 8 {
+			failed++
+		}
+	}
+
+	return l, count, failed, nil
+}
+
+// ataChecksumValid returns true if a SMART page sums to zero
+func ataChecksumValid(b []byte) bool {
+	var sum byte
+
+	for _, c := range b {
+		sum += c
+	}
+
+	return sum == 0
+}
+
+// ataIdentity is an ATA IDENTIFY DEVICE response
+type ataIdentity struct {
+	ata.IdentifyDeviceData
+	Blocks            uint64
+	LogicalBlockSize  int
+	PhysicalBlockSize int
+	SmartSupported    bool
+	SmartEnabled      bool
+	GpLogging         bool
+}
+
+// parseATAIdentify parses the 512 byte IDENTIFY DEVICE data
+func parseATAIdentify(b []byte) (*ataIdentity, error) {
+	if len(b) < ataPageSize {
+		return nil, errShortPage
+	}
+
+	word := func(n int) uint16 {
+		return binary.LittleEndian.Uint16(b[n*2:])
+	}
+
+	id := &ataIdentity{
+		LogicalBlockSize: 512,
+		SmartSupported:   word(82)&0x1 != 0,
+		SmartEnabled:     word(85)&0x1 != 0,
+		GpLogging:        word(84)&0x20 != 0,
+	}
+
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &id.IdentifyDeviceData); err != nil {
+		return nil, err
+	}
+
+	if word(83)&0x400 != 0 {
+		// 48-bit LBA
+		id.Blocks = binary.LittleEndian.Uint64(b[200:])
+	} else {
+		id.Blocks = uint64(binary.LittleEndian.Uint32(b[120:]))
+	}
+
+	// word 106 is only valid if bit 14 is set and bit 15 is clear
+	if w := word(106); w&0xc000 == 0x4000 {
+		if w&0x1000 != 0 {
+			id.LogicalBlockSize = int(binary.LittleEndian.Uint32(b[234:])) * 2
+		}
+
+		id.PhysicalBlockSize = id.LogicalBlockSize
+
+		if w&0x2000 != 0 {
+			id.PhysicalBlockSize = id.LogicalBlockSize << (w & 0xf)
+		}
+	} else {
+		id.PhysicalBlockSize = id.LogicalBlockSize
+	}
+
+	return id, nil
+}
+
+// wwn returns the NAA, IEEE OUI and unique ID of the drive's world wide name
+func (id *ataIdentity) wwn() (naa, oui int, uid int64) {
+	w := id.WWNRaw
+
+	naa = int(w[0] >> 12)
+	oui = int(w[0]&0x0fff)<<12 | int(w[1]>>4)
+	uid = int64(w[1]&0xf)<<32 | int64(w[2])<<16 | int64(w[3])
+
+	return
+}
+
+// ataRawValue returns an attribute's raw value with its bytes in the order
+// given by a drivedb conversion such as "raw48" or "raw48:543210". Bytes 0-5
+// are the vendor bytes, r is the reserved byte, v the value and w the worst
+func ataRawValue(vendor [6]byte, reserved, value, worst uint8, conv string) uint64 {
+	format, order := conv, ""
+
+	if i := strings.IndexByte(conv, ':'); i >= 0 {
+		format, order = conv[:i], conv[i+1:]
+	}
+
+	if len(order) < 1 {
+		switch format {
+		case "raw64", "hex64":
+			order = "543210wv"
+		case "raw56", "hex56", "raw24/raw32", "msec24hour32":
+			order = "r543210"
+		default:
+			order = "543210"
+		}
+	}
+
+	var raw uint64
+
+	for _, c := range order {
+		var b byte
+
+		switch c {
+		case '0', '1', '2', '3', '4', '5':
+			b = vendor[c-'0']
+		case 'r':
+			b = reserved
+		case 'v':
+			b = value
+		case 'w':
+			b = worst
+		}
+
+		raw = raw<<8 | uint64(b)
+	}
+
+	return raw
+}
+
+// formatATARaw formats a raw value the way smartctl does for a drivedb
+// conversion
+func formatATARaw(raw uint64, conv string) string {
+	if i := strings.IndexByte(conv, ':'); i >= 0 {
+		conv = conv[:i]
+	}
+
+	word := func(n uint) uint64 {
+		return (raw >> (16 * n)) & 0xffff
+	}
+
+	byt := func(n uint) uint64 {
+		return (raw >> (8 * n)) & 0xff
+	}
+
+	switch conv {
+	case "raw8":
+		return fmt.Sprintf("%d %d %d %d %d %d", byt(5), byt(4), byt(3), byt(2), byt(1), byt(0))
+	case "raw16":
+		return fmt.Sprintf("%d %d %d", word(2), word(1), word(0))
+	case "hex48":
+		return fmt.Sprintf("0x%012x", raw)
+	case "hex56":
+		return fmt.Sprintf("0x%014x", raw)
+	case "hex64":
+		return fmt.Sprintf("0x%016x", raw)
+	case "raw16(raw16)":
+		if word(1) != 0 || word(2) != 0 {
+			return fmt.Sprintf("%d (%d %d)", word(0), word(2), word(1))
+		}
+
+		return strconv.FormatUint(word(0), 10)
+	case "raw16(avg16)":
+		if word(1) != 0 {
+			return fmt.Sprintf("%d (Average %d)", word(0), word(1))
+		}
+
+		return strconv.FormatUint(word(0), 10)
+	case "raw24(raw8)":
+		if raw>>24 != 0 {
+			return fmt.Sprintf("%d (%d %d %d)", raw&0xffffff, byt(5), byt(4), byt(3))
+		}
+
+		return strconv.FormatUint(raw&0xffffff, 10)
+	case "raw24/raw24":
+		return fmt.Sprintf("%d/%d", (raw>>24)&0xffffff, raw&0xffffff)
+	case "raw24/raw32":
+		return fmt.Sprintf("%d/%d", (raw>>32)&0xffffff, raw&0xffffffff)
+	case "sec2hour":
+		return fmt.Sprintf("%dh+%02dm+%02ds", raw/3600, (raw/60)%60, raw%60)
+	case "min2hour":
+		return fmt.Sprintf("%dh+%02dm", raw/60, raw%60)
+	case "halfmin2hour":
+		return fmt.Sprintf("%dh+%02dm", raw/120, (raw/2)%60)
+	case "msec24hour32":
+		msec := raw >> 32
+		return fmt.Sprintf("%dh+%02dm+%02d.%03ds", raw&0xffffffff, msec/60000, (msec/1000)%60, msec%1000)
+	case "tempminmax":
+		return formatTempMinMax(raw)
+	case "temp10x":
+		return fmt.Sprintf("%d.%d", word(0)/10, word(0)%10)
+	default:
+		return strconv.FormatUint(raw, 10)
+	}
+}
+
+// formatTempMinMax formats a temperature attribute that may record the
+// lifetime min and max temperatures in bytes 2 and 3 or 2 and 4
+func formatTempMinMax(raw uint64) string {
+	b := func(n uint) int {
+		return int(int8(raw >> (8 * n)))
+	}
+
+	t := b(0)
+
+	switch {
+	case b(3) == 0 && b(5) == 0 && b(2) <= t && t <= b(4) && b(2) < b(4):
+		return fmt.Sprintf("%d (Min/Max %d/%d)", t, b(2), b(4))
+	case b(4) == 0 && b(5) == 0 && b(2) <= t && t <= b(3) && b(2) < b(3):
+		return fmt.Sprintf("%d (Min/Max %d/%d)", t, b(2), b(3))
+	default:
+		return strconv.Itoa(t)
+	}
+}
+
+// ataPowerOnHours converts a power on time raw value to hours
+func ataPowerOnHours(raw uint64, conv string) int {
+	if i := strings.IndexByte(conv, ':'); i >= 0 {
+		conv = conv[:i]
+	}
+
+	switch conv {
+	case "sec2hour":
+		return int(raw / 3600)
+	case "min2hour":
+		return int(raw / 60)
+	case "halfmin2hour":
+		return int(raw / 120)
+	case "msec24hour32":
+		return int(raw & 0xffffffff)
+	default:
+		return int(raw & 0xffffff)
+	}
+}
+
+// ataFlagString formats attribute flags like smartctl, e.g. PO-R--
+func ataFlagString(flags uint16) string {
+	var buf bytes.Buffer
+
+	for i, c := range "POSRCK" {
+		if flags&(1<<uint(i)) != 0 {
+			buf.WriteRune(c)
+		} else {
+			buf.WriteByte('-')
+		}
+	}
+
+	if flags&0xffc0 != 0 {
+		buf.WriteByte('+')
+	} else {
+		buf.WriteByte(' ')
+	}
+
+	return buf.String()
+}
+
+var ataSelfTestStatusString = map[uint8]string{
+	0x0: "completed without error",
+	0x1: "aborted by host",
+	0x2: "interrupted by host with a hard or soft reset",
+	0x3: "could not complete due to a fatal or unknown error",
+	0x4: "completed with an unknown failure",
+	0x5: "completed with an electrical failure",
+	0x6: "completed with a servo/seek failure",
+	0x7: "completed with a read failure",
+	0x8: "completed with handling damage",
+	0xf: "in progress",
+}
+
+var ataOfflineStatusString = map[uint8]string{
+	0x0: "was never started",
+	0x2: "was completed without error",
+	0x3: "is in progress",
+	0x4: "was suspended by an interrupting command from host",
+	0x5: "was aborted by an interrupting command from host",
+	0x6: "was aborted by the device with a fatal error",
+}
+
+// setATAIdentity sets the device identity from IDENTIFY DEVICE data
+func (s *SMARTInfo) setATAIdentity(id *ataIdentity, model drivedb.DriveModel) {
+	s.Device.Protocol = "ATA"
+	s.ModelName = strings.TrimSpace(string(id.ModelNumber()))
+	s.SerialNumber = strings.TrimSpace(string(id.SerialNumber()))
+	s.FirmwareVersion = strings.TrimSpace(string(id.FirmwareRevision()))
+	s.ModelFamily = model.Family
+	s.InSmartctlDatabase = len(model.Family) > 0
+	s.Wwn.Naa, s.Wwn.Oui, s.Wwn.ID = id.wwn()
+	s.UserCapacity.Blocks = int64(id.Blocks)
+	s.UserCapacity.Bytes = int64(id.Blocks) * int64(id.LogicalBlockSize)
+	s.LogicalBlockSize = id.LogicalBlockSize
+	s.PhysicalBlockSize = id.PhysicalBlockSize
+	s.RotationRate = int(id.RotationRate)
+	s.AtaVersion.String = id.ATAMajorVersion()
+	s.AtaVersion.MajorValue = int(id.MajorVersion)
+	s.AtaVersion.MinorValue = int(id.MinorVersion)
+	s.SataVersion.String = id.Transport()
+	s.SataVersion.Value = int(id.TransportMajor)
+	s.AtaSmartData.Capabilities.GpLoggingSupported = id.GpLogging
+}
+
+// setATASmartData sets the SMART data, attribute table and the status bits of
+// the exit code from SMART READ DATA and READ THRESHOLDS
+func (s *SMARTInfo) setATASmartData(d *ataSmartData, thresholds map[uint8]uint8, model drivedb.DriveModel) {
+	offline := &s.AtaSmartData.OfflineDataCollection
+	offline.Status.Value = int(d.OfflineStatus)
+	offline.Status.String = ataOfflineStatusString[d.OfflineStatus&0x7f]
+	offline.Status.Passed = d.OfflineStatus&0x7f != 0x6
+	offline.CompletionSeconds = d.OfflineSeconds
+
+	selfTest := &s.AtaSmartData.SelfTest
+	selfTest.Status.Value = int(d.SelfTestStatus)
+	selfTest.Status.String = ataSelfTestStatusString[d.SelfTestStatus>>4]
+	selfTest.Status.Passed = d.SelfTestStatus>>4 == 0
+	selfTest.PollingMinutes.Short = d.ShortPollMinutes
+	selfTest.PollingMinutes.Extended = d.ExtendedPollMinutes
+	selfTest.PollingMinutes.Conveyance = d.ConveyancePollMinutes
+
+	caps := &s.AtaSmartData.Capabilities
+	caps.Values = []int{int(d.OfflineCapabilities), int(d.SmartCapabilities)}
+	caps.ExecOfflineImmediateSupported = d.OfflineCapabilities&0x01 != 0
+	caps.OfflineIsAbortedUponNewCmd = d.OfflineCapabilities&0x04 != 0
+	caps.OfflineSurfaceScanSupported = d.OfflineCapabilities&0x08 != 0
+	caps.SelfTestsSupported = d.OfflineCapabilities&0x10 != 0
+	caps.ConveyanceSelfTestSupported = d.OfflineCapabilities&0x20 != 0
+	caps.SelectiveSelfTestSupported = d.OfflineCapabilities&0x40 != 0
+	caps.AttributeAutosaveEnabled = d.SmartCapabilities&0x02 != 0
+	caps.ErrorLoggingSupported = d.ErrorLogCapability&0x01 != 0
+
+	if !d.ChecksumValid {
+		s.ExitCode |= SmartResponseError
+	}
+
+	s.AtaSmartAttributes.Revision = int(d.Version)
+	s.AtaSmartAttributes.Table = nil
+
+	for _, a := range d.Attrs {
+		if a.Id == 0 {
+			continue
+		}
+
+		conv := model.Presets[strconv.Itoa(int(a.Id))]
+		raw := ataRawValue(a.VendorBytes, a.Reserved, a.Value, a.Worst, conv.Conv)
+
+		attr := SMARTAttribute{
+			ID:     int(a.Id),
+			Name:   conv.Name,
+			Value:  int(a.Value),
+			Worst:  int(a.Worst),
+			Thresh: int(thresholds[a.Id]),
+		}
+
+		if len(attr.Name) < 1 {
+			attr.Name = "Unknown_Attribute"
+		}
+
+		attr.Flags.Value = int(a.Flags)
+		attr.Flags.String = ataFlagString(a.Flags)
+		attr.Flags.Prefailure = a.Flags&0x01 != 0
+		attr.Flags.UpdatedOnline = a.Flags&0x02 != 0
+		attr.Flags.Performance = a.Flags&0x04 != 0
+		attr.Flags.ErrorRate = a.Flags&0x08 != 0
+		attr.Flags.EventCount = a.Flags&0x10 != 0
+		attr.Flags.AutoKeep = a.Flags&0x20 != 0
+
+		// byte orders that pack all 8 bytes can overflow an int64
+		if raw > math.MaxInt64 {
+			attr.Raw.Value = math.MaxInt64
+		} else {
+			attr.Raw.Value = int64(raw)
+		}
+
+		attr.Raw.String = formatATARaw(raw, conv.Conv)
+
+		if attr.Thresh > 0 {
+			switch {
+			case attr.Value <= attr.Thresh:
+				attr.WhenFailed = "now"
+
+				if attr.Flags.Prefailure {
+					s.ExitCode |= SmartPrefail
+				} else {
+					s.ExitCode |= SmartPreviousPrefail
+				}
+			case attr.Worst <= attr.Thresh:
+				attr.WhenFailed = "past"
+				s.ExitCode |= SmartPreviousPrefail
+			}
+		}
+
+		switch attr.ID {
+		case 9:
+			s.PowerOnTime.Hours = ataPowerOnHours(raw, conv.Conv)
+		case 12:
+			s.PowerCycleCount = int(raw)
+		case 194:
+			s.Temperature.Current = ataTemperature(raw, conv.Conv)
+		case 190:
+			if s.Temperature.Current == 0 {
+				s.Temperature.Current = ataTemperature(raw, conv.Conv)
+			}
+		}
+
+		s.AtaSmartAttributes.Table = append(s.AtaSmartAttributes.Table, attr)
+	}
+}
+
+// ataTemperature returns the current temperature from a temperature
+// attribute's raw value
+func ataTemperature(raw uint64, conv string) int {
+	if strings.HasPrefix(conv, "temp10x") {
+		return int(raw&0xffff) / 10
+	}
+
+	return int(int8(raw))
+}
+
+// setATALogs sets the error and self-test log summaries
+func (s *SMARTInfo) setATALogs(errLog *ata.SmartSummaryErrorLog, selfTestLog *ata.SmartSelfTestLog,
+	selfTests, selfTestsFailed int) {
+	if errLog != nil {
+		s.AtaSmartErrorLog.Summary.Revision = int(errLog.Version)
+		s.AtaSmartErrorLog.Summary.Count = int(errLog.ErrorCount)
+
+		if errLog.ErrorCount > 0 {
+			s.ExitCode |= SmartErrorLogHasErrors
+		}
+	}
+
+	if selfTestLog != nil {
+		s.AtaSmartSelfTestLog.Standard.Revision = int(selfTestLog.Version)
+		s.AtaSmartSelfTestLog.Standard.Table = ataSelfTestEntries(selfTestLog)
+		s.AtaSmartSelfTestLog.Standard.Count = selfTests
+		s.AtaSmartSelfTestLog.Standard.ErrorCountTotal = selfTestsFailed
+
+		if selfTestsFailed > 0 {
+			s.ExitCode |= SmartSelfTestErrors
+		}
+	}
+}
+
+var ataSelfTestTypeString = map[uint8]string{
+	0x00: "Offline",
+	0x01: "Short offline",
+	0x02: "Extended offline",
+	0x03: "Conveyance offline",
+	0x04: "Selective offline",
+	0x7f: "Abort offline test",
+	0x81: "Short captive",
+	0x82: "Extended captive",
+	0x83: "Conveyance captive",
+	0x84: "Selective captive",
+}
+
+// ataSelfTestEntries returns the used entries of the self-test log ring
+// buffer, most recent first
+func ataSelfTestEntries(l *ata.SmartSelfTestLog) []SMARTSelfTestEntry {
+	var out []SMARTSelfTestEntry
+
+	n := len(l.Entry)
+
+	// Index is the 1 based position of the most recent entry
+	newest := int(l.Index) - 1
+	if newest < 0 || newest >= n {
+		newest = n - 1
+	}
+
+	for i := 0; i < n; i++ {
+		e := l.Entry[(newest-i+n)%n]
+		if e.LBA_7 == 0 && e.Status == 0 && e.LifeTimestamp == 0 && e.Checkpoint == 0 {
+			continue
+		}
+
+		var entry SMARTSelfTestEntry
+
+		status := e.Status >> 4
+
+		entry.Type.Value = int(e.LBA_7)
+		entry.Type.String = ataSelfTestTypeString[e.LBA_7]
+		entry.Status.Value = int(e.Status)
+		entry.Status.String = ataSelfTestStatusString[status]
+		entry.Status.RemainingPercent = int(e.Status&0xf) * 10
+		entry.Status.Passed = status == 0
+		entry.LifetimeHours = int(e.LifeTimestamp)
+
+		if status >= 3 && status <= 8 {
+			lba := int64(e.LBA)
+			entry.LBA = &lba
+		}
+
+		out = append(out, entry)
+	}
+
+	return out
+}
+
+// setSmartStatus sets the overall health assessment
+func (s *SMARTInfo) setSmartStatus(passed bool) {
+	s.SmartStatus = &SMARTStatus{Passed: passed}
+
+	if !passed {
+		s.ExitCode |= SmartDiskFailing
+	}
+}
+
+// nvmeIdentity is an NVMe Identify Controller response
+type nvmeIdentity struct {
+	VendorID          uint16
+	SubsystemVendorID uint16
+	SerialNumber      string
+	ModelNumber       string
+	FirmwareVersion   string
+	IEEEOUI           int
+	ControllerID      uint16
+	Version           uint32
+	// WarningTemp and CriticalTemp are the composite temperature thresholds
+	// in Celsius, or 0 if not reported
+	WarningTemp         int
+	CriticalTemp        int
+	TotalCapacity       uint64
+	UnallocatedCapacity uint64
+	Namespaces          uint32
+}
+
+// parseNVMeIdentifyController parses the 4096 byte Identify Controller data
+func parseNVMeIdentifyController(b []byte) (*nvmeIdentity, error) {
+	if len(b) < nvmeIdentifySize {
+		return nil, errShortPage
+	}
+
+	return &nvmeIdentity{
+		VendorID:            binary.LittleEndian.Uint16(b[0:]),
+		SubsystemVendorID:   binary.LittleEndian.Uint16(b[2:]),
+		SerialNumber:        strings.TrimSpace(string(b[4:24])),
+		ModelNumber:         strings.TrimSpace(string(b[24:64])),
+		FirmwareVersion:     strings.TrimSpace(string(b[64:72])),
+		IEEEOUI:             int(b[75])<<16 | int(b[74])<<8 | int(b[73]),
+		ControllerID:        binary.LittleEndian.Uint16(b[78:]),
+		Version:             binary.LittleEndian.Uint32(b[80:]),
+		WarningTemp:         kelvinToCelsius(binary.LittleEndian.Uint16(b[266:])),
+		CriticalTemp:        kelvinToCelsius(binary.LittleEndian.Uint16(b[268:])),
+		TotalCapacity:       le128ToUint64(b[280:]),
+		UnallocatedCapacity: le128ToUint64(b[296:]),
+		Namespaces:          binary.LittleEndian.Uint32(b[516:]),
+	}, nil
+}
+
+// parseNVMeIdentifyNamespace parses the 4096 byte Identify Namespace data
+func parseNVMeIdentifyNamespace(b []byte, nsid int) (*NVMeNamespace, error) {
+	if len(b) < nvmeIdentifySize {
+		return nil, errShortPage
+	}
+
+	// the low nibble of FLBAS selects the LBA format in use
+	lbaf := 128 + int(b[26]&0xf)*4
+	blockSize := int64(1) << b[lbaf+2]
+
+	blocks := func(off int) NVMeBlocks {
+		n := int64(binary.LittleEndian.Uint64(b[off:]))
+		return NVMeBlocks{Blocks: n, Bytes: n * blockSize}
+	}
+
+	ns := &NVMeNamespace{
+		ID:               nsid,
+		Size:             blocks(0),
+		Capacity:         blocks(8),
+		Utilization:      blocks(16),
+		FormattedLbaSize: int(blockSize),
+	}
+
+	// the EUI-64 is big endian with the OUI in the first 3 bytes
+	eui := binary.BigEndian.Uint64(b[120:])
+	ns.Eui64.Oui = int(eui >> 40)
+	ns.Eui64.ExtID = int64(eui & 0xffffffffff)
+
+	return ns, nil
+}
+
+// parseNVMeHealthLog parses the 512 byte SMART / Health Information log page
+func parseNVMeHealthLog(b []byte) (*NVMeHealthInformationLog, error) {
+	if len(b) < nvmeLogPageSize {
+		return nil, errShortPage
+	}
+
+	l := &NVMeHealthInformationLog{
+		CriticalWarning:         NVMeCriticalWarning(b[0]),
+		Temperature:             kelvinToCelsius(binary.LittleEndian.Uint16(b[1:])),
+		AvailableSpare:          int(b[3]),
+		AvailableSpareThreshold: int(b[4]),
+		PercentageUsed:          int(b[5]),
+		DataUnitsRead:           le128ToUint64(b[32:]),
+		DataUnitsWritten:        le128ToUint64(b[48:]),
+		HostReads:               le128ToUint64(b[64:]),
+		HostWrites:              le128ToUint64(b[80:]),
+		ControllerBusyTime:      le128ToUint64(b[96:]),
+		PowerCycles:             le128ToUint64(b[112:]),
+		PowerOnHours:            le128ToUint64(b[128:]),
+		UnsafeShutdowns:         le128ToUint64(b[144:]),
+		MediaErrors:             le128ToUint64(b[160:]),
+		NumErrLogEntries:        le128ToUint64(b[176:]),
+		WarningTempTime:         int(binary.LittleEndian.Uint32(b[192:])),
+		CriticalCompTime:        int(binary.LittleEndian.Uint32(b[196:])),
+	}
+
+	for i := 0; i < 8; i++ {
+		// unimplemented sensors report 0
+		if k := binary.LittleEndian.Uint16(b[200+i*2:]); k != 0 {
+			l.TemperatureSensors = append(l.TemperatureSensors, kelvinToCelsius(k))
+		}
+	}
+
+	return l, nil
+}
+
+// le128ToUint64 returns a little endian 128-bit counter, saturated at the
+// largest uint64
+func le128ToUint64(b []byte) uint64 {
+	if binary.LittleEndian.Uint64(b[8:]) != 0 {
+		return math.MaxUint64
+	}
+
+	return binary.LittleEndian.Uint64(b)
+}
+
+// kelvinToCelsius converts an NVMe temperature, 0 means not reported
+func kelvinToCelsius(k uint16) int {
+	if k == 0 {
+		return 0
+	}
+
+	return int(k) - 273
+}
+
+// setNVMe sets the device identity and health from NVMe identify and log data
+func (s *SMARTInfo) setNVMe(id *nvmeIdentity, ns *NVMeNamespace, l *NVMeHealthInformationLog) {
+	s.Device.Protocol = "NVMe"
+	s.ModelName = id.ModelNumber
+	s.SerialNumber = id.SerialNumber
+	s.FirmwareVersion = id.FirmwareVersion
+	s.NvmePciVendor = &NVMePciVendor{ID: int(id.VendorID), SubsystemID: int(id.SubsystemVendorID)}
+	s.NvmeIeeeOuiIdentifier = id.IEEEOUI
+	s.NvmeTotalCapacity = int64(id.TotalCapacity)
+	s.NvmeUnallocatedCapacity = int64(id.UnallocatedCapacity)
+	s.NvmeControllerID = int(id.ControllerID)
+	s.NvmeNumberOfNamespaces = int(id.Namespaces)
+
+	if id.Version != 0 {
+		v := newNVMeVersion(id.Version)
+		s.NvmeVersion = &v
+	}
+
+	if ns != nil {
+		s.NvmeNamespaces = []NVMeNamespace{*ns}
+		s.UserCapacity.Blocks = ns.Size.Blocks
+		s.UserCapacity.Bytes = ns.Size.Bytes
+		s.LogicalBlockSize = ns.FormattedLbaSize
+	}
+
+	s.NvmeSmartHealthInformationLog = l
+	s.Temperature.Current = l.Temperature
+	s.PowerOnTime.Hours = int(l.PowerOnHours)
+	s.PowerCycleCount = int(l.PowerCycles)
+	s.setSmartStatus(l.CriticalWarning == 0)
+
+	if l.NumErrLogEntries > 0 {
+		s.ExitCode |= SmartErrorLogHasErrors
+	}
+}
+
+// scsiInquiry is a standard SCSI INQUIRY response
+type scsiInquiry struct {
+	PeripheralType uint8
+	Vendor         string
+	Product        string
+	Revision       string
+}
+
+// isATA returns true if the device is an ATA drive behind a SAT layer
+func (inq *scsiInquiry) isATA() bool {
+	return inq.Vendor == "ATA"
+}
+
+// parseSCSIInquiry parses a standard INQUIRY response
+func parseSCSIInquiry(b []byte) (*scsiInquiry, error) {
+	if len(b) < scsiInquiryReplySize {
+		return nil, errShortPage
+	}
+
+	return &scsiInquiry{
+		PeripheralType: b[0] & 0x1f,
+		Vendor:         strings.TrimSpace(string(b[8:16])),
+		Product:        strings.TrimSpace(string(b[16:32])),
+		Revision:       strings.TrimSpace(string(b[32:36])),
+	}, nil
+}
+
+// parseSCSISerialVPD parses the Unit Serial Number VPD page (80h)
+func parseSCSISerialVPD(b []byte) (string, error) {
+	if len(b) < 4 || b[1] != 0x80 {
+		return "", errors.New("not a unit serial number VPD page")
+	}
+
+	end := 4 + int(binary.BigEndian.Uint16(b[2:]))
+	if end > len(b) {
+		end = len(b)
+	}
+
+	return strings.TrimSpace(string(bytes.TrimRight(b[4:end], "\x00"))), nil
+}
+
+// parseSCSIReadCapacity16 parses a READ CAPACITY(16) response
+func parseSCSIReadCapacity16(b []byte) (blocks uint64, logical, physical int, err error) {
+	if len(b) < 14 {
+		return 0, 0, 0, errShortPage
+	}
+
+	blocks = binary.BigEndian.Uint64(b) + 1
+	logical = int(binary.BigEndian.Uint32(b[8:]))
+	physical = logical << (b[13] & 0xf)
+
+	return blocks, logical, physical, nil
+}
+
+// parseSCSIReadCapacity10 parses a READ CAPACITY(10) response
+func parseSCSIReadCapacity10(b []byte) (blocks uint64, logical int, err error) {
+	if len(b) < 8 {
+		return 0, 0, errShortPage
+	}
+
+	return uint64(binary.BigEndian.Uint32(b)) + 1, int(binary.BigEndian.Uint32(b[4:])), nil
+}
+
+// scsiLogPage is a LOG SENSE response
+type scsiLogPage struct {
+	Code    uint8
+	SubPage uint8
+	// Params are the parameter values keyed by parameter code
+	Params map[uint16][]byte
+}
+
+// parseSCSILogPage parses a LOG SENSE response into its parameters
+func parseSCSILogPage(b []byte) (*scsiLogPage, error) {
+	if len(b) < 4 {
+		return nil, errShortPage
+	}
+
+	p := &scsiLogPage{
+		Code:    b[0] & 0x3f,
+		SubPage: b[1],
+		Params:  make(map[uint16][]byte),
+	}
+
+	end := 4 + int(binary.BigEndian.Uint16(b[2:]))
+	if end > len(b) {
+		end = len(b)
+	}
+
+	for off := 4; off+4 <= end; {
+		code := binary.BigEndian.Uint16(b[off:])
+		n := int(b[off+3])
+
+		if off+4+n > end {
+			return nil, fmt.Errorf("log page %#02x parameter %#04x overruns the page", p.Code, code)
+		}
+
+		p.Params[code] = b[off+4 : off+4+n]
+		off += 4 + n
+	}
+
+	return p, nil
+}
+
+// Uint returns a parameter as a big endian counter
+func (p *scsiLogPage) Uint(code uint16) (uint64, bool) {
+	b, ok := p.Params[code]
+	if !ok || len(b) < 1 || len(b) > 8 {
+		return 0, false
+	}
+
+	var v uint64
+
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+
+	return v, true
+}
+
+// SCSI log pages read natively
+const (
+	scsiPageWriteErrors    = 0x02
+	scsiPageReadErrors     = 0x03
+	scsiPageVerifyErrors   = 0x05
+	scsiPageTemperature    = 0x0d
+	scsiPageStartStop      = 0x0e
+	scsiPageBackgroundScan = 0x15
+	scsiPageIE             = 0x2f
+)
+
+// scsiLogPages are the log pages read for SCSI SMART data
+var scsiLogPages = []uint8{
+	scsiPageWriteErrors,
+	scsiPageReadErrors,
+	scsiPageVerifyErrors,
+	scsiPageTemperature,
+	scsiPageStartStop,
+	scsiPageBackgroundScan,
+	scsiPageIE,
+}
+
+// parseSCSIErrorCounterPage parses a write, read or verify error counter page
+func parseSCSIErrorCounterPage(p *scsiLogPage) *ScsiErrorCounter {
+	c := new(ScsiErrorCounter)
+
+	counter := func(code uint16) int64 {
+		v, _ := p.Uint(code)
+		return int64(v)
+	}
+
+	c.ErrorsCorrectedByEccfast = counter(0x0000)
+	c.ErrorsCorrectedByEccdelayed = counter(0x0001)
+	c.ErrorsCorrectedByRereadsRewrites = counter(0x0002)
+	c.TotalErrorsCorrected = counter(0x0003)
+	c.CorrectionAlgorithmInvocations = counter(0x0004)
+	c.GigabytesProcessed = fmt.Sprintf("%.3f", float64(counter(0x0005))/1e9)
+	c.TotalUncorrectedErrors = counter(0x0006)
+
+	return c
+}
+
+// parseSCSIStartStopPage parses the start-stop cycle counter page
+func parseSCSIStartStopPage(p *scsiLogPage) *ScsiStartStopCycleCounter {
+	c := new(ScsiStartStopCycleCounter)
+
+	// the date of manufacture is 4 ASCII year digits and 2 week digits
+	if b := p.Params[0x0001]; len(b) >= 6 {
+		c.YearOfManufacture = strings.TrimSpace(string(b[0:4]))
+		c.WeekOfManufacture = strings.TrimSpace(string(b[4:6]))
+	}
+
+	counter := func(code uint16) int64 {
+		v, _ := p.Uint(code)
+		return int64(v)
+	}
+
+	c.SpecifiedCycleCountOverDeviceLifetime = counter(0x0003)
+	c.AccumulatedStartStopCycles = counter(0x0004)
+	c.SpecifiedLoadUnloadCountOverDeviceLifetime = counter(0x0005)
+	c.AccumulatedLoadUnloadCycles = counter(0x0006)
+
+	return c
+}
+
+// parseSCSIBackgroundScan parses the status parameter of the background scan
+// results page and returns it with the accumulated power on minutes
+func parseSCSIBackgroundScan(p *scsiLogPage) (*ScsiBackgroundScan, int, error) {
+	b := p.Params[0x0000]
+	if len(b) < 12 {
+		return nil, 0, errShortPage
+	}
+
+	bg := new(ScsiBackgroundScan)
+	bg.Status.Value = int(b[5])
+	bg.Status.String = scsiBackgroundScanStatusString[bg.Status.Value]
+	bg.Status.NumberScansPerformed = int(binary.BigEndian.Uint16(b[6:]))
+	bg.Status.ScanProgress = fmt.Sprintf("%.2f%%", float64(binary.BigEndian.Uint16(b[8:]))*100/65536)
+	bg.Status.NumberBackgroundMediumScansPerformed = int(binary.BigEndian.Uint16(b[10:]))
+
+	return bg, int(binary.BigEndian.Uint32(b)), nil
+}
+
+// parseSCSIDefectData parses a READ DEFECT DATA(10) response header and
+// returns the number of entries in the defect list
+func parseSCSIDefectData(b []byte) (int64, error) {
+	if len(b) < 4 {
+		return 0, errShortPage
+	}
+
+	size := 8
+
+	// the short block format uses 4 byte entries
+	if b[1]&0x07 == 0 {
+		size = 4
+	}
+
+	return int64(binary.BigEndian.Uint16(b[2:])) / int64(size), nil
+}
+
+// setSCSIIdentity sets the device identity from INQUIRY and READ CAPACITY
+func (s *SMARTInfo) setSCSIIdentity(inq *scsiInquiry, serial string, blocks uint64, logical, physical int) {
+	s.Device.Protocol = "SCSI"
+	s.ModelName = strings.TrimSpace(inq.Vendor + " " + inq.Product)
+	s.ScsiVendor = inq.Vendor
+	s.ScsiProduct = inq.Product
+	s.ScsiRevision = inq.Revision
+	s.FirmwareVersion = inq.Revision
+	s.SerialNumber = serial
+	s.UserCapacity.Blocks = int64(blocks)
+	s.UserCapacity.Bytes = int64(blocks) * int64(logical)
+	s.LogicalBlockSize = logical
+	s.PhysicalBlockSize = physical
+}
+
+// setSCSILogPages sets the health, temperature, power on time, error counters,
+// start-stop cycles and background scan status from the log pages keyed by
+// page code. Pages the device doesn't support are missing. Like smartctl,
+// the health is only reported from the informational exceptions page
+func (s *SMARTInfo) setSCSILogPages(pages map[uint8]*scsiLogPage) {
+	if p := pages[scsiPageIE]; p != nil {
+		if b := p.Params[0]; len(b) >= 3 {
+			// a non zero additional sense code is a predicted failure
+			s.setSmartStatus(b[0] == 0)
+
+			if b[2] != 0xff {
+				s.Temperature.Current = int(b[2])
+			}
+		}
+	}
+
+	if p := pages[scsiPageTemperature]; p != nil {
+		if b := p.Params[0]; len(b) >= 2 && b[1] != 0xff {
+			s.Temperature.Current = int(b[1])
+		}
+
+		if b := p.Params[1]; len(b) >= 2 && b[1] != 0xff {
+			s.Temperature.DriveTrip = int(b[1])
+		}
+	}
+
+	errorPages := map[uint8]**ScsiErrorCounter{}
+	counters := new(ScsiErrorCounterLog)
+	errorPages[scsiPageReadErrors] = &counters.Read
+	errorPages[scsiPageWriteErrors] = &counters.Write
+	errorPages[scsiPageVerifyErrors] = &counters.Verify
+
+	for code, c := range errorPages {
+		if p := pages[code]; p != nil {
+			*c = parseSCSIErrorCounterPage(p)
+			s.ScsiErrorCounterLog = counters
+		}
+	}
+
+	if p := pages[scsiPageStartStop]; p != nil {
+		s.ScsiStartStopCycleCounter = parseSCSIStartStopPage(p)
+	}
+
+	if p := pages[scsiPageBackgroundScan]; p != nil {
+		if bg, minutes, err := parseSCSIBackgroundScan(p); err == nil {
+			s.ScsiBackgroundScan = bg
+			s.PowerOnTime.Hours = minutes / 60
+			s.PowerOnTime.Minutes = minutes % 60
+		}
+	}
+}
+
+// setSCSIGrownDefects sets the size of the grown defect list
+func (s *SMARTInfo) setSCSIGrownDefects(n int64) {
+	s.ScsiGrownDefectList = &n
+}
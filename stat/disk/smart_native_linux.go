@@ -0,0 +1,489 @@
+//+build linux
+
+package disk
+
+import (
+	"fmt"
+	"github.com/dswarbrick/smart/ata"
+	"github.com/dswarbrick/smart/ioctl"
+	"github.com/dswarbrick/smart/nvme"
+	"github.com/dswarbrick/smart/scsi"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const nativeSMARTSupported = true
+
+// nvmeIoctlID is NVME_IOCTL_ID, _IO('N', 0x40), which returns the namespace
+// id of a namespace device
+const nvmeIoctlID = 0x4e40
+
+// nvme0n2 or nvme0c1n2 is namespace 2
+var nvmeNsidRe = regexp.MustCompile(`^nvme\d+(?:c\d+)?n(\d+)$`)
+
+const (
+	ataSmartReadThresholds = 0xd1
+	scsiLogSense           = 0x4d
+	scsiReadDefectData10   = 0x37
+	scsiServiceActionIn16  = 0x9e
+	scsiReadCapacity16     = 0x10
+)
+
+// sgIoHdr is sg_io_hdr_t from <scsi/sg.h>
+type sgIoHdr struct {
+	interfaceID    int32
+	dxferDirection int32
+	cmdLen         uint8
+	mxSbLen        uint8
+	iovecCount     uint16
+	dxferLen       uint32
+	dxferp         uintptr
+	cmdp           uintptr
+	sbp            uintptr
+	timeout        uint32
+	flags          uint32
+	packID         int32
+	usrPtr         uintptr
+	status         uint8
+	maskedStatus   uint8
+	msgStatus      uint8
+	sbLenWr        uint8
+	hostStatus     uint16
+	driverStatus   uint16
+	resid          int32
+	duration       uint32
+	info           uint32
+}
+
+// nvmeAdminCmd is struct nvme_admin_cmd from <linux/nvme_ioctl.h>
+type nvmeAdminCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+// GetNativeSMARTInfo reads SMART data for a device with SG_IO and NVMe admin
+// ioctls instead of running smartctl. ATA drives are read through the kernel's
+// SCSI-ATA translation, SAS drives with LOG SENSE and NVMe drives with the
+// SMART / Health Information log page. Requires CAP_SYS_RAWIO
+func GetNativeSMARTInfo(dev string) (*SMARTInfo, error) {
+	dev = devicePath(dev)
+
+	f, err := os.OpenFile(dev, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	info := new(SMARTInfo)
+	info.Device.Name = dev
+	info.Device.InfoName = dev
+
+	if strings.HasPrefix(filepath.Base(dev), "nvme") {
+		err = readNVMeSMART(f, info)
+	} else {
+		err = readSCSISMART(&sgDevice{f: f}, info)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	info.Smartctl.ExitStatus = int(info.ExitCode)
+
+	return info, nil
+}
+
+// sgDevice sends SCSI commands to a block device with the SG_IO ioctl
+type sgDevice struct {
+	f *os.File
+}
+
+// exec sends a CDB and returns the completed header. Only a failed ioctl is
+// returned as an error, the SCSI status is left to the caller
+func (d *sgDevice) exec(cdb, buf, sense []byte, dir int32) (*sgIoHdr, error) {
+	hdr := &sgIoHdr{
+		interfaceID:    'S',
+		dxferDirection: dir,
+		cmdLen:         uint8(len(cdb)),
+		mxSbLen:        uint8(len(sense)),
+		dxferLen:       uint32(len(buf)),
+		cmdp:           uintptr(unsafe.Pointer(&cdb[0])),
+		sbp:            uintptr(unsafe.Pointer(&sense[0])),
+		timeout:        scsi.DEFAULT_TIMEOUT,
+	}
+
+	if len(buf) > 0 {
+		hdr.dxferp = uintptr(unsafe.Pointer(&buf[0]))
+	}
+
+	err := ioctl.Ioctl(d.f.Fd(), scsi.SG_IO, uintptr(unsafe.Pointer(hdr)))
+
+	runtime.KeepAlive(cdb)
+	runtime.KeepAlive(buf)
+	runtime.KeepAlive(sense)
+
+	return hdr, err
+}
+
+// read sends a CDB that reads len(buf) bytes from the device
+func (d *sgDevice) read(cdb, buf []byte) error {
+	sense := make([]byte, 32)
+
+	hdr, err := d.exec(cdb, buf, sense, scsi.SG_DXFER_FROM_DEV)
+	if err != nil {
+		return err
+	}
+
+	if hdr.info&scsi.SG_INFO_OK_MASK != scsi.SG_INFO_OK {
+		return fmt.Errorf("SCSI command %#02x failed: status %#02x, host status %#02x, driver status %#02x",
+			cdb[0], hdr.status, hdr.hostStatus, hdr.driverStatus)
+	}
+
+	return nil
+}
+
+func (d *sgDevice) inquiry(vpdPage int) ([]byte, error) {
+	buf := make([]byte, 252)
+	cdb := scsi.CDB6{scsi.SCSI_INQUIRY}
+
+	if vpdPage >= 0 {
+		cdb[1] = 0x01
+		cdb[2] = uint8(vpdPage)
+	} else {
+		buf = buf[:scsi.INQ_REPLY_LEN]
+	}
+
+	cdb[4] = uint8(len(buf))
+
+	return buf, d.read(cdb[:], buf)
+}
+
+func (d *sgDevice) readCapacity() (blocks uint64, logical, physical int, err error) {
+	buf := make([]byte, 32)
+	cdb := scsi.CDB16{scsiServiceActionIn16, scsiReadCapacity16}
+	cdb[13] = uint8(len(buf))
+
+	if err = d.read(cdb[:], buf); err == nil {
+		return parseSCSIReadCapacity16(buf)
+	}
+
+	buf = buf[:8]
+	cdb10 := scsi.CDB10{scsi.SCSI_READ_CAPACITY_10}
+
+	if err = d.read(cdb10[:], buf); err != nil {
+		return 0, 0, 0, err
+	}
+
+	blocks, logical, err = parseSCSIReadCapacity10(buf)
+
+	return blocks, logical, logical, err
+}
+
+// logSense reads the cumulative values of a log page, returning nil if the
+// device doesn't support it
+func (d *sgDevice) logSense(page uint8) *scsiLogPage {
+	buf := make([]byte, 1024)
+	cdb := scsi.CDB10{scsiLogSense}
+	cdb[2] = 0x40 | page
+	cdb[7] = uint8(len(buf) >> 8)
+	cdb[8] = uint8(len(buf))
+
+	if err := d.read(cdb[:], buf); err != nil {
+		return nil
+	}
+
+	p, err := parseSCSILogPage(buf)
+	if err != nil || p.Code != page {
+		return nil
+	}
+
+	return p
+}
+
+// grownDefects returns the number of entries in the grown defect list
+func (d *sgDevice) grownDefects() (int64, error) {
+	buf := make([]byte, 4)
+	cdb := scsi.CDB10{scsiReadDefectData10}
+	cdb[2] = 0x08 | 0x05 // GLIST in physical sector format
+	cdb[8] = uint8(len(buf))
+
+	if err := d.read(cdb[:], buf); err != nil {
+		return 0, err
+	}
+
+	return parseSCSIDefectData(buf)
+}
+
+// ataCommand sends an ATA PIO data-in command with ATA PASS-THROUGH(16)
+func (d *sgDevice) ataCommand(command, feature, count, lbaLow uint8) ([]byte, error) {
+	buf := make([]byte, ataPageSize)
+
+	cdb := scsi.CDB16{scsi.SCSI_ATA_PASSTHRU_16}
+	cdb[1] = 0x08 // PIO data-in
+	cdb[2] = 0x0e // BYT_BLOK = 1, T_LENGTH = 2, T_DIR = 1
+	cdb[4] = feature
+	cdb[6] = count
+	cdb[8] = lbaLow
+	cdb[14] = command
+
+	if command == ata.ATA_SMART {
+		cdb[10] = 0x4f
+		cdb[12] = 0xc2
+	}
+
+	return buf, d.read(cdb[:], buf)
+}
+
+// ataSmartStatus sends SMART RETURN STATUS and returns false if the drive
+// reports that it is failing
+func (d *sgDevice) ataSmartStatus() (bool, error) {
+	sense := make([]byte, 32)
+
+	cdb := scsi.CDB16{scsi.SCSI_ATA_PASSTHRU_16}
+	cdb[1] = 0x06 // non-data
+	cdb[2] = 0x20 // CK_COND to return the ATA registers
+	cdb[4] = ata.SMART_RETURN_STATUS
+	cdb[10] = 0x4f
+	cdb[12] = 0xc2
+	cdb[14] = ata.ATA_SMART
+
+	hdr, err := d.exec(cdb[:], nil, sense, scsi.SG_DXFER_NONE)
+	if err != nil {
+		return false, err
+	}
+
+	return parseATAStatusSense(sense[:hdr.sbLenWr])
+}
+
+func readSCSISMART(d *sgDevice, info *SMARTInfo) error {
+	buf, err := d.inquiry(-1)
+	if err != nil {
+		return err
+	}
+
+	inq, err := parseSCSIInquiry(buf)
+	if err != nil {
+		return err
+	}
+
+	if inq.isATA() {
+		return readSATSMART(d, info)
+	}
+
+	info.Device.Type = "scsi"
+
+	var serial string
+
+	if buf, err = d.inquiry(0x80); err == nil {
+		serial, _ = parseSCSISerialVPD(buf)
+	}
+
+	blocks, logical, physical, err := d.readCapacity()
+	if err != nil {
+		return err
+	}
+
+	info.setSCSIIdentity(inq, serial, blocks, logical, physical)
+
+	pages := make(map[uint8]*scsiLogPage)
+
+	for _, code := range scsiLogPages {
+		if p := d.logSense(code); p != nil {
+			pages[code] = p
+		}
+	}
+
+	info.setSCSILogPages(pages)
+
+	if n, err := d.grownDefects(); err == nil {
+		info.setSCSIGrownDefects(n)
+	}
+
+	return nil
+}
+
+func readSATSMART(d *sgDevice, info *SMARTInfo) error {
+	info.Device.Type = "sat"
+	info.Device.InfoName = info.Device.Name + " [SAT]"
+
+	buf, err := d.ataCommand(ata.ATA_IDENTIFY_DEVICE, 0, 1, 0)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseATAIdentify(buf)
+	if err != nil {
+		return err
+	}
+
+	model := lookupDriveModel(strings.TrimSpace(string(id.ModelNumber())))
+	info.setATAIdentity(id, model)
+
+	if !id.SmartSupported || !id.SmartEnabled {
+		info.ExitCode |= SmartResponseError
+		info.Messages = append(info.Messages, SMARTMessage{
+			String:   "SMART support is not available or disabled",
+			Severity: "error",
+		})
+
+		return nil
+	}
+
+	if buf, err = d.ataCommand(ata.ATA_SMART, ata.SMART_READ_DATA, 1, 0); err != nil {
+		return err
+	}
+
+	data, err := parseATASmartData(buf)
+	if err != nil {
+		return err
+	}
+
+	// thresholds are obsolete in ACS and some drives no longer return them
+	thresholds := make(map[uint8]uint8)
+
+	if buf, err = d.ataCommand(ata.ATA_SMART, ataSmartReadThresholds, 1, 1); err == nil {
+		if t, err := parseATAThresholds(buf); err == nil {
+			thresholds = t
+		}
+	}
+
+	info.setATASmartData(data, thresholds, model)
+
+	if passed, err := d.ataSmartStatus(); err == nil {
+		info.setSmartStatus(passed)
+	} else {
+		info.setSmartStatus(info.ExitCode&SmartPrefail == 0)
+	}
+
+	var (
+		errLog      *ata.SmartSummaryErrorLog
+		selfTestLog *ata.SmartSelfTestLog
+		count       int
+		failed      int
+	)
+
+	if info.AtaSmartData.Capabilities.ErrorLoggingSupported {
+		if buf, err = d.ataCommand(ata.ATA_SMART, ata.SMART_READ_LOG, 1, 0x01); err == nil {
+			errLog, _ = parseATAErrorLog(buf)
+		}
+	}
+
+	if info.AtaSmartData.Capabilities.SelfTestsSupported {
+		if buf, err = d.ataCommand(ata.ATA_SMART, ata.SMART_READ_LOG, 1, 0x06); err == nil {
+			selfTestLog, count, failed, _ = parseATASelfTestLog(buf)
+		}
+	}
+
+	info.setATALogs(errLog, selfTestLog, count, failed)
+
+	return nil
+}
+
+// nvmeAdmin sends an NVMe admin command that reads into buf
+func nvmeAdmin(f *os.File, opcode uint8, nsid, cdw10 uint32, buf []byte) error {
+	cmd := nvmeAdminCmd{
+		opcode:  opcode,
+		nsid:    nsid,
+		addr:    uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		dataLen: uint32(len(buf)),
+		cdw10:   cdw10,
+	}
+
+	err := ioctl.Ioctl(f.Fd(), nvme.NVME_IOCTL_ADMIN_CMD, uintptr(unsafe.Pointer(&cmd)))
+	runtime.KeepAlive(buf)
+
+	return err
+}
+
+func readNVMeSMART(f *os.File, info *SMARTInfo) error {
+	info.Device.Type = "nvme"
+
+	buf := make([]byte, nvmeIdentifySize)
+
+	// CNS 1 identifies the controller
+	if err := nvmeAdmin(f, nvme.NVME_ADMIN_IDENTIFY, 0, 1, buf); err != nil {
+		return err
+	}
+
+	id, err := parseNVMeIdentifyController(buf)
+	if err != nil {
+		return err
+	}
+
+	var ns *NVMeNamespace
+
+	nsid := nvmeNamespaceID(f)
+	buf = make([]byte, nvmeIdentifySize)
+
+	if err = nvmeAdmin(f, nvme.NVME_ADMIN_IDENTIFY, nsid, 0, buf); err == nil {
+		ns, _ = parseNVMeIdentifyNamespace(buf, int(nsid))
+	}
+
+	buf = make([]byte, nvmeLogPageSize)
+
+	// log page 02h for all namespaces, the number of dwords minus one in bits 16-27
+	if err = nvmeAdmin(f, nvme.NVME_ADMIN_GET_LOG_PAGE, 0xffffffff, 0x02|uint32(len(buf)/4-1)<<16, buf); err != nil {
+		return err
+	}
+
+	l, err := parseNVMeHealthLog(buf)
+	if err != nil {
+		return err
+	}
+
+	info.setNVMe(id, ns, l)
+
+	return nil
+}
+
+// nvmeNamespaceID returns the namespace id of an open NVMe device with
+// NVME_IOCTL_ID, falling back to its name for kernels or devices that don't
+// support it. Controller devices such as /dev/nvme0 default to namespace 1
+func nvmeNamespaceID(f *os.File) uint32 {
+	r, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), nvmeIoctlID, 0)
+	if errno == 0 && int32(r) > 0 {
+		return uint32(r)
+	}
+
+	name := f.Name()
+	if resolved, err := filepath.EvalSymlinks(name); err == nil {
+		name = resolved
+	}
+
+	return nvmeNamespaceFromName(name)
+}
+
+// nvmeNamespaceFromName returns the namespace id in a device name such as
+// /dev/nvme0n2, or 1 if it has none
+func nvmeNamespaceFromName(name string) uint32 {
+	if match := nvmeNsidRe.FindStringSubmatch(filepath.Base(name)); match != nil {
+		if n, err := strconv.ParseUint(match[1], 10, 32); err == nil && n > 0 {
+			return uint32(n)
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,11 @@
+//+build !linux
+
+package disk
+
+const nativeSMARTSupported = false
+
+// GetNativeSMARTInfo reads SMART data without smartctl, which is only
+// supported on linux
+func GetNativeSMARTInfo(dev string) (*SMARTInfo, error) {
+	return nil, ErrNativeSMARTNotSupported
+}
@@ -0,0 +1,452 @@
+//+build linux
+
+package disk
+
+import (
+	"encoding/hex"
+	"github.com/dswarbrick/smart/drivedb"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readHexFixture reads a raw response page saved as hex under testdata/smart
+func readHexFixture(t *testing.T, name string) []byte {
+	b, err := os.ReadFile(filepath.Join("testdata", "smart", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := hex.DecodeString(strings.Join(strings.Fields(string(b)), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func findAttr(t *testing.T, info *SMARTInfo, id int) SMARTAttribute {
+	for _, a := range info.AtaSmartAttributes.Table {
+		if a.ID == id {
+			return a
+		}
+	}
+
+	t.Fatalf("attribute %d not found", id)
+
+	return SMARTAttribute{}
+}
+
+func TestParseATAPages(t *testing.T) {
+	id, err := parseATAIdentify(readHexFixture(t, "ata_identify.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !id.SmartSupported || !id.SmartEnabled {
+		t.Error("expected SMART to be supported and enabled")
+	}
+
+	data, err := parseATASmartData(readHexFixture(t, "ata_smart_data.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !data.ChecksumValid {
+		t.Error("expected a valid checksum")
+	}
+
+	thresholds, err := parseATAThresholds(readHexFixture(t, "ata_thresholds.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errLog, err := parseATAErrorLog(readHexFixture(t, "ata_error_log.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selfTestLog, count, failed, err := parseATASelfTestLog(readHexFixture(t, "ata_selftest_log.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := lookupDriveModel(strings.TrimSpace(string(id.ModelNumber())))
+	info := new(SMARTInfo)
+	info.setATAIdentity(id, model)
+	info.setATASmartData(data, thresholds, model)
+	info.setATALogs(errLog, selfTestLog, count, failed)
+	info.setSmartStatus(true)
+
+	if info.ModelName != "WDC WD40EFRX-68N32N0" || info.SerialNumber != "WD-WCC7K1234567" ||
+		info.FirmwareVersion != "82.00A82" {
+		t.Errorf("unexpected identity %q %q %q", info.ModelName, info.SerialNumber, info.FirmwareVersion)
+	}
+
+	if info.UserCapacity.Blocks != 7814037168 || info.UserCapacity.Bytes != 7814037168*512 {
+		t.Errorf("unexpected capacity %+v", info.UserCapacity)
+	}
+
+	if info.LogicalBlockSize != 512 || info.PhysicalBlockSize != 4096 {
+		t.Errorf("unexpected block sizes %d/%d", info.LogicalBlockSize, info.PhysicalBlockSize)
+	}
+
+	if info.Wwn.Naa != 5 || info.Wwn.Oui != 0x0014ee || info.Wwn.ID != 0x2b6c1234 {
+		t.Errorf("unexpected wwn %+v", info.Wwn)
+	}
+
+	if info.RotationRate != 5400 || info.AtaVersion.String != "ACS-3" || info.SataVersion.String != "Serial ATA SATA 3.1" {
+		t.Errorf("unexpected rotation rate %d, ata version %q or sata version %q",
+			info.RotationRate, info.AtaVersion.String, info.SataVersion.String)
+	}
+
+	if len(info.AtaSmartAttributes.Table) != 10 {
+		t.Fatalf("expected 10 attributes, got %d", len(info.AtaSmartAttributes.Table))
+	}
+
+	a := findAttr(t, info, 1)
+	if a.Name != "Raw_Read_Error_Rate" || a.Thresh != 51 || a.Flags.String != "POSR-K " || !a.Flags.Prefailure {
+		t.Errorf("unexpected attribute %+v", a)
+	}
+
+	if a = findAttr(t, info, 3); a.Raw.Value != 6033 || a.Raw.String != "6033" || a.Worst != 175 {
+		t.Errorf("unexpected attribute %+v", a)
+	}
+
+	if a = findAttr(t, info, 194); a.Raw.String != "37 (Min/Max 19/46)" || a.Name != "Temperature_Celsius" {
+		t.Errorf("unexpected attribute %+v", a)
+	}
+
+	if info.PowerOnTime.Hours != 28789 || info.PowerCycleCount != 28 || info.Temperature.Current != 37 {
+		t.Errorf("unexpected power on hours %d, power cycles %d or temperature %d",
+			info.PowerOnTime.Hours, info.PowerCycleCount, info.Temperature.Current)
+	}
+
+	polling := info.AtaSmartData.SelfTest.PollingMinutes
+	if polling.Short != 2 || polling.Extended != 470 || polling.Conveyance != 5 {
+		t.Errorf("unexpected polling minutes %+v", polling)
+	}
+
+	if !info.AtaSmartData.Capabilities.SelfTestsSupported || !info.AtaSmartData.Capabilities.ErrorLoggingSupported {
+		t.Errorf("unexpected capabilities %+v", info.AtaSmartData.Capabilities)
+	}
+
+	if info.AtaSmartErrorLog.Summary.Count != 3 || info.AtaSmartSelfTestLog.Standard.Count != 2 {
+		t.Errorf("unexpected error log count %d or self-test count %d",
+			info.AtaSmartErrorLog.Summary.Count, info.AtaSmartSelfTestLog.Standard.Count)
+	}
+
+	if tests := info.SelfTests(); len(tests) != 2 || !tests[0].Failed || *tests[0].FirstErrorLBA != 1234567 ||
+		tests[0].Type != SelfTestShort || tests[1].Type != SelfTestLong || !tests[1].Passed {
+		t.Errorf("unexpected self-test log %+v", tests)
+	}
+
+	if info.ExitCode != SmartErrorLogHasErrors|SmartSelfTestErrors {
+		t.Errorf("unexpected exit code %d", info.ExitCode)
+	}
+
+	if !info.Healthy() {
+		t.Error("expected the drive to be healthy")
+	}
+}
+
+func TestParseATAFailingAttribute(t *testing.T) {
+	page := readHexFixture(t, "ata_smart_data.hex")
+
+	// Reallocated_Sector_Ct is the fourth attribute, drop its value below
+	// the threshold of 140
+	page[2+3*12+3] = 100
+
+	data, err := parseATASmartData(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thresholds, err := parseATAThresholds(readHexFixture(t, "ata_thresholds.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := new(SMARTInfo)
+	info.setATASmartData(data, thresholds, lookupDriveModel(""))
+
+	if a := findAttr(t, info, 5); a.WhenFailed != "now" {
+		t.Errorf("expected Reallocated_Sector_Ct to be failing, got %q", a.WhenFailed)
+	}
+
+	if a := findAttr(t, info, 198); a.WhenFailed != "" {
+		t.Errorf("expected attributes without a threshold not to fail, got %q", a.WhenFailed)
+	}
+
+	if info.ExitCode != SmartPrefail|SmartResponseError {
+		t.Errorf("expected prefail and checksum errors, got %d", info.ExitCode)
+	}
+}
+
+func TestParseATAStatusSense(t *testing.T) {
+	sense := func(mid, high byte) []byte {
+		b := make([]byte, 22)
+		b[0], b[7] = 0x72, 14
+		b[8], b[9] = 0x09, 12
+		b[8+9], b[8+11] = mid, high
+
+		return b
+	}
+
+	if passed, err := parseATAStatusSense(sense(0x4f, 0xc2)); err != nil || !passed {
+		t.Errorf("expected the drive to pass: %v", err)
+	}
+
+	if passed, err := parseATAStatusSense(sense(0xf4, 0x2c)); err != nil || passed {
+		t.Errorf("expected the drive to fail: %v", err)
+	}
+
+	if _, err := parseATAStatusSense([]byte{0x70, 0, 5}); err == nil {
+		t.Error("expected an error for fixed format sense data")
+	}
+}
+
+func TestFormatATARaw(t *testing.T) {
+	tests := []struct {
+		vendor [6]byte
+		conv   string
+		value  uint64
+		str    string
+	}{
+		{[6]byte{0x91, 0x17}, "raw48", 6033, "6033"},
+		{[6]byte{0x91, 0x17, 0xa0, 0x0f}, "raw16(avg16)", 0x0fa01791, "6033 (Average 4000)"},
+		{[6]byte{0x05, 0, 0x01, 0, 0x02}, "raw16(raw16)", 0x000200010005, "5 (2 1)"},
+		{[6]byte{0x75, 0x70, 0, 0x10}, "raw24(raw8)", 0x10007075, "28789 (0 0 16)"},
+		{[6]byte{0x10, 0x0e}, "sec2hour", 3600, "1h+00m+00s"},
+		{[6]byte{0x52}, "min2hour", 82, "1h+22m"},
+		{[6]byte{0x5b, 0x01}, "temp10x", 347, "34.7"},
+		{[6]byte{0x2a, 0, 0x10, 0x37}, "tempminmax", 0x3710002a, "42 (Min/Max 16/55)"},
+		{[6]byte{0x2a}, "hex48", 42, "0x00000000002a"},
+		{[6]byte{0x01, 0, 0, 0, 0, 0x80}, "raw48:012345", 0x010000000080, "1099511627904"},
+	}
+
+	for _, tt := range tests {
+		raw := ataRawValue(tt.vendor, 0, 100, 100, tt.conv)
+		if raw != tt.value {
+			t.Errorf("%s: expected raw value %#x, got %#x", tt.conv, tt.value, raw)
+		}
+
+		if s := formatATARaw(tt.value, tt.conv); s != tt.str {
+			t.Errorf("%s: expected %q, got %q", tt.conv, tt.str, s)
+		}
+	}
+}
+
+func TestParseNVMePages(t *testing.T) {
+	id, err := parseNVMeIdentifyController(readHexFixture(t, "nvme_identify_ctrl.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.VendorID != 0x144d || id.IEEEOUI != 0x002538 || id.WarningTemp != 85 || id.TotalCapacity != 1000204886016 {
+		t.Errorf("unexpected controller %+v", id)
+	}
+
+	ns, err := parseNVMeIdentifyNamespace(readHexFixture(t, "nvme_identify_ns.hex"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := parseNVMeHealthLog(readHexFixture(t, "nvme_health_log.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l.PercentageUsed != 3 || l.AvailableSpare != 100 || l.DataUnitsWritten != 23456789 || l.UnsafeShutdowns != 15 {
+		t.Errorf("unexpected health log %+v", l)
+	}
+
+	if len(l.TemperatureSensors) != 2 || l.TemperatureSensors[0] != 37 || l.TemperatureSensors[1] != 45 {
+		t.Errorf("unexpected temperature sensors %v", l.TemperatureSensors)
+	}
+
+	info := new(SMARTInfo)
+	info.setNVMe(id, ns, l)
+
+	if info.ModelName != "Samsung SSD 970 EVO Plus 1TB" || info.SerialNumber != "S4EWNX0R123456A" ||
+		info.FirmwareVersion != "2B2QEXM7" {
+		t.Errorf("unexpected identity %q %q %q", info.ModelName, info.SerialNumber, info.FirmwareVersion)
+	}
+
+	if info.UserCapacity.Bytes != 1953525168*512 || info.LogicalBlockSize != 512 {
+		t.Errorf("unexpected capacity %+v", info.UserCapacity)
+	}
+
+	if info.Temperature.Current != 37 || info.PowerOnTime.Hours != 4321 || info.PowerCycleCount != 120 {
+		t.Errorf("unexpected temperature %d, power on hours %d or power cycles %d",
+			info.Temperature.Current, info.PowerOnTime.Hours, info.PowerCycleCount)
+	}
+
+	if !info.Healthy() || info.ExitCode != SmartErrorLogHasErrors {
+		t.Errorf("unexpected health %v with exit code %d", info.Healthy(), info.ExitCode)
+	}
+
+	if info.NvmeVersion.String != "1.3" || info.NvmePciVendor.ID != 0x144d || len(info.NvmeNamespaces) != 1 {
+		t.Errorf("unexpected version %+v, vendor %+v or namespaces %+v",
+			info.NvmeVersion, info.NvmePciVendor, info.NvmeNamespaces)
+	}
+
+	if eui := info.NvmeNamespaces[0].Eui64; eui.Oui != 0x002538 || eui.ExtID != 0x5b91b01234 {
+		t.Errorf("unexpected eui64 %+v", eui)
+	}
+}
+
+func TestNVMeNamespaceFromName(t *testing.T) {
+	for name, want := range map[string]uint32{
+		"/dev/nvme0n1":   1,
+		"/dev/nvme0n2":   2,
+		"nvme1c2n14":     14,
+		"/dev/nvme0":     1,
+		"/dev/nvme0n1p3": 1,
+		"/dev/sda":       1,
+	} {
+		if got := nvmeNamespaceFromName(name); got != want {
+			t.Errorf("%s: expected namespace %d, got %d", name, want, got)
+		}
+	}
+}
+
+func TestParseSCSIPages(t *testing.T) {
+	inq, err := parseSCSIInquiry(readHexFixture(t, "scsi_inquiry.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inq.isATA() || inq.Vendor != "SEAGATE" || inq.Product != "ST4000NM0023" || inq.Revision != "0004" {
+		t.Errorf("unexpected inquiry %+v", inq)
+	}
+
+	serial, err := parseSCSISerialVPD(readHexFixture(t, "scsi_serial_vpd.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, logical, physical, err := parseSCSIReadCapacity16(readHexFixture(t, "scsi_readcap16.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages := make(map[uint8]*scsiLogPage)
+
+	for _, name := range []string{"ie", "temp", "bgscan", "read_errors", "write_errors", "verify_errors", "start_stop"} {
+		p, err := parseSCSILogPage(readHexFixture(t, "scsi_log_"+name+".hex"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pages[p.Code] = p
+	}
+
+	if ref, ok := pages[scsiPageTemperature].Uint(1); !ok || ref != 68 {
+		t.Errorf("expected a reference temperature of 68, got %d", ref)
+	}
+
+	defects, err := parseSCSIDefectData(readHexFixture(t, "scsi_defect_data.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := new(SMARTInfo)
+	info.setSCSIIdentity(inq, serial, blocks, logical, physical)
+	info.setSCSILogPages(pages)
+	info.setSCSIGrownDefects(defects)
+
+	if info.ModelName != "SEAGATE ST4000NM0023" || info.SerialNumber != "Z1Z2ABCD0000C4261234" {
+		t.Errorf("unexpected identity %q %q", info.ModelName, info.SerialNumber)
+	}
+
+	if info.UserCapacity.Blocks != 7814037168 || info.LogicalBlockSize != 512 || info.PhysicalBlockSize != 4096 {
+		t.Errorf("unexpected capacity %+v with block sizes %d/%d",
+			info.UserCapacity, info.LogicalBlockSize, info.PhysicalBlockSize)
+	}
+
+	if !info.Healthy() || info.Temperature.Current != 33 || info.PowerOnTime.Hours != 43207 {
+		t.Errorf("unexpected health %v, temperature %d or power on hours %d",
+			info.Healthy(), info.Temperature.Current, info.PowerOnTime.Hours)
+	}
+
+	if info.ScsiVendor != "SEAGATE" || info.PowerOnTime.Minutes != 0 || info.Temperature.DriveTrip != 68 {
+		t.Errorf("unexpected vendor %q, power on minutes %d or drive trip %d",
+			info.ScsiVendor, info.PowerOnTime.Minutes, info.Temperature.DriveTrip)
+	}
+
+	if *info.ScsiGrownDefectList != 11 {
+		t.Errorf("expected 11 grown defects, got %d", *info.ScsiGrownDefectList)
+	}
+
+	if l := info.ScsiErrorCounterLog; l.Read.TotalErrorsCorrected != 12 || l.Read.GigabytesProcessed != "412345.679" ||
+		l.Write.GigabytesProcessed != "125000.000" || l.Verify.ErrorsCorrectedByEccdelayed != 3 {
+		t.Errorf("unexpected error counters %+v %+v %+v", l.Read, l.Write, l.Verify)
+	}
+
+	if c := info.ScsiStartStopCycleCounter; c.YearOfManufacture != "2016" || c.WeekOfManufacture != "12" ||
+		c.AccumulatedStartStopCycles != 64 || c.AccumulatedLoadUnloadCycles != 2456 {
+		t.Errorf("unexpected start-stop cycle counter %+v", c)
+	}
+
+	if bg := info.ScsiBackgroundScan.Status; bg.Value != 8 || bg.NumberScansPerformed != 18 ||
+		bg.ScanProgress != "50.00%" || bg.NumberBackgroundMediumScansPerformed != 3 {
+		t.Errorf("unexpected background scan status %+v", bg)
+	}
+
+	if problems := info.SCSIHealthProblems(); len(problems) != 0 {
+		t.Errorf("expected no health problems, got %v", problems)
+	}
+
+	// without the informational exceptions page the health is unknown
+	delete(pages, scsiPageIE)
+
+	info = new(SMARTInfo)
+	info.setSCSILogPages(pages)
+
+	if info.SmartStatus != nil || info.Healthy() || info.StatusFailed() {
+		t.Errorf("expected no health status without the IE page, got %+v", info.SmartStatus)
+	}
+
+	if _, err = parseSCSILogPage([]byte{0x2f, 0, 0, 8, 0, 0, 0x03, 8}); err == nil {
+		t.Error("expected an error for a parameter overrunning the page")
+	}
+}
+
+func TestLoadDriveDb(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drivedb.yaml")
+	db := `drives:
+- family: Western Digital Red
+  model_regex: 'WDC WD[1-6]0EFRX-.*'
+  firmware_regex: ''
+  presets:
+    "9":
+      conv: min2hour
+`
+
+	if err := os.WriteFile(path, []byte(db), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(db *drivedb.DriveDb) {
+		driveDb = db
+	}(driveDb)
+
+	if err := LoadDriveDb(path); err != nil {
+		t.Fatal(err)
+	}
+
+	m := lookupDriveModel("WDC WD40EFRX-68N32N0")
+	if m.Family != "Western Digital Red" || m.Presets["9"].Conv != "min2hour" || m.Presets["9"].Name != "Power_On_Hours" {
+		t.Errorf("unexpected drive model %+v", m)
+	}
+
+	if m = lookupDriveModel("ST4000NM0023"); len(m.Family) > 0 || m.Presets["9"].Conv != "raw24(raw8)" {
+		t.Errorf("expected the default conversions, got %+v", m)
+	}
+
+	if err := LoadDriveDb(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error loading a missing drive database")
+	}
+}
@@ -0,0 +1,160 @@
+package disk
+
+import (
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"math"
+	"strings"
+)
+
+// nvmeDataUnit is the size of an NVMe data unit, 1000 512 byte blocks
+const nvmeDataUnit = 512 * 1000
+
+// NVMeCriticalWarning is the critical warning bitmask of the NVMe SMART /
+// Health Information log
+type NVMeCriticalWarning uint8
+
+const (
+	NVMeSpareBelowThreshold NVMeCriticalWarning = 1 << iota
+	NVMeTemperatureThreshold
+	NVMeReliabilityDegraded
+	NVMeReadOnly
+	NVMeVolatileBackupFailed
+	NVMePersistentMemoryReadOnly
+)
+
+var nvmeCriticalWarningNames = []struct {
+	flag NVMeCriticalWarning
+	name string
+}{
+	{NVMeSpareBelowThreshold, "available spare below threshold"},
+	{NVMeTemperatureThreshold, "temperature above or below threshold"},
+	{NVMeReliabilityDegraded, "NVM subsystem reliability degraded"},
+	{NVMeReadOnly, "media placed in read only mode"},
+	{NVMeVolatileBackupFailed, "volatile memory backup device failed"},
+	{NVMePersistentMemoryReadOnly, "persistent memory region placed in read only mode"},
+}
+
+// Has returns true if all of the given warnings are set
+func (w NVMeCriticalWarning) Has(flag NVMeCriticalWarning) bool {
+	return w&flag == flag
+}
+
+// Strings returns a description of each warning that is set
+func (w NVMeCriticalWarning) Strings() []string {
+	var out []string
+
+	for _, n := range nvmeCriticalWarningNames {
+		if w.Has(n.flag) {
+			out = append(out, n.name)
+		}
+	}
+
+	return out
+}
+
+// String returns the warnings that are set separated by commas
+func (w NVMeCriticalWarning) String() string {
+	return strings.Join(w.Strings(), ", ")
+}
+
+// NVMeHealthInformationLog is the NVMe SMART / Health Information log page
+type NVMeHealthInformationLog struct {
+	CriticalWarning         NVMeCriticalWarning `yaml:"critical_warning" json:"critical_warning"`
+	Temperature             int                 `yaml:"temperature" json:"temperature"`
+	AvailableSpare          int                 `yaml:"available_spare" json:"available_spare"`
+	AvailableSpareThreshold int                 `yaml:"available_spare_threshold" json:"available_spare_threshold"`
+	PercentageUsed          int                 `yaml:"percentage_used" json:"percentage_used"`
+	// DataUnitsRead and DataUnitsWritten are in thousands of 512 byte units
+	DataUnitsRead      uint64 `yaml:"data_units_read" json:"data_units_read"`
+	DataUnitsWritten   uint64 `yaml:"data_units_written" json:"data_units_written"`
+	HostReads          uint64 `yaml:"host_reads" json:"host_reads"`
+	HostWrites         uint64 `yaml:"host_writes" json:"host_writes"`
+	ControllerBusyTime uint64 `yaml:"controller_busy_time" json:"controller_busy_time"`
+	PowerCycles        uint64 `yaml:"power_cycles" json:"power_cycles"`
+	PowerOnHours       uint64 `yaml:"power_on_hours" json:"power_on_hours"`
+	UnsafeShutdowns    uint64 `yaml:"unsafe_shutdowns" json:"unsafe_shutdowns"`
+	MediaErrors        uint64 `yaml:"media_errors" json:"media_errors"`
+	NumErrLogEntries   uint64 `yaml:"num_err_log_entries" json:"num_err_log_entries"`
+	// WarningTempTime and CriticalCompTime are in minutes
+	WarningTempTime  int `yaml:"warning_temp_time" json:"warning_temp_time"`
+	CriticalCompTime int `yaml:"critical_comp_time" json:"critical_comp_time"`
+	// TemperatureSensors are the implemented sensors in Celsius
+	TemperatureSensors []int `yaml:"temperature_sensors,omitempty" json:"temperature_sensors,omitempty"`
+}
+
+// DataRead returns the data read from the drive
+func (l *NVMeHealthInformationLog) DataRead() cap.Capacity {
+	return nvmeDataCapacity(l.DataUnitsRead)
+}
+
+// DataWritten returns the data written to the drive
+func (l *NVMeHealthInformationLog) DataWritten() cap.Capacity {
+	return nvmeDataCapacity(l.DataUnitsWritten)
+}
+
+// nvmeDataCapacity converts data units to a capacity, clamping counts too
+// large for a Capacity instead of wrapping
+func nvmeDataCapacity(units uint64) cap.Capacity {
+	if units > math.MaxInt64/nvmeDataUnit {
+		return cap.Capacity(math.MaxInt64)
+	}
+
+	return cap.Capacity(units * nvmeDataUnit)
+}
+
+// SpareBelowThreshold returns true if the available spare has dropped to or
+// below the threshold. Drives that don't report a threshold only trip on the
+// critical warning
+func (l *NVMeHealthInformationLog) SpareBelowThreshold() bool {
+	return l.CriticalWarning.Has(NVMeSpareBelowThreshold) ||
+		(l.AvailableSpareThreshold > 0 && l.AvailableSpare <= l.AvailableSpareThreshold)
+}
+
+// NVMePciVendor is the PCI vendor and subsystem vendor of an NVMe controller
+type NVMePciVendor struct {
+	ID          int `yaml:"id" json:"id"`
+	SubsystemID int `yaml:"subsystem_id" json:"subsystem_id"`
+}
+
+// NVMeBlocks is a size in logical blocks and bytes
+type NVMeBlocks struct {
+	Blocks int64 `yaml:"blocks" json:"blocks"`
+	Bytes  int64 `yaml:"bytes" json:"bytes"`
+}
+
+// NVMeNamespace is the identity of an NVMe namespace
+type NVMeNamespace struct {
+	ID               int        `yaml:"id" json:"id"`
+	Size             NVMeBlocks `yaml:"size" json:"size"`
+	Capacity         NVMeBlocks `yaml:"capacity" json:"capacity"`
+	Utilization      NVMeBlocks `yaml:"utilization" json:"utilization"`
+	FormattedLbaSize int        `yaml:"formatted_lba_size" json:"formatted_lba_size"`
+	Eui64            struct {
+		Oui   int   `yaml:"oui" json:"oui"`
+		ExtID int64 `yaml:"ext_id" json:"ext_id"`
+	} `yaml:"eui64" json:"eui64"`
+}
+
+// NVMeVersion is the NVMe specification version a controller supports
+type NVMeVersion struct {
+	String string `yaml:"string" json:"string"`
+	Value  int    `yaml:"value" json:"value"`
+}
+
+// newNVMeVersion decodes the VER field of Identify Controller, e.g. 0x10300
+// is 1.3
+func newNVMeVersion(v uint32) NVMeVersion {
+	s := fmt.Sprintf("%d.%d", v>>16, (v>>8)&0xff)
+
+	if v&0xff != 0 {
+		s = fmt.Sprintf("%s.%d", s, v&0xff)
+	}
+
+	return NVMeVersion{String: s, Value: int(v)}
+}
+
+// IsNVMe returns true if the SMART data is from an NVMe drive
+func (s *SMARTInfo) IsNVMe() bool {
+	return s.NvmeSmartHealthInformationLog != nil
+}
@@ -0,0 +1,134 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+)
+
+// ScanSMARTDevices lists the devices smartctl can open with
+// smartctl --scan-open, including the disks behind RAID controllers and USB
+// bridges that need a device type to be read
+func ScanSMARTDevices() ([]SMARTDevice, error) {
+	if !smartctlInstalled {
+		return nil, ErrSmartctlNotInstalled
+	}
+
+	var out bytes.Buffer
+
+	cmd := exec.Command("smartctl", "--scan-open", "--json")
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil && out.Len() == 0 {
+		return nil, err
+	}
+
+	return parseSMARTScan(out.Bytes())
+}
+
+// parseSMARTScan parses the output of smartctl --scan-open --json
+func parseSMARTScan(b []byte) ([]SMARTDevice, error) {
+	var scan struct {
+		Devices []SMARTDevice `json:"devices"`
+	}
+
+	if err := json.Unmarshal(b, &scan); err != nil {
+		return nil, err
+	}
+
+	return scan.Devices, nil
+}
+
+// identifySMARTDevice reads the identity of a device with smartctl -i
+func identifySMARTDevice(dev SMARTDevice) (*SMARTInfo, error) {
+	return execSmartctl(dev.Name, "-i", "-d", dev.Type)
+}
+
+// DiscoverSMARTDevices scans for devices with ScanSMARTDevices and matches
+// them to the inventory's disks with MatchSMARTDevices
+func (inv *Inventory) DiscoverSMARTDevices() ([]SMARTDevice, error) {
+	devs, err := ScanSMARTDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	return inv.MatchSMARTDevices(devs), nil
+}
+
+// MatchSMARTDevices matches devices found by ScanSMARTDevices to the
+// inventory's disks so their SMART data is read with the right device type.
+// Devices are matched by name, then by serial number or WWN for disks behind
+// a controller. The devices that match no disk are returned, e.g. the member
+// disks of a hardware RAID volume, and can be read with GetSMARTInfo and
+// WithDeviceType
+func (inv *Inventory) MatchSMARTDevices(devs []SMARTDevice) []SMARTDevice {
+	return matchSMARTDevices(inv.Disks, devs, identifySMARTDevice)
+}
+
+func matchSMARTDevices(disks []*BlockDevice, devs []SMARTDevice,
+	identify func(SMARTDevice) (*SMARTInfo, error)) []SMARTDevice {
+	var (
+		unmatched []SMARTDevice
+		rest      []SMARTDevice
+	)
+
+	byName := make(map[string]*BlockDevice)
+
+	for _, d := range disks {
+		byName[d.Name] = d
+	}
+
+	for _, dev := range devs {
+		if len(dev.OpenError) > 0 {
+			unmatched = append(unmatched, dev)
+			continue
+		}
+
+		name := strings.TrimPrefix(dev.Name, "/dev/")
+		matched := false
+
+		for _, d := range disks {
+			// smartctl names NVMe controllers, the kernel their namespaces
+			if d.Name == name || (strings.HasPrefix(name, "nvme") && strings.HasPrefix(d.Name, name+"n")) {
+				d.setSMARTDevice(dev)
+				matched = true
+			}
+		}
+
+		if !matched {
+			rest = append(rest, dev)
+		}
+	}
+
+	for _, dev := range rest {
+		info, err := identify(dev)
+		if err != nil {
+			unmatched = append(unmatched, dev)
+			continue
+		}
+
+		serial, wwn := strings.TrimSpace(info.SerialNumber), info.WWN()
+		matched := false
+
+		for _, d := range disks {
+			if d.SMARTDevice != nil {
+				continue
+			}
+
+			if (len(serial) > 0 && strings.EqualFold(strings.TrimSpace(d.SerialNumber), serial)) ||
+				(len(wwn) > 0 && strings.EqualFold(d.WWN, wwn)) {
+				d.setSMARTDevice(dev)
+				matched = true
+			}
+		}
+
+		if !matched {
+			unmatched = append(unmatched, dev)
+		}
+	}
+
+	return unmatched
+}
@@ -0,0 +1,74 @@
+//+build linux
+
+package disk
+
+import (
+	"errors"
+	"github.com/jaypipes/ghw/pkg/block"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchSMARTDevices(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "smart", "smartctl_scan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devs, err := parseSMARTScan(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devs) != 5 || devs[2].Type != "sat+megaraid,0" || devs[4].OpenError != "INQUIRY failed" {
+		t.Fatalf("unexpected devices %+v", devs)
+	}
+
+	sda := &BlockDevice{Disk: &block.Disk{Name: "sda", SerialNumber: "WD-1"}}
+	nvme := &BlockDevice{Disk: &block.Disk{Name: "nvme0n1"}}
+	jbod := &BlockDevice{Disk: &block.Disk{Name: "sdb", SerialNumber: "ZDH1ABCD"}}
+	other := &BlockDevice{Disk: &block.Disk{Name: "sdc", WWN: "0x5000c500a1b2c3d4"}}
+
+	var identified []string
+
+	unmatched := matchSMARTDevices([]*BlockDevice{sda, nvme, jbod, other}, devs,
+		func(dev SMARTDevice) (*SMARTInfo, error) {
+			identified = append(identified, dev.Type)
+
+			if dev.Type == "sat+megaraid,1" {
+				return nil, errors.New("no such device")
+			}
+
+			return readSmartctlFixture(t, "smartctl_ata_seagate.json"), nil
+		})
+
+	if sda.SMARTDevice.Type != "sat" || nvme.SMARTDevice.Name != "/dev/nvme0" {
+		t.Errorf("expected devices to match by name, got %+v and %+v", sda.SMARTDevice, nvme.SMARTDevice)
+	}
+
+	if jbod.SMARTDevice == nil || jbod.SMARTDevice.Type != "sat+megaraid,0" {
+		t.Errorf("expected the controller device to match by serial, got %+v", jbod.SMARTDevice)
+	}
+
+	if other.SMARTDevice != nil {
+		t.Errorf("expected no match, got %+v", other.SMARTDevice)
+	}
+
+	if len(identified) != 2 {
+		t.Errorf("expected only the controller devices to be identified, got %v", identified)
+	}
+
+	if len(unmatched) != 2 || unmatched[0].OpenError == "" || unmatched[1].Type != "sat+megaraid,1" {
+		t.Errorf("unexpected unmatched devices %+v", unmatched)
+	}
+
+	dev, opts := jbod.smartDevice()
+	if o := newSMARTOptions(opts...); dev != "/dev/bus/0" || o.deviceType != "sat+megaraid,0" {
+		t.Errorf("unexpected device %s with type %q", dev, o.deviceType)
+	}
+
+	if !nativeDeviceType("sat") || nativeDeviceType("megaraid,0") {
+		t.Error("expected only sat, scsi and nvme to be read natively")
+	}
+}
@@ -0,0 +1,128 @@
+package disk
+
+import (
+	"fmt"
+)
+
+// SCSIGrownDefectLimit is the number of grown defects at which a SAS drive is
+// considered unhealthy
+var SCSIGrownDefectLimit int64 = 100
+
+// ScsiErrorCounter is one direction of the SCSI error counter log
+type ScsiErrorCounter struct {
+	ErrorsCorrectedByEccfast         int64  `yaml:"errors_corrected_by_eccfast" json:"errors_corrected_by_eccfast"`
+	ErrorsCorrectedByEccdelayed      int64  `yaml:"errors_corrected_by_eccdelayed" json:"errors_corrected_by_eccdelayed"`
+	ErrorsCorrectedByRereadsRewrites int64  `yaml:"errors_corrected_by_rereads_rewrites" json:"errors_corrected_by_rereads_rewrites"`
+	TotalErrorsCorrected             int64  `yaml:"total_errors_corrected" json:"total_errors_corrected"`
+	CorrectionAlgorithmInvocations   int64  `yaml:"correction_algorithm_invocations" json:"correction_algorithm_invocations"`
+	GigabytesProcessed               string `yaml:"gigabytes_processed" json:"gigabytes_processed"`
+	TotalUncorrectedErrors           int64  `yaml:"total_uncorrected_errors" json:"total_uncorrected_errors"`
+}
+
+// ScsiErrorCounterLog is the read, write and verify error counter log pages.
+// Counters are nil if the device doesn't support the page
+type ScsiErrorCounterLog struct {
+	Read   *ScsiErrorCounter `yaml:"read,omitempty" json:"read,omitempty"`
+	Write  *ScsiErrorCounter `yaml:"write,omitempty" json:"write,omitempty"`
+	Verify *ScsiErrorCounter `yaml:"verify,omitempty" json:"verify,omitempty"`
+}
+
+// UncorrectedErrors returns the total read, write and verify errors that
+// could not be corrected
+func (l *ScsiErrorCounterLog) UncorrectedErrors() int64 {
+	var n int64
+
+	for _, c := range []*ScsiErrorCounter{l.Read, l.Write, l.Verify} {
+		if c != nil {
+			n += c.TotalUncorrectedErrors
+		}
+	}
+
+	return n
+}
+
+// ScsiStartStopCycleCounter is the SCSI start-stop cycle counter log page
+type ScsiStartStopCycleCounter struct {
+	YearOfManufacture                          string `yaml:"year_of_manufacture,omitempty" json:"year_of_manufacture,omitempty"`
+	WeekOfManufacture                          string `yaml:"week_of_manufacture,omitempty" json:"week_of_manufacture,omitempty"`
+	SpecifiedCycleCountOverDeviceLifetime      int64  `yaml:"specified_cycle_count_over_device_lifetime" json:"specified_cycle_count_over_device_lifetime"`
+	AccumulatedStartStopCycles                 int64  `yaml:"accumulated_start_stop_cycles" json:"accumulated_start_stop_cycles"`
+	SpecifiedLoadUnloadCountOverDeviceLifetime int64  `yaml:"specified_load_unload_count_over_device_lifetime" json:"specified_load_unload_count_over_device_lifetime"`
+	AccumulatedLoadUnloadCycles                int64  `yaml:"accumulated_load_unload_cycles" json:"accumulated_load_unload_cycles"`
+}
+
+// ScsiBackgroundScan is the status parameter of the background scan results
+// log page
+type ScsiBackgroundScan struct {
+	Status struct {
+		Value                                int    `yaml:"value" json:"value"`
+		String                               string `yaml:"string" json:"string"`
+		NumberScansPerformed                 int    `yaml:"number_scans_performed" json:"number_scans_performed"`
+		ScanProgress                         string `yaml:"scan_progress" json:"scan_progress"`
+		NumberBackgroundMediumScansPerformed int    `yaml:"number_background_medium_scans_performed" json:"number_background_medium_scans_performed"`
+	} `yaml:"status" json:"status"`
+}
+
+var scsiBackgroundScanStatusString = map[int]string{
+	0: "no scans active",
+	1: "scan is active",
+	2: "pre-scan is active",
+	3: "halted due to fatal error",
+	4: "halted due to a vendor specific pattern of error",
+	5: "halted due to medium formatted without P-List",
+	6: "halted - vendor specific cause",
+	7: "halted due to temperature out of range",
+	8: "waiting until BMS interval timer expires",
+}
+
+// IsSCSI returns true if the SMART data is from a SCSI or SAS drive
+func (s *SMARTInfo) IsSCSI() bool {
+	return s.Device.Protocol == "SCSI"
+}
+
+// SCSIHealthProblems returns the reasons a SCSI or SAS drive should be
+// considered unhealthy. SAS drives have no attribute thresholds so this looks
+// at the informational exceptions status, uncorrected errors, grown defects,
+// rated start-stop and load-unload cycles and the drive trip temperature
+func (s *SMARTInfo) SCSIHealthProblems() []string {
+	var out []string
+
+	if s.StatusFailed() {
+		out = append(out, "informational exceptions report a failure prediction")
+	}
+
+	if s.ScsiErrorCounterLog != nil {
+		if n := s.ScsiErrorCounterLog.UncorrectedErrors(); n > 0 {
+			out = append(out, fmt.Sprintf("%d uncorrected read, write or verify errors", n))
+		}
+	}
+
+	if s.ScsiGrownDefectList != nil && *s.ScsiGrownDefectList >= SCSIGrownDefectLimit {
+		out = append(out, fmt.Sprintf("%d grown defects", *s.ScsiGrownDefectList))
+	}
+
+	if c := s.ScsiStartStopCycleCounter; c != nil {
+		if c.SpecifiedCycleCountOverDeviceLifetime > 0 &&
+			c.AccumulatedStartStopCycles >= c.SpecifiedCycleCountOverDeviceLifetime {
+			out = append(out, fmt.Sprintf("%d start-stop cycles exceeds the rated %d",
+				c.AccumulatedStartStopCycles, c.SpecifiedCycleCountOverDeviceLifetime))
+		}
+
+		if c.SpecifiedLoadUnloadCountOverDeviceLifetime > 0 &&
+			c.AccumulatedLoadUnloadCycles >= c.SpecifiedLoadUnloadCountOverDeviceLifetime {
+			out = append(out, fmt.Sprintf("%d load-unload cycles exceeds the rated %d",
+				c.AccumulatedLoadUnloadCycles, c.SpecifiedLoadUnloadCountOverDeviceLifetime))
+		}
+	}
+
+	if s.Temperature.DriveTrip > 0 && s.Temperature.Current >= s.Temperature.DriveTrip {
+		out = append(out, fmt.Sprintf("temperature %dC is at or above the drive trip temperature %dC",
+			s.Temperature.Current, s.Temperature.DriveTrip))
+	}
+
+	if bg := s.ScsiBackgroundScan; bg != nil && bg.Status.Value == 3 {
+		out = append(out, "background scan halted due to a fatal error")
+	}
+
+	return out
+}
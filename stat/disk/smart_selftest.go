@@ -0,0 +1,325 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSelfTestNotLogged is returned by RunSelfTest if the test finished but
+// the drive didn't log it
+var ErrSelfTestNotLogged = errors.New("self-test finished but was not found in the self-test log")
+
+// SelfTestType is the type of a SMART self-test
+type SelfTestType int
+
+const (
+	SelfTestShort SelfTestType = iota + 1
+	SelfTestLong
+	SelfTestConveyance
+	SelfTestSelective
+)
+
+var selfTestTypeString = map[SelfTestType]string{
+	SelfTestShort:      "short",
+	SelfTestLong:       "long",
+	SelfTestConveyance: "conveyance",
+	SelfTestSelective:  "selective",
+}
+
+func (t SelfTestType) String() string {
+	return selfTestTypeString[t]
+}
+
+// SelfTestSpan is an LBA range checked by a selective self-test
+type SelfTestSpan struct {
+	Start int64
+	End   int64
+}
+
+// SMARTSelfTestEntry is an entry of the ATA self-test log
+type SMARTSelfTestEntry struct {
+	Type struct {
+		Value  int    `yaml:"value" json:"value"`
+		String string `yaml:"string" json:"string"`
+	} `yaml:"type" json:"type"`
+	Status struct {
+		Value            int    `yaml:"value" json:"value"`
+		String           string `yaml:"string" json:"string"`
+		RemainingPercent int    `yaml:"remaining_percent,omitempty" json:"remaining_percent,omitempty"`
+		Passed           bool   `yaml:"passed" json:"passed"`
+	} `yaml:"status" json:"status"`
+	LifetimeHours int `yaml:"lifetime_hours" json:"lifetime_hours"`
+	// LBA is the first LBA that failed
+	LBA *int64 `yaml:"lba,omitempty" json:"lba,omitempty"`
+}
+
+// NVMeSelfTestEntry is an entry of the NVMe device self-test log
+type NVMeSelfTestEntry struct {
+	SelfTestCode struct {
+		Value  int    `yaml:"value" json:"value"`
+		String string `yaml:"string" json:"string"`
+	} `yaml:"self_test_code" json:"self_test_code"`
+	SelfTestResult struct {
+		Value  int    `yaml:"value" json:"value"`
+		String string `yaml:"string" json:"string"`
+	} `yaml:"self_test_result" json:"self_test_result"`
+	PowerOnHours int `yaml:"power_on_hours" json:"power_on_hours"`
+	Segment      int `yaml:"segment,omitempty" json:"segment,omitempty"`
+	// Nsid and LBA are the namespace and first LBA that failed
+	Nsid *int   `yaml:"nsid,omitempty" json:"nsid,omitempty"`
+	LBA  *int64 `yaml:"lba,omitempty" json:"lba,omitempty"`
+}
+
+// NVMeSelfTestLog is the NVMe device self-test log
+type NVMeSelfTestLog struct {
+	CurrentSelfTestOperation struct {
+		Value  int    `yaml:"value" json:"value"`
+		String string `yaml:"string" json:"string"`
+	} `yaml:"current_self_test_operation" json:"current_self_test_operation"`
+	CurrentSelfTestCompletionPercent int                 `yaml:"current_self_test_completion_percent,omitempty" json:"current_self_test_completion_percent,omitempty"`
+	Table                            []NVMeSelfTestEntry `yaml:"table,omitempty" json:"table,omitempty"`
+}
+
+// SelfTestResult is an ATA or NVMe self-test log entry
+type SelfTestResult struct {
+	Type         SelfTestType `yaml:"type" json:"type"`
+	Description  string       `yaml:"description" json:"description"`
+	Status       string       `yaml:"status" json:"status"`
+	Passed       bool         `yaml:"passed" json:"passed"`
+	Failed       bool         `yaml:"failed" json:"failed"`
+	PowerOnHours int          `yaml:"power_on_hours" json:"power_on_hours"`
+	// FirstErrorLBA is the first LBA that failed
+	FirstErrorLBA *int64 `yaml:"first_error_lba,omitempty" json:"first_error_lba,omitempty"`
+}
+
+// SelfTestProgress is the execution status of the current self-test
+type SelfTestProgress struct {
+	InProgress       bool   `yaml:"in_progress" json:"in_progress"`
+	RemainingPercent int    `yaml:"remaining_percent" json:"remaining_percent"`
+	Status           string `yaml:"status" json:"status"`
+}
+
+// ataSelfTestType maps the subcommand of an ATA self-test log entry to its
+// type. The captive forms have the high bit set
+func ataSelfTestType(v int) SelfTestType {
+	switch v & 0x7f {
+	case 1, 2, 3, 4:
+		return SelfTestType(v & 0x7f)
+	}
+
+	return 0
+}
+
+// SelfTests returns the ATA or NVMe self-test log, most recent first
+func (s *SMARTInfo) SelfTests() []SelfTestResult {
+	var out []SelfTestResult
+
+	for _, e := range s.AtaSmartSelfTestLog.Standard.Table {
+		status := e.Status.Value >> 4
+
+		out = append(out, SelfTestResult{
+			Type:          ataSelfTestType(e.Type.Value),
+			Description:   e.Type.String,
+			Status:        e.Status.String,
+			Passed:        e.Status.Passed,
+			Failed:        status >= 3 && status <= 8,
+			PowerOnHours:  e.LifetimeHours,
+			FirstErrorLBA: e.LBA,
+		})
+	}
+
+	if l := s.NvmeSelfTestLog; l != nil {
+		for _, e := range l.Table {
+			var t SelfTestType
+
+			switch e.SelfTestCode.Value {
+			case 1:
+				t = SelfTestShort
+			case 2:
+				t = SelfTestLong
+			}
+
+			out = append(out, SelfTestResult{
+				Type:          t,
+				Description:   e.SelfTestCode.String,
+				Status:        e.SelfTestResult.String,
+				Passed:        e.SelfTestResult.Value == 0,
+				Failed:        e.SelfTestResult.Value >= 5 && e.SelfTestResult.Value <= 7,
+				PowerOnHours:  e.PowerOnHours,
+				FirstErrorLBA: e.LBA,
+			})
+		}
+	}
+
+	return out
+}
+
+// SelfTestStatus returns the execution status of the current self-test
+func (s *SMARTInfo) SelfTestStatus() *SelfTestProgress {
+	if l := s.NvmeSelfTestLog; l != nil {
+		p := &SelfTestProgress{
+			InProgress: l.CurrentSelfTestOperation.Value != 0,
+			Status:     l.CurrentSelfTestOperation.String,
+		}
+
+		if p.InProgress {
+			p.RemainingPercent = 100 - l.CurrentSelfTestCompletionPercent
+		}
+
+		return p
+	}
+
+	st := s.AtaSmartData.SelfTest.Status
+	p := &SelfTestProgress{Status: st.String}
+
+	if st.Value>>4 == 0xf {
+		p.InProgress = true
+		p.RemainingPercent = (st.Value & 0xf) * 10
+	}
+
+	return p
+}
+
+// selfTestArgs returns the smartctl arguments that start a self-test
+func selfTestArgs(test SelfTestType, spans []SelfTestSpan) ([]string, error) {
+	switch test {
+	case SelfTestShort, SelfTestLong, SelfTestConveyance:
+		return []string{"-t", test.String()}, nil
+	case SelfTestSelective:
+		if len(spans) < 1 || len(spans) > 5 {
+			return nil, fmt.Errorf("a selective self-test needs 1 to 5 spans, got %d", len(spans))
+		}
+
+		var args []string
+
+		for _, sp := range spans {
+			if sp.End < sp.Start {
+				return nil, fmt.Errorf("invalid self-test span %d-%d", sp.Start, sp.End)
+			}
+
+			args = append(args, "-t", fmt.Sprintf("select,%d-%d", sp.Start, sp.End))
+		}
+
+		return args, nil
+	}
+
+	return nil, fmt.Errorf("unknown self-test type %d", test)
+}
+
+// runSmartctl runs smartctl with the given arguments and --json, returning
+// an error if the command couldn't be run or the device couldn't be opened
+func runSmartctl(dev string, args ...string) (*SMARTInfo, error) {
+	if !smartctlInstalled {
+		return nil, ErrSmartctlNotInstalled
+	}
+
+	info, err := execSmartctl(devicePath(dev), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.ExitCode&(SmartCmdFailed|DeviceOpenFailed|SmartResponseError) != 0 {
+		return info, info.Error()
+	}
+
+	return info, nil
+}
+
+// StartSelfTest starts a self-test on the given device. Selective tests
+// check the given LBA spans, other tests ignore them
+func StartSelfTest(dev string, test SelfTestType, spans ...SelfTestSpan) error {
+	args, err := selfTestArgs(test, spans)
+	if err != nil {
+		return err
+	}
+
+	_, err = runSmartctl(dev, args...)
+
+	return err
+}
+
+// AbortSelfTest aborts the running self-test on the given device
+func AbortSelfTest(dev string) error {
+	_, err := runSmartctl(dev, "-X")
+	return err
+}
+
+// GetSelfTestStatus returns the execution status of the current self-test on
+// the given device
+func GetSelfTestStatus(dev string) (*SelfTestProgress, error) {
+	info, err := GetSMARTInfo(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	return info.SelfTestStatus(), nil
+}
+
+// RunSelfTest starts a self-test on the given device, polls its status every
+// interval until it finishes and returns the new entry of the self-test log.
+// The test is aborted if ctx is done first or its status can't be read
+func RunSelfTest(ctx context.Context, dev string, test SelfTestType, interval time.Duration,
+	spans ...SelfTestSpan) (*SelfTestResult, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid self-test poll interval %s", interval)
+	}
+
+	before, err := GetSMARTInfo(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	logged := before.SelfTests()
+
+	if err = StartSelfTest(dev, test, spans...); err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = AbortSelfTest(dev)
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		info, err := GetSMARTInfo(dev)
+		if err != nil {
+			_ = AbortSelfTest(dev)
+			return nil, err
+		}
+
+		if info.SelfTestStatus().InProgress {
+			continue
+		}
+
+		if r := newSelfTestResult(logged, info.SelfTests()); r != nil {
+			return r, nil
+		}
+
+		return nil, ErrSelfTestNotLogged
+	}
+}
+
+// newSelfTestResult returns the newest entry of the self-test log if it was
+// logged after the before log was read. The log is a ring buffer, so once
+// it's full the count stays the same and the newest entry is only new if its
+// power on hours stamp changed. The ATA stamp is 16 bits and wraps, so any
+// change counts. A test logged in the same hour as the previous newest entry
+// of a full log can't be told apart from it
+func newSelfTestResult(before, after []SelfTestResult) *SelfTestResult {
+	if len(after) < 1 {
+		return nil
+	}
+
+	if len(before) < 1 || len(after) > len(before) || after[0].PowerOnHours != before[0].PowerOnHours {
+		return &after[0]
+	}
+
+	return nil
+}
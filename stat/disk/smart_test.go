@@ -0,0 +1,386 @@
+//+build linux
+
+package disk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gopkg.in/yaml.v2"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readSmartctlFixture(t *testing.T, name string) *SMARTInfo {
+	b, err := os.ReadFile(filepath.Join("testdata", "smart", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := parseSMARTInfo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info
+}
+
+func TestSMARTInfoNVMe(t *testing.T) {
+	info := readSmartctlFixture(t, "smartctl_nvme.json")
+
+	if !info.IsNVMe() {
+		t.Fatal("expected an NVMe drive")
+	}
+
+	l := info.NvmeSmartHealthInformationLog
+
+	if l.PercentageUsed != 103 || l.MediaErrors != 2 || l.UnsafeShutdowns != 15 || len(l.TemperatureSensors) != 2 {
+		t.Errorf("unexpected health log %+v", l)
+	}
+
+	if !l.CriticalWarning.Has(NVMeSpareBelowThreshold|NVMeReliabilityDegraded) || l.CriticalWarning.Has(NVMeReadOnly) {
+		t.Errorf("unexpected critical warning %#x", uint8(l.CriticalWarning))
+	}
+
+	if s := l.CriticalWarning.String(); s != "available spare below threshold, NVM subsystem reliability degraded" {
+		t.Errorf("unexpected critical warning string %q", s)
+	}
+
+	if !l.SpareBelowThreshold() {
+		t.Error("expected the available spare to be below the threshold")
+	}
+
+	if l.DataWritten().B() != 23456789*512000 || l.DataRead().B() != 12345678*512000 {
+		t.Errorf("unexpected data written %s or read %s", l.DataWritten(), l.DataRead())
+	}
+
+	if c := (&NVMeHealthInformationLog{DataUnitsWritten: math.MaxUint64 / 1000}).DataWritten(); c != math.MaxInt64 {
+		t.Errorf("expected data written to clamp instead of wrapping, got %d", c)
+	}
+
+	if new(NVMeHealthInformationLog).SpareBelowThreshold() {
+		t.Error("expected no spare warning without a threshold")
+	}
+
+	if info.NvmeVersion.String != "1.3" || info.NvmePciVendor.ID != 0x144d || info.NvmeTotalCapacity != 1000204886016 {
+		t.Errorf("unexpected controller %+v %+v %d", info.NvmeVersion, info.NvmePciVendor, info.NvmeTotalCapacity)
+	}
+
+	if len(info.NvmeNamespaces) != 1 || info.NvmeNamespaces[0].Utilization.Bytes != 268435456000 ||
+		info.NvmeNamespaces[0].Eui64.Oui != 0x002538 {
+		t.Errorf("unexpected namespaces %+v", info.NvmeNamespaces)
+	}
+
+	if info.Healthy() {
+		t.Error("expected a drive with critical warnings not to be healthy")
+	}
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again := new(NVMeHealthInformationLog)
+	if err = json.Unmarshal(b, again); err != nil {
+		t.Fatal(err)
+	}
+
+	if again.CriticalWarning != l.CriticalWarning || again.DataRead() != l.DataRead() {
+		t.Errorf("expected the health log to round trip, got %+v", again)
+	}
+
+	if s := new(SMARTInfo).String(); strings.Contains(s, "nvme_") {
+		t.Errorf("expected no NVMe fields for other drives:\n%s", s)
+	}
+}
+
+func TestNVMeVersion(t *testing.T) {
+	for v, s := range map[uint32]string{0x10300: "1.3", 0x10400: "1.4", 0x20000: "2.0", 0x10201: "1.2.1"} {
+		if got := newNVMeVersion(v); got.String != s || got.Value != int(v) {
+			t.Errorf("expected %s for %#x, got %+v", s, v, got)
+		}
+	}
+}
+
+func TestSMARTInfoSAS(t *testing.T) {
+	info := readSmartctlFixture(t, "smartctl_sas.json")
+
+	if !info.IsSCSI() || info.IsNVMe() {
+		t.Fatal("expected a SCSI drive")
+	}
+
+	if *info.ScsiGrownDefectList != 312 || info.ScsiErrorCounterLog.UncorrectedErrors() != 4 {
+		t.Errorf("unexpected grown defects %d or error counters %+v",
+			*info.ScsiGrownDefectList, info.ScsiErrorCounterLog.Read)
+	}
+
+	if c := info.ScsiStartStopCycleCounter; c.YearOfManufacture != "2017" || c.AccumulatedLoadUnloadCycles != 1217 {
+		t.Errorf("unexpected start-stop cycle counter %+v", c)
+	}
+
+	if info.Temperature.DriveTrip != 85 || info.PowerOnTime.Minutes != 17 {
+		t.Errorf("unexpected drive trip %d or power on minutes %d", info.Temperature.DriveTrip, info.PowerOnTime.Minutes)
+	}
+
+	problems := info.SCSIHealthProblems()
+	if len(problems) != 3 {
+		t.Fatalf("expected uncorrected errors, grown defects and a halted scan, got %v", problems)
+	}
+
+	if info.Healthy() {
+		t.Error("expected a drive with uncorrected errors not to be healthy")
+	}
+
+	info.ScsiErrorCounterLog.Read.TotalUncorrectedErrors = 0
+	info.ScsiBackgroundScan = nil
+	*info.ScsiGrownDefectList = 12
+
+	if !info.Healthy() {
+		t.Errorf("expected a healthy drive, got %v", info.SCSIHealthProblems())
+	}
+}
+
+func TestSMARTExitCode(t *testing.T) {
+	ec := SmartErrorLogHasErrors | SmartResponseError
+
+	if !ec.Has(SmartResponseError) || ec.Has(SmartDiskFailing) || len(ec.Flags()) != 2 {
+		t.Errorf("unexpected flags %v", ec.Flags())
+	}
+
+	if s := ec.String(); !strings.HasPrefix(s, "Some SMART") || !strings.HasSuffix(s, "records of errors") {
+		t.Errorf("unexpected string %q", s)
+	}
+
+	if SmartOK.String() != "OK" {
+		t.Errorf("expected OK, got %q", SmartOK.String())
+	}
+
+	b, err := json.Marshal(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `["response_error","error_log_has_errors"]` {
+		t.Errorf("unexpected json %s", b)
+	}
+
+	var again SMARTExitCode
+	if err = json.Unmarshal(b, &again); err != nil || again != ec {
+		t.Errorf("expected %d to round trip, got %d: %v", ec, again, err)
+	}
+
+	if err = yaml.Unmarshal([]byte(ec.String()), &again); err == nil {
+		t.Error("expected an error decoding a description")
+	}
+
+	y, err := yaml.Marshal(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again = 0
+	if err = yaml.Unmarshal(y, &again); err != nil || again != ec {
+		t.Errorf("expected %d to round trip yaml, got %d: %v", ec, again, err)
+	}
+
+	if err = json.Unmarshal([]byte("68"), &again); err != nil || again != ec {
+		t.Errorf("expected an exit status of 68 to decode, got %d: %v", again, err)
+	}
+}
+
+func TestSMARTInfoError(t *testing.T) {
+	info := readSmartctlFixture(t, "smartctl_nvme.json")
+
+	err := info.Error()
+	if !errors.Is(err, ErrSmartDiskFailing) || !errors.Is(err, ErrSmartErrorLogHasErrors) || errors.Is(err, ErrSmartPrefail) {
+		t.Errorf("unexpected error %v for exit code %d", err, info.ExitCode)
+	}
+
+	var smartErr *SMARTError
+	if !errors.As(err, &smartErr) || smartErr.ExitCode != SmartDiskFailing|SmartErrorLogHasErrors {
+		t.Errorf("expected a *SMARTError, got %T", err)
+	}
+
+	if _, err = info.JSON(); err != nil {
+		t.Errorf("expected SMARTInfo to marshal to json: %v", err)
+	}
+
+	if new(SMARTInfo).Error() != nil {
+		t.Error("expected no error for an OK exit code")
+	}
+}
+
+func TestSMARTAttributes(t *testing.T) {
+	info := readSmartctlFixture(t, "smartctl_ata_seagate.json")
+
+	for name, c := range map[string]struct {
+		get  func() (int64, bool)
+		want int64
+	}{
+		"reallocated":   {info.ReallocatedSectors, 264},
+		"pending":       {info.PendingSectors, 16},
+		"offline":       {info.OfflineUncorrectable, 16},
+		"uncorrectable": {info.ReportedUncorrectable, 4},
+		"timeout":       {info.CommandTimeout, 2},
+		"crc":           {info.UDMACRCErrors, 0},
+	} {
+		if got, ok := c.get(); !ok || got != c.want {
+			t.Errorf("expected %s %d, got %d", name, c.want, got)
+		}
+	}
+
+	for id, want := range map[int]int64{
+		AttrRawReadErrorRate: 3,
+		AttrSeekErrorRate:    0,
+		AttrPowerOnHours:     33501,
+		AttrTemperature:      36,
+	} {
+		if got, ok := info.AttributeRaw(id); !ok || got != want {
+			t.Errorf("expected attribute %d to decode to %d, got %d", id, want, got)
+		}
+	}
+
+	if _, ok := info.SpinRetries(); ok {
+		t.Error("expected no spin retry attribute")
+	}
+
+	r := info.Risk()
+	if r.Level != SMARTRiskCritical || r.Score != 100 || len(r.Reasons) != 5 {
+		t.Errorf("unexpected risk %+v", r)
+	}
+
+	if r = (&SMARTInfo{SmartStatus: &SMARTStatus{}}).Risk(); r.Level != SMARTRiskCritical {
+		t.Errorf("expected a failed status to be critical, got %+v", r)
+	}
+
+	info = readSmartctlFixture(t, "smartctl_nvme.json")
+	if r = info.Risk(); r.Level != SMARTRiskCritical || len(r.Reasons) != 4 || !strings.HasPrefix(r.Reasons[1], "critical warning") {
+		t.Errorf("unexpected NVMe risk %+v", r)
+	}
+
+	info.SmartStatus = &SMARTStatus{Passed: true}
+	info.NvmeSmartHealthInformationLog = &NVMeHealthInformationLog{PercentageUsed: 12}
+
+	if r = info.Risk(); r.Level != SMARTRiskLow || r.Score != 0 {
+		t.Errorf("expected a low risk, got %+v", r)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil || string(b) != `{"score":0,"level":"low","reasons":[]}` {
+		t.Errorf("unexpected risk json %s: %v", b, err)
+	}
+
+	info, err = parseSMARTInfo([]byte(`{
+  "serial_number": "WD-WX12A3456789",
+  "device": {"name": "/dev/sdc", "type": "sat", "protocol": "ATA"},
+  "ata_smart_attributes": {"table": []}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.SmartStatus != nil || info.StatusFailed() || info.Healthy() {
+		t.Errorf("expected a missing smart_status to be neither failed nor healthy, got %+v", info.SmartStatus)
+	}
+
+	if r = info.Risk(); r.Level != SMARTRiskLow || r.Score != 0 {
+		t.Errorf("expected a missing smart_status not to raise the risk, got %+v", r)
+	}
+}
+
+func TestSMARTSelfTests(t *testing.T) {
+	info := readSmartctlFixture(t, "smartctl_ata_seagate.json")
+
+	results := info.SelfTests()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 self-tests, got %d", len(results))
+	}
+
+	if r := results[0]; r.Type != SelfTestLong || !r.Failed || r.Passed || r.FirstErrorLBA == nil ||
+		*r.FirstErrorLBA != 1953525000 || r.PowerOnHours != 33480 {
+		t.Errorf("unexpected failed self-test %+v", r)
+	}
+
+	if r := results[2]; r.Type != SelfTestShort || r.Failed || r.Passed || r.FirstErrorLBA != nil {
+		t.Errorf("expected an interrupted self-test, got %+v", r)
+	}
+
+	if p := info.SelfTestStatus(); !p.InProgress || p.RemainingPercent != 90 {
+		t.Errorf("expected a self-test in progress, got %+v", p)
+	}
+
+	info = readSmartctlFixture(t, "smartctl_nvme.json")
+
+	results = info.SelfTests()
+	if len(results) != 2 || results[0].Type != SelfTestLong || !results[0].Failed || *results[0].FirstErrorLBA != 524288 {
+		t.Errorf("unexpected NVMe self-tests %+v", results)
+	}
+
+	if p := info.SelfTestStatus(); p.InProgress || p.Status != "No self-test in progress" {
+		t.Errorf("expected no self-test in progress, got %+v", p)
+	}
+}
+
+func TestNewSelfTestResult(t *testing.T) {
+	full := []SelfTestResult{
+		{Type: SelfTestShort, Passed: true, PowerOnHours: 1200},
+		{Type: SelfTestLong, Passed: true, PowerOnHours: 1100},
+	}
+
+	if r := newSelfTestResult(full, full); r != nil {
+		t.Errorf("expected the previous short test not to be new, got %+v", r)
+	}
+
+	// the log is full, so the oldest entry was dropped for the new one
+	after := []SelfTestResult{{Type: SelfTestShort, Failed: true, PowerOnHours: 1300}, full[0]}
+
+	if r := newSelfTestResult(full, after); r == nil || !r.Failed || r.PowerOnHours != 1300 {
+		t.Errorf("expected the new short test, got %+v", r)
+	}
+
+	if r := newSelfTestResult(full[1:], full); r == nil || r.PowerOnHours != 1200 {
+		t.Errorf("expected a new entry when the log grew, got %+v", r)
+	}
+
+	if r := newSelfTestResult(nil, full[:1]); r == nil {
+		t.Error("expected the first entry of an empty log to be new")
+	}
+
+	if r := newSelfTestResult(full, nil); r != nil {
+		t.Errorf("expected no result without a log, got %+v", r)
+	}
+}
+
+func TestSelfTestArgs(t *testing.T) {
+	args, err := selfTestArgs(SelfTestLong, nil)
+	if err != nil || strings.Join(args, " ") != "-t long" {
+		t.Errorf("unexpected args %v: %v", args, err)
+	}
+
+	args, err = selfTestArgs(SelfTestSelective, []SelfTestSpan{{0, 1000}, {5000, 6000}})
+	if err != nil || strings.Join(args, " ") != "-t select,0-1000 -t select,5000-6000" {
+		t.Errorf("unexpected args %v: %v", args, err)
+	}
+
+	if _, err = selfTestArgs(SelfTestSelective, nil); err == nil {
+		t.Error("expected an error for a selective self-test without spans")
+	}
+
+	if _, err = selfTestArgs(SelfTestSelective, []SelfTestSpan{{10, 1}}); err == nil {
+		t.Error("expected an error for an invalid span")
+	}
+}
+
+func TestRunSelfTestInterval(t *testing.T) {
+	// the interval is checked before the drive is touched
+	for _, interval := range []time.Duration{0, -time.Second} {
+		_, err := RunSelfTest(context.Background(), "/dev/nonexistent", SelfTestShort, interval)
+		if err == nil || !strings.Contains(err.Error(), "interval") {
+			t.Errorf("expected an interval error for %s, got %v", interval, err)
+		}
+	}
+}
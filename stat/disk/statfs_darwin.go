@@ -0,0 +1,28 @@
+package disk
+
+import "syscall"
+
+// statfs f_flags as defined in sys/mount.h
+var darwinMountFlags = map[uint64]MountFlags{
+	0x00000001: MountReadOnly,
+	0x00000002: MountSynchronous,
+	0x00000004: MountNoExec,
+	0x00000008: MountNoSUID,
+	0x00000010: MountNoDev,
+	0x10000000: MountNoAtime,
+}
+
+// statfsFragmentSize returns the unit the block counts are in, which is the
+// fundamental block size on darwin
+func statfsFragmentSize(stat *syscall.Statfs_t) int64 {
+	return int64(stat.Bsize)
+}
+
+// statfsNameLength is unknown on darwin as statfs doesn't report it
+func statfsNameLength(stat *syscall.Statfs_t) uint64 {
+	return 0
+}
+
+func statfsMountFlags(stat *syscall.Statfs_t) MountFlags {
+	return decodeMountFlags(uint64(stat.Flags), darwinMountFlags)
+}
@@ -0,0 +1,34 @@
+package disk
+
+import "syscall"
+
+// statfs f_flags as defined in linux/statfs.h
+var linuxMountFlags = map[uint64]MountFlags{
+	0x0001: MountReadOnly,
+	0x0002: MountNoSUID,
+	0x0004: MountNoDev,
+	0x0008: MountNoExec,
+	0x0010: MountSynchronous,
+	0x0040: MountMandatoryLock,
+	0x0400: MountNoAtime,
+	0x0800: MountNoDirAtime,
+	0x1000: MountRelatime,
+	0x2000: MountNoSymFollow,
+}
+
+// statfsFragmentSize returns the unit the block counts are in
+func statfsFragmentSize(stat *syscall.Statfs_t) int64 {
+	if stat.Frsize > 0 {
+		return int64(stat.Frsize)
+	}
+
+	return int64(stat.Bsize)
+}
+
+func statfsNameLength(stat *syscall.Statfs_t) uint64 {
+	return uint64(stat.Namelen)
+}
+
+func statfsMountFlags(stat *syscall.Statfs_t) MountFlags {
+	return decodeMountFlags(uint64(stat.Flags), linuxMountFlags)
+}
@@ -0,0 +1,66 @@
+//+build linux
+
+package disk
+
+import (
+	"encoding/json"
+	"syscall"
+	"testing"
+)
+
+func TestNewFsCapacity(t *testing.T) {
+	ds := newFsCapacity(syscall.Statfs_t{
+		Bsize:   4096,
+		Frsize:  1024,
+		Blocks:  1000,
+		Bfree:   300,
+		Bavail:  250,
+		Files:   100,
+		Ffree:   40,
+		Namelen: 255,
+		Flags:   0x1 | 0x2 | 0x20 | 0x400,
+	})
+
+	if ds.TotalBytes != 1000*1024 || ds.UsedBytes != 700*1024 || ds.FreeBytes != 300*1024 ||
+		ds.AvailableBytes != 250*1024 || ds.ReservedBytes != 50*1024 {
+		t.Errorf("unexpected capacity total %d used %d free %d available %d reserved %d",
+			ds.TotalBytes, ds.UsedBytes, ds.FreeBytes, ds.AvailableBytes, ds.ReservedBytes)
+	}
+
+	if ds.BlockSizeBytes != 4096 || ds.FragmentSizeBytes != 1024 {
+		t.Errorf("unexpected block size %d fragment size %d", ds.BlockSizeBytes, ds.FragmentSizeBytes)
+	}
+
+	if ds.UsedPercent != float64(700)/float64(950)*100 {
+		t.Errorf("unexpected used percent %f", ds.UsedPercent)
+	}
+
+	if ds.InodesTotal != 100 || ds.InodesUsed != 60 || ds.InodesFree != 40 || ds.InodesUsedPercent != 60 {
+		t.Errorf("unexpected inodes total %d used %d free %d %f%%",
+			ds.InodesTotal, ds.InodesUsed, ds.InodesFree, ds.InodesUsedPercent)
+	}
+
+	if ds.MaxNameLength != 255 {
+		t.Errorf("unexpected max name length %d", ds.MaxNameLength)
+	}
+
+	if !ds.IsReadOnly() || ds.MountFlags.String() != "ro,nosuid,noatime" {
+		t.Errorf("unexpected mount flags %s", ds.MountFlags)
+	}
+
+	b, err := json.Marshal(ds.MountFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `["ro","nosuid","noatime"]` {
+		t.Errorf("unexpected json %s", b)
+	}
+
+	// btrfs has no inode totals and everything is free
+	ds = newFsCapacity(syscall.Statfs_t{Bsize: 4096, Blocks: 10, Bfree: 10, Bavail: 10})
+	if ds.InodesUsedPercent != 0 || ds.UsedPercent != 0 || ds.FragmentSizeBytes != 4096 ||
+		ds.MountFlags.String() != "rw" {
+		t.Errorf("unexpected capacity %+v", ds)
+	}
+}
@@ -0,0 +1,465 @@
+//+build linux
+
+package disk
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// hwmonDiskDrivers are the hwmon drivers that report disk temperatures
+var hwmonDiskDrivers = map[string]bool{
+	"drivetemp": true,
+	"nvme":      true,
+}
+
+var (
+	// temp1_input
+	hwmonTempInputRe = regexp.MustCompile(`^temp(\d+)_input$`)
+	// nvme0n1
+	nvmeNamespaceRe = regexp.MustCompile(`^nvme\d+n\d+$`)
+	// nvme0c1n1 is namespace 1 of subsystem 0 through controller 1 with native
+	// multipath, which is the block device nvme0n1
+	nvmePathRe = regexp.MustCompile(`^nvme(\d+)c\d+n(\d+)$`)
+)
+
+// TemperatureSource is where a disk temperature was read from
+type TemperatureSource string
+
+const (
+	// TemperatureHwmon is read from a kernel drivetemp or nvme hwmon sensor
+	// without running smartctl
+	TemperatureHwmon TemperatureSource = "hwmon"
+	// TemperatureSMART is read from the disk's SMART data
+	TemperatureSMART TemperatureSource = "smart"
+)
+
+// TemperatureSensor is a temperature sensor of a disk in Celsius. Values the
+// drive doesn't report are nil
+type TemperatureSensor struct {
+	Label   string  `yaml:"label,omitempty" json:"label,omitempty"`
+	Current float64 `yaml:"current" json:"current"`
+	// Lowest and Highest are the extremes since the sensor was reset or, for
+	// SMART, over the drive's lifetime
+	Lowest  *float64 `yaml:"lowest,omitempty" json:"lowest,omitempty"`
+	Highest *float64 `yaml:"highest,omitempty" json:"highest,omitempty"`
+	// Min and Max are the drive's rated operating range
+	Min *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+	// LowCrit and Crit are the limits past which the drive may be damaged or
+	// shut down
+	LowCrit *float64 `yaml:"low_crit,omitempty" json:"low_crit,omitempty"`
+	Crit    *float64 `yaml:"crit,omitempty" json:"crit,omitempty"`
+}
+
+// Critical returns true if the sensor is at or past a critical limit
+func (s *TemperatureSensor) Critical() bool {
+	return (s.Crit != nil && s.Current >= *s.Crit) || (s.LowCrit != nil && s.Current <= *s.LowCrit)
+}
+
+// OutOfRange returns true if the sensor is outside the drive's rated
+// operating range or past a critical limit
+func (s *TemperatureSensor) OutOfRange() bool {
+	return s.Critical() || (s.Max != nil && s.Current > *s.Max) || (s.Min != nil && s.Current < *s.Min)
+}
+
+// Temperature is the temperature of a disk
+type Temperature struct {
+	Disk   string            `yaml:"disk" json:"disk"`
+	Source TemperatureSource `yaml:"source" json:"source"`
+	// Hwmon is the hwmon device the temperature was read from, e.g. hwmon2
+	Hwmon string    `yaml:"hwmon,omitempty" json:"hwmon,omitempty"`
+	Time  time.Time `yaml:"time" json:"time"`
+	// TemperatureSensor is the drive's main sensor, the composite temperature
+	// of NVMe drives
+	TemperatureSensor `yaml:",inline"`
+	// Sensors are the drive's other sensors, e.g. the NVMe Sensor 1 to 8
+	Sensors []*TemperatureSensor `yaml:"sensors,omitempty" json:"sensors,omitempty"`
+}
+
+// String implements stringer and returns a yaml formatted string
+func (t *Temperature) String() string {
+	b, err := yaml.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// OutOfRange returns true if any of the disk's sensors is outside the
+// drive's rated operating range
+func (t *Temperature) OutOfRange() bool {
+	if t.TemperatureSensor.OutOfRange() {
+		return true
+	}
+
+	for _, s := range t.Sensors {
+		if s.OutOfRange() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Temperatures returns the temperature of every disk by name. Disks with a
+// drivetemp or nvme hwmon sensor are read from sysfs, which doesn't run
+// smartctl or wake disks in standby, and the rest from their SMART data.
+// Disks whose temperature can't be read are left out and the first error is
+// returned
+func (inv *Inventory) Temperatures() (map[string]*Temperature, error) {
+	if inv.offline {
+		return nil, fmt.Errorf("the temperature of a snapshot can not be read")
+	}
+
+	hwmon := inv.readHwmonTemperatures()
+	out := make(map[string]*Temperature)
+
+	var first error
+
+	for _, d := range inv.Disks {
+		if t, ok := hwmon[d.Name]; ok {
+			out[d.Name] = t
+			continue
+		}
+
+		t, err := smartTemperature(d)
+		if t != nil {
+			out[d.Name] = t
+		}
+
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return out, first
+}
+
+// Temperature returns the temperature of a disk from its hwmon sensor or, if
+// it has none, its SMART data. SMART data cached before a disk spun down is
+// returned along with ErrDeviceInStandby when the inventory's SMARTCache
+// doesn't wake disks
+func (inv *Inventory) Temperature(d *BlockDevice) (*Temperature, error) {
+	if inv.offline {
+		return nil, fmt.Errorf("the temperature of a snapshot can not be read")
+	}
+
+	if t, ok := inv.readHwmonTemperatures()[d.Name]; ok {
+		return t, nil
+	}
+
+	return smartTemperature(d)
+}
+
+// readHwmonTemperatures reads the drivetemp and nvme hwmon sensors by disk name
+func (inv *Inventory) readHwmonTemperatures() map[string]*Temperature {
+	out := make(map[string]*Temperature)
+
+	dirs, _ := filepath.Glob(inv.opts.hostPath("/sys/class/hwmon/hwmon*"))
+
+	for _, dir := range dirs {
+		if !hwmonDiskDrivers[readSysfsString(filepath.Join(dir, "name"))] {
+			continue
+		}
+
+		sensors := readHwmonSensors(dir)
+		if len(sensors) < 1 {
+			continue
+		}
+
+		for _, name := range hwmonDisks(dir) {
+			out[name] = &Temperature{
+				Disk:              name,
+				Source:            TemperatureHwmon,
+				Hwmon:             filepath.Base(dir),
+				Time:              time.Now(),
+				TemperatureSensor: *sensors[0],
+				Sensors:           sensors[1:],
+			}
+		}
+	}
+
+	return out
+}
+
+// hwmonDisks returns the disks an hwmon device is the sensor of. The device of
+// a drivetemp sensor is a scsi device with the disk under block, and of an
+// nvme sensor the controller with its namespaces, or on older kernels the pci
+// device with the controller under nvme
+func hwmonDisks(dir string) []string {
+	dev := filepath.Join(dir, "device")
+	seen := make(map[string]bool)
+
+	var out []string
+
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+
+	for _, name := range readDirNames(filepath.Join(dev, "block")) {
+		add(name)
+	}
+
+	ctrls := []string{dev}
+
+	for _, name := range readDirNames(filepath.Join(dev, "nvme")) {
+		ctrls = append(ctrls, filepath.Join(dev, "nvme", name))
+	}
+
+	for _, ctrl := range ctrls {
+		for _, name := range readDirNames(ctrl) {
+			if match := nvmePathRe.FindStringSubmatch(name); match != nil {
+				name = "nvme" + match[1] + "n" + match[2]
+			}
+
+			if nvmeNamespaceRe.MatchString(name) {
+				add(name)
+			}
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// readHwmonSensors reads the temp<n>_ attributes of an hwmon device, ordered
+// by n
+func readHwmonSensors(dir string) []*TemperatureSensor {
+	var indexes []int
+
+	for _, name := range readDirNames(dir) {
+		if match := hwmonTempInputRe.FindStringSubmatch(name); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			indexes = append(indexes, n)
+		}
+	}
+
+	sort.Ints(indexes)
+
+	var out []*TemperatureSensor
+
+	for _, n := range indexes {
+		prefix := filepath.Join(dir, fmt.Sprintf("temp%d_", n))
+
+		current := readMillidegrees(prefix + "input")
+		if current == nil {
+			continue
+		}
+
+		out = append(out, &TemperatureSensor{
+			Label:   readSysfsString(prefix + "label"),
+			Current: *current,
+			Lowest:  readMillidegrees(prefix + "lowest"),
+			Highest: readMillidegrees(prefix + "highest"),
+			Min:     readMillidegrees(prefix + "min"),
+			Max:     readMillidegrees(prefix + "max"),
+			LowCrit: readMillidegrees(prefix + "lcrit"),
+			Crit:    readMillidegrees(prefix + "crit"),
+		})
+	}
+
+	return out
+}
+
+// readMillidegrees reads an hwmon attribute in millidegrees Celsius. It's nil
+// if missing or a disabled threshold, which nvme reports as 0 or 65535 Kelvin
+func readMillidegrees(path string) *float64 {
+	v, err := strconv.ParseInt(readSysfsString(path), 10, 64)
+	if err != nil || v <= -273150 || v >= 65000000 {
+		return nil
+	}
+
+	c := float64(v) / 1000
+
+	return &c
+}
+
+// smartTemperature reads the temperature of a disk from its cached SMART data
+func smartTemperature(d *BlockDevice) (*Temperature, error) {
+	info, err := d.SMARTInfo()
+	if info == nil {
+		return nil, err
+	}
+
+	t, terr := NewSMARTTemperature(d.Name, info)
+	if terr != nil {
+		return nil, terr
+	}
+
+	if age, ok := d.SMARTInfoAge(); ok {
+		t.Time = time.Now().Add(-age)
+	}
+
+	return t, err
+}
+
+// NewSMARTTemperature returns the temperature of a disk in its SMART data.
+// ATA drives with SCT status report their lifetime extremes and limits and
+// NVMe drives their warning and critical thresholds
+func NewSMARTTemperature(disk string, info *SMARTInfo) (*Temperature, error) {
+	s := info.Temperature
+
+	if s.Current == 0 {
+		return nil, fmt.Errorf("could not find the temperature of %s in its SMART data", disk)
+	}
+
+	t := &Temperature{
+		Disk:   disk,
+		Source: TemperatureSMART,
+		Time:   time.Now(),
+		TemperatureSensor: TemperatureSensor{
+			Current: float64(s.Current),
+			Lowest:  celsius(s.LifetimeMin),
+			Highest: celsius(s.LifetimeMax),
+			Min:     celsius(s.OpLimitMin),
+			Max:     celsius(s.OpLimitMax),
+			LowCrit: celsius(s.CriticalLimitMin, s.LimitMin),
+			Crit:    celsius(s.CriticalLimitMax, s.LimitMax),
+		},
+	}
+
+	if info.LocalTime.TimeT > 0 {
+		t.Time = time.Unix(int64(info.LocalTime.TimeT), 0)
+	}
+
+	// SCSI drives only report the trip temperature
+	if t.Crit == nil && s.DriveTrip > 0 {
+		t.Crit = celsius(&s.DriveTrip)
+	}
+
+	if l := info.NvmeSmartHealthInformationLog; l != nil {
+		for i, v := range l.TemperatureSensors {
+			t.Sensors = append(t.Sensors, &TemperatureSensor{
+				Label:   "Sensor " + strconv.Itoa(i+1),
+				Current: float64(v),
+			})
+		}
+	}
+
+	return t, nil
+}
+
+// celsius returns the first of values that is set as a float
+func celsius(values ...*int) *float64 {
+	for _, v := range values {
+		if v != nil {
+			c := float64(*v)
+			return &c
+		}
+	}
+
+	return nil
+}
+
+// TemperatureSample is the temperature of a disk at a point in time
+type TemperatureSample struct {
+	Time    time.Time `yaml:"time" json:"time"`
+	Celsius float64   `yaml:"celsius" json:"celsius"`
+}
+
+// TemperatureHistory keeps the most recent temperatures of each disk in
+// memory, by disk name
+type TemperatureHistory struct {
+	size    int
+	mu      sync.Mutex
+	samples map[string][]TemperatureSample
+}
+
+// NewTemperatureHistory returns a TemperatureHistory that keeps up to size
+// samples of each disk
+func NewTemperatureHistory(size int) *TemperatureHistory {
+	if size < 1 {
+		size = 1
+	}
+
+	return &TemperatureHistory{
+		size:    size,
+		samples: make(map[string][]TemperatureSample),
+	}
+}
+
+// Record adds the current temperature of a disk, dropping its oldest sample
+// if the history is full
+func (h *TemperatureHistory) Record(t *Temperature) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := append(h.samples[t.Disk], TemperatureSample{Time: t.Time, Celsius: t.Current})
+
+	if len(samples) > h.size {
+		samples = append([]TemperatureSample{}, samples[len(samples)-h.size:]...)
+	}
+
+	h.samples[t.Disk] = samples
+}
+
+// RecordAll adds the temperatures of several disks, e.g. from
+// Inventory.Temperatures
+func (h *TemperatureHistory) RecordAll(temps map[string]*Temperature) {
+	for _, t := range temps {
+		h.Record(t)
+	}
+}
+
+// Samples returns the samples of a disk taken at or after since, oldest
+// first
+func (h *TemperatureHistory) Samples(disk string, since time.Time) []TemperatureSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var out []TemperatureSample
+
+	for _, s := range h.samples[disk] {
+		if !s.Time.Before(since) {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// Range returns the lowest and highest temperatures of a disk at or after
+// since, or false if there are no samples
+func (h *TemperatureHistory) Range(disk string, since time.Time) (lowest, highest float64, ok bool) {
+	for i, s := range h.Samples(disk, since) {
+		if i == 0 || s.Celsius < lowest {
+			lowest = s.Celsius
+		}
+
+		if i == 0 || s.Celsius > highest {
+			highest = s.Celsius
+		}
+
+		ok = true
+	}
+
+	return lowest, highest, ok
+}
+
+// Disks returns the names of the disks with samples
+func (h *TemperatureHistory) Disks() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]string, 0, len(h.samples))
+
+	for name := range h.samples {
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
@@ -0,0 +1,184 @@
+//+build linux
+
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadHwmonTemperatures(t *testing.T) {
+	scsi := "sys/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0"
+	ctrl := "sys/devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0"
+
+	root := writeFakeTree(t, map[string]string{
+		scsi + "/block/sda/size":                                   "7814037168\n",
+		scsi + "/hwmon/hwmon1/name":                                "drivetemp\n",
+		scsi + "/hwmon/hwmon1/temp1_input":                         "41000\n",
+		scsi + "/hwmon/hwmon1/temp1_lowest":                        "24000\n",
+		scsi + "/hwmon/hwmon1/temp1_highest":                       "52000\n",
+		scsi + "/hwmon/hwmon1/temp1_min":                           "0\n",
+		scsi + "/hwmon/hwmon1/temp1_max":                           "60000\n",
+		scsi + "/hwmon/hwmon1/temp1_lcrit":                         "-40000\n",
+		scsi + "/hwmon/hwmon1/temp1_crit":                          "70000\n",
+		ctrl + "/nvme0c0n1/size":                                   "1953525168\n",
+		ctrl + "/hwmon2/name":                                      "nvme\n",
+		ctrl + "/hwmon2/temp1_label":                               "Composite\n",
+		ctrl + "/hwmon2/temp1_input":                               "84850\n",
+		ctrl + "/hwmon2/temp1_min":                                 "-273150\n",
+		ctrl + "/hwmon2/temp1_max":                                 "81850\n",
+		ctrl + "/hwmon2/temp1_crit":                                "84850\n",
+		ctrl + "/hwmon2/temp2_label":                               "Sensor 1\n",
+		ctrl + "/hwmon2/temp2_input":                               "70850\n",
+		ctrl + "/hwmon2/temp2_max":                                 "65261850\n",
+		"sys/devices/platform/coretemp.0/hwmon/hwmon0/name":        "coretemp\n",
+		"sys/devices/platform/coretemp.0/hwmon/hwmon0/temp1_input": "45000\n",
+	})
+
+	links := map[string]string{
+		"sys/class/hwmon/hwmon0":      "../../devices/platform/coretemp.0/hwmon/hwmon0",
+		"sys/class/hwmon/hwmon1":      "../../" + strings.TrimPrefix(scsi, "sys/") + "/hwmon/hwmon1",
+		"sys/class/hwmon/hwmon2":      "../../" + strings.TrimPrefix(ctrl, "sys/") + "/hwmon2",
+		scsi + "/hwmon/hwmon1/device": "../../../0:0:0:0",
+		ctrl + "/hwmon2/device":       "../../nvme0",
+	}
+
+	for name, target := range links {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	temps := (&Inventory{opts: newOptions(WithRoot(root))}).readHwmonTemperatures()
+
+	if len(temps) != 2 {
+		t.Fatalf("expected the temperatures of 2 disks, got %v", temps)
+	}
+
+	sda := temps["sda"]
+	if sda == nil || sda.Source != TemperatureHwmon || sda.Hwmon != "hwmon1" || sda.Current != 41 ||
+		*sda.Lowest != 24 || *sda.Highest != 52 || *sda.Min != 0 || *sda.Max != 60 || *sda.LowCrit != -40 ||
+		*sda.Crit != 70 || len(sda.Sensors) != 0 {
+		t.Fatalf("unexpected sda temperature %s", sda)
+	}
+
+	if sda.OutOfRange() || sda.Critical() {
+		t.Error("expected sda to be within its rated range")
+	}
+
+	nvme := temps["nvme0n1"]
+	if nvme == nil || nvme.Label != "Composite" || nvme.Current != 84.85 || nvme.Min != nil || *nvme.Max != 81.85 ||
+		*nvme.Crit != 84.85 || nvme.Lowest != nil {
+		t.Fatalf("unexpected nvme0n1 temperature %s", nvme)
+	}
+
+	if len(nvme.Sensors) != 1 || nvme.Sensors[0].Label != "Sensor 1" || nvme.Sensors[0].Current != 70.85 ||
+		nvme.Sensors[0].Max != nil {
+		t.Errorf("unexpected nvme0n1 sensors %v", nvme.Sensors)
+	}
+
+	if !nvme.OutOfRange() || !nvme.Critical() {
+		t.Error("expected nvme0n1 to be at its critical temperature")
+	}
+
+	if _, err := (&Inventory{offline: true}).Temperatures(); err == nil {
+		t.Error("expected an error for a snapshot")
+	}
+}
+
+func TestNewSMARTTemperature(t *testing.T) {
+	temp, err := NewSMARTTemperature("nvme0n1", readSmartctlFixture(t, "smartctl_nvme.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if temp.Source != TemperatureSMART || temp.Current != 37 || temp.Crit != nil || len(temp.Sensors) != 2 ||
+		temp.Sensors[1].Label != "Sensor 2" || temp.Sensors[1].Current != 45 || temp.OutOfRange() {
+		t.Errorf("unexpected nvme temperature %s", temp)
+	}
+
+	temp, _ = NewSMARTTemperature("sda", readSmartctlFixture(t, "smartctl_sas.json"))
+	if temp == nil || temp.Current != 36 || *temp.Crit != 85 || temp.Max != nil || temp.OutOfRange() {
+		t.Errorf("unexpected sas temperature %s", temp)
+	}
+
+	info, err := parseSMARTInfo([]byte(`{
+  "serial_number": "ZA1B2C3D",
+  "local_time": {"time_t": 1671032321},
+  "temperature": {
+    "current": 63,
+    "power_cycle_min": 22,
+    "power_cycle_max": 63,
+    "lifetime_min": 12,
+    "lifetime_max": 66,
+    "op_limit_min": 0,
+    "op_limit_max": 60,
+    "limit_min": -40,
+    "limit_max": 70
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	temp, err = NewSMARTTemperature("sdb", info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *temp.Lowest != 12 || *temp.Highest != 66 || *temp.Min != 0 || *temp.Max != 60 || *temp.LowCrit != -40 ||
+		*temp.Crit != 70 || !temp.Time.Equal(time.Unix(1671032321, 0)) {
+		t.Errorf("unexpected sct temperature %s", temp)
+	}
+
+	if !temp.OutOfRange() || temp.Critical() {
+		t.Error("expected sdb to be above its rated range but below critical")
+	}
+
+	if _, err = NewSMARTTemperature("sdc", new(SMARTInfo)); err == nil {
+		t.Error("expected an error without a temperature")
+	}
+}
+
+func TestTemperatureHistory(t *testing.T) {
+	h := NewTemperatureHistory(3)
+	start := time.Date(2022, 12, 14, 15, 0, 0, 0, time.UTC)
+
+	for i, c := range []float64{40, 38, 45, 41} {
+		h.Record(&Temperature{
+			Disk:              "sda",
+			Time:              start.Add(time.Duration(i) * time.Minute),
+			TemperatureSensor: TemperatureSensor{Current: c},
+		})
+	}
+
+	h.RecordAll(map[string]*Temperature{
+		"nvme0n1": {Disk: "nvme0n1", Time: start, TemperatureSensor: TemperatureSensor{Current: 50}},
+	})
+
+	samples := h.Samples("sda", time.Time{})
+	if len(samples) != 3 || samples[0].Celsius != 38 || samples[2].Celsius != 41 {
+		t.Fatalf("expected the 3 newest samples, got %v", samples)
+	}
+
+	if low, high, ok := h.Range("sda", start.Add(2*time.Minute)); !ok || low != 41 || high != 45 {
+		t.Errorf("unexpected range %v to %v", low, high)
+	}
+
+	if _, _, ok := h.Range("sdb", time.Time{}); ok {
+		t.Error("expected no range without samples")
+	}
+
+	if disks := h.Disks(); len(disks) != 2 || disks[0] != "nvme0n1" {
+		t.Errorf("unexpected disks %v", disks)
+	}
+}
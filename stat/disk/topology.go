@@ -0,0 +1,541 @@
+//+build linux
+
+package disk
+
+import (
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NodeKind is the kind of block device in a Topology
+type NodeKind string
+
+const (
+	// NodeDisk is a whole physical disk
+	NodeDisk NodeKind = "disk"
+	// NodePartition is a partition of a disk
+	NodePartition NodeKind = "partition"
+	// NodeMD is an md RAID array
+	NodeMD NodeKind = "md"
+	// NodeLVM is an LVM logical volume
+	NodeLVM NodeKind = "lvm"
+	// NodeCrypt is a dm-crypt mapping such as LUKS
+	NodeCrypt NodeKind = "crypt"
+	// NodeMultipath is a dm-multipath device
+	NodeMultipath NodeKind = "multipath"
+	// NodeDM is any other device-mapper device
+	NodeDM NodeKind = "dm"
+	// NodeLoop is a loop device
+	NodeLoop NodeKind = "loop"
+)
+
+// Direction is the way a Topology is walked from a node
+type Direction int
+
+const (
+	// Down walks from a device towards the physical disks it's built on
+	Down Direction = iota
+	// Up walks from a device towards the devices and filesystems built on it
+	Up
+)
+
+// TopologyNode is a block device in a Topology
+type TopologyNode struct {
+	Name   string       `yaml:"name" json:"name"`
+	DevID  DevNum       `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
+	Kind   NodeKind     `yaml:"kind" json:"kind"`
+	Size   cap.Capacity `yaml:"size" json:"size"`
+	DMName string       `yaml:"dm_name,omitempty" json:"dm_name,omitempty"`
+	DMUUID string       `yaml:"dm_uuid,omitempty" json:"dm_uuid,omitempty"`
+	// Level is the RAID level of an md array
+	Level string `yaml:"level,omitempty" json:"level,omitempty"`
+	// Mounts are the filesystems mounted directly from this device
+	Mounts  Mounts `yaml:"-" json:"-"`
+	slaves  []*TopologyNode
+	holders []*TopologyNode
+}
+
+// Lower returns the devices this one is built on. A partition's lower device
+// is its disk
+func (n *TopologyNode) Lower() []*TopologyNode {
+	return append([]*TopologyNode(nil), n.slaves...)
+}
+
+// Upper returns the devices built on this one, including a disk's partitions
+func (n *TopologyNode) Upper() []*TopologyNode {
+	return append([]*TopologyNode(nil), n.holders...)
+}
+
+// IsPhysical returns true for a disk that isn't built on other devices
+func (n *TopologyNode) IsPhysical() bool {
+	return n.Kind == NodeDisk && len(n.slaves) == 0
+}
+
+// Label returns a short description of the node, e.g. dm-1 (vg0-home) lvm 10 GiB
+func (n *TopologyNode) Label() string {
+	label := n.Name
+
+	if len(n.DMName) > 0 {
+		label += " (" + n.DMName + ")"
+	}
+
+	kind := string(n.Kind)
+	if len(n.Level) > 0 {
+		kind = n.Level
+	}
+
+	return fmt.Sprintf("%s %s %s", label, kind, n.Size.FormatBase2Bytes())
+}
+
+// walk visits every node reachable in the given direction, without the node itself
+func (n *TopologyNode) walk(dir Direction, fn func(*TopologyNode)) {
+	seen := map[*TopologyNode]bool{n: true}
+
+	var visit func(*TopologyNode)
+
+	visit = func(node *TopologyNode) {
+		for _, next := range node.next(dir) {
+			if !seen[next] {
+				seen[next] = true
+				fn(next)
+				visit(next)
+			}
+		}
+	}
+
+	visit(n)
+}
+
+func (n *TopologyNode) next(dir Direction) []*TopologyNode {
+	if dir == Up {
+		return n.holders
+	}
+
+	return n.slaves
+}
+
+// PhysicalDisks returns the physical disks the device is built on, or the
+// device itself if it's a physical disk
+func (n *TopologyNode) PhysicalDisks() []*TopologyNode {
+	if n.IsPhysical() {
+		return []*TopologyNode{n}
+	}
+
+	var out []*TopologyNode
+
+	n.walk(Down, func(node *TopologyNode) {
+		if node.IsPhysical() {
+			out = append(out, node)
+		}
+	})
+
+	sortNodes(out)
+
+	return out
+}
+
+// AffectedMounts returns the filesystems mounted from the device or from any
+// device built on it, i.e. what's at risk if the device fails
+func (n *TopologyNode) AffectedMounts() Mounts {
+	out := append(Mounts(nil), n.Mounts...)
+
+	n.walk(Up, func(node *TopologyNode) {
+		out = append(out, node.Mounts...)
+	})
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].MountPoint < out[j].MountPoint
+	})
+
+	return out
+}
+
+// Tree renders the node and everything reachable from it in the given
+// direction as a text tree. Mount points are shown next to their device
+func (n *TopologyNode) Tree(dir Direction) string {
+	var sb strings.Builder
+
+	n.writeTree(&sb, dir, "", "", map[*TopologyNode]bool{})
+
+	return sb.String()
+}
+
+func (n *TopologyNode) writeTree(sb *strings.Builder, dir Direction, first, rest string, path map[*TopologyNode]bool) {
+	sb.WriteString(first + n.Label())
+
+	for _, m := range n.Mounts {
+		sb.WriteString(" " + m.MountPoint)
+	}
+
+	sb.WriteString("\n")
+
+	// a cycle should never happen, but sysfs is only read once so guard anyway
+	if path[n] {
+		return
+	}
+
+	path[n] = true
+	defer delete(path, n)
+
+	next := n.next(dir)
+
+	for i, child := range next {
+		if i == len(next)-1 {
+			child.writeTree(sb, dir, rest+"└─ ", rest+"   ", path)
+		} else {
+			child.writeTree(sb, dir, rest+"├─ ", rest+"│  ", path)
+		}
+	}
+}
+
+func sortNodes(nodes []*TopologyNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+}
+
+// Topology is the graph of how block devices are stacked on each other, built
+// from the holders and slaves of every device in /sys/block
+type Topology struct {
+	Nodes map[string]*TopologyNode `yaml:"nodes" json:"nodes"`
+}
+
+// String implements stringer and returns a yaml formatted string
+func (t *Topology) String() string {
+	b, err := yaml.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// sorted returns all nodes sorted by name
+func (t *Topology) sorted() []*TopologyNode {
+	out := make([]*TopologyNode, 0, len(t.Nodes))
+
+	for _, n := range t.Nodes {
+		out = append(out, n)
+	}
+
+	sortNodes(out)
+
+	return out
+}
+
+// Node returns the node for a device name such as sda2, /dev/dm-0 or
+// /dev/mapper/vg0-root
+func (t *Topology) Node(name string) *TopologyNode {
+	name = strings.TrimPrefix(name, "/dev/")
+
+	if n, ok := t.Nodes[name]; ok {
+		return n
+	}
+
+	dmName := strings.TrimPrefix(name, "mapper/")
+
+	for _, n := range t.Nodes {
+		if len(n.DMName) > 0 && n.DMName == dmName {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// NodeFromDevNum returns the node with the given device number
+func (t *Topology) NodeFromDevNum(dev DevNum) *TopologyNode {
+	for _, n := range t.Nodes {
+		if n.DevID == dev {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// Physical returns the physical disks
+func (t *Topology) Physical() []*TopologyNode {
+	var out []*TopologyNode
+
+	for _, n := range t.sorted() {
+		if n.IsPhysical() {
+			out = append(out, n)
+		}
+	}
+
+	return out
+}
+
+// NodeFromMount returns the device the filesystem containing dir is mounted from
+func (t *Topology) NodeFromMount(dir string) (*TopologyNode, error) {
+	var (
+		found *TopologyNode
+		mount *Mount
+	)
+
+	dir = filepath.Clean(dir)
+
+	for _, n := range t.Nodes {
+		for _, m := range n.Mounts {
+			if !pathHasPrefix(dir, m.MountPoint) {
+				continue
+			}
+
+			if mount == nil || len(m.MountPoint) > len(mount.MountPoint) {
+				found, mount = n, m
+			}
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("could not find block device for %s", dir)
+	}
+
+	return found, nil
+}
+
+// DisksForMount returns the physical disks backing the filesystem containing dir
+func (t *Topology) DisksForMount(dir string) ([]*TopologyNode, error) {
+	n, err := t.NodeFromMount(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.PhysicalDisks(), nil
+}
+
+// MountsForDevice returns the filesystems affected by a failure of the device
+func (t *Topology) MountsForDevice(name string) (Mounts, error) {
+	n := t.Node(name)
+	if n == nil {
+		return nil, fmt.Errorf("could not find block device %s", name)
+	}
+
+	return n.AffectedMounts(), nil
+}
+
+// DOT renders the topology as a graphviz digraph with edges pointing from a
+// device to the devices built on it and on to its mount points. If any nodes
+// are given only they and the devices connected to them are included
+func (t *Topology) DOT(nodes ...*TopologyNode) string {
+	include := make(map[*TopologyNode]bool)
+
+	if len(nodes) < 1 {
+		for _, n := range t.Nodes {
+			include[n] = true
+		}
+	}
+
+	for _, n := range nodes {
+		include[n] = true
+
+		for _, dir := range []Direction{Down, Up} {
+			n.walk(dir, func(node *TopologyNode) {
+				include[node] = true
+			})
+		}
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("digraph topology {\n\trankdir=BT;\n\tnode [shape=box];\n")
+
+	for _, n := range t.sorted() {
+		if !include[n] {
+			continue
+		}
+
+		shape := "box"
+		if n.IsPhysical() {
+			shape = "cylinder"
+		}
+
+		sb.WriteString(fmt.Sprintf("\t%s [label=%s, shape=%s];\n",
+			strconv.Quote(n.Name), strconv.Quote(n.Label()), shape))
+
+		for _, h := range n.holders {
+			if include[h] {
+				sb.WriteString(fmt.Sprintf("\t%s -> %s;\n", strconv.Quote(n.Name), strconv.Quote(h.Name)))
+			}
+		}
+
+		for _, m := range n.Mounts {
+			id := strconv.Quote("mount:" + m.MountPoint)
+			sb.WriteString(fmt.Sprintf("\t%s [label=%s, shape=folder];\n", id, strconv.Quote(m.MountPoint+" "+m.FsType)))
+			sb.WriteString(fmt.Sprintf("\t%s -> %s;\n", strconv.Quote(n.Name), id))
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// GetTopology builds the block device topology from sysfs and attaches the
+// mounted filesystems to the devices they're mounted from
+func GetTopology(opt ...Option) (*Topology, error) {
+	opts := newOptions(opt...)
+	blockDir := opts.hostPath("/sys/block")
+
+	entries, err := ioutil.ReadDir(blockDir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Topology{Nodes: make(map[string]*TopologyNode)}
+	dirs := make(map[string]string)
+
+	for _, e := range entries {
+		dir := filepath.Join(blockDir, e.Name())
+		n := readTopologyNode(e.Name(), dir)
+		t.Nodes[n.Name] = n
+		dirs[n.Name] = dir
+
+		// partitions are sub directories of their disk
+		subs, _ := ioutil.ReadDir(dir)
+
+		for _, sub := range subs {
+			partDir := filepath.Join(dir, sub.Name())
+
+			if !isPartition(partDir) {
+				continue
+			}
+
+			p := readTopologyNode(sub.Name(), partDir)
+			p.Kind = NodePartition
+			t.Nodes[p.Name] = p
+			dirs[p.Name] = partDir
+			link(n, p)
+		}
+	}
+
+	for name, dir := range dirs {
+		n := t.Nodes[name]
+
+		// holders are the reverse of slaves so reading slaves covers every edge
+		// but holders are read as well in case only one side is populated
+		for _, slave := range readDirNames(filepath.Join(dir, "slaves")) {
+			if lower, ok := t.Nodes[slave]; ok {
+				link(lower, n)
+			}
+		}
+
+		for _, holder := range readDirNames(filepath.Join(dir, "holders")) {
+			if upper, ok := t.Nodes[holder]; ok {
+				link(n, upper)
+			}
+		}
+	}
+
+	for _, n := range t.Nodes {
+		sortNodes(n.slaves)
+		sortNodes(n.holders)
+	}
+
+	mounts, err := opts.readHostMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range mounts {
+		if !m.IsReal() {
+			continue
+		}
+
+		// btrfs and others use an anonymous device number, so fall back to the
+		// source device
+		n := t.NodeFromDevNum(m.DevID)
+		if n == nil && strings.HasPrefix(m.Source, "/dev/") {
+			if n = t.Node(m.Source); n == nil {
+				if resolved, err := filepath.EvalSymlinks(opts.hostPath(m.Source)); err == nil {
+					n = t.Node(filepath.Base(resolved))
+				}
+			}
+		}
+
+		if n != nil {
+			n.Mounts = append(n.Mounts, m)
+		}
+	}
+
+	return t, nil
+}
+
+// link adds an edge from a lower device to an upper device built on it
+func link(lower, upper *TopologyNode) {
+	for _, h := range lower.holders {
+		if h == upper {
+			return
+		}
+	}
+
+	lower.holders = append(lower.holders, upper)
+	upper.slaves = append(upper.slaves, lower)
+}
+
+// readTopologyNode reads a block device's sysfs directory
+func readTopologyNode(name, dir string) *TopologyNode {
+	n := &TopologyNode{Name: name, Kind: NodeDisk}
+	n.DevID, _ = readDevNum(filepath.Join(dir, "dev"))
+
+	if sectors, err := strconv.ParseInt(readSysfsString(filepath.Join(dir, "size")), 10, 64); err == nil {
+		n.Size = cap.Capacity(sectors * 512)
+	}
+
+	switch {
+	case strings.HasPrefix(name, "dm-"):
+		n.DMName = readSysfsString(filepath.Join(dir, "dm", "name"))
+		n.DMUUID = readSysfsString(filepath.Join(dir, "dm", "uuid"))
+		n.Kind = dmKind(n.DMUUID)
+	case strings.HasPrefix(name, "md"):
+		n.Kind = NodeMD
+		n.Level = readSysfsString(filepath.Join(dir, "md", "level"))
+	case strings.HasPrefix(name, "loop"):
+		n.Kind = NodeLoop
+	}
+
+	return n
+}
+
+// dmKind returns the kind of a device-mapper device from the subsystem prefix
+// of its uuid, e.g. LVM-<vg uuid><lv uuid> or CRYPT-LUKS2-<uuid>-<name>
+func dmKind(uuid string) NodeKind {
+	switch prefix := strings.SplitN(uuid, "-", 2)[0]; prefix {
+	case "LVM":
+		return NodeLVM
+	case "CRYPT":
+		return NodeCrypt
+	case "mpath":
+		return NodeMultipath
+	}
+
+	// kpartx partitions of a multipath device are part<n>-mpath-...
+	if strings.HasPrefix(uuid, "part") {
+		return NodePartition
+	}
+
+	return NodeDM
+}
+
+// readDirNames returns the names of the entries in a directory
+func readDirNames(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, len(entries))
+
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+
+	return names
+}
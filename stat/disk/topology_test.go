@@ -0,0 +1,170 @@
+//+build linux
+
+package disk
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeStackFiles is LUKS on LVM on an md RAID1 of two partitions, plus a
+// btrfs partition and an unused loop device
+var fakeStackFiles = map[string]string{
+	"sys/block/sda/dev":              "8:0",
+	"sys/block/sda/size":             "4194304",
+	"sys/block/sda/sda1/partition":   "1",
+	"sys/block/sda/sda1/dev":         "8:1",
+	"sys/block/sda/sda1/size":        "1024",
+	"sys/block/sda/sda2/partition":   "2",
+	"sys/block/sda/sda2/dev":         "8:2",
+	"sys/block/sda/sda2/size":        "3145728",
+	"sys/block/sda/sda2/holders/md0": "",
+	"sys/block/sdb/dev":              "8:16",
+	"sys/block/sdb/size":             "4194304",
+	"sys/block/sdb/sdb2/partition":   "2",
+	"sys/block/sdb/sdb2/dev":         "8:18",
+	"sys/block/sdb/sdb2/size":        "3145728",
+	"sys/block/sdb/sdb2/holders/md0": "",
+	"sys/block/sdc/dev":              "8:32",
+	"sys/block/sdc/size":             "4194304",
+	"sys/block/sdc/sdc1/partition":   "1",
+	"sys/block/sdc/sdc1/dev":         "8:33",
+	"sys/block/sdc/sdc1/size":        "4192256",
+	"sys/block/md0/dev":              "9:0",
+	"sys/block/md0/size":             "3141632",
+	"sys/block/md0/md/level":         "raid1",
+	"sys/block/md0/slaves/sda2":      "",
+	"sys/block/md0/slaves/sdb2":      "",
+	"sys/block/md0/holders/dm-0":     "",
+	"sys/block/dm-0/dev":             "253:0",
+	"sys/block/dm-0/size":            "2097152",
+	"sys/block/dm-0/dm/name":         "vg0-home\n",
+	"sys/block/dm-0/dm/uuid":         "LVM-Zq8fWm2zHx7cPv4nRt1yJd9sEb6gUa3fKq8LXk1sVb2dG3Qh4Xa7Lp8wUefJ2nTq\n",
+	"sys/block/dm-0/slaves/md0":      "",
+	"sys/block/dm-1/dev":             "253:1",
+	"sys/block/dm-1/size":            "2031616",
+	"sys/block/dm-1/dm/name":         "luks-home\n",
+	"sys/block/dm-1/dm/uuid":         "CRYPT-LUKS2-6a1f0e4b9c8d4f2e8b7a6c5d4e3f2a1b-luks-home\n",
+	"sys/block/dm-1/slaves/dm-0":     "",
+	"sys/block/loop0/dev":            "7:0",
+	"sys/block/loop0/size":           "0",
+	"proc/1/mountinfo": "28 1 8:1 / /boot rw,relatime shared:1 - ext4 /dev/sda1 rw\n" +
+		"29 1 253:1 / /home rw,relatime shared:2 - ext4 /dev/mapper/luks-home rw\n" +
+		"30 1 0:45 /@data /data rw,relatime - btrfs /dev/sdc1 rw,space_cache\n" +
+		"31 1 0:22 / /proc rw,nosuid - proc proc rw\n",
+}
+
+func TestGetTopology(t *testing.T) {
+	topo, err := GetTopology(WithRoot(writeFakeTree(t, fakeStackFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(topo.Nodes) != 11 {
+		t.Fatalf("expected 11 nodes, got %d", len(topo.Nodes))
+	}
+
+	for name, kind := range map[string]NodeKind{
+		"sda": NodeDisk, "sda2": NodePartition, "md0": NodeMD, "dm-0": NodeLVM, "dm-1": NodeCrypt, "loop0": NodeLoop,
+	} {
+		if n := topo.Node(name); n == nil || n.Kind != kind {
+			t.Errorf("expected %s to be a %s, got %+v", name, kind, n)
+		}
+	}
+
+	luks := topo.Node("/dev/mapper/luks-home")
+	if luks == nil || luks.Name != "dm-1" || luks.DevID != NewDevNum(253, 1) || luks.Size != 2031616*512 {
+		t.Fatalf("unexpected node %+v", luks)
+	}
+
+	if lower := topo.Node("md0").Lower(); len(lower) != 2 || lower[0].Name != "sda2" || lower[1].Name != "sdb2" {
+		t.Errorf("unexpected md0 slaves %v", lower)
+	}
+
+	if upper := topo.Node("sda").Upper(); len(upper) != 2 || upper[0].Name != "sda1" || upper[1].Name != "sda2" {
+		t.Errorf("unexpected sda partitions %v", upper)
+	}
+
+	disks, err := topo.DisksForMount("/home/user/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(disks) != 2 || disks[0].Name != "sda" || disks[1].Name != "sdb" {
+		t.Errorf("expected /home to be on sda and sdb, got %v", disks)
+	}
+
+	// btrfs mounts have an anonymous device number and are matched by source
+	if disks, err := topo.DisksForMount("/data"); err != nil || len(disks) != 1 || disks[0].Name != "sdc" {
+		t.Errorf("expected /data to be on sdc, got %v, %v", disks, err)
+	}
+
+	mounts, err := topo.MountsForDevice("/dev/sda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mounts) != 2 || mounts[0].MountPoint != "/boot" || mounts[1].MountPoint != "/home" {
+		t.Errorf("expected sda to affect /boot and /home, got %v", mounts)
+	}
+
+	if mounts, _ := topo.MountsForDevice("sdb"); len(mounts) != 1 || mounts[0].MountPoint != "/home" {
+		t.Errorf("expected sdb to affect /home, got %v", mounts)
+	}
+
+	if _, err := topo.MountsForDevice("sdz"); err == nil {
+		t.Error("expected an error for a missing device")
+	}
+
+	if _, err := topo.NodeFromMount("/proc"); err == nil {
+		t.Error("expected no device for a pseudo filesystem")
+	}
+
+	if p := topo.Physical(); len(p) != 3 || p[0].Name != "sda" || p[2].Name != "sdc" {
+		t.Errorf("unexpected physical devices %v", p)
+	}
+}
+
+func TestTopologyTree(t *testing.T) {
+	topo, err := GetTopology(WithRoot(writeFakeTree(t, fakeStackFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "dm-1 (luks-home) crypt 992 MiB /home\n" +
+		"└─ dm-0 (vg0-home) lvm 1 GiB\n" +
+		"   └─ md0 raid1 1.5 GiB\n" +
+		"      ├─ sda2 partition 1.5 GiB\n" +
+		"      │  └─ sda disk 2 GiB\n" +
+		"      └─ sdb2 partition 1.5 GiB\n" +
+		"         └─ sdb disk 2 GiB\n"
+
+	if got := topo.Node("dm-1").Tree(Down); got != want {
+		t.Errorf("unexpected tree:\n%s\nwant:\n%s", got, want)
+	}
+
+	up := topo.Node("sdb").Tree(Up)
+	if !strings.HasPrefix(up, "sdb disk 2 GiB\n└─ sdb2") || !strings.HasSuffix(up, "luks-home) crypt 992 MiB /home\n") {
+		t.Errorf("unexpected tree:\n%s", up)
+	}
+
+	dot := topo.DOT(topo.Node("sdc"))
+	for _, s := range []string{
+		"digraph topology {",
+		`"sdc" [label="sdc disk 2 GiB", shape=cylinder];`,
+		`"sdc" -> "sdc1";`,
+		`"sdc1" -> "mount:/data";`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("expected DOT to contain %s, got:\n%s", s, dot)
+		}
+	}
+
+	if strings.Contains(dot, "md0") {
+		t.Errorf("expected only sdc's devices, got:\n%s", dot)
+	}
+
+	if dot := topo.DOT(); !strings.Contains(dot, `"md0" -> "dm-0";`) || !strings.Contains(dot, `"sda2" -> "md0";`) {
+		t.Errorf("unexpected DOT:\n%s", dot)
+	}
+}
@@ -0,0 +1,132 @@
+package disk
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCacheErrorTTL is how long a failed fetch is cached before retrying
+const ttlCacheErrorTTL = 5 * time.Second
+
+// ttlCache caches values by key for a time to live. Concurrent gets of the
+// same key share a single call to fetch, and the lock is never held while
+// fetching
+type ttlCache struct {
+	ttl time.Duration
+	// errTTL is the time to live of a failed fetch, at most ttl
+	errTTL  time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]*ttlCacheEntry
+}
+
+type ttlCacheEntry struct {
+	value interface{}
+	err   error
+	// updated is when value was fetched, checked is when fetch last ran
+	updated time.Time
+	checked time.Time
+	// wait is closed when an in flight fetch finishes
+	wait chan struct{}
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{
+		ttl:     ttl,
+		errTTL:  ttlCacheErrorTTL,
+		now:     time.Now,
+		entries: make(map[string]*ttlCacheEntry),
+	}
+}
+
+// get returns the value for key and when it was fetched, calling fetch if the
+// value is older than the ttl, or the error ttl if the last fetch failed. If
+// fetch fails with an error keep returns true for, the previous value is kept
+// and returned along with the error, otherwise it's dropped
+func (c *ttlCache) get(key string, fetch func() (interface{}, error),
+	keep func(error) bool) (interface{}, time.Time, error) {
+	c.mu.Lock()
+
+	e, ok := c.entries[key]
+
+	for ok && e.wait != nil {
+		wait := e.wait
+		c.mu.Unlock()
+		<-wait
+		c.mu.Lock()
+		e, ok = c.entries[key]
+	}
+
+	if ok && c.now().Sub(e.checked) < c.entryTTL(e) {
+		defer c.mu.Unlock()
+		return e.value, e.updated, e.err
+	}
+
+	if !ok {
+		e = new(ttlCacheEntry)
+		c.entries[key] = e
+	}
+
+	wait := make(chan struct{})
+	e.wait = wait
+	c.mu.Unlock()
+
+	// release the waiters even if fetch panics, checked hasn't moved so they
+	// fetch again
+	defer func() {
+		c.mu.Lock()
+		e.wait = nil
+		c.mu.Unlock()
+		close(wait)
+	}()
+
+	v, err := fetch()
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.checked = now
+	e.err = err
+
+	switch {
+	case err == nil:
+		e.value = v
+		e.updated = now
+	case keep == nil || !keep(err):
+		e.value = nil
+		e.updated = time.Time{}
+	}
+
+	return e.value, e.updated, e.err
+}
+
+// entryTTL returns how long e is fresh for
+func (c *ttlCache) entryTTL(e *ttlCacheEntry) time.Duration {
+	if e.err != nil && c.errTTL < c.ttl {
+		return c.errTTL
+	}
+
+	return c.ttl
+}
+
+// updated returns when the value for key was fetched
+func (c *ttlCache) updated(key string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || e.updated.IsZero() {
+		return time.Time{}, false
+	}
+
+	return e.updated, true
+}
+
+// invalidate removes the value for key so the next get fetches it. A fetch
+// in flight still returns to its callers but isn't cached
+func (c *ttlCache) invalidate(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
@@ -0,0 +1,193 @@
+//+build linux
+
+package disk
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	c := newTTLCache(time.Minute)
+	now := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	var calls int32
+
+	release := make(chan struct{})
+	fetch := func() (interface{}, error) {
+		<-release
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if v, _, err := c.get("a", fetch, nil); err != nil || v.(int32) != 1 {
+				t.Errorf("expected the shared fetch, got %v: %v", v, err)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("expected 1 fetch, got %d", calls)
+	}
+
+	now = now.Add(30 * time.Second)
+
+	if _, updated, _ := c.get("a", fetch, nil); calls != 1 || now.Sub(updated) != 30*time.Second {
+		t.Errorf("expected a cache hit 30s old, got %d fetches and %s", calls, now.Sub(updated))
+	}
+
+	// after the ttl a failed fetch that is kept returns the old value
+	now = now.Add(time.Minute)
+	errKeep := errors.New("keep")
+
+	v, updated, err := c.get("a", func() (interface{}, error) {
+		return nil, errKeep
+	}, func(err error) bool {
+		return err == errKeep
+	})
+
+	if v.(int32) != 1 || err != errKeep || now.Sub(updated) != 90*time.Second {
+		t.Errorf("expected the kept value with its age, got %v %s: %v", v, now.Sub(updated), err)
+	}
+
+	// errors are retried sooner than the ttl
+	now = now.Add(ttlCacheErrorTTL)
+
+	if v, _, err = c.get("a", fetch, nil); v.(int32) != 2 || err != nil {
+		t.Errorf("expected a retry after the error ttl, got %v: %v", v, err)
+	}
+
+	c.invalidate("a")
+
+	if _, ok := c.updated("a"); ok {
+		t.Error("expected no value after invalidating")
+	}
+
+	if v, _, _ = c.get("a", fetch, nil); v.(int32) != 3 {
+		t.Errorf("expected a new fetch, got %v", v)
+	}
+}
+
+func TestTTLCacheErrors(t *testing.T) {
+	c := newTTLCache(time.Minute)
+	now := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.get("a", func() (interface{}, error) { return 1, nil }, nil)
+	now = now.Add(2 * time.Minute)
+
+	errFetch := errors.New("fetch")
+
+	v, updated, err := c.get("a", func() (interface{}, error) { return nil, errFetch }, nil)
+	if v != nil || !updated.IsZero() || err != errFetch {
+		t.Errorf("expected the old value to be dropped, got %v %s: %v", v, updated, err)
+	}
+
+	if _, ok := c.updated("a"); ok {
+		t.Error("expected no value after a failed fetch")
+	}
+
+	// a panicking fetch doesn't leave later gets waiting on it
+	now = now.Add(time.Minute)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to reach the caller")
+			}
+		}()
+
+		c.get("a", func() (interface{}, error) { panic("fetch") }, nil)
+	}()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if v, _, err := c.get("a", func() (interface{}, error) { return 2, nil }, nil); v != 2 || err != nil {
+			t.Errorf("expected a new fetch after the panic, got %v: %v", v, err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("get blocked after a panicking fetch")
+	}
+}
+
+func TestSMARTCache(t *testing.T) {
+	c := NewSMARTCache(time.Minute, WithNoWake())
+
+	var devs []string
+
+	standby := false
+	c.get = func(dev string, opts ...SMARTOption) (*SMARTInfo, error) {
+		if o := newSMARTOptions(opts...); !o.noWake {
+			t.Error("expected the cache options to be passed")
+		}
+
+		devs = append(devs, dev)
+
+		if standby {
+			return nil, ErrDeviceInStandby
+		}
+
+		return &SMARTInfo{SerialNumber: "ABC"}, nil
+	}
+
+	if _, ok := c.Age("sda"); ok {
+		t.Error("expected no age before reading")
+	}
+
+	if info, err := c.Get("sda"); err != nil || info.SerialNumber != "ABC" {
+		t.Fatalf("unexpected info %+v: %v", info, err)
+	}
+
+	if _, err := c.Get("/dev/sda"); err != nil || len(devs) != 1 || devs[0] != "/dev/sda" {
+		t.Errorf("expected a single read of /dev/sda, got %v: %v", devs, err)
+	}
+
+	if age, ok := c.Age("sda"); !ok || age > time.Second {
+		t.Errorf("unexpected age %s", age)
+	}
+
+	c.Invalidate("sda")
+	standby = true
+
+	if info, err := c.Get("sda"); info != nil || !errors.Is(err, ErrDeviceInStandby) {
+		t.Errorf("expected ErrDeviceInStandby without data, got %+v: %v", info, err)
+	}
+}
+
+func TestDevicePath(t *testing.T) {
+	for in, want := range map[string]string{"sda": "/dev/sda", "/dev/nvme0": "/dev/nvme0", "": ""} {
+		if got := devicePath(in); got != want {
+			t.Errorf("expected %q for %q, got %q", want, in, got)
+		}
+	}
+
+	o := newOptions(WithRoot("/host"))
+
+	for in, want := range map[string]string{"sda1": "/host/dev/sda1", "/dev/sdb": "/host/dev/sdb"} {
+		if got := o.hostDevicePath(in); got != want {
+			t.Errorf("expected %q for %q under /host, got %q", want, in, got)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+//+build linux darwin
+
+package disk
+
+import (
+	"container/heap"
+	"context"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DefaultUsageTopN is how many of the largest files and dirs Usage reports by
+// default
+const DefaultUsageTopN = 10
+
+// UsageOption configures Usage
+type UsageOption func(o *usageOptions)
+
+type usageOptions struct {
+	oneFileSystem bool
+	exclude       []string
+	maxDepth      int
+	scanDepth     int
+	topN          int
+	workers       int
+	interval      time.Duration
+	progress      func(UsageProgress)
+}
+
+func newUsageOptions(opts ...UsageOption) *usageOptions {
+	o := &usageOptions{
+		maxDepth:  -1,
+		scanDepth: -1,
+		topN:      DefaultUsageTopN,
+		workers:   runtime.NumCPU() * 2,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.workers < 1 {
+		o.workers = 1
+	}
+
+	return o
+}
+
+// WithOneFileSystem skips directories on other filesystems than the root,
+// like du -x
+func WithOneFileSystem() UsageOption {
+	return func(o *usageOptions) {
+		o.oneFileSystem = true
+	}
+}
+
+// WithExclude skips files and directories matching any of the glob patterns.
+// Patterns are matched against both the name and the slash separated path
+// relative to the root
+func WithExclude(patterns ...string) UsageOption {
+	return func(o *usageOptions) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// WithMaxDepth limits how deep DirUsage.Children are reported, the root being
+// depth 0, like du --max-depth. It only trims the report: the whole tree is
+// still scanned and deeper directories are counted in their parents' totals.
+// Use WithScanDepth to stop the scan from descending. A negative depth
+// reports every directory, which is the default
+func WithMaxDepth(depth int) UsageOption {
+	return func(o *usageOptions) {
+		o.maxDepth = depth
+	}
+}
+
+// WithScanDepth stops the scan from reading directories deeper than depth,
+// the root being depth 0, like find -maxdepth. Directories at depth+1 are
+// counted but not read, so nothing below them is in the totals. A negative
+// depth scans the whole tree, which is the default
+func WithScanDepth(depth int) UsageOption {
+	return func(o *usageOptions) {
+		o.scanDepth = depth
+	}
+}
+
+// WithTopN sets how many of the largest files and dirs are reported
+func WithTopN(n int) UsageOption {
+	return func(o *usageOptions) {
+		o.topN = n
+	}
+}
+
+// WithConcurrency sets how many directories are read at once
+func WithConcurrency(n int) UsageOption {
+	return func(o *usageOptions) {
+		o.workers = n
+	}
+}
+
+// WithProgress calls fn with the totals so far every interval while the scan
+// runs, and once more when it finishes
+func WithProgress(interval time.Duration, fn func(UsageProgress)) UsageOption {
+	return func(o *usageOptions) {
+		o.interval = interval
+		o.progress = fn
+	}
+}
+
+// DirUsage is the space used by a directory and everything below it.
+// Apparent is the sum of file sizes and Allocated the space the blocks take
+// on disk, which is smaller for sparse and compressed files
+type DirUsage struct {
+	Path      string       `yaml:"path" json:"path"`
+	Apparent  cap.Capacity `yaml:"apparent" json:"apparent"`
+	Allocated cap.Capacity `yaml:"allocated" json:"allocated"`
+	Files     int64        `yaml:"files" json:"files"`
+	Dirs      int64        `yaml:"dirs" json:"dirs"`
+	// Children are the subdirectories up to the max depth, largest first
+	Children []*DirUsage `yaml:"children,omitempty" json:"children,omitempty"`
+}
+
+// Child returns the subdirectory with the given name
+func (d *DirUsage) Child(name string) *DirUsage {
+	for _, c := range d.Children {
+		if filepath.Base(c.Path) == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// add adds the totals of a subdirectory
+func (d *DirUsage) add(c *DirUsage) {
+	d.Apparent = d.Apparent.Add(c.Apparent)
+	d.Allocated = d.Allocated.Add(c.Allocated)
+	d.Files += c.Files
+	d.Dirs += c.Dirs
+}
+
+// entry returns the directory's totals as a UsageEntry
+func (d *DirUsage) entry() *UsageEntry {
+	return &UsageEntry{Path: d.Path, Apparent: d.Apparent, Allocated: d.Allocated}
+}
+
+// UsageEntry is one of the largest files or directories
+type UsageEntry struct {
+	Path      string       `yaml:"path" json:"path"`
+	Apparent  cap.Capacity `yaml:"apparent" json:"apparent"`
+	Allocated cap.Capacity `yaml:"allocated" json:"allocated"`
+}
+
+// UsageProgress is the running total of a scan
+type UsageProgress struct {
+	Files     int64         `yaml:"files" json:"files"`
+	Dirs      int64         `yaml:"dirs" json:"dirs"`
+	Apparent  cap.Capacity  `yaml:"apparent" json:"apparent"`
+	Allocated cap.Capacity  `yaml:"allocated" json:"allocated"`
+	Errors    int64         `yaml:"errors" json:"errors"`
+	Elapsed   time.Duration `yaml:"elapsed" json:"elapsed"`
+}
+
+// UsageReport is the result of Usage
+type UsageReport struct {
+	Root         *DirUsage     `yaml:"root" json:"root"`
+	LargestFiles []*UsageEntry `yaml:"largest_files,omitempty" json:"largest_files,omitempty"`
+	// LargestDirs doesn't include the root
+	LargestDirs []*UsageEntry `yaml:"largest_dirs,omitempty" json:"largest_dirs,omitempty"`
+	// HardLinks is how many extra links to already counted files were skipped
+	HardLinks int64 `yaml:"hard_links" json:"hard_links"`
+	// Errors are the files and directories that couldn't be read
+	Errors  []string      `yaml:"errors,omitempty" json:"errors,omitempty"`
+	Elapsed time.Duration `yaml:"elapsed" json:"elapsed"`
+}
+
+// usageHeap is a min heap of the largest entries seen so far
+type usageHeap []*UsageEntry
+
+func (h usageHeap) Len() int            { return len(h) }
+func (h usageHeap) Less(i, j int) bool  { return usageLess(h[i], h[j]) }
+func (h usageHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *usageHeap) Push(x interface{}) { *h = append(*h, x.(*UsageEntry)) }
+
+func (h *usageHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// usageLess orders entries by allocated then apparent size, and by path so
+// ties are stable
+func usageLess(a, b *UsageEntry) bool {
+	if a.Allocated != b.Allocated {
+		return a.Allocated < b.Allocated
+	}
+
+	if a.Apparent != b.Apparent {
+		return a.Apparent < b.Apparent
+	}
+
+	return a.Path > b.Path
+}
+
+// usageTop keeps the n largest entries
+type usageTop struct {
+	n  int
+	mu sync.Mutex
+	h  usageHeap
+}
+
+func (t *usageTop) push(e *UsageEntry) {
+	if t.n < 1 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.h) < t.n {
+		heap.Push(&t.h, e)
+		return
+	}
+
+	if usageLess(t.h[0], e) {
+		t.h[0] = e
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// sorted returns the entries largest first
+func (t *usageTop) sorted() []*UsageEntry {
+	out := append([]*UsageEntry{}, t.h...)
+
+	sort.Slice(out, func(i, j int) bool {
+		return usageLess(out[j], out[i])
+	})
+
+	return out
+}
+
+type usageInode struct {
+	dev uint64
+	ino uint64
+}
+
+type usageWalker struct {
+	// running totals for progress, updated atomically and first in the
+	// struct so they're 64 bit aligned
+	nFiles, nDirs, nApparent, nAllocated, nErrors, nHardLinks int64
+
+	ctx   context.Context
+	opts  *usageOptions
+	root  string
+	dev   uint64
+	sem   chan struct{}
+	files usageTop
+	dirs  usageTop
+
+	mu     sync.Mutex
+	seen   map[usageInode]struct{}
+	errors []string
+}
+
+// Usage scans the directory tree under root and reports the space used by
+// each directory like du. Directories are read concurrently, symlinks aren't
+// followed and files with several hard links are only counted once. If ctx
+// is cancelled, the totals so far are returned along with ctx's error
+func Usage(ctx context.Context, root string, opts ...UsageOption) (*UsageReport, error) {
+	o := newUsageOptions(opts...)
+
+	for _, pattern := range o.exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	root = filepath.Clean(root)
+
+	fi, err := os.Lstat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		return nil, &os.PathError{Op: "usage", Path: root, Err: syscall.ENOTDIR}
+	}
+
+	w := &usageWalker{
+		ctx:   ctx,
+		opts:  o,
+		root:  root,
+		sem:   make(chan struct{}, o.workers-1),
+		files: usageTop{n: o.topN},
+		dirs:  usageTop{n: o.topN},
+		seen:  make(map[usageInode]struct{}),
+	}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		w.dev = uint64(st.Dev)
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	if o.progress != nil && o.interval > 0 {
+		go func() {
+			defer close(stopped)
+
+			ticker := time.NewTicker(o.interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					o.progress(w.progress(start))
+				}
+			}
+		}()
+	} else {
+		close(stopped)
+	}
+
+	report := &UsageReport{Root: w.walk(root, fi, 0)}
+
+	close(done)
+	<-stopped
+
+	report.Elapsed = time.Since(start)
+	report.LargestFiles = w.files.sorted()
+	report.LargestDirs = w.dirs.sorted()
+	report.HardLinks = w.nHardLinks
+	report.Errors = w.errors
+	sort.Strings(report.Errors)
+
+	if o.progress != nil {
+		o.progress(w.progress(start))
+	}
+
+	return report, ctx.Err()
+}
+
+// progress returns the running totals
+func (w *usageWalker) progress(start time.Time) UsageProgress {
+	return UsageProgress{
+		Files:     atomic.LoadInt64(&w.nFiles),
+		Dirs:      atomic.LoadInt64(&w.nDirs),
+		Apparent:  cap.Capacity(atomic.LoadInt64(&w.nApparent)),
+		Allocated: cap.Capacity(atomic.LoadInt64(&w.nAllocated)),
+		Errors:    atomic.LoadInt64(&w.nErrors),
+		Elapsed:   time.Since(start),
+	}
+}
+
+func (w *usageWalker) error(err error) {
+	atomic.AddInt64(&w.nErrors, 1)
+
+	w.mu.Lock()
+	w.errors = append(w.errors, err.Error())
+	w.mu.Unlock()
+}
+
+// excluded returns true if the path matches an exclude pattern
+func (w *usageWalker) excluded(path string) bool {
+	if len(w.opts.exclude) < 1 {
+		return false
+	}
+
+	name := filepath.Base(path)
+	rel, _ := filepath.Rel(w.root, path)
+	rel = filepath.ToSlash(rel)
+
+	for _, pattern := range w.opts.exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// size returns the apparent and allocated size of a file
+func (w *usageWalker) size(fi os.FileInfo) (cap.Capacity, cap.Capacity) {
+	apparent := cap.Capacity(fi.Size())
+	allocated := apparent
+
+	// st_blocks is always in 512 byte units
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		allocated = cap.Capacity(int64(st.Blocks) * 512)
+	}
+
+	atomic.AddInt64(&w.nApparent, int64(apparent))
+	atomic.AddInt64(&w.nAllocated, int64(allocated))
+
+	return apparent, allocated
+}
+
+// firstLink returns false if another link to the file was already counted
+func (w *usageWalker) firstLink(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || uint64(st.Nlink) < 2 {
+		return true
+	}
+
+	key := usageInode{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.seen[key]; ok {
+		atomic.AddInt64(&w.nHardLinks, 1)
+		return false
+	}
+
+	w.seen[key] = struct{}{}
+
+	return true
+}
+
+// otherFileSystem returns true if the directory is a mount point that
+// WithOneFileSystem should skip
+func (w *usageWalker) otherFileSystem(fi os.FileInfo) bool {
+	if !w.opts.oneFileSystem {
+		return false
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+
+	return ok && uint64(st.Dev) != w.dev
+}
+
+// walk totals a directory, reading subdirectories in other goroutines while
+// there are free workers and in this one otherwise
+func (w *usageWalker) walk(path string, fi os.FileInfo, depth int) *DirUsage {
+	d := &DirUsage{Path: path}
+	d.Apparent, d.Allocated = w.size(fi)
+	atomic.AddInt64(&w.nDirs, 1)
+
+	if w.ctx.Err() != nil || w.opts.scanDepth >= 0 && depth > w.opts.scanDepth {
+		return d
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		w.error(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		subdirs []*DirUsage
+	)
+
+	for _, e := range entries {
+		if w.ctx.Err() != nil {
+			break
+		}
+
+		p := filepath.Join(path, e.Name())
+
+		if w.excluded(p) {
+			continue
+		}
+
+		if !e.IsDir() {
+			w.addFile(d, p, e)
+			continue
+		}
+
+		if w.otherFileSystem(e) {
+			continue
+		}
+
+		d.Dirs++
+
+		walk := func(p string, e os.FileInfo) {
+			c := w.walk(p, e, depth+1)
+
+			mu.Lock()
+			subdirs = append(subdirs, c)
+			mu.Unlock()
+		}
+
+		select {
+		case w.sem <- struct{}{}:
+			wg.Add(1)
+
+			go func(p string, e os.FileInfo) {
+				defer wg.Done()
+				defer func() { <-w.sem }()
+				walk(p, e)
+			}(p, e)
+		default:
+			walk(p, e)
+		}
+	}
+
+	wg.Wait()
+
+	for _, c := range subdirs {
+		d.add(c)
+	}
+
+	if w.opts.maxDepth < 0 || depth < w.opts.maxDepth {
+		sort.Slice(subdirs, func(i, j int) bool {
+			return usageLess(subdirs[j].entry(), subdirs[i].entry())
+		})
+
+		d.Children = subdirs
+	}
+
+	if depth > 0 {
+		w.dirs.push(d.entry())
+	}
+
+	return d
+}
+
+// addFile adds a file that isn't a directory to its directory's totals
+func (w *usageWalker) addFile(d *DirUsage, path string, fi os.FileInfo) {
+	if !w.firstLink(fi) {
+		return
+	}
+
+	apparent, allocated := w.size(fi)
+
+	d.Apparent = d.Apparent.Add(apparent)
+	d.Allocated = d.Allocated.Add(allocated)
+	d.Files++
+	atomic.AddInt64(&w.nFiles, 1)
+
+	if fi.Mode().IsRegular() {
+		w.files.push(&UsageEntry{Path: path, Apparent: apparent, Allocated: allocated})
+	}
+}
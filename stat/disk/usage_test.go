@@ -0,0 +1,147 @@
+//+build linux
+
+package disk
+
+import (
+	"context"
+	"errors"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUsage(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]int{
+		"a/big":          64 << 10,
+		"a/deep/x/small": 4 << 10,
+		"skip/ignored":   8 << 10,
+		"c.log":          8 << 10,
+	}
+
+	for name, size := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(root, "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sparse, err := os.Create(filepath.Join(root, "b/sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sparse.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	sparse.Close()
+
+	if err := os.Link(filepath.Join(root, "a/big"), filepath.Join(root, "a/link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("a/big", filepath.Join(root, "sym")); err != nil {
+		t.Fatal(err)
+	}
+
+	// everything that should be counted, with the hard link only once
+	var want cap.Capacity
+
+	for _, name := range []string{".", "a", "a/big", "a/deep", "a/deep/x", "a/deep/x/small", "b", "b/sparse", "sym"} {
+		fi, err := os.Lstat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want += cap.Capacity(fi.Size())
+	}
+
+	var progress []UsageProgress
+
+	report, err := Usage(context.Background(), root,
+		WithExclude("skip", "*.log"),
+		WithMaxDepth(1),
+		WithTopN(2),
+		WithConcurrency(2),
+		WithProgress(0, func(p UsageProgress) {
+			progress = append(progress, p)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := report.Root
+
+	if r.Files != 4 || r.Dirs != 4 || report.HardLinks != 1 || len(report.Errors) > 0 {
+		t.Errorf("unexpected files %d, dirs %d, hard links %d or errors %v", r.Files, r.Dirs, report.HardLinks, report.Errors)
+	}
+
+	if r.Apparent != want {
+		t.Errorf("expected apparent size %d, got %d", want, r.Apparent)
+	}
+
+	a, b := r.Child("a"), r.Child("b")
+	if a == nil || b == nil || r.Child("skip") != nil || len(r.Children) != 2 {
+		t.Fatalf("unexpected children %+v", r.Children)
+	}
+
+	if a.Files != 2 || a.Dirs != 2 || a.Children != nil {
+		t.Errorf("unexpected usage of a %+v", a)
+	}
+
+	if b.Apparent < 1<<20 || b.Allocated >= b.Apparent {
+		t.Errorf("expected b to be sparse, got apparent %d and allocated %d", b.Apparent, b.Allocated)
+	}
+
+	if len(report.LargestFiles) != 2 || report.LargestFiles[0].Path != filepath.Join(root, "a/big") {
+		t.Errorf("unexpected largest files %+v", report.LargestFiles)
+	}
+
+	if len(report.LargestDirs) != 2 || report.LargestDirs[0].Path != filepath.Join(root, "a") {
+		t.Errorf("unexpected largest dirs %+v", report.LargestDirs)
+	}
+
+	if len(progress) != 1 || progress[0].Files != 4 || progress[0].Dirs != 5 || progress[0].Apparent != want {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+
+	// only the root and its subdirectories are read
+	if report, err = Usage(context.Background(), root, WithExclude("skip", "*.log"), WithScanDepth(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if r = report.Root; r.Files != 3 || r.Dirs != 3 || r.Apparent >= want {
+		t.Errorf("unexpected files %d, dirs %d or apparent size %d", r.Files, r.Dirs, r.Apparent)
+	}
+
+	if a = r.Child("a"); a == nil || a.Files != 1 || a.Dirs != 1 || a.Child("deep") == nil || a.Child("deep").Dirs != 0 {
+		t.Errorf("expected a/deep to be counted but not read, got %+v", a)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if report, err := Usage(ctx, root); !errors.Is(err, context.Canceled) || report == nil || report.Root.Files != 0 {
+		t.Errorf("expected a cancelled scan to return an empty report, got %v", err)
+	}
+
+	if _, err := Usage(context.Background(), root, WithExclude("[")); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Errorf("expected a bad pattern error, got %v", err)
+	}
+
+	if _, err := Usage(context.Background(), filepath.Join(root, "c.log")); err == nil {
+		t.Error("expected an error scanning a file")
+	}
+}
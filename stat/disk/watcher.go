@@ -0,0 +1,452 @@
+//+build linux
+
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// EventType is the type of a change seen by a Watcher
+type EventType string
+
+const (
+	DiskAdded         EventType = "disk_added"
+	DiskRemoved       EventType = "disk_removed"
+	PartitionChanged  EventType = "partition_changed"
+	Mounted           EventType = "mounted"
+	Unmounted         EventType = "unmounted"
+	RemountedReadOnly EventType = "remounted_read_only"
+	SizeChanged       EventType = "size_changed"
+)
+
+// Event is a change to a disk, partition or mount
+type Event struct {
+	Type EventType `yaml:"type" json:"type"`
+	// Name is the kernel name of the disk or partition
+	Name  string `yaml:"name,omitempty" json:"name,omitempty"`
+	DevID DevNum `yaml:"dev_id,omitempty" json:"dev_id,omitempty"`
+	// Disk is the parent disk of a changed partition
+	Disk string `yaml:"disk,omitempty" json:"disk,omitempty"`
+	// Action is added, removed or resized for PartitionChanged events
+	Action  string       `yaml:"action,omitempty" json:"action,omitempty"`
+	OldSize cap.Capacity `yaml:"old_size,omitempty" json:"old_size,omitempty"`
+	NewSize cap.Capacity `yaml:"new_size,omitempty" json:"new_size,omitempty"`
+	Mount   *Mount       `yaml:"mount,omitempty" json:"mount,omitempty"`
+	Time    time.Time    `yaml:"time" json:"time"`
+}
+
+// blockState is the state of a disk or partition in sysfs
+type blockState struct {
+	Name        string
+	DevID       DevNum
+	Size        cap.Capacity
+	IsPartition bool
+	Disk        string
+}
+
+// Watcher reports disks being added or removed, partition tables and sizes
+// changing and filesystems being mounted, unmounted or remounted read-only.
+// It rescans on kernel uevents and polls the host's mountinfo every interval
+type Watcher struct {
+	Events   chan *Event
+	Errors   chan error
+	opts     *Options
+	interval time.Duration
+	devices  map[string]*blockState
+	mounts   map[int]*Mount
+	uevents  *os.File
+	trigger  chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	closeMu  sync.Once
+}
+
+// NewWatcher creates a Watcher and takes the initial state that later changes
+// are reported against. Call Start or StartPolling to begin watching. The
+// interval must be positive, the watcher always polls
+func NewWatcher(interval time.Duration, opts ...Option) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid watcher poll interval %s", interval)
+	}
+
+	w := &Watcher{
+		Events:   make(chan *Event, 64),
+		Errors:   make(chan error, 1),
+		opts:     newOptions(opts...),
+		interval: interval,
+		trigger:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	var err error
+
+	if w.devices, err = w.scanDevices(); err != nil {
+		return nil, err
+	}
+
+	if w.mounts, err = w.scanMounts(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Start listens for kernel block uevents and polls every interval. It falls
+// back to polling only if the uevent socket can't be opened, e.g. without
+// CAP_NET_ADMIN in a container
+func (w *Watcher) Start() {
+	if f, err := openUeventSocket(); err == nil {
+		w.uevents = f
+		w.wg.Add(1)
+
+		go w.readUevents()
+	}
+
+	w.StartPolling()
+}
+
+// StartPolling polls sysfs and the mount table every interval
+func (w *Watcher) StartPolling() {
+	w.wg.Add(1)
+
+	go w.run()
+}
+
+// UsingUevents returns true if the watcher is listening for kernel uevents
+func (w *Watcher) UsingUevents() bool {
+	return w.uevents != nil
+}
+
+// Close stops the watcher and closes the Events and Errors channels
+func (w *Watcher) Close() error {
+	var err error
+
+	w.closeMu.Do(func() {
+		close(w.done)
+
+		if w.uevents != nil {
+			err = w.uevents.Close()
+		}
+
+		w.wg.Wait()
+		close(w.Events)
+		close(w.Errors)
+	})
+
+	return err
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.trigger:
+		}
+
+		events, err := w.Poll()
+		if err != nil {
+			select {
+			case w.Errors <- err:
+			default:
+				// drop errors nobody is reading
+			}
+
+			continue
+		}
+
+		for _, e := range events {
+			select {
+			case w.Events <- e:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// Poll rescans sysfs and the mount table once and returns the changes since
+// the previous scan without sending them to Events. Concurrent calls are
+// serialised so each change is reported once
+func (w *Watcher) Poll() ([]*Event, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	devices, err := w.scanDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := w.scanMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	events := append(diffDevices(w.devices, devices), diffMounts(w.mounts, mounts)...)
+
+	for _, e := range events {
+		e.Time = now
+	}
+
+	w.devices = devices
+	w.mounts = mounts
+
+	return events, nil
+}
+
+// scanDevices reads all disks and partitions from /sys/class/block
+func (w *Watcher) scanDevices() (map[string]*blockState, error) {
+	classDir := w.opts.hostPath("/sys/class/block")
+
+	files, err := ioutil.ReadDir(classDir)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]*blockState, len(files))
+
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+
+		dir := filepath.Join(classDir, name)
+
+		devID, err := readDevNum(filepath.Join(dir, "dev"))
+		if err != nil {
+			// the device went away while scanning
+			continue
+		}
+
+		st := &blockState{
+			Name:        name,
+			DevID:       devID,
+			IsPartition: isPartition(dir),
+		}
+
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "size")); err == nil {
+			sectors, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+			st.Size = cap.Capacity(sectors * sectorSize)
+		}
+
+		if st.IsPartition {
+			// partitions are linked under their disk's device dir
+			if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+				st.Disk = filepath.Base(filepath.Dir(resolved))
+			}
+		}
+
+		out[name] = st
+	}
+
+	return out, nil
+}
+
+// scanMounts reads the mount table keyed by mount ID
+func (w *Watcher) scanMounts() (map[int]*Mount, error) {
+	mounts, err := w.opts.readHostMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[int]*Mount, len(mounts))
+
+	for _, m := range mounts {
+		out[m.ID] = m
+	}
+
+	return out, nil
+}
+
+func diffDevices(prev, cur map[string]*blockState) []*Event {
+	var events []*Event
+
+	for _, name := range sortedKeys(prev, cur) {
+		p, c := prev[name], cur[name]
+
+		switch {
+		case p == nil && !c.IsPartition:
+			events = append(events, &Event{Type: DiskAdded, Name: name, DevID: c.DevID, NewSize: c.Size})
+		case c == nil && !p.IsPartition:
+			events = append(events, &Event{Type: DiskRemoved, Name: name, DevID: p.DevID, OldSize: p.Size})
+		case p == nil:
+			events = append(events, &Event{Type: PartitionChanged, Action: "added", Name: name,
+				DevID: c.DevID, Disk: c.Disk, NewSize: c.Size})
+		case c == nil:
+			events = append(events, &Event{Type: PartitionChanged, Action: "removed", Name: name,
+				DevID: p.DevID, Disk: p.Disk, OldSize: p.Size})
+		case p.Size != c.Size && c.IsPartition:
+			events = append(events, &Event{Type: PartitionChanged, Action: "resized", Name: name,
+				DevID: c.DevID, Disk: c.Disk, OldSize: p.Size, NewSize: c.Size})
+		case p.Size != c.Size:
+			events = append(events, &Event{Type: SizeChanged, Name: name, DevID: c.DevID,
+				OldSize: p.Size, NewSize: c.Size})
+		}
+	}
+
+	return events
+}
+
+func diffMounts(prev, cur map[int]*Mount) []*Event {
+	var (
+		events []*Event
+		ids    []int
+	)
+
+	for id := range prev {
+		ids = append(ids, id)
+	}
+
+	for id := range cur {
+		if _, ok := prev[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		p, c := prev[id], cur[id]
+
+		switch {
+		case p == nil:
+			events = append(events, &Event{Type: Mounted, Name: c.Source, DevID: c.DevID, Mount: c})
+		case c == nil:
+			events = append(events, &Event{Type: Unmounted, Name: p.Source, DevID: p.DevID, Mount: p})
+		case !p.IsReadOnly() && c.IsReadOnly():
+			events = append(events, &Event{Type: RemountedReadOnly, Name: c.Source, DevID: c.DevID, Mount: c})
+		}
+	}
+
+	return events
+}
+
+func sortedKeys(maps ...map[string]*blockState) []string {
+	var keys []string
+
+	seen := make(map[string]bool)
+
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// uevent is a kernel object event as sent on the NETLINK_KOBJECT_UEVENT socket
+type uevent struct {
+	Action    string
+	DevPath   string
+	Subsystem string
+	DevName   string
+	DevType   string
+	Env       map[string]string
+}
+
+// parseUevent parses a kernel uevent message, which is a header followed by
+// null separated KEY=VALUE pairs:
+// add@/devices/.../block/sda\0ACTION=add\0DEVPATH=...\0SUBSYSTEM=block\0DEVNAME=sda\0
+func parseUevent(b []byte) *uevent {
+	parts := bytes.Split(b, []byte{0})
+	if len(parts) < 2 || !bytes.Contains(parts[0], []byte("@")) {
+		// udev's own messages on the same socket start with libudev
+		return nil
+	}
+
+	e := &uevent{Env: make(map[string]string)}
+
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(string(p), "=", 2)
+		if len(kv) == 2 {
+			e.Env[kv[0]] = kv[1]
+		}
+	}
+
+	e.Action = e.Env["ACTION"]
+	e.DevPath = e.Env["DEVPATH"]
+	e.Subsystem = e.Env["SUBSYSTEM"]
+	e.DevName = e.Env["DEVNAME"]
+	e.DevType = e.Env["DEVTYPE"]
+
+	return e
+}
+
+// openUeventSocket opens a netlink socket subscribed to kernel uevents
+func openUeventSocket() (*os.File, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK,
+		syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: 1,
+	}
+
+	if err = syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	// non-blocking fds are registered with the runtime poller so Close
+	// unblocks pending reads
+	return os.NewFile(uintptr(fd), "uevent"), nil
+}
+
+// readUevents triggers a rescan for every block subsystem uevent
+func (w *Watcher) readUevents() {
+	defer w.wg.Done()
+
+	buf := make([]byte, 16384)
+
+	for {
+		n, err := w.uevents.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			case w.Errors <- err:
+			default:
+			}
+
+			return
+		}
+
+		if e := parseUevent(buf[:n]); e == nil || e.Subsystem != "block" {
+			continue
+		}
+
+		select {
+		case w.trigger <- struct{}{}:
+		default:
+			// a rescan is already pending
+		}
+	}
+}
@@ -0,0 +1,220 @@
+//+build linux
+
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeBlockDevice creates a device in a fake sysfs tree linked from /sys/class/block
+func fakeBlockDevice(t *testing.T, root, disk, name, dev string, sectors string) {
+	dir := filepath.Join(root, "sys/devices/virtual/block", disk)
+	if name != disk {
+		dir = filepath.Join(dir, name)
+	}
+
+	files := map[string]string{"dev": dev, "size": sectors}
+	if name != disk {
+		files["partition"] = "1"
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for f, v := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(v+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	classDir := filepath.Join(root, "sys/class/block")
+	if err := os.MkdirAll(classDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(dir, filepath.Join(classDir, name)); err != nil && !os.IsExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func writeFakeFile(t *testing.T, root, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	root := writeFakeTree(t, map[string]string{
+		"proc/1/mountinfo": "28 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n" +
+			"40 28 8:2 / /data rw,relatime shared:2 - xfs /dev/sda2 rw\n",
+	})
+
+	fakeBlockDevice(t, root, "sda", "sda", "8:0", "2000")
+	fakeBlockDevice(t, root, "sda", "sda1", "8:1", "1000")
+	fakeBlockDevice(t, root, "sda", "sda2", "8:2", "1000")
+	fakeBlockDevice(t, root, "loop0", "loop0", "7:0", "100")
+
+	w, err := NewWatcher(time.Hour, WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if events, err := w.Poll(); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events without changes, got %v %v", events, err)
+	}
+
+	fakeBlockDevice(t, root, "sdb", "sdb", "8:16", "4000")
+	fakeBlockDevice(t, root, "sda", "sda3", "8:3", "500")
+	writeFakeFile(t, root, "sys/devices/virtual/block/sda/size", "3000\n")
+	writeFakeFile(t, root, "sys/devices/virtual/block/sda/sda2/size", "1500\n")
+	writeFakeFile(t, root, "proc/1/mountinfo", "28 1 8:1 / / ro,relatime shared:1 - ext4 /dev/sda1 ro\n"+
+		"41 28 8:16 / /mnt rw,relatime shared:3 - ext4 /dev/sdb rw\n")
+
+	events, err := w.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []struct {
+		typ    EventType
+		name   string
+		action string
+	}{
+		{SizeChanged, "sda", ""},
+		{PartitionChanged, "sda2", "resized"},
+		{PartitionChanged, "sda3", "added"},
+		{DiskAdded, "sdb", ""},
+		{RemountedReadOnly, "/dev/sda1", ""},
+		{Unmounted, "/dev/sda2", ""},
+		{Mounted, "/dev/sdb", ""},
+	}
+
+	if len(events) != len(expect) {
+		t.Fatalf("expected %d events, got %d", len(expect), len(events))
+	}
+
+	for i, e := range expect {
+		if events[i].Type != e.typ || events[i].Name != e.name || events[i].Action != e.action {
+			t.Errorf("expected %s %s %s, got %+v", e.typ, e.name, e.action, events[i])
+		}
+	}
+
+	if events[0].OldSize != 2000*512 || events[0].NewSize != 3000*512 {
+		t.Errorf("unexpected sizes %d -> %d", events[0].OldSize, events[0].NewSize)
+	}
+
+	if events[2].Disk != "sda" || events[2].DevID != NewDevNum(8, 3) {
+		t.Errorf("unexpected partition event %+v", events[2])
+	}
+
+	if events[6].Mount == nil || events[6].Mount.MountPoint != "/mnt" {
+		t.Errorf("unexpected mount event %+v", events[6])
+	}
+
+	if err = os.RemoveAll(filepath.Join(root, "sys/class/block/sdb")); err != nil {
+		t.Fatal(err)
+	}
+
+	if events, err = w.Poll(); err != nil || len(events) != 1 || events[0].Type != DiskRemoved {
+		t.Fatalf("expected sdb to be removed, got %v %v", events, err)
+	}
+}
+
+func TestWatcherConcurrentPoll(t *testing.T) {
+	root := writeFakeTree(t, map[string]string{
+		"proc/1/mountinfo": "28 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n",
+	})
+
+	fakeBlockDevice(t, root, "sda", "sda", "8:0", "2000")
+
+	w, err := NewWatcher(time.Hour, WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakeBlockDevice(t, root, "sdb", "sdb", "8:16", "4000")
+
+	counts := make(chan int)
+
+	for i := 0; i < 8; i++ {
+		go func() {
+			events, _ := w.Poll()
+			counts <- len(events)
+		}()
+	}
+
+	var total int
+
+	for i := 0; i < 8; i++ {
+		total += <-counts
+	}
+
+	if total != 1 {
+		t.Errorf("expected sdb to be reported once, got %d events", total)
+	}
+}
+
+func TestWatcherInterval(t *testing.T) {
+	root := writeFakeTree(t, map[string]string{"proc/1/mountinfo": ""})
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := NewWatcher(interval, WithRoot(root)); err == nil {
+			t.Errorf("expected an error for an interval of %s", interval)
+		}
+	}
+}
+
+func TestWatcherStart(t *testing.T) {
+	root := writeFakeTree(t, map[string]string{"proc/1/mountinfo": ""})
+
+	if err := os.MkdirAll(filepath.Join(root, "sys/class/block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(10*time.Millisecond, WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Start()
+	fakeBlockDevice(t, root, "sdc", "sdc", "8:32", "100")
+
+	select {
+	case e := <-w.Events:
+		if e.Type != DiskAdded || e.Name != "sdc" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case err = <-w.Errors:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-w.Events; ok {
+		t.Error("expected events to be closed")
+	}
+}
+
+func TestParseUevent(t *testing.T) {
+	e := parseUevent([]byte("add@/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sda\x00" +
+		"ACTION=add\x00DEVPATH=/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sda\x00" +
+		"SUBSYSTEM=block\x00MAJOR=8\x00MINOR=0\x00DEVNAME=sda\x00DEVTYPE=disk\x00SEQNUM=4242\x00"))
+
+	if e == nil || e.Action != "add" || e.Subsystem != "block" || e.DevName != "sda" || e.DevType != "disk" ||
+		e.Env["MAJOR"] != "8" {
+		t.Errorf("unexpected uevent %+v", e)
+	}
+
+	if parseUevent([]byte("libudev\x00\xfe\xed\xca\xfe")) != nil {
+		t.Error("expected udev messages to be ignored")
+	}
+}
@@ -0,0 +1,43 @@
+//+build linux
+
+package lvm
+
+import (
+	"github.com/ericmaustin/unixtools/stat/disk"
+	"path/filepath"
+)
+
+// LinkDisks sets the disk and partition of each PV that's on one of the
+// inventory's disks. PVs on other block devices, such as md arrays, are left
+// unlinked
+func LinkDisks(pvs []*PhysicalVolume, inv *disk.Inventory) {
+	linkDisks(pvs, inv.GetPartitionFromIdentifier, inv.GetDiskFromIdentifier)
+}
+
+// LinkDisks links the report's PVs to the inventory's disks
+func (r *Report) LinkDisks(inv *disk.Inventory) {
+	LinkDisks(r.PhysicalVolumes, inv)
+}
+
+func linkDisks(pvs []*PhysicalVolume, partition func(string) (*disk.Partition, error),
+	blockDevice func(string) (*disk.BlockDevice, error)) {
+	for _, pv := range pvs {
+		name := pv.Name
+
+		// pvs may report a /dev/disk or /dev/mapper link
+		if target, err := filepath.EvalSymlinks(name); err == nil {
+			name = target
+		}
+
+		if p, err := partition(name); err == nil {
+			pv.Partition = p
+			pv.Disk = p.Disk
+		} else if d, err := blockDevice(name); err == nil {
+			pv.Disk = d
+		}
+
+		if pv.Disk != nil {
+			pv.DiskName = pv.Disk.Name
+		}
+	}
+}
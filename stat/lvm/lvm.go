@@ -0,0 +1,317 @@
+//+build linux
+
+// Package lvm reports LVM physical volumes, volume groups and logical volumes
+// from the pvs, vgs and lvs JSON reports
+package lvm
+
+import (
+	"bytes"
+	"encoding/json"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"github.com/ericmaustin/unixtools/stat/disk"
+	"gopkg.in/yaml.v2"
+	"os/exec"
+	"strings"
+)
+
+var (
+	pvFields = "pv_name,vg_name,pv_fmt,pv_attr,pv_size,pv_free,pv_used,dev_size,pv_uuid,pv_mda_count"
+	vgFields = "vg_name,vg_uuid,vg_attr,vg_size,vg_free,vg_extent_size,vg_extent_count,vg_free_count," +
+		"pv_count,lv_count,snap_count,vg_missing_pv_count"
+	lvFields = "lv_name,vg_name,lv_uuid,lv_path,lv_dm_path,lv_attr,lv_size,lv_layout,lv_role,segtype," +
+		"pool_lv,origin,data_percent,metadata_percent,snap_percent,copy_percent,raid_sync_action," +
+		"raid_mismatch_count,lv_health_status,lv_metadata_size,lv_active,devices,cache_total_blocks," +
+		"cache_used_blocks,cache_dirty_blocks,cache_read_hits,cache_read_misses,cache_write_hits,cache_write_misses"
+)
+
+// PhysicalVolume is an LVM physical volume
+type PhysicalVolume struct {
+	Name          string       `yaml:"name" json:"name"`
+	VGName        string       `yaml:"vg_name,omitempty" json:"vg_name,omitempty"`
+	Format        string       `yaml:"format" json:"format"`
+	Attr          string       `yaml:"attr" json:"attr"`
+	UUID          string       `yaml:"uuid" json:"uuid"`
+	Size          cap.Capacity `yaml:"size" json:"size"`
+	Free          cap.Capacity `yaml:"free" json:"free"`
+	Used          cap.Capacity `yaml:"used" json:"used"`
+	DevSize       cap.Capacity `yaml:"dev_size" json:"dev_size"`
+	MetadataAreas int          `yaml:"metadata_areas" json:"metadata_areas"`
+	Allocatable   bool         `yaml:"allocatable" json:"allocatable"`
+	Exported      bool         `yaml:"exported,omitempty" json:"exported,omitempty"`
+	Missing       bool         `yaml:"missing,omitempty" json:"missing,omitempty"`
+	// DiskName is the name of the disk the PV is on, set by LinkDisks along
+	// with Disk and Partition
+	DiskName  string            `yaml:"disk,omitempty" json:"disk,omitempty"`
+	Disk      *disk.BlockDevice `yaml:"-" json:"-"`
+	Partition *disk.Partition   `yaml:"-" json:"-"`
+}
+
+// VolumeGroup is an LVM volume group
+type VolumeGroup struct {
+	Name           string       `yaml:"name" json:"name"`
+	UUID           string       `yaml:"uuid" json:"uuid"`
+	Attr           string       `yaml:"attr" json:"attr"`
+	Size           cap.Capacity `yaml:"size" json:"size"`
+	Free           cap.Capacity `yaml:"free" json:"free"`
+	ExtentSize     cap.Capacity `yaml:"extent_size" json:"extent_size"`
+	ExtentCount    int64        `yaml:"extent_count" json:"extent_count"`
+	FreeCount      int64        `yaml:"free_count" json:"free_count"`
+	PVCount        int          `yaml:"pv_count" json:"pv_count"`
+	LVCount        int          `yaml:"lv_count" json:"lv_count"`
+	SnapCount      int          `yaml:"snap_count" json:"snap_count"`
+	MissingPVCount int          `yaml:"missing_pv_count" json:"missing_pv_count"`
+	// Partial is set when PVs are missing
+	Partial bool `yaml:"partial,omitempty" json:"partial,omitempty"`
+	// UsedPercent is how much of the VG is allocated to LVs
+	UsedPercent float64 `yaml:"used_percent" json:"used_percent"`
+}
+
+// ThinPoolUsage is the data and metadata usage of a thin pool
+type ThinPoolUsage struct {
+	DataPercent     float64      `yaml:"data_percent" json:"data_percent"`
+	MetadataPercent float64      `yaml:"metadata_percent" json:"metadata_percent"`
+	MetadataSize    cap.Capacity `yaml:"metadata_size" json:"metadata_size"`
+}
+
+// SnapshotUsage is how full a snapshot is. Thin snapshots don't fill up and
+// have no usage
+type SnapshotUsage struct {
+	Origin  string  `yaml:"origin" json:"origin"`
+	Percent float64 `yaml:"percent" json:"percent"`
+	// Invalid is set when the snapshot overflowed and was dropped
+	Invalid bool `yaml:"invalid,omitempty" json:"invalid,omitempty"`
+}
+
+// RAIDStatus is the sync state of a RAID or mirror LV
+type RAIDStatus struct {
+	SyncPercent   float64 `yaml:"sync_percent" json:"sync_percent"`
+	SyncAction    string  `yaml:"sync_action,omitempty" json:"sync_action,omitempty"`
+	MismatchCount uint64  `yaml:"mismatch_count" json:"mismatch_count"`
+	InSync        bool    `yaml:"in_sync" json:"in_sync"`
+}
+
+// CacheStats are the block usage and hit counts of a cached LV
+type CacheStats struct {
+	TotalBlocks uint64  `yaml:"total_blocks" json:"total_blocks"`
+	UsedBlocks  uint64  `yaml:"used_blocks" json:"used_blocks"`
+	DirtyBlocks uint64  `yaml:"dirty_blocks" json:"dirty_blocks"`
+	ReadHits    uint64  `yaml:"read_hits" json:"read_hits"`
+	ReadMisses  uint64  `yaml:"read_misses" json:"read_misses"`
+	WriteHits   uint64  `yaml:"write_hits" json:"write_hits"`
+	WriteMisses uint64  `yaml:"write_misses" json:"write_misses"`
+	UsedPercent float64 `yaml:"used_percent" json:"used_percent"`
+	// ReadHitPercent is the share of reads served from the cache
+	ReadHitPercent float64 `yaml:"read_hit_percent" json:"read_hit_percent"`
+}
+
+// LogicalVolume is an LVM logical volume, including hidden internal volumes
+// such as thin pool data or RAID images
+type LogicalVolume struct {
+	Name    string       `yaml:"name" json:"name"`
+	VGName  string       `yaml:"vg_name" json:"vg_name"`
+	UUID    string       `yaml:"uuid" json:"uuid"`
+	Path    string       `yaml:"path,omitempty" json:"path,omitempty"`
+	DMPath  string       `yaml:"dm_path" json:"dm_path"`
+	Attr    string       `yaml:"attr" json:"attr"`
+	Size    cap.Capacity `yaml:"size" json:"size"`
+	Layout  string       `yaml:"layout" json:"layout"`
+	Role    string       `yaml:"role" json:"role"`
+	SegType string       `yaml:"segtype" json:"segtype"`
+	Pool    string       `yaml:"pool,omitempty" json:"pool,omitempty"`
+	Origin  string       `yaml:"origin,omitempty" json:"origin,omitempty"`
+	Active  bool         `yaml:"active" json:"active"`
+	// Health is empty when healthy, or e.g. partial or mismatches exist
+	Health   string         `yaml:"health,omitempty" json:"health,omitempty"`
+	Devices  []string       `yaml:"devices,omitempty" json:"devices,omitempty"`
+	ThinPool *ThinPoolUsage `yaml:"thin_pool,omitempty" json:"thin_pool,omitempty"`
+	// DataPercent is how much of a thin volume's size is allocated in its pool
+	DataPercent float64        `yaml:"data_percent,omitempty" json:"data_percent,omitempty"`
+	Snapshot    *SnapshotUsage `yaml:"snapshot,omitempty" json:"snapshot,omitempty"`
+	RAID        *RAIDStatus    `yaml:"raid,omitempty" json:"raid,omitempty"`
+	Cache       *CacheStats    `yaml:"cache,omitempty" json:"cache,omitempty"`
+}
+
+// volumeType returns the first lv_attr character, e.g. t for a thin pool
+func (lv *LogicalVolume) volumeType() byte {
+	if len(lv.Attr) < 1 {
+		return 0
+	}
+
+	return lv.Attr[0]
+}
+
+// IsThinPool returns true for a thin pool
+func (lv *LogicalVolume) IsThinPool() bool {
+	return lv.volumeType() == 't'
+}
+
+// IsThin returns true for a thin volume
+func (lv *LogicalVolume) IsThin() bool {
+	return lv.volumeType() == 'V'
+}
+
+// IsSnapshot returns true for a thick or thin snapshot
+func (lv *LogicalVolume) IsSnapshot() bool {
+	return lv.volumeType() == 's' || lv.volumeType() == 'S' || (lv.IsThin() && len(lv.Origin) > 0)
+}
+
+// IsRAID returns true for RAID and mirror LVs
+func (lv *LogicalVolume) IsRAID() bool {
+	return strings.HasPrefix(lv.SegType, "raid") || lv.SegType == "mirror"
+}
+
+// IsCached returns true for an LV with a cache or writecache
+func (lv *LogicalVolume) IsCached() bool {
+	return lv.SegType == "cache" || lv.SegType == "writecache"
+}
+
+// IsHidden returns true for internal LVs such as RAID images and pool data,
+// which lvs shows in brackets
+func (lv *LogicalVolume) IsHidden() bool {
+	return strings.HasPrefix(lv.Name, "[")
+}
+
+// Report holds all of the PVs, VGs and LVs
+type Report struct {
+	PhysicalVolumes []*PhysicalVolume `yaml:"physical_volumes" json:"physical_volumes"`
+	VolumeGroups    []*VolumeGroup    `yaml:"volume_groups" json:"volume_groups"`
+	LogicalVolumes  []*LogicalVolume  `yaml:"logical_volumes" json:"logical_volumes"`
+}
+
+// String implements stringer
+func (r *Report) String() string {
+	b, err := yaml.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// JSONString prints the JSON value for this Report
+func (r *Report) JSONString() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// VolumeGroup returns the VG with the given name
+func (r *Report) VolumeGroup(name string) *VolumeGroup {
+	for _, vg := range r.VolumeGroups {
+		if vg.Name == name {
+			return vg
+		}
+	}
+
+	return nil
+}
+
+// LogicalVolume returns the LV with the given name in a VG
+func (r *Report) LogicalVolume(vg, name string) *LogicalVolume {
+	for _, lv := range r.LogicalVolumes {
+		if lv.VGName == vg && strings.Trim(lv.Name, "[]") == name {
+			return lv
+		}
+	}
+
+	return nil
+}
+
+// PVsOf returns the PVs of a VG
+func (r *Report) PVsOf(vg string) []*PhysicalVolume {
+	var out []*PhysicalVolume
+
+	for _, pv := range r.PhysicalVolumes {
+		if pv.VGName == vg {
+			out = append(out, pv)
+		}
+	}
+
+	return out
+}
+
+// LVsOf returns the LVs of a VG
+func (r *Report) LVsOf(vg string) []*LogicalVolume {
+	var out []*LogicalVolume
+
+	for _, lv := range r.LogicalVolumes {
+		if lv.VGName == vg {
+			out = append(out, lv)
+		}
+	}
+
+	return out
+}
+
+// runReport runs one of pvs, vgs or lvs with a JSON report in bytes
+func runReport(command string, args ...string) ([]byte, error) {
+	args = append([]string{"--reportformat", "json", "--units", "b", "--nosuffix"}, args...)
+	cmd := exec.Command(command, args...)
+
+	var out bytes.Buffer
+
+	cmd.Stdout = &out
+	err := cmd.Run()
+
+	if err != nil && out.Len() == 0 {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// GetPhysicalVolumes runs pvs and returns the physical volumes
+func GetPhysicalVolumes() ([]*PhysicalVolume, error) {
+	b, err := runReport("pvs", "-o", pvFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePVs(b)
+}
+
+// GetVolumeGroups runs vgs and returns the volume groups
+func GetVolumeGroups() ([]*VolumeGroup, error) {
+	b, err := runReport("vgs", "-o", vgFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseVGs(b)
+}
+
+// GetLogicalVolumes runs lvs and returns the logical volumes, including
+// hidden ones
+func GetLogicalVolumes() ([]*LogicalVolume, error) {
+	b, err := runReport("lvs", "-a", "-o", lvFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseLVs(b)
+}
+
+// GetReport runs pvs, vgs and lvs
+func GetReport() (*Report, error) {
+	var (
+		r   = new(Report)
+		err error
+	)
+
+	if r.PhysicalVolumes, err = GetPhysicalVolumes(); err != nil {
+		return nil, err
+	}
+
+	if r.VolumeGroups, err = GetVolumeGroups(); err != nil {
+		return nil, err
+	}
+
+	if r.LogicalVolumes, err = GetLogicalVolumes(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
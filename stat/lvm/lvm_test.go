@@ -0,0 +1,206 @@
+//+build linux
+
+package lvm
+
+import (
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"github.com/ericmaustin/unixtools/stat/disk"
+	"github.com/jaypipes/ghw/pkg/block"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestParsePVs(t *testing.T) {
+	pvs, err := ParsePVs(readFixture(t, "pvs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pvs) != 5 {
+		t.Fatalf("expected 5 PVs, got %d", len(pvs))
+	}
+
+	if pv := pvs[0]; pv.Name != "/dev/sda2" || pv.VGName != "vg0" || pv.Size != 499570720768 ||
+		pv.Free != 100<<30 || pv.DevSize != 499571769344 || !pv.Allocatable || pv.MetadataAreas != 1 {
+		t.Errorf("unexpected PV %+v", pv)
+	}
+
+	// sizes keep their unit suffix without --nosuffix
+	if pv := pvs[2]; pv.Size != 255550554112 || pv.Used != pv.Size || pv.Free != 0 {
+		t.Errorf("unexpected PV %+v", pv)
+	}
+
+	if pv := pvs[3]; !pv.Missing || pv.Name != "[unknown]" {
+		t.Errorf("expected a missing PV, got %+v", pv)
+	}
+
+	if pv := pvs[4]; pv.Allocatable || len(pv.VGName) > 0 {
+		t.Errorf("expected an unused PV, got %+v", pv)
+	}
+}
+
+func TestParseVGs(t *testing.T) {
+	vgs, err := ParseVGs(readFixture(t, "vgs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vgs) != 2 {
+		t.Fatalf("expected 2 VGs, got %d", len(vgs))
+	}
+
+	vg0 := vgs[0]
+	if vg0.Name != "vg0" || vg0.ExtentSize != 4<<20 || vg0.ExtentCount != 357574 || vg0.PVCount != 2 ||
+		vg0.LVCount != 7 || vg0.SnapCount != 1 || vg0.Partial {
+		t.Errorf("unexpected VG %+v", vg0)
+	}
+
+	if p := fmt.Sprintf("%.2f", vg0.UsedPercent); p != "26.15" {
+		t.Errorf("expected vg0 to be 26.15%% used, got %s", p)
+	}
+
+	if fast := vgs[1]; !fast.Partial || fast.MissingPVCount != 1 || fast.UsedPercent != 50 {
+		t.Errorf("expected fast to be partial, got %+v", fast)
+	}
+}
+
+func TestParseLVs(t *testing.T) {
+	lvs, err := ParseLVs(readFixture(t, "lvs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Report{LogicalVolumes: lvs}
+
+	if len(r.LVsOf("vg0")) != 7 || len(r.LVsOf("fast")) != 1 {
+		t.Fatalf("unexpected LVs %v", lvs)
+	}
+
+	root := r.LogicalVolume("vg0", "root")
+	if root.Size != 50<<30 || !root.Active || root.Path != "/dev/vg0/root" || !root.IsRAID() {
+		t.Errorf("unexpected LV %+v", root)
+	}
+
+	if s := root.RAID; s == nil || s.SyncPercent != 100 || s.SyncAction != "idle" || !s.InSync {
+		t.Errorf("expected root to be in sync, got %+v", s)
+	}
+
+	if len(root.Devices) != 2 || root.Devices[1] != "root_rimage_1(0)" {
+		t.Errorf("unexpected devices %v", root.Devices)
+	}
+
+	if image := r.LogicalVolume("vg0", "root_rimage_0"); image == nil || !image.IsHidden() || image.RAID != nil {
+		t.Errorf("unexpected RAID image %+v", image)
+	}
+
+	if s := r.LogicalVolume("vg0", "data").RAID; s == nil || s.SyncPercent != 42.17 || s.SyncAction != "resync" || s.InSync {
+		t.Errorf("expected data to be resyncing, got %+v", s)
+	}
+
+	snap := r.LogicalVolume("vg0", "root_snap")
+	if s := snap.Snapshot; !snap.IsSnapshot() || s == nil || s.Origin != "root" || s.Percent != 37.52 || s.Invalid {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+
+	pool := r.LogicalVolume("vg0", "pool")
+	if p := pool.ThinPool; !pool.IsThinPool() || p == nil || p.DataPercent != 63.85 || p.MetadataPercent != 12.04 ||
+		p.MetadataSize != 108<<20 {
+		t.Errorf("unexpected thin pool %+v", p)
+	}
+
+	if vm1 := r.LogicalVolume("vg0", "vm1"); !vm1.IsThin() || vm1.IsSnapshot() || vm1.DataPercent != 88.4 || vm1.Pool != "pool" {
+		t.Errorf("unexpected thin volume %+v", vm1)
+	}
+
+	// thin snapshots are thin volumes without a fill percentage
+	if s := r.LogicalVolume("vg0", "vm1_snap"); !s.IsSnapshot() || s.Snapshot != nil || s.Active {
+		t.Errorf("unexpected thin snapshot %+v", s)
+	}
+
+	home := r.LogicalVolume("fast", "home")
+	if !home.IsCached() || home.Health != "partial" || home.RAID != nil {
+		t.Errorf("unexpected cached LV %+v", home)
+	}
+
+	c := home.Cache
+	if c == nil || c.TotalBlocks != 655360 || c.UsedBlocks != 466616 || c.DirtyBlocks != 1024 || c.ReadHitPercent != 90 ||
+		c.WriteHits != 2500 || c.WriteMisses != 500 {
+		t.Fatalf("unexpected cache stats %+v", c)
+	}
+
+	if p := fmt.Sprintf("%.1f", c.UsedPercent); p != "71.2" {
+		t.Errorf("expected the cache to be 71.2%% used, got %s", p)
+	}
+}
+
+func TestParseReportErrors(t *testing.T) {
+	if _, err := ParsePVs([]byte("  WARNING: not json")); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+
+	if _, err := ParseVGs([]byte(`{"report": []}`)); err == nil {
+		t.Error("expected an error for an empty report")
+	}
+
+	lvs, err := ParseLVs([]byte(`{"report": [{"lv": []}]}`))
+	if err != nil || len(lvs) != 0 {
+		t.Errorf("expected no LVs, got %v, %v", lvs, err)
+	}
+}
+
+func TestLinkDisks(t *testing.T) {
+	pvs, err := ParsePVs(readFixture(t, "pvs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sda := &disk.BlockDevice{Disk: &block.Disk{Name: "sda"}, SizeBytes: 500 << 30}
+	sda2 := &disk.Partition{Name: "sda2", Disk: sda}
+	sda.Partitions = []*disk.Partition{sda2}
+	sdb := &disk.BlockDevice{Disk: &block.Disk{Name: "sdb"}, SizeBytes: cap.Capacity(1000204886016)}
+
+	linkDisks(pvs, func(name string) (*disk.Partition, error) {
+		if strings.TrimPrefix(name, "/dev/") == "sda2" {
+			return sda2, nil
+		}
+
+		return nil, fmt.Errorf("could not find partition %s", name)
+	}, func(name string) (*disk.BlockDevice, error) {
+		if strings.TrimPrefix(name, "/dev/") == "sdb" {
+			return sdb, nil
+		}
+
+		return nil, fmt.Errorf("could not find disk %s", name)
+	})
+
+	if pv := pvs[0]; pv.Partition != sda2 || pv.Disk != sda || pv.DiskName != "sda" {
+		t.Errorf("expected /dev/sda2 to be linked to sda, got %+v", pv)
+	}
+
+	if pv := pvs[1]; pv.Partition != nil || pv.Disk != sdb || pv.DiskName != "sdb" {
+		t.Errorf("expected /dev/sdb to be linked to sdb, got %+v", pv)
+	}
+
+	for _, pv := range pvs[2:] {
+		if pv.Disk != nil || pv.Partition != nil {
+			t.Errorf("expected %s to be unlinked, got %+v", pv.Name, pv)
+		}
+	}
+
+	r := &Report{PhysicalVolumes: pvs}
+	if s := r.String(); !strings.Contains(s, "disk: sda") || strings.Contains(s, "partitions") {
+		t.Errorf("unexpected report %s", s)
+	}
+}
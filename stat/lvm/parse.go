@@ -0,0 +1,230 @@
+//+build linux
+
+package lvm
+
+import (
+	"encoding/json"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"strconv"
+	"strings"
+)
+
+// report is the JSON report format, e.g. {"report": [{"pv": [{...}]}]} with
+// every value a string
+type report struct {
+	Report []map[string][]map[string]string `json:"report"`
+}
+
+// parseReport returns the rows of a report section such as pv
+func parseReport(b []byte, section string) ([]map[string]string, error) {
+	var r report
+
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	if len(r.Report) < 1 {
+		return nil, fmt.Errorf("lvm report has no %s section", section)
+	}
+
+	var out []map[string]string
+
+	for _, s := range r.Report {
+		out = append(out, s[section]...)
+	}
+
+	return out, nil
+}
+
+// parseSize parses a size in bytes, with or without the B suffix
+func parseSize(v string) cap.Capacity {
+	n, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "B"), 64)
+	return cap.Capacity(n)
+}
+
+func parseFloat(v string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	return f
+}
+
+func parseUint(v string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	return n
+}
+
+func parseInt(v string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	return n
+}
+
+// attr returns the character of an attr string at i
+func attr(v string, i int) byte {
+	if i >= len(v) {
+		return 0
+	}
+
+	return v[i]
+}
+
+// ParsePVs parses the output of pvs --reportformat json
+func ParsePVs(b []byte) ([]*PhysicalVolume, error) {
+	rows, err := parseReport(b, "pv")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*PhysicalVolume, len(rows))
+
+	for i, row := range rows {
+		pv := &PhysicalVolume{
+			Name:          row["pv_name"],
+			VGName:        row["vg_name"],
+			Format:        row["pv_fmt"],
+			Attr:          row["pv_attr"],
+			UUID:          row["pv_uuid"],
+			Size:          parseSize(row["pv_size"]),
+			Free:          parseSize(row["pv_free"]),
+			Used:          parseSize(row["pv_used"]),
+			DevSize:       parseSize(row["dev_size"]),
+			MetadataAreas: int(parseInt(row["pv_mda_count"])),
+		}
+
+		pv.Allocatable = attr(pv.Attr, 0) == 'a'
+		pv.Exported = attr(pv.Attr, 1) == 'x'
+		pv.Missing = attr(pv.Attr, 2) == 'm'
+
+		out[i] = pv
+	}
+
+	return out, nil
+}
+
+// ParseVGs parses the output of vgs --reportformat json
+func ParseVGs(b []byte) ([]*VolumeGroup, error) {
+	rows, err := parseReport(b, "vg")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*VolumeGroup, len(rows))
+
+	for i, row := range rows {
+		vg := &VolumeGroup{
+			Name:           row["vg_name"],
+			UUID:           row["vg_uuid"],
+			Attr:           row["vg_attr"],
+			Size:           parseSize(row["vg_size"]),
+			Free:           parseSize(row["vg_free"]),
+			ExtentSize:     parseSize(row["vg_extent_size"]),
+			ExtentCount:    parseInt(row["vg_extent_count"]),
+			FreeCount:      parseInt(row["vg_free_count"]),
+			PVCount:        int(parseInt(row["pv_count"])),
+			LVCount:        int(parseInt(row["lv_count"])),
+			SnapCount:      int(parseInt(row["snap_count"])),
+			MissingPVCount: int(parseInt(row["vg_missing_pv_count"])),
+		}
+
+		vg.Partial = attr(vg.Attr, 3) == 'p' || vg.MissingPVCount > 0
+
+		if vg.Size > 0 {
+			vg.UsedPercent = float64(vg.Size-vg.Free) / float64(vg.Size) * 100
+		}
+
+		out[i] = vg
+	}
+
+	return out, nil
+}
+
+// ParseLVs parses the output of lvs --reportformat json
+func ParseLVs(b []byte) ([]*LogicalVolume, error) {
+	rows, err := parseReport(b, "lv")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*LogicalVolume, len(rows))
+
+	for i, row := range rows {
+		lv := &LogicalVolume{
+			Name:    row["lv_name"],
+			VGName:  row["vg_name"],
+			UUID:    row["lv_uuid"],
+			Path:    row["lv_path"],
+			DMPath:  row["lv_dm_path"],
+			Attr:    row["lv_attr"],
+			Size:    parseSize(row["lv_size"]),
+			Layout:  row["lv_layout"],
+			Role:    row["lv_role"],
+			SegType: row["segtype"],
+			Pool:    row["pool_lv"],
+			Origin:  row["origin"],
+			Active:  row["lv_active"] == "active",
+			Health:  row["lv_health_status"],
+		}
+
+		for _, d := range strings.Split(row["devices"], ",") {
+			if d = strings.TrimSpace(d); len(d) > 0 {
+				lv.Devices = append(lv.Devices, d)
+			}
+		}
+
+		switch {
+		case lv.IsThinPool():
+			lv.ThinPool = &ThinPoolUsage{
+				DataPercent:     parseFloat(row["data_percent"]),
+				MetadataPercent: parseFloat(row["metadata_percent"]),
+				MetadataSize:    parseSize(row["lv_metadata_size"]),
+			}
+		case lv.IsThin():
+			lv.DataPercent = parseFloat(row["data_percent"])
+		}
+
+		// thick snapshots have a fill percentage, thin ones are thin volumes
+		if t := lv.volumeType(); t == 's' || t == 'S' {
+			lv.Snapshot = &SnapshotUsage{
+				Origin:  lv.Origin,
+				Percent: parseFloat(row["snap_percent"]),
+				Invalid: attr(lv.Attr, 4) == 'I',
+			}
+		}
+
+		if lv.IsRAID() {
+			lv.RAID = &RAIDStatus{
+				SyncPercent:   parseFloat(row["copy_percent"]),
+				SyncAction:    row["raid_sync_action"],
+				MismatchCount: parseUint(row["raid_mismatch_count"]),
+			}
+
+			lv.RAID.InSync = lv.RAID.SyncPercent >= 100 &&
+				(len(lv.RAID.SyncAction) < 1 || lv.RAID.SyncAction == "idle")
+		}
+
+		if lv.IsCached() {
+			c := &CacheStats{
+				TotalBlocks: parseUint(row["cache_total_blocks"]),
+				UsedBlocks:  parseUint(row["cache_used_blocks"]),
+				DirtyBlocks: parseUint(row["cache_dirty_blocks"]),
+				ReadHits:    parseUint(row["cache_read_hits"]),
+				ReadMisses:  parseUint(row["cache_read_misses"]),
+				WriteHits:   parseUint(row["cache_write_hits"]),
+				WriteMisses: parseUint(row["cache_write_misses"]),
+			}
+
+			if c.TotalBlocks > 0 {
+				c.UsedPercent = float64(c.UsedBlocks) / float64(c.TotalBlocks) * 100
+			}
+
+			if reads := c.ReadHits + c.ReadMisses; reads > 0 {
+				c.ReadHitPercent = float64(c.ReadHits) / float64(reads) * 100
+			}
+
+			lv.Cache = c
+		}
+
+		out[i] = lv
+	}
+
+	return out, nil
+}
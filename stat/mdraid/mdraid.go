@@ -0,0 +1,223 @@
+// Package mdraid reports the status of Linux software RAID arrays from
+// /proc/mdstat and sysfs
+package mdraid
+
+import (
+	"encoding/json"
+	"fmt"
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// Option configures how arrays are read
+type Option func(o *options)
+
+type options struct {
+	root string
+}
+
+// WithRoot reads /proc and /sys under root instead of /, e.g. a host's
+// filesystem mounted in a container
+func WithRoot(root string) Option {
+	return func(o *options) {
+		o.root = root
+	}
+}
+
+func (o *options) path(p string) string {
+	if len(o.root) < 1 {
+		return p
+	}
+
+	return filepath.Join(o.root, p)
+}
+
+// Member is a device in an array
+type Member struct {
+	Name string `yaml:"name" json:"name"`
+	// Slot is the member's role number in the array. Spares and faulty
+	// devices have a role number too, but it isn't a slot in the array
+	Slot int `yaml:"slot" json:"slot"`
+	// State is the comma separated state from sysfs, e.g. in_sync,write_mostly
+	State       string `yaml:"state,omitempty" json:"state,omitempty"`
+	Active      bool   `yaml:"active" json:"active"`
+	Faulty      bool   `yaml:"faulty,omitempty" json:"faulty,omitempty"`
+	Spare       bool   `yaml:"spare,omitempty" json:"spare,omitempty"`
+	WriteMostly bool   `yaml:"write_mostly,omitempty" json:"write_mostly,omitempty"`
+	Replacement bool   `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	Journal     bool   `yaml:"journal,omitempty" json:"journal,omitempty"`
+	// Errors is the count of read errors corrected on the device
+	Errors uint64 `yaml:"errors,omitempty" json:"errors,omitempty"`
+}
+
+// SyncStatus is the progress of a resync, recovery, check, repair or reshape
+type SyncStatus struct {
+	Action string `yaml:"action" json:"action"`
+	// Delayed and Pending are set when the action is queued behind another
+	// array sharing a device, or waiting for the array to be written to
+	Delayed bool    `yaml:"delayed,omitempty" json:"delayed,omitempty"`
+	Pending bool    `yaml:"pending,omitempty" json:"pending,omitempty"`
+	Percent float64 `yaml:"percent" json:"percent"`
+	Done    int64   `yaml:"done" json:"done"`
+	Total   int64   `yaml:"total" json:"total"`
+	// Speed is the rate per second
+	Speed cap.Capacity  `yaml:"speed" json:"speed"`
+	ETA   time.Duration `yaml:"eta" json:"eta"`
+}
+
+// Bitmap is the write-intent bitmap of an array
+type Bitmap struct {
+	Pages      int          `yaml:"pages" json:"pages"`
+	TotalPages int          `yaml:"total_pages" json:"total_pages"`
+	Size       cap.Capacity `yaml:"size" json:"size"`
+	Chunk      cap.Capacity `yaml:"chunk" json:"chunk"`
+	// File is set for a bitmap stored in a file rather than the superblock
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+}
+
+// Array is a software RAID array
+type Array struct {
+	Name string `yaml:"name" json:"name"`
+	// State is active or inactive, ReadOnly and AutoReadOnly are set when it's
+	// marked (read-only) or (auto-read-only)
+	State        string `yaml:"state" json:"state"`
+	ReadOnly     bool   `yaml:"read_only,omitempty" json:"read_only,omitempty"`
+	AutoReadOnly bool   `yaml:"auto_read_only,omitempty" json:"auto_read_only,omitempty"`
+	Level        string `yaml:"level,omitempty" json:"level,omitempty"`
+	// Metadata is the superblock version such as 1.2 or external:imsm
+	Metadata    string       `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	Size        cap.Capacity `yaml:"size" json:"size"`
+	Chunk       cap.Capacity `yaml:"chunk,omitempty" json:"chunk,omitempty"`
+	RaidDisks   int          `yaml:"raid_disks,omitempty" json:"raid_disks,omitempty"`
+	ActiveDisks int          `yaml:"active_disks,omitempty" json:"active_disks,omitempty"`
+	// Status is the member status such as [UU_], _ being a missing member
+	Status   string      `yaml:"status,omitempty" json:"status,omitempty"`
+	Degraded bool        `yaml:"degraded" json:"degraded"`
+	Members  []*Member   `yaml:"members" json:"members"`
+	Sync     *SyncStatus `yaml:"sync,omitempty" json:"sync,omitempty"`
+	Bitmap   *Bitmap     `yaml:"bitmap,omitempty" json:"bitmap,omitempty"`
+	// ArrayState, SyncAction and MismatchCount are read from sysfs
+	ArrayState    string `yaml:"array_state,omitempty" json:"array_state,omitempty"`
+	SyncAction    string `yaml:"sync_action,omitempty" json:"sync_action,omitempty"`
+	MismatchCount uint64 `yaml:"mismatch_count" json:"mismatch_count"`
+}
+
+// Member returns the member with the given device name
+func (a *Array) Member(name string) *Member {
+	for _, m := range a.Members {
+		if m.Name == name {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// Failed returns the faulty members
+func (a *Array) Failed() []*Member {
+	var out []*Member
+
+	for _, m := range a.Members {
+		if m.Faulty {
+			out = append(out, m)
+		}
+	}
+
+	return out
+}
+
+// String implements stringer
+func (a *Array) String() string {
+	b, err := yaml.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// JSONString prints the JSON value for this Array
+func (a *Array) JSONString() string {
+	b, err := json.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// Arrays represents a list of Array
+type Arrays []*Array
+
+// String implements the Stringer interface
+func (a Arrays) String() string {
+	b, err := yaml.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// Get returns the array with the given name
+func (a Arrays) Get(name string) *Array {
+	for _, arr := range a {
+		if arr.Name == name {
+			return arr
+		}
+	}
+
+	return nil
+}
+
+// Degraded returns the degraded arrays
+func (a Arrays) Degraded() Arrays {
+	var out Arrays
+
+	for _, arr := range a {
+		if arr.Degraded {
+			out = append(out, arr)
+		}
+	}
+
+	return out
+}
+
+// GetArrays reads /proc/mdstat and adds the details sysfs has for each array
+func GetArrays(opts ...Option) (Arrays, error) {
+	o := new(options)
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	b, err := ioutil.ReadFile(o.path("/proc/mdstat"))
+	if err != nil {
+		return nil, err
+	}
+
+	arrays := ParseMdstat(string(b))
+
+	for _, a := range arrays {
+		readSysfs(a, o.path(filepath.Join("/sys/block", a.Name, "md")))
+	}
+
+	return arrays, nil
+}
+
+// GetArray reads the array with the given name, e.g. md0
+func GetArray(name string, opts ...Option) (*Array, error) {
+	arrays, err := GetArrays(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if a := arrays.Get(filepath.Base(name)); a != nil {
+		return a, nil
+	}
+
+	return nil, fmt.Errorf("could not find md array %s", name)
+}
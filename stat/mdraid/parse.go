@@ -0,0 +1,183 @@
+package mdraid
+
+import (
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	arrayLineRe  = regexp.MustCompile(`^(md\S*)\s*:\s*(.*)$`)
+	memberRe     = regexp.MustCompile(`^(\S+)\[(\d+)\]((?:\([A-Z]\))*)$`)
+	blocksRe     = regexp.MustCompile(`^(\d+) blocks`)
+	superRe      = regexp.MustCompile(`super (\S+)`)
+	chunkRe      = regexp.MustCompile(`(\d+)[kK] chunk`)
+	disksRe      = regexp.MustCompile(`\[(\d+)/(\d+)\]\s+\[([U_]+)\]`)
+	syncRe       = regexp.MustCompile(`(resync|recovery|check|repair|reshape)\s*=\s*([\d.]+)%\s*\((\d+)/(\d+)\)(?:\s+finish=([\d.]+)min)?(?:\s+speed=(\d+)K/sec)?`)
+	syncQueuedRe = regexp.MustCompile(`(resync|recovery|check|repair|reshape)\s*=\s*(DELAYED|PENDING)`)
+	bitmapRe     = regexp.MustCompile(`bitmap:\s*(\d+)/(\d+) pages \[(\d+)KB\],\s*(\d+)KB chunk(?:,\s*file:\s*(\S+))?`)
+)
+
+// ParseMdstat parses the contents of /proc/mdstat
+func ParseMdstat(v string) Arrays {
+	var (
+		out Arrays
+		cur *Array
+	)
+
+	for _, line := range strings.Split(v, "\n") {
+		if m := arrayLineRe.FindStringSubmatch(line); m != nil {
+			cur = parseArrayLine(m[1], m[2])
+			out = append(out, cur)
+
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+
+		// arrays are separated by a blank line
+		if cur == nil || len(line) < 1 {
+			cur = nil
+			continue
+		}
+
+		parseDetailLine(cur, line)
+	}
+
+	for _, a := range out {
+		a.Degraded = a.ActiveDisks < a.RaidDisks || strings.Contains(a.Status, "_")
+	}
+
+	return out
+}
+
+// parseArrayLine parses the state, level and members of an array, e.g.
+// active raid1 sdb1[1](F) sda1[0]
+func parseArrayLine(name, v string) *Array {
+	a := &Array{Name: name}
+
+	fields := strings.Fields(v)
+	if len(fields) < 1 {
+		return a
+	}
+
+	a.State, fields = fields[0], fields[1:]
+
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "(") {
+		switch fields[0] {
+		case "(read-only)":
+			a.ReadOnly = true
+		case "(auto-read-only)":
+			a.AutoReadOnly = true
+		}
+
+		fields = fields[1:]
+	}
+
+	// inactive arrays have no personality
+	if len(fields) > 0 && !memberRe.MatchString(fields[0]) {
+		a.Level, fields = fields[0], fields[1:]
+	}
+
+	for _, f := range fields {
+		m := memberRe.FindStringSubmatch(f)
+		if m == nil {
+			continue
+		}
+
+		slot, _ := strconv.Atoi(m[2])
+		member := &Member{Name: m[1], Slot: slot}
+
+		for _, flag := range strings.Split(strings.Trim(m[3], "()"), ")(") {
+			switch flag {
+			case "F":
+				member.Faulty = true
+			case "S":
+				member.Spare = true
+			case "W":
+				member.WriteMostly = true
+			case "R":
+				member.Replacement = true
+			case "J":
+				member.Journal = true
+			}
+		}
+
+		member.Active = a.State == "active" && !member.Faulty && !member.Spare
+		a.Members = append(a.Members, member)
+	}
+
+	// mdstat lists members in the order they were added, not by slot
+	sort.SliceStable(a.Members, func(i, j int) bool {
+		return a.Members[i].Slot < a.Members[j].Slot
+	})
+
+	return a
+}
+
+// parseDetailLine parses the size, sync and bitmap lines under an array
+func parseDetailLine(a *Array, line string) {
+	if m := blocksRe.FindStringSubmatch(line); m != nil {
+		blocks, _ := strconv.ParseInt(m[1], 10, 64)
+		a.Size = cap.Capacity(blocks << 10)
+
+		if m := superRe.FindStringSubmatch(line); m != nil {
+			a.Metadata = m[1]
+		}
+
+		if m := chunkRe.FindStringSubmatch(line); m != nil {
+			chunk, _ := strconv.ParseInt(m[1], 10, 64)
+			a.Chunk = cap.Capacity(chunk << 10)
+		}
+
+		if m := disksRe.FindStringSubmatch(line); m != nil {
+			a.RaidDisks, _ = strconv.Atoi(m[1])
+			a.ActiveDisks, _ = strconv.Atoi(m[2])
+			a.Status = m[3]
+		}
+
+		return
+	}
+
+	if m := syncRe.FindStringSubmatch(line); m != nil {
+		s := &SyncStatus{Action: m[1]}
+		s.Percent, _ = strconv.ParseFloat(m[2], 64)
+		s.Done, _ = strconv.ParseInt(m[3], 10, 64)
+		s.Total, _ = strconv.ParseInt(m[4], 10, 64)
+
+		if len(m[5]) > 0 {
+			minutes, _ := strconv.ParseFloat(m[5], 64)
+			s.ETA = time.Duration(minutes * float64(time.Minute))
+		}
+
+		if len(m[6]) > 0 {
+			speed, _ := strconv.ParseInt(m[6], 10, 64)
+			s.Speed = cap.Capacity(speed << 10)
+		}
+
+		a.Sync = s
+
+		return
+	}
+
+	if m := syncQueuedRe.FindStringSubmatch(line); m != nil {
+		a.Sync = &SyncStatus{Action: m[1], Delayed: m[2] == "DELAYED", Pending: m[2] == "PENDING"}
+		return
+	}
+
+	if m := bitmapRe.FindStringSubmatch(line); m != nil {
+		b := &Bitmap{File: m[5]}
+		b.Pages, _ = strconv.Atoi(m[1])
+		b.TotalPages, _ = strconv.Atoi(m[2])
+
+		size, _ := strconv.ParseInt(m[3], 10, 64)
+		chunk, _ := strconv.ParseInt(m[4], 10, 64)
+		b.Size = cap.Capacity(size << 10)
+		b.Chunk = cap.Capacity(chunk << 10)
+
+		a.Bitmap = b
+	}
+}
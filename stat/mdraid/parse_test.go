@@ -0,0 +1,240 @@
+package mdraid
+
+import (
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readMdstatFixture(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+// arraySummary is what's checked for each array in a fixture
+type arraySummary struct {
+	name, state, level, metadata, status string
+	size                                 cap.Capacity
+	members                              int
+	degraded                             bool
+}
+
+func summarize(a *Array) arraySummary {
+	return arraySummary{
+		name:     a.Name,
+		state:    a.State,
+		level:    a.Level,
+		metadata: a.Metadata,
+		status:   a.Status,
+		size:     a.Size,
+		members:  len(a.Members),
+		degraded: a.Degraded,
+	}
+}
+
+func TestParseMdstat(t *testing.T) {
+	for name, want := range map[string][]arraySummary{
+		"raid1_degraded.mdstat": {
+			{"md1", "active", "raid1", "1.2", "U_", 976630464 << 10, 2, true},
+			{"md0", "active", "raid1", "1.2", "UU", 523264 << 10, 2, false},
+		},
+		"raid5_recovery.mdstat": {
+			{"md2", "active", "raid5", "1.2", "UUU_", 5860147200 << 10, 4, true},
+		},
+		"raid6_check.mdstat": {
+			{"md127", "active", "raid6", "1.2", "UUUUUUUU", 35162348544 << 10, 9, false},
+		},
+		"raid10_writemostly.mdstat": {
+			{"md3", "active", "raid10", "1.2", "UUUU", 1953259520 << 10, 4, false},
+			{"md4", "active", "raid1", "1.2", "UU", 976630464 << 10, 2, false},
+		},
+		"mixed.mdstat": {
+			{"md5", "active", "raid0", "1.2", "", 3906764800 << 10, 2, false},
+			{"md6", "active", "linear", "1.2", "", 1953260544 << 10, 2, false},
+			{"md7", "active", "raid1", "1.2", "U_", 488254464 << 10, 2, true},
+			{"md8", "active", "raid1", "1.0", "UU", 10476544 << 10, 2, false},
+			{"md9", "active", "raid5", "1.2", "UUUU", 2929886208 << 10, 4, false},
+			{"md10", "active", "raid1", "1.2", "UU", 97589248 << 10, 3, false},
+			{"md126", "active", "raid1", "external:/md127/0", "UU", 976759808 << 10, 2, false},
+			{"md127", "inactive", "", "external:imsm", "", 5288 << 10, 2, false},
+		},
+	} {
+		arrays := ParseMdstat(readMdstatFixture(t, name))
+
+		if len(arrays) != len(want) {
+			t.Errorf("%s: expected %d arrays, got %d", name, len(want), len(arrays))
+			continue
+		}
+
+		for i, a := range arrays {
+			if got := summarize(a); got != want[i] {
+				t.Errorf("%s: expected %+v, got %+v", name, want[i], got)
+			}
+		}
+	}
+}
+
+func TestParseMdstatDetails(t *testing.T) {
+	arrays := ParseMdstat(readMdstatFixture(t, "raid1_degraded.mdstat"))
+
+	md1 := arrays.Get("md1")
+	if m := md1.Member("sdb2"); m == nil || !m.Faulty || m.Active || m.Slot != 1 {
+		t.Errorf("expected sdb2 to be faulty, got %+v", m)
+	}
+
+	if md1.Members[0].Name != "sda2" || !md1.Members[0].Active || len(md1.Failed()) != 1 {
+		t.Errorf("unexpected members %+v", md1.Members)
+	}
+
+	if b := md1.Bitmap; b == nil || b.Pages != 4 || b.TotalPages != 8 || b.Size != 16<<10 || b.Chunk != 64<<20 {
+		t.Errorf("unexpected bitmap %+v", b)
+	}
+
+	if d := arrays.Degraded(); len(d) != 1 || d[0].Name != "md1" {
+		t.Errorf("unexpected degraded arrays %v", d)
+	}
+
+	md2 := ParseMdstat(readMdstatFixture(t, "raid5_recovery.mdstat")).Get("md2")
+
+	if md2.Chunk != 512<<10 || md2.RaidDisks != 4 || md2.ActiveDisks != 3 {
+		t.Errorf("unexpected array %+v", md2)
+	}
+
+	s := md2.Sync
+	if s == nil || s.Action != "recovery" || s.Percent != 12.6 || s.Done != 246309248 || s.Total != 1953382400 {
+		t.Fatalf("unexpected sync %+v", s)
+	}
+
+	if s.Speed != 172100<<10 || s.ETA != 165*time.Minute+18*time.Second {
+		t.Errorf("unexpected speed %d or eta %s", s.Speed, s.ETA)
+	}
+
+	md127 := ParseMdstat(readMdstatFixture(t, "raid6_check.mdstat")).Get("md127")
+
+	if m := md127.Member("sdi"); !m.Spare || m.Active || md127.Sync.Action != "check" || md127.Members[8] != m {
+		t.Errorf("unexpected spare %+v or sync %+v", m, md127.Sync)
+	}
+
+	arrays = ParseMdstat(readMdstatFixture(t, "raid10_writemostly.mdstat"))
+
+	md3 := arrays.Get("md3")
+	if m := md3.Member("sda1"); !m.WriteMostly || !m.Active || md3.Members[2] != m {
+		t.Errorf("expected sda1 to be write mostly, got %+v", m)
+	}
+
+	if md3.Chunk != 512<<10 || md3.Bitmap.File != "/var/lib/md3.bitmap" {
+		t.Errorf("unexpected chunk %d or bitmap %+v", md3.Chunk, md3.Bitmap)
+	}
+
+	if md4 := arrays.Get("md4"); !md4.AutoReadOnly || md4.Sync == nil || !md4.Sync.Pending {
+		t.Errorf("expected md4 to be auto read only with a pending resync, got %+v", md4)
+	}
+
+	arrays = ParseMdstat(readMdstatFixture(t, "mixed.mdstat"))
+
+	if md7 := arrays.Get("md7"); md7.Sync == nil || !md7.Sync.Delayed || md7.Sync.Action != "resync" {
+		t.Errorf("expected a delayed resync, got %+v", md7.Sync)
+	}
+
+	if md8 := arrays.Get("md8"); !md8.ReadOnly {
+		t.Error("expected md8 to be read only")
+	}
+
+	if md9 := arrays.Get("md9"); md9.Sync.Action != "reshape" || md9.Chunk != 64<<10 {
+		t.Errorf("unexpected reshape %+v", md9.Sync)
+	}
+
+	if m := arrays.Get("md10").Member("sdr1"); !m.Replacement {
+		t.Errorf("expected sdr1 to be a replacement, got %+v", m)
+	}
+
+	for _, m := range arrays.Get("md127").Members {
+		if !m.Spare || m.Active {
+			t.Errorf("expected container member %s to be a spare, got %+v", m.Name, m)
+		}
+	}
+}
+
+func TestGetArrays(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"proc/mdstat":                      readMdstatFixture(t, "raid1_degraded.mdstat"),
+		"sys/block/md1/md/array_state":     "clean\n",
+		"sys/block/md1/md/sync_action":     "idle\n",
+		"sys/block/md1/md/mismatch_cnt":    "0\n",
+		"sys/block/md1/md/degraded":        "1\n",
+		"sys/block/md1/md/dev-sda2/state":  "in_sync\n",
+		"sys/block/md1/md/dev-sda2/slot":   "0\n",
+		"sys/block/md1/md/dev-sda2/errors": "3\n",
+		"sys/block/md1/md/dev-sdb2/state":  "faulty\n",
+		"sys/block/md1/md/dev-sdb2/slot":   "none\n",
+		"sys/block/md0/md/array_state":     "active\n",
+		"sys/block/md0/md/sync_action":     "check\n",
+		"sys/block/md0/md/sync_completed":  "261632 / 1046528\n",
+		"sys/block/md0/md/sync_speed":      "98304\n",
+		"sys/block/md0/md/mismatch_cnt":    "128\n",
+		"sys/block/md0/md/dev-sda1/state":  "in_sync\n",
+		"sys/block/md0/md/dev-sdb1/state":  "in_sync,write_mostly\n",
+		"sys/block/md0/md/dev-sdc1/state":  "spare\n",
+		"sys/block/md0/md/dev-sdc1/slot":   "none\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	arrays, err := GetArrays(WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md1 := arrays.Get("md1")
+	if md1.ArrayState != "clean" || md1.SyncAction != "idle" || !md1.Degraded || md1.Sync != nil {
+		t.Errorf("unexpected md1 %+v", md1)
+	}
+
+	if m := md1.Member("sda2"); m.Errors != 3 || !m.Active || m.State != "in_sync" {
+		t.Errorf("unexpected member %+v", m)
+	}
+
+	md0, err := GetArray("/dev/md0", WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if md0.MismatchCount != 128 || md0.Sync == nil || md0.Sync.Action != "check" || md0.Sync.Percent != 25 {
+		t.Errorf("unexpected md0 %+v with sync %+v", md0, md0.Sync)
+	}
+
+	if md0.Sync.Done != 130816 || md0.Sync.Speed != 96<<20 {
+		t.Errorf("unexpected sync %+v", md0.Sync)
+	}
+
+	if m := md0.Member("sdb1"); !m.WriteMostly || !m.Active {
+		t.Errorf("expected sdb1 to be write mostly, got %+v", m)
+	}
+
+	if m := md0.Member("sdc1"); m == nil || !m.Spare || m.Slot != -1 {
+		t.Errorf("expected a spare sdc1 from sysfs, got %+v", m)
+	}
+
+	if _, err := GetArray("md9", WithRoot(root)); err == nil {
+		t.Error("expected an error for a missing array")
+	}
+}
@@ -0,0 +1,119 @@
+package mdraid
+
+import (
+	cap "github.com/ericmaustin/unixtools/capacity"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readAttr reads a sysfs attribute with its whitespace trimmed
+func readAttr(dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// readIntAttr reads a numeric sysfs attribute
+func readIntAttr(dir, name string) (int64, bool) {
+	v, err := strconv.ParseInt(readAttr(dir, name), 10, 64)
+	return v, err == nil
+}
+
+// readSysfs adds the details from an array's /sys/block/md*/md directory that
+// mdstat doesn't have, and the state of each member
+func readSysfs(a *Array, dir string) {
+	a.ArrayState = readAttr(dir, "array_state")
+	a.SyncAction = readAttr(dir, "sync_action")
+
+	if v, ok := readIntAttr(dir, "mismatch_cnt"); ok {
+		a.MismatchCount = uint64(v)
+	}
+
+	if v, ok := readIntAttr(dir, "degraded"); ok && v > 0 {
+		a.Degraded = true
+	}
+
+	if len(a.Level) < 1 {
+		a.Level = readAttr(dir, "level")
+	}
+
+	if len(a.Metadata) < 1 {
+		a.Metadata = readAttr(dir, "metadata_version")
+	}
+
+	if v, ok := readIntAttr(dir, "raid_disks"); ok && a.RaidDisks == 0 {
+		a.RaidDisks = int(v)
+	}
+
+	if v, ok := readIntAttr(dir, "chunk_size"); ok && a.Chunk == 0 {
+		a.Chunk = cap.Capacity(v)
+	}
+
+	// sync_completed is in sectors as "done / total"
+	if a.Sync == nil && a.SyncAction != "idle" && a.SyncAction != "frozen" && len(a.SyncAction) > 0 {
+		if parts := strings.Split(readAttr(dir, "sync_completed"), " / "); len(parts) == 2 {
+			done, err1 := strconv.ParseInt(parts[0], 10, 64)
+			total, err2 := strconv.ParseInt(parts[1], 10, 64)
+
+			if err1 == nil && err2 == nil && total > 0 {
+				s := &SyncStatus{Action: a.SyncAction, Done: done / 2, Total: total / 2}
+				s.Percent = float64(done) / float64(total) * 100
+
+				if speed, ok := readIntAttr(dir, "sync_speed"); ok {
+					s.Speed = cap.Capacity(speed << 10)
+				}
+
+				a.Sync = s
+			}
+		}
+	}
+
+	devs, _ := filepath.Glob(filepath.Join(dir, "dev-*"))
+
+	for _, devDir := range devs {
+		name := strings.TrimPrefix(filepath.Base(devDir), "dev-")
+
+		m := a.Member(name)
+		if m == nil {
+			m = &Member{Name: name, Slot: -1}
+			a.Members = append(a.Members, m)
+		}
+
+		if slot, ok := readIntAttr(devDir, "slot"); ok {
+			m.Slot = int(slot)
+		}
+
+		if v, ok := readIntAttr(devDir, "errors"); ok {
+			m.Errors = uint64(v)
+		}
+
+		m.State = readAttr(devDir, "state")
+		if len(m.State) < 1 {
+			continue
+		}
+
+		m.Active = false
+
+		for _, s := range strings.Split(m.State, ",") {
+			switch s {
+			case "in_sync":
+				m.Active = true
+			case "faulty":
+				m.Faulty = true
+			case "spare":
+				m.Spare = true
+			case "write_mostly":
+				m.WriteMostly = true
+			case "replacement":
+				m.Replacement = true
+			case "journal":
+				m.Journal = true
+			}
+		}
+	}
+}